@@ -0,0 +1,21 @@
+variable "last_usn" {
+  type    = number
+  default = 0
+}
+
+# Users changed since the last run, including those deleted since
+data "adldap_changed_objects" "staff" {
+  distinguished_name = "OU=Staff,DC=example,DC=com"
+  filter             = "(objectClass=user)"
+  attributes         = ["sAMAccountName", "mail", "department"]
+  since_usn          = var.last_usn
+  include_deleted    = true
+}
+
+output "next_usn" {
+  value = data.adldap_changed_objects.staff.highest_usn
+}
+
+output "server" {
+  value = data.adldap_changed_objects.staff.server
+}
@@ -0,0 +1,22 @@
+data "adldap_ldif_export" "staff" {
+  distinguished_name = "OU=Staff,DC=example,DC=com"
+  scope              = "subtree"
+  filter             = "(objectClass=user)"
+  attributes         = ["objectClass", "cn", "sAMAccountName", "userPrincipalName"]
+}
+
+resource "local_file" "staff_backup" {
+  filename = "staff.ldif"
+  content  = data.adldap_ldif_export.staff.ldif
+}
+
+# The second hundred users by sAMAccountName
+data "adldap_ldif_export" "staff_page_2" {
+  distinguished_name = "OU=Staff,DC=example,DC=com"
+  scope              = "subtree"
+  filter             = "(objectClass=user)"
+  attributes         = ["sAMAccountName"]
+  sort_by            = "sAMAccountName"
+  offset             = 100
+  limit              = 100
+}
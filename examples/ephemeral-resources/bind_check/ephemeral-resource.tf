@@ -0,0 +1,4 @@
+ephemeral "adldap_bind_check" "example" {
+  account  = adldap_user.example.sam_account_name
+  password = var.new_password
+}
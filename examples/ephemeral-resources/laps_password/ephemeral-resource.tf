@@ -0,0 +1,3 @@
+ephemeral "adldap_laps_password" "example" {
+  computer = "WS01"
+}
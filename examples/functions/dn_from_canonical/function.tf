@@ -0,0 +1,4 @@
+# result: "OU=Users,OU=Corp,DC=example,DC=com"
+output "users_ou" {
+  value = provider::adldap::dn_from_canonical("example.com/Corp/Users", "OU")
+}
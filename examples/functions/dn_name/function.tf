@@ -0,0 +1,4 @@
+# result: "Doe, Jane"
+output "name" {
+  value = provider::adldap::dn_name("CN=Doe\\, Jane,OU=Staff,DC=example,DC=com")
+}
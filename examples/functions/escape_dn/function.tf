@@ -0,0 +1,4 @@
+# result: "CN=Doe\\, Jane,OU=Staff,DC=example,DC=com"
+output "dn" {
+  value = "CN=${provider::adldap::escape_dn("Doe, Jane")},OU=Staff,DC=example,DC=com"
+}
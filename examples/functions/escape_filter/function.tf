@@ -0,0 +1,4 @@
+# result: "(cn=Doe \\28Jane\\29)"
+output "filter" {
+  value = "(cn=${provider::adldap::escape_filter("Doe (Jane)")})"
+}
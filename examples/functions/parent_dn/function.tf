@@ -0,0 +1,4 @@
+# result: "OU=Staff,DC=example,DC=com"
+output "staff_ou" {
+  value = provider::adldap::parent_dn("CN=Jane Doe,OU=Staff,DC=example,DC=com")
+}
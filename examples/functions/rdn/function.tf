@@ -0,0 +1,4 @@
+# result: "CN=Jane Doe"
+output "rdn" {
+  value = provider::adldap::rdn("CN=Jane Doe,OU=Staff,DC=example,DC=com")
+}
@@ -1,2 +1,8 @@
 # import using the computer's sAMAccountName
-terraform import adldap_user.mycomputer server02
+terraform import adldap_computer.mycomputer 'server02$'
+
+# or the computer's distinguished name
+terraform import adldap_computer.mycomputer "CN=server02,OU=Servers,DC=example,DC=com"
+
+# or the computer's objectGUID
+terraform import adldap_computer.mycomputer f81d4fae-7dec-11d0-a765-00a0c91e6bf6
@@ -0,0 +1,13 @@
+resource "adldap_ldif" "example" {
+  ldif = <<-EOT
+    dn: OU=Kiosks,DC=example,DC=com
+    objectClass: organizationalUnit
+    description: Shared kiosk computers
+
+    dn: CN=Jane Doe,OU=Staff,DC=example,DC=com
+    changetype: modify
+    replace: extensionAttribute5
+    extensionAttribute5: kiosk-admin
+    -
+  EOT
+}
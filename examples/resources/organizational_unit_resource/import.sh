@@ -1,2 +1,5 @@
 # import using the distinguishedname of the OU
 terraform import adldap_organizational_unit.myou "OU=Test Users,DC=example,DC=com"
+
+# or the OU's objectGUID
+terraform import adldap_organizational_unit.myou f81d4fae-7dec-11d0-a765-00a0c91e6bf6
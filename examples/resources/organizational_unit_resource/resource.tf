@@ -1,3 +1,19 @@
 resource "adldap_organizational_unit" "example" {
   distinguished_name = "OU=test,DC=example,DC=com"
 }
+
+# or by name under a parent, which composes well with for_each
+resource "adldap_organizational_unit" "regions" {
+  for_each  = toset(["EMEA", "APAC"])
+  name      = each.key
+  parent_dn = adldap_organizational_unit.example.distinguished_name
+}
+
+resource "adldap_organizational_unit" "servers" {
+  distinguished_name = "OU=Servers,OU=test,DC=example,DC=com"
+
+  gp_link {
+    gpo_guid = "6AC1786C-016F-11D2-945F-00C04FB984F9"
+    enforced = true
+  }
+}
@@ -1,2 +1,8 @@
-# import using a deconstructable spn---samaccountname format
+# import using just the spn; the owning account is looked up
+terraform import adldap_service_principal.myspn host/example.com
+
+# or using a deconstructable spn---samaccountname format
 terraform import adldap_service_principal.myspn host/example.com---exampleuser
+
+# import all SPNs of an account authoritatively using the sAMAccountName
+terraform import adldap_service_principal.sql svc-sql
@@ -2,3 +2,12 @@ resource "adldap_service_principal" "example" {
   samaccountname = "foo"
   spn            = "bar/baz"
 }
+
+# manage every SPN on the account; others are removed
+resource "adldap_service_principal" "sql" {
+  samaccountname = "svc-sql"
+  spns = [
+    "MSSQLSvc/sql01.example.com",
+    "MSSQLSvc/sql01.example.com:1433",
+  ]
+}
@@ -1,2 +1,8 @@
 # import using the user's sAMAccountName
 terraform import adldap_user.myuser jdoe1
+
+# or the user's distinguished name
+terraform import adldap_user.myuser "CN=John Doe,OU=Users,DC=example,DC=com"
+
+# or the user's objectGUID
+terraform import adldap_user.myuser f81d4fae-7dec-11d0-a765-00a0c91e6bf6
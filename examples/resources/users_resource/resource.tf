@@ -0,0 +1,20 @@
+locals {
+  staff = {
+    "e1001" = { sam_account_name = "jdoe", given_name = "Jane", surname = "Doe" }
+    "e1002" = { sam_account_name = "asmith", given_name = "Alex", surname = "Smith" }
+  }
+}
+
+resource "adldap_users" "staff" {
+  users = {
+    for id, person in local.staff : id => {
+      sam_account_name    = person.sam_account_name
+      organizational_unit = "OU=Staff,DC=example,DC=com"
+      display_name        = "${person.given_name} ${person.surname}"
+      given_name          = person.given_name
+      surname             = person.surname
+      user_principal_name = "${person.sam_account_name}@example.com"
+      enabled             = false
+    }
+  }
+}
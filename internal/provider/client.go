@@ -1,32 +1,116 @@
 package provider
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
-	"crypto/tls"
+	"time"
+	"unicode/utf8"
 
 	uac "github.com/audibleblink/msldapuac"
 	"github.com/go-ldap/ldap/v3"
 	"golang.org/x/text/encoding/unicode"
 )
 
+// GUID of the Computers container in the domain's wellKnownObjects
+const computersContainerGUID = "AA312825768811D1ADED00C04FD8D5CD"
+
+// Object classes of the accounts resources look up.  Computers and managed
+// service accounts are also users.
+const (
+	objectClassUser     = "user"
+	objectClassComputer = "computer"
+)
+
+// Requests no attributes, for searches that only check an object exists
+var noAttributes = []string{"1.1"}
+
+// NotFoundError is returned when a lookup finds no matching object.
+type NotFoundError struct {
+	ObjectClass string
+	Name        string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no entry returned for %s object \"%s\"", e.ObjectClass, e.Name)
+}
+
+// IsNotFound reports whether err means the object does not exist, either from
+// a lookup or from the directory refusing an operation on a missing DN.
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	return errors.As(err, &notFound) || isLDAPError(err, ldap.LDAPResultNoSuchObject)
+}
+
+// IsAlreadyExists reports whether err means an add or rename failed because an
+// object already has the DN.  AD refuses a duplicate sAMAccountName with the
+// same LDAP result code but a different error code, which doesn't count.
+func IsAlreadyExists(err error) bool {
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) || ldapErr.ResultCode != ldap.LDAPResultEntryAlreadyExists {
+		return false
+	}
+	if ldapErr.Err == nil {
+		return true
+	}
+	code, ok := adErrorCode(ldapErr.Err.Error())
+	return !ok || code == 0x00002071
+}
+
 type LdapClient struct {
-	*ldap.Conn
+	Conn            ldap.Client
 	LdapURL         string
 	SearchBase      string
 	ActIdempotently bool
+	AllowedBaseDNs  []string      // Subtrees writes are confined to; empty allows all
+	ReplicationWait time.Duration // How long reads wait for objects missing from the DC to replicate
+	DirectoryType   string        // directoryTypeAD, or directoryTypeADLDS for an AD LDS instance
+
+	bindAccount  string
+	bindPassword string
+	gc           *globalCatalogConn    // Global Catalog connection, dialed on first use
+	dc           *domainControllerName // DNS name of the domain controller Conn is bound to
+	dnCache      *dnCache              // DNs found by sAMAccountName lookups
+	domains      *domainRouter         // Connections to the provider's other domains
+	auditLog     *auditLog             // Where writes are recorded, if anywhere
 }
 
+// encodePassword encodes a password as AD expects in unicodePwd: wrapped in
+// double quotes, with nothing inside escaped, as UTF-16LE.
 func encodePassword(password string) (string, error) {
+	if !utf8.ValidString(password) {
+		return "", errors.New("password is not valid UTF-8")
+	}
 	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
-	passwordUTF, err := utf16.NewEncoder().String(fmt.Sprintf("%q", password))
+	passwordUTF, err := utf16.NewEncoder().String("\"" + password + "\"")
 	if err != nil {
 		return password, err
 	}
 	return passwordUTF, nil
 }
 
+// fileTimeToTime converts an AD timestamp (100ns intervals since 1601-01-01 UTC)
+// to a time.Time.  Zero and "never" values return the zero time.
+func fileTimeToTime(fileTime int64) time.Time {
+	const epochDifference = 116444736000000000 // 1601-01-01 to 1970-01-01 in 100ns intervals
+
+	if fileTime <= 0 || fileTime == 0x7FFFFFFFFFFFFFFF {
+		return time.Time{}
+	}
+
+	return time.Unix(0, (fileTime-epochDifference)*100).UTC()
+}
+
+// generalizedTimeToTime parses an LDAP GeneralizedTime value such as whenCreated.
+func generalizedTimeToTime(generalizedTime string) (time.Time, error) {
+	if generalizedTime == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("20060102150405.0Z0700", generalizedTime)
+}
+
 func stringSlicesEqual(a []string, b []string) bool {
 	sort.Strings(a)
 	sort.Strings(b)
@@ -71,9 +155,19 @@ func sliceIsSubset(parent []string, subset []string) bool {
 	return true
 }
 
+// sliceContainsFold reports whether the slice holds the value, ignoring case.
+func sliceContainsFold(slice []string, value string) bool {
+	for _, s := range slice {
+		if strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // LdapClient receivers
 
-func (c *LdapClient) New(url string, bindAccount string, bindPassword string, searchBase string, actIdempotently bool) error {
+func (c *LdapClient) New(ctx context.Context, url string, bindAccount string, bindPassword string, searchBase string, actIdempotently bool) error {
 	var err error
 
 	if url == "" {
@@ -81,35 +175,92 @@ func (c *LdapClient) New(url string, bindAccount string, bindPassword string, se
 	}
 
 	c.LdapURL = url
+	if searchBase != "" {
+		c.SearchBase = searchBase
+	}
 	c.ActIdempotently = actIdempotently
+	c.bindAccount = bindAccount
+	c.bindPassword = bindPassword
 
-	c.Conn, err = ldap.DialURL(url, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	c.Conn, err = dialClient(ctx, url)
 	if err != nil {
 		return err
 	}
+	bound := c.Conn
+	if len(c.AllowedBaseDNs) > 0 {
+		c.Conn = &guardedConn{Client: c.Conn, allowedBaseDNs: c.AllowedBaseDNs}
+	}
+	c.dnCache = newDNCache()
+	c.gc = new(globalCatalogConn)
+	c.dc = new(domainControllerName)
+	c.Conn = &dnCacheConn{Client: c.Conn, cache: c.dnCache}
+	var audit *auditConn
+	if c.auditLog != nil {
+		audit = &auditConn{Client: c.Conn, log: c.auditLog}
+		c.Conn = audit
+	}
 
-	err = c.Bind(bindAccount, bindPassword)
+	err = c.Bind(ctx, bindAccount, bindPassword)
 	if err != nil {
 		return err
 	}
 
 	if c.SearchBase == "" {
-		defaultNamingContext, err := c.DefaultNamingContext()
+		defaultNamingContext, err := c.DefaultNamingContext(ctx)
 		c.SearchBase = defaultNamingContext
 		if err != nil || c.SearchBase == "" {
-			return fmt.Errorf("searchBase is empty and Active Directory auto-detection failed")
+			return fmt.Errorf("searchBase is empty and naming context auto-detection failed: %v", err)
+		}
+	}
+
+	if audit != nil {
+		audit.operator, err = whoAmI(ctx, bound)
+		if err != nil {
+			return fmt.Errorf("error asking who the bind account is for the audit log: %s", err)
 		}
 	}
 
 	return nil
 }
 
-func (c *LdapClient) Bind(bindAccount string, bindPassword string) error {
-	err := c.Conn.Bind(bindAccount, bindPassword)
+func (c *LdapClient) Bind(ctx context.Context, bindAccount string, bindPassword string) error {
+	err := bindContext(ctx, c.Conn, bindAccount, bindPassword)
 	return err
 }
 
-func (c *LdapClient) DefaultNamingContext() (string, error) {
+// CheckBind reports whether the account can bind with the password, on a
+// connection of its own so the client stays bound as the provider's account.
+// Only rejected credentials report false; anything else, such as the server
+// being unreachable, is an error.
+func (c *LdapClient) CheckBind(ctx context.Context, account string, password string) (bool, error) {
+	// An empty password would make an unauthenticated bind, which succeeds
+	if password == "" {
+		return false, nil
+	}
+
+	conn, err := dialContext(ctx, c.LdapURL)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	err = bindContext(ctx, conn, account, password)
+	if isLDAPError(err, ldap.LDAPResultInvalidCredentials) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DefaultNamingContext returns the domain's naming context, or for AD LDS the
+// instance's default one.
+func (c *LdapClient) DefaultNamingContext(ctx context.Context) (string, error) {
+	if c.IsADLDS() {
+		return c.adldsNamingContext(ctx)
+	}
+
 	searchRequest := ldap.NewSearchRequest(
 		"", // The base dn to search
 		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
@@ -118,7 +269,7 @@ func (c *LdapClient) DefaultNamingContext() (string, error) {
 		nil,
 	)
 
-	result, err := c.Conn.Search(searchRequest)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
 	if err != nil {
 		return "", err
 	}
@@ -128,23 +279,56 @@ func (c *LdapClient) DefaultNamingContext() (string, error) {
 	return defaultNamingContext, nil
 }
 
-func (c *LdapClient) LdapSearch(filter string, attributes []string) (*ldap.SearchResult, error) {
+// GetWellKnownContainer resolves one of the domain's wellKnownObjects, such as
+// the Computers container, to its current distinguished name.
+func (c *LdapClient) GetWellKnownContainer(ctx context.Context, guid string) (string, error) {
+	defaultNamingContext, err := c.DefaultNamingContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		fmt.Sprintf("<WKGUID=%s,%s>", guid, defaultNamingContext),
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"distinguishedName"},
+		nil,
+	)
+
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return "", fmt.Errorf("error resolving well-known container %s: %w", guid, err)
+	}
+	if len(result.Entries) != 1 {
+		return "", fmt.Errorf("well-known container %s not found", guid)
+	}
+
+	return result.Entries[0].DN, nil
+}
+
+func (c *LdapClient) LdapSearch(ctx context.Context, filter string, attributes []string) (*ldap.SearchResult, error) {
 	searchRequest := ldap.NewSearchRequest(
 		c.SearchBase, // The base dn to search
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		filter,     // The filter to apply
 		attributes, // A list attributes to retrieve
-		nil,
+		searchControls(attributes),
 	)
 
 	// TODO handle errors other than "not found", etc.
 
-	result, err := c.Conn.Search(searchRequest)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
 	return result, err
 }
 
-func (c *LdapClient) GetObject(objectName string, searchField string, objectClass string, attributes []string) (*LdapEntry, error) {
-	entry, err := c.GetEntry(objectName, searchField, objectClass, attributes)
+func (c *LdapClient) GetObject(ctx context.Context, objectName string, searchField string, objectClass string, attributes []string) (*LdapEntry, error) {
+	return c.getObject(ctx, ldap.EscapeFilter(objectName), searchField, objectClass, attributes)
+}
+
+// getObject is GetObject for a value that is already escaped for the filter,
+// such as a binary objectGUID.
+func (c *LdapClient) getObject(ctx context.Context, filterValue string, searchField string, objectClass string, attributes []string) (*LdapEntry, error) {
+	entry, err := c.getEntry(ctx, filterValue, searchField, objectClass, attributes)
 	if err != nil {
 		return &LdapEntry{}, err
 	}
@@ -157,47 +341,91 @@ func (c *LdapClient) GetObject(objectName string, searchField string, objectClas
 	return ldapEntry, nil
 }
 
-func (c *LdapClient) GetEntry(objectName string, searchField string, objectClass string, attributes []string) (*ldap.Entry, error) {
-	filter := fmt.Sprintf("(&(objectClass=%s)(%s=%s))", objectClass, searchField, objectName)
+func (c *LdapClient) GetEntry(ctx context.Context, objectName string, searchField string, objectClass string, attributes []string) (*ldap.Entry, error) {
+	return c.getEntry(ctx, ldap.EscapeFilter(objectName), searchField, objectClass, attributes)
+}
+
+func (c *LdapClient) getEntry(ctx context.Context, filterValue string, searchField string, objectClass string, attributes []string) (*ldap.Entry, error) {
+	filter := entryFilter(objectClass, searchField, filterValue)
 
-	results, err := c.LdapSearch(filter, attributes)
+	results, err := c.LdapSearch(ctx, filter, attributes)
 	if err != nil {
 		return nil, err
 	}
 	if len(results.Entries) > 1 {
-		return nil, fmt.Errorf("too many results (%d) returned for %s object \"%s\", expected 1", len(results.Entries), objectClass, objectName)
+		return nil, fmt.Errorf("too many results (%d) returned for %s object \"%s\", expected 1", len(results.Entries), objectClass, filterValue)
 	}
 	if len(results.Entries) == 0 {
-		return nil, fmt.Errorf("no entry returned for %s object \"%s\"", objectClass, objectName)
+		return nil, &NotFoundError{ObjectClass: objectClass, Name: filterValue}
 	}
 	return results.Entries[0], nil
 }
 
-func (c *LdapClient) ObjectExists(objectDN string, objectClass string) (bool, error) {
-	filter := fmt.Sprintf("(&(objectClass=%s)(distinguishedName=%s))", objectClass, objectDN)
+// getObjectAt reads the object of the class at the DN with a base search,
+// which, unlike a subtree search filtered on distinguishedName, costs the same
+// however large the directory is.
+func (c *LdapClient) getObjectAt(ctx context.Context, distinguishedName string, objectClass string, attributes []string) (*LdapEntry, error) {
+	if _, err := NewLdapDN(distinguishedName); err != nil || distinguishedName == "" {
+		return &LdapEntry{}, &NotFoundError{ObjectClass: objectClass, Name: distinguishedName}
+	}
 
-	results, err := c.LdapSearch(filter, nil)
+	searchRequest := ldap.NewSearchRequest(
+		distinguishedName,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(objectClass=%s)", objectClass),
+		attributes,
+		searchControls(attributes),
+	)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if IsNotFound(err) || (err == nil && len(result.Entries) == 0) {
+		return &LdapEntry{}, &NotFoundError{ObjectClass: objectClass, Name: distinguishedName}
+	}
 	if err != nil {
-		return false, err
+		return &LdapEntry{}, err
 	}
-	if len(results.Entries) > 1 {
-		return false, fmt.Errorf("too many results (%d) returned for %s object \"%s\", expected 1", len(results.Entries), "distinguishedName", objectDN)
+
+	ldapEntry := &LdapEntry{
+		LdapClient:          c,
+		Entry:               result.Entries[0],
+		requestedAttributes: attributes,
 	}
-	if len(results.Entries) == 0 {
+
+	return ldapEntry, nil
+}
+
+func entryFilter(objectClass string, searchField string, filterValue string) string {
+	return fmt.Sprintf("(&(objectClass=%s)(%s=%s))", objectClass, searchField, filterValue)
+}
+
+func (c *LdapClient) ObjectExists(ctx context.Context, objectDN string, objectClass string) (bool, error) {
+	_, err := c.getObjectAt(ctx, objectDN, objectClass, noAttributes)
+	if IsNotFound(err) {
 		return false, nil
 	}
-	return true, nil
+	return err == nil, err
 }
 
-func (c *LdapClient) ContainerExists(objectDN string) (bool, error) {
-	filter := fmt.Sprintf("(&(|(objectClass=organizationalUnit)(objectClass=container)(objectClass=domain))(distinguishedName=%s))", objectDN)
+func (c *LdapClient) ContainerExists(ctx context.Context, objectDN string) (bool, error) {
+	for _, objectClass := range []string{"organizationalUnit", "container", "domain"} {
+		exists, err := c.ObjectExists(ctx, objectDN, objectClass)
+		if exists || err != nil {
+			return exists, err
+		}
+	}
+	return false, nil
+}
 
-	results, err := c.LdapSearch(filter, nil)
+// AccountExists reports whether any object has the sAMAccountName, which is
+// unique across users, computers, and groups alike.
+func (c *LdapClient) AccountExists(ctx context.Context, sAMAccountName string) (bool, error) {
+	filter := fmt.Sprintf("(%s=%s)", c.accountNameAttribute(), ldap.EscapeFilter(sAMAccountName))
+
+	results, err := c.LdapSearch(ctx, filter, noAttributes)
 	if err != nil {
 		return false, err
 	}
 	if len(results.Entries) > 1 {
-		return false, fmt.Errorf("too many results (%d) returned for %s object \"%s\", expected 1", len(results.Entries), "distinguishedName", objectDN)
+		return false, fmt.Errorf("too many results (%d) returned for %s object \"%s\", expected 1", len(results.Entries), "sAMAccountName", sAMAccountName)
 	}
 	if len(results.Entries) == 0 {
 		return false, nil
@@ -205,37 +433,90 @@ func (c *LdapClient) ContainerExists(objectDN string) (bool, error) {
 	return true, nil
 }
 
-func (c *LdapClient) AccountExists(sAMAccountName string) (bool, error) {
-	filter := fmt.Sprintf("(&(objectClass=%s)(samAccountName=%s))", "*", sAMAccountName)
-
-	results, err := c.LdapSearch(filter, nil)
+// GetDN returns the DN of the account, from the client's cache if an earlier
+// lookup found it.
+func (c *LdapClient) GetDN(ctx context.Context, sAMAccountName string) (string, error) {
+	if dn, ok := c.dnCache.get(sAMAccountName); ok {
+		return dn, nil
+	}
+	result, err := c.GetObjectBySAMAccountName(ctx, sAMAccountName, objectClassUser, []string{c.accountNameAttribute()})
 	if err != nil {
-		return false, err
+		return "", err
 	}
-	if len(results.Entries) > 1 {
-		return false, fmt.Errorf("too many results (%d) returned for %s object \"%s\", expected 1", len(results.Entries), "sAMAccountName", sAMAccountName)
+	return result.DN, nil
+}
+
+func (c *LdapClient) GetObjectByDN(ctx context.Context, distinguishedName string, attributes []string) (*LdapEntry, error) {
+	return c.getObjectAt(ctx, distinguishedName, "*", attributes)
+}
+
+// GetObjectBySAMAccountName looks up an account by sAMAccountName, or in AD
+// LDS by userPrincipalName, searching only the DN an earlier lookup found
+// while the account is still there.
+func (c *LdapClient) GetObjectBySAMAccountName(ctx context.Context, sAMAccountName string, objectClass string, attributes []string) (*LdapEntry, error) {
+	filter := entryFilter(objectClass, c.accountNameAttribute(), ldap.EscapeFilter(sAMAccountName))
+	if dn, ok := c.dnCache.get(sAMAccountName); ok {
+		searchRequest := ldap.NewSearchRequest(
+			dn,
+			ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+			filter,
+			attributes,
+			searchControls(attributes),
+		)
+		result, err := searchContext(ctx, c.Conn, searchRequest)
+		if err != nil && !IsNotFound(err) {
+			return &LdapEntry{}, err
+		}
+		if err == nil && len(result.Entries) == 1 {
+			return &LdapEntry{LdapClient: c, Entry: result.Entries[0], requestedAttributes: attributes}, nil
+		}
+		c.dnCache.forget(sAMAccountName)
 	}
-	if len(results.Entries) == 0 {
-		return false, nil
+
+	ldapEntry, err := c.GetObject(ctx, sAMAccountName, c.accountNameAttribute(), objectClass, attributes)
+	if err != nil {
+		return ldapEntry, err
 	}
-	return true, nil
+	c.dnCache.put(sAMAccountName, ldapEntry.DN)
+
+	return ldapEntry, nil
 }
 
-func (c *LdapClient) GetDN(sAMAccountName string) (string, error) {
-	result, err := c.GetObjectBySAMAccountName(sAMAccountName, nil)
-	return result.DN, err
+func (c *LdapClient) GetOU(ctx context.Context, distinguishedName string) (*LdapOU, error) {
+	return c.GetOUWithAttributes(ctx, distinguishedName, []string{"objectGUID"})
 }
 
-func (c *LdapClient) GetObjectByDN(distinguishedName string, attributes []string) (*LdapEntry, error) {
-	return c.GetObject(distinguishedName, "distinguishedName", "*", attributes)
+func (c *LdapClient) GetOUByGUID(ctx context.Context, guid string, attributes []string) (*LdapOU, error) {
+	objectGUID, err := parseGUID(guid)
+	if err != nil {
+		return &LdapOU{}, err
+	}
+
+	ldapEntry, err := c.getObject(ctx, guidFilterValue(objectGUID), "objectGUID", "organizationalUnit", attributes)
+	if IsNotFound(err) {
+		return &LdapOU{}, &NotFoundError{ObjectClass: "organizationalUnit", Name: guid}
+	}
+	if err != nil {
+		return &LdapOU{}, err
+	}
+
+	ldapOU := &LdapOU{
+		LdapEntry: ldapEntry,
+	}
+
+	return ldapOU, nil
 }
 
-func (c *LdapClient) GetObjectBySAMAccountName(sAMAccountName string, attributes []string) (*LdapEntry, error) {
-	return c.GetObject(sAMAccountName, "sAMAccountName", "*", attributes)
+// GetOUByIdentifier looks up an OU by objectGUID or distinguished name.
+func (c *LdapClient) GetOUByIdentifier(ctx context.Context, identifier string, attributes []string) (*LdapOU, error) {
+	if _, err := parseGUID(identifier); err == nil {
+		return c.GetOUByGUID(ctx, identifier, attributes)
+	}
+	return c.GetOUWithAttributes(ctx, identifier, attributes)
 }
 
-func (c *LdapClient) GetOU(distinguishedName string) (*LdapOU, error) {
-	ldapEntry, err := c.GetObject(distinguishedName, "distinguishedName", "organizationalUnit", nil)
+func (c *LdapClient) GetOUWithAttributes(ctx context.Context, distinguishedName string, attributes []string) (*LdapOU, error) {
+	ldapEntry, err := c.getObjectAt(ctx, distinguishedName, "organizationalUnit", attributes)
 	if err != nil {
 		return &LdapOU{}, err
 	}
@@ -247,8 +528,8 @@ func (c *LdapClient) GetOU(distinguishedName string) (*LdapOU, error) {
 	return ldapOU, nil
 }
 
-func (c *LdapClient) GetAccountByDN(distinguishedName string, attributes []string) (*LdapAccount, error) {
-	ldapEntry, err := c.GetObject(distinguishedName, "distinguishedName", "*", attributes)
+func (c *LdapClient) GetAccountByDN(ctx context.Context, distinguishedName string, objectClass string, attributes []string) (*LdapAccount, error) {
+	ldapEntry, err := c.getObjectAt(ctx, distinguishedName, objectClass, attributes)
 	if err != nil {
 		return &LdapAccount{}, err
 	}
@@ -260,8 +541,8 @@ func (c *LdapClient) GetAccountByDN(distinguishedName string, attributes []strin
 	return account, err
 }
 
-func (c *LdapClient) GetAccountBySAMAccountName(sAMAccountName string, attributes []string) (*LdapAccount, error) {
-	ldapEntry, err := c.GetObject(sAMAccountName, "sAMAccountName", "*", attributes)
+func (c *LdapClient) GetAccountBySAMAccountName(ctx context.Context, sAMAccountName string, objectClass string, attributes []string) (*LdapAccount, error) {
+	ldapEntry, err := c.GetObjectBySAMAccountName(ctx, sAMAccountName, objectClass, attributes)
 	if err != nil {
 		return &LdapAccount{}, err
 	}
@@ -273,16 +554,71 @@ func (c *LdapClient) GetAccountBySAMAccountName(sAMAccountName string, attribute
 	return account, err
 }
 
-func (c *LdapClient) CreateObject(distinguishedName string, attributes map[string][]string, objectClass string) (*LdapEntry, error) {
+func (c *LdapClient) GetAccountByGUID(ctx context.Context, guid string, objectClass string, attributes []string) (*LdapAccount, error) {
+	objectGUID, err := parseGUID(guid)
+	if err != nil {
+		return &LdapAccount{}, err
+	}
 
-	exists, err := c.ObjectExists(distinguishedName, "*")
+	ldapEntry, err := c.getObject(ctx, guidFilterValue(objectGUID), "objectGUID", objectClass, attributes)
+	if IsNotFound(err) {
+		return &LdapAccount{}, &NotFoundError{ObjectClass: objectClass, Name: guid}
+	}
 	if err != nil {
-		return new(LdapEntry), err
+		return &LdapAccount{}, err
 	}
-	if exists {
-		return new(LdapEntry), fmt.Errorf("object \"%s\" already exists", distinguishedName)
+
+	account := &LdapAccount{
+		LdapEntry: ldapEntry,
+	}
+
+	return account, err
+}
+
+// GetAccountByServicePrincipal looks up the account in the domain that has the SPN.
+func (c *LdapClient) GetAccountByServicePrincipal(ctx context.Context, spn string, attributes []string) (*LdapAccount, error) {
+	ldapEntry, err := c.GetObject(ctx, spn, "servicePrincipalName", objectClassUser, attributes)
+	if err != nil {
+		return &LdapAccount{}, err
 	}
 
+	account := &LdapAccount{
+		LdapEntry: ldapEntry,
+	}
+
+	return account, err
+}
+
+// GetAccountByIdentifier looks up an account of the object class by
+// objectGUID, distinguished name, or sAMAccountName, in that order of
+// precedence.
+func (c *LdapClient) GetAccountByIdentifier(ctx context.Context, identifier string, objectClass string, attributes []string) (*LdapAccount, error) {
+	if _, err := parseGUID(identifier); err == nil {
+		return c.GetAccountByGUID(ctx, identifier, objectClass, attributes)
+	}
+	if strings.Contains(identifier, "=") {
+		if _, err := NewLdapDN(identifier); err == nil {
+			return c.GetAccountByDN(ctx, identifier, objectClass, attributes)
+		}
+	}
+	return c.GetAccountBySAMAccountName(ctx, identifier, objectClass, attributes)
+}
+
+// GetComputerByIdentifier looks up a computer account like
+// GetAccountByIdentifier, also accepting a sAMAccountName without the trailing
+// "$".
+func (c *LdapClient) GetComputerByIdentifier(ctx context.Context, identifier string, attributes []string) (*LdapAccount, error) {
+	account, err := c.GetAccountByIdentifier(ctx, identifier, objectClassComputer, attributes)
+	if err != nil && !strings.HasSuffix(identifier, "$") {
+		account, err = c.GetAccountBySAMAccountName(ctx, identifier+"$", objectClassComputer, attributes)
+	}
+	return account, err
+}
+
+// CreateObject adds the object and reads it back with objectGUID and the
+// attributes it was created with.  The directory reports an existing object
+// at the DN, so it isn't looked for first.
+func (c *LdapClient) CreateObject(ctx context.Context, distinguishedName string, attributes map[string][]string, objectClass string) (*LdapEntry, error) {
 	request := ldap.NewAddRequest(distinguishedName, nil)
 	request.Attribute("objectClass", []string{objectClass})
 
@@ -294,17 +630,20 @@ func (c *LdapClient) CreateObject(distinguishedName string, attributes map[strin
 		request.Attribute(k, v)
 	}
 
-	err = c.Conn.Add(request)
+	err := addContext(ctx, c.Conn, request)
+	if IsAlreadyExists(err) {
+		return new(LdapEntry), fmt.Errorf("object \"%s\" already exists: %w", distinguishedName, err)
+	}
 	if err != nil {
 		return new(LdapEntry), err
 	}
 
-	var attributeNames []string
+	attributeNames := []string{"objectGUID"}
 	for k := range attributes {
 		attributeNames = append(attributeNames, k)
 	}
 
-	ldapEntry, err := c.GetObjectByDN(distinguishedName, attributeNames)
+	ldapEntry, err := c.GetObjectByDN(ctx, distinguishedName, attributeNames)
 	if err != nil {
 		return ldapEntry, err
 	}
@@ -312,66 +651,111 @@ func (c *LdapClient) CreateObject(distinguishedName string, attributes map[strin
 	return ldapEntry, nil
 }
 
-func (c *LdapClient) CreateOU(distinguishedName string) (*LdapOU, error) {
+func (c *LdapClient) CreateOU(ctx context.Context, distinguishedName string, attributes map[string][]string) (*LdapOU, error) {
 	var ou *LdapOU
 
-	parsedSearchBase, _ := ldap.ParseDN(c.SearchBase)
-	parsedOU, _ := ldap.ParseDN(distinguishedName)
-	if !parsedSearchBase.AncestorOf(parsedOU) {
-		return ou, fmt.Errorf("organizational unit \"%s\" is not an ancestor of search base \"%s\"", distinguishedName, c.SearchBase)
+	parsedOU, err := ldap.ParseDN(distinguishedName)
+	if err != nil {
+		return ou, err
 	}
-	if parsedOU.RDNs[0].Attributes[0].Type != "OU" {
+	if !dnIsDescendant(distinguishedName, c.SearchBase) {
+		return ou, fmt.Errorf("organizational unit \"%s\" is not beneath search base \"%s\"", distinguishedName, c.SearchBase)
+	}
+	if !strings.EqualFold(parsedOU.RDNs[0].Attributes[0].Type, "OU") {
 		return ou, fmt.Errorf("\"%s\" is not an OU distinguished name", distinguishedName)
 	}
 
-	_, err := c.CreateObject(distinguishedName, nil, "organizationalUnit")
+	ldapEntry, err := c.CreateObject(ctx, distinguishedName, attributes, "organizationalUnit")
 	if err != nil {
 		return ou, err
 	}
 
-	ou, err = c.GetOU(distinguishedName)
-
-	return ou, err
+	return &LdapOU{LdapEntry: ldapEntry}, nil
 }
 
-func (c *LdapClient) CreateOUAndParents(distinguishedName string) (*LdapOU, error) {
-	var ou *LdapOU
+// CreateParentOUs creates any missing parent OUs of the distinguished name,
+// returning the DNs it created from the top down.  Each ancestor is looked for
+// once, up to the nearest that exists; an OU that appears in the meantime is
+// left to whoever created it.
+func (c *LdapClient) CreateParentOUs(ctx context.Context, distinguishedName string) ([]string, error) {
+	var missing []string
+	for dn := distinguishedName; ; {
+		parsed, err := NewLdapDN(dn)
+		if err != nil {
+			return nil, err
+		}
+		dn = parsed.ParentDN()
+		if dn == "" {
+			break
+		}
 
-	dn, err := NewLdapDN(distinguishedName)
-	if err != nil {
-		return ou, err
+		exists, err := c.ObjectExists(ctx, dn, "*")
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			break
+		}
+		missing = append(missing, dn)
 	}
-	parentOU := dn.ParentDN()
 
-	parentExists, err := c.ObjectExists(parentOU, "*")
-	if err != nil {
-		return ou, err
+	created := []string{}
+	for i := len(missing) - 1; i >= 0; i-- {
+		_, err := c.CreateOU(ctx, missing[i], nil)
+		if IsAlreadyExists(err) {
+			continue
+		}
+		if err != nil {
+			return created, err
+		}
+		created = append(created, missing[i])
 	}
 
-	if !parentExists {
-		c.CreateOUAndParents(parentOU)
+	return created, nil
+}
+
+// CreateOUAndParents creates the OU with the given attributes, and any missing
+// parent OUs without attributes.
+func (c *LdapClient) CreateOUAndParents(ctx context.Context, distinguishedName string, attributes map[string][]string) (*LdapOU, error) {
+	_, err := c.CreateParentOUs(ctx, distinguishedName)
+	if err != nil {
+		return nil, err
 	}
 
-	return c.CreateOU(distinguishedName)
+	return c.CreateOU(ctx, distinguishedName, attributes)
 }
 
-func (c *LdapClient) CreateAccount(sAMAccountName string, ou string, attributes map[string][]string, objectClass string, userAccountControl int) (*LdapAccount, error) {
+// accountDN returns the DN a new account gets in the OU: named after its cn,
+// or else its displayName, or else its sAMAccountName without any trailing $.
+func accountDN(sAMAccountName string, ou string, attributes map[string][]string) string {
 	var name string
-	if attributes == nil {
-		attributes = make(map[string][]string)
-	}
-
-	if val, ok := attributes["displayName"]; ok {
+	if val, ok := attributes["cn"]; ok {
+		name = val[0]
+	} else if val, ok := attributes["displayName"]; ok {
 		name = val[0]
 	} else {
 		name = strings.TrimRight(sAMAccountName, "$")
 	}
 
-	dn := fmt.Sprintf("CN=%s,%s", name, ou)
-	attributes["sAMAccountName"] = []string{sAMAccountName}
-	attributes["userAccountControl"] = []string{fmt.Sprintf("%d", userAccountControl)}
+	return fmt.Sprintf("CN=%s,%s", escapeRDNValue(name), ou)
+}
+
+func (c *LdapClient) CreateAccount(ctx context.Context, sAMAccountName string, ou string, attributes map[string][]string, objectClass string, userAccountControl int) (*LdapAccount, error) {
+	if attributes == nil {
+		attributes = make(map[string][]string)
+	}
+
+	dn := accountDN(sAMAccountName, ou, attributes)
+	attributes[c.accountNameAttribute()] = []string{sAMAccountName}
+	accountControl, err := c.accountControlValues(int64(userAccountControl))
+	if err != nil {
+		return &LdapAccount{}, err
+	}
+	for name, values := range accountControl {
+		attributes[name] = values
+	}
 
-	ldapEntry, err := c.CreateObject(dn, attributes, objectClass)
+	ldapEntry, err := c.CreateObject(ctx, dn, attributes, objectClass)
 	if err != nil {
 		return &LdapAccount{}, err
 	}
@@ -382,25 +766,52 @@ func (c *LdapClient) CreateAccount(sAMAccountName string, ou string, attributes
 	return account, nil
 }
 
-func (c *LdapClient) CreateUserAccount(sAMAccountName string, password string, ou string, attributes map[string][]string) (*LdapAccount, error) {
+func (c *LdapClient) CreateUserAccount(ctx context.Context, sAMAccountName string, password string, ou string, attributes map[string][]string) (*LdapAccount, error) {
 	userAccountControl := uac.NormalAccount | uac.Accountdisable
 
-	account, err := c.CreateAccount(sAMAccountName, ou, attributes, "user", userAccountControl)
+	account, err := c.CreateAccount(ctx, sAMAccountName, ou, attributes, "user", userAccountControl)
 	if err != nil {
-		return new(LdapAccount), fmt.Errorf("error creating user account: %s", err)
+		return new(LdapAccount), fmt.Errorf("error creating user account: %w", err)
 	}
 
 	if password != "" {
-		err := account.SetPassword(password)
+		err := account.SetPassword(ctx, password)
 		if err != nil {
-			return nil, fmt.Errorf("error setting password: %s", err)
+			return nil, fmt.Errorf("error setting password: %w", err)
 		}
 	}
 
 	return account, nil
 }
 
-func (c *LdapClient) CreateComputerAccount(sAMAccountName string, ou string, attributes map[string][]string) (*LdapAccount, error) {
+func (c *LdapClient) CreateComputerAccount(ctx context.Context, sAMAccountName string, password string, ou string, attributes map[string][]string) (*LdapAccount, error) {
+	if c.IsADLDS() {
+		return &LdapAccount{}, fmt.Errorf("AD LDS has no computer accounts")
+	}
+
 	userAccountControl := uac.WorkstationTrustAccount
-	return c.CreateAccount(sAMAccountName, ou, attributes, "computer", userAccountControl)
+
+	account, err := c.CreateAccount(ctx, sAMAccountName, ou, attributes, "computer", userAccountControl)
+	if err != nil {
+		return account, err
+	}
+
+	if password != "" {
+		err := account.SetPassword(ctx, password)
+		if err != nil {
+			return account, fmt.Errorf("error setting password: %w", err)
+		}
+	}
+
+	return account, nil
+}
+
+// defaultComputerPassword returns the password ADUC assigns when pre-staging a
+// computer for pre-Windows 2000 style join: the lowercase name, up to 14 characters.
+func defaultComputerPassword(sAMAccountName string) string {
+	password := strings.ToLower(strings.TrimSuffix(sAMAccountName, "$"))
+	if len(password) > 14 {
+		password = password[:14]
+	}
+	return password
 }
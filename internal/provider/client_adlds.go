@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	uac "github.com/audibleblink/msldapuac"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Kinds of directory the provider manages
+const (
+	directoryTypeAD    = "ad"
+	directoryTypeADLDS = "adlds"
+)
+
+// AD LDS keeps the userAccountControl flags it supports on users in
+// attributes of their own, and has no userAccountControl to write.
+var adldsAccountControlAttributes = map[int64]string{
+	uac.Accountdisable:     "msDS-UserAccountDisabled",
+	uac.DontExpirePassword: "msDS-UserDontExpirePassword",
+	uac.PasswdNotReqd:      "ms-DS-UserPasswordNotRequired",
+}
+
+// accountControlAttributes are the attributes an account's userAccountControl
+// is read from, in either kind of directory.
+var accountControlAttributes = []string{"userAccountControl", "msDS-UserAccountDisabled", "msDS-UserDontExpirePassword", "ms-DS-UserPasswordNotRequired"}
+
+// IsADLDS reports whether the client manages an AD LDS instance rather than
+// Active Directory.
+func (c *LdapClient) IsADLDS() bool {
+	return c.DirectoryType == directoryTypeADLDS
+}
+
+// accountNameAttribute is the attribute holding an account's unique logon
+// name: sAMAccountName, or in AD LDS, which has none, userPrincipalName.
+func (c *LdapClient) accountNameAttribute() string {
+	if c.IsADLDS() {
+		return "userPrincipalName"
+	}
+	return "sAMAccountName"
+}
+
+// entryAccountControl returns an account's userAccountControl, which in AD
+// LDS is put together from the attributes it keeps the flags in, as a normal
+// account.  The entry must have been read with accountControlAttributes.
+func (c *LdapClient) entryAccountControl(entry *ldap.Entry) (int64, error) {
+	if !c.IsADLDS() {
+		value := entry.GetEqualFoldAttributeValue("userAccountControl")
+		userAccountControl, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return -1, fmt.Errorf("error parsing userAccountControl \"%s\": %s", value, err)
+		}
+		return userAccountControl, nil
+	}
+
+	var userAccountControl int64 = uac.NormalAccount
+	for flag, attribute := range adldsAccountControlAttributes {
+		if strings.EqualFold(entry.GetEqualFoldAttributeValue(attribute), "TRUE") {
+			userAccountControl |= flag
+		}
+	}
+	return userAccountControl, nil
+}
+
+// accountControlValues returns the attributes that give an account the
+// userAccountControl.  AD LDS refuses flags it has no attribute for, other
+// than the account type.
+func (c *LdapClient) accountControlValues(userAccountControl int64) (map[string][]string, error) {
+	if !c.IsADLDS() {
+		return map[string][]string{"userAccountControl": {strconv.FormatInt(userAccountControl, 10)}}, nil
+	}
+
+	values := map[string][]string{}
+	unsupported := userAccountControl &^ (uac.NormalAccount | uac.WorkstationTrustAccount)
+	for flag, attribute := range adldsAccountControlAttributes {
+		values[attribute] = []string{strings.ToUpper(strconv.FormatBool(userAccountControl&flag != 0))}
+		unsupported &^= flag
+	}
+	if unsupported != 0 {
+		return nil, fmt.Errorf("AD LDS has no equivalent of userAccountControl flags 0x%x", unsupported)
+	}
+	return values, nil
+}
+
+// adldsNamingContext returns the naming context an AD LDS instance searches
+// by default: the one set as its msDS-DefaultNamingContext, if any, or else
+// its first application partition.
+func (c *LdapClient) adldsNamingContext(ctx context.Context) (string, error) {
+	searchRequest := ldap.NewSearchRequest(
+		"",
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"defaultNamingContext", "namingContexts", "configurationNamingContext", "schemaNamingContext"},
+		nil,
+	)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Entries) == 0 {
+		return "", &NotFoundError{ObjectClass: "rootDSE", Name: "namingContexts"}
+	}
+
+	rootDSE := result.Entries[0]
+	if defaultNamingContext := rootDSE.GetAttributeValue("defaultNamingContext"); defaultNamingContext != "" {
+		return defaultNamingContext, nil
+	}
+	for _, namingContext := range rootDSE.GetAttributeValues("namingContexts") {
+		if !dnsEqual(namingContext, rootDSE.GetAttributeValue("configurationNamingContext")) && !dnsEqual(namingContext, rootDSE.GetAttributeValue("schemaNamingContext")) {
+			return namingContext, nil
+		}
+	}
+	return "", fmt.Errorf("the AD LDS instance has no application partition")
+}
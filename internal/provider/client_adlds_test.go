@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	uac "github.com/audibleblink/msldapuac"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// newFakeADLDSClient returns a client in AD LDS mode bound to a fake directory
+// behaving like an AD LDS instance.
+func newFakeADLDSClient(t *testing.T) (*LdapClient, *fakeDirectory) {
+	t.Helper()
+
+	client, directory := newFakeClient(t)
+	directory.adlds = true
+	client.DirectoryType = directoryTypeADLDS
+	return client, directory
+}
+
+func TestAdldapADLDSNamingContext(t *testing.T) {
+	client, _ := newFakeADLDSClient(t)
+
+	// AD LDS has no defaultNamingContext unless one is set, so the first
+	// application partition is used
+	namingContext, err := client.DefaultNamingContext(context.Background())
+	if err != nil || namingContext != fakeDomainDN {
+		t.Errorf("Error detecting the naming context: got %q, %v", namingContext, err)
+	}
+
+	client.DirectoryType = directoryTypeAD
+	if namingContext, _ := client.DefaultNamingContext(context.Background()); namingContext != "" {
+		t.Errorf("Error reading defaultNamingContext: got %q", namingContext)
+	}
+}
+
+func TestAdldapADLDSAccountControl(t *testing.T) {
+	client, _ := newFakeADLDSClient(t)
+
+	values, err := client.accountControlValues(uac.NormalAccount | uac.Accountdisable | uac.DontExpirePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"msDS-UserAccountDisabled": "TRUE", "msDS-UserDontExpirePassword": "TRUE", "ms-DS-UserPasswordNotRequired": "FALSE"}
+	for name, value := range expected {
+		if len(values[name]) != 1 || values[name][0] != value {
+			t.Errorf("Error setting %s: got %v", name, values)
+		}
+	}
+	if _, ok := values["userAccountControl"]; ok {
+		t.Errorf("Error leaving out userAccountControl: got %v", values)
+	}
+
+	entry := ldap.NewEntry("CN=user,"+fakeDomainDN, map[string][]string{"msDS-UserAccountDisabled": {"TRUE"}})
+	if userAccountControl, err := client.entryAccountControl(entry); err != nil || userAccountControl != uac.NormalAccount|uac.Accountdisable {
+		t.Errorf("Error reading userAccountControl: got 0x%x, %v", userAccountControl, err)
+	}
+
+	// Flags with no attribute of their own are refused
+	if _, err := client.accountControlValues(uac.NormalAccount | DONT_REQ_PREAUTH); err == nil {
+		t.Error("Error refusing DONT_REQ_PREAUTH")
+	}
+}
@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Attributes whose values audit records leave out
+var auditSecretAttributes = []string{"unicodePwd", "userPassword", "ms-Mcs-AdmPwd", "msLAPS-Password", "msLAPS-EncryptedPassword"}
+
+// Names of the operations of LDAP modify changes
+var auditChangeOperations = map[uint]string{
+	ldap.AddAttribute:     "add",
+	ldap.DeleteAttribute:  "delete",
+	ldap.ReplaceAttribute: "replace",
+}
+
+// auditRecord is the JSON line written to the audit log for each write.
+type auditRecord struct {
+	Time      string        `json:"time"`
+	Operator  string        `json:"operator"`
+	Operation string        `json:"operation"`
+	DN        string        `json:"dn"`
+	NewDN     string        `json:"new_dn,omitempty"`
+	Changes   []auditChange `json:"changes,omitempty"`
+	Attempts  int           `json:"attempts"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// auditChange is an attribute an add set, or a modify changed.  Binary values
+// are base64-encoded, and secrets are left out.
+type auditChange struct {
+	Operation string   `json:"operation,omitempty"`
+	Attribute string   `json:"attribute"`
+	Values    []string `json:"values,omitempty"`
+	Redacted  bool     `json:"redacted,omitempty"`
+}
+
+// auditLog appends audit records as JSON lines, shared by the connections to
+// each of the provider's domains.
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// openAuditLog opens the file at the path for appending, or standard output
+// for "-".
+func openAuditLog(path string) (*auditLog, error) {
+	if path == "-" {
+		return &auditLog{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %s", err)
+	}
+	return &auditLog{w: f}, nil
+}
+
+func (a *auditLog) write(record auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(line, '\n'))
+	return err
+}
+
+// auditConn is the outermost connection of a client with an audit log.
+// addContext, modifyContext, modifyDNContext, and delContext record each
+// add, modify, rename, and delete sent through it once, whether or not the
+// directory accepted it, with its final result and the number of attempts
+// made.  A write that can't be recorded returns an error even when the
+// directory has made it, so that no change goes unaudited without notice.
+type auditConn struct {
+	ldap.Client
+	log      *auditLog
+	operator string // Who the server says the connection is bound as, set once bound
+}
+
+func (a *auditConn) record(record auditRecord, attempts int, err error) error {
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	record.Operator = a.operator
+	record.Attempts = attempts
+	if err != nil {
+		record.Error = err.Error()
+	}
+	auditErr := a.log.write(record)
+	if auditErr == nil {
+		return err
+	}
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("%s of %s couldn't be written to the audit log: %s", record.Operation, record.DN, auditErr))
+	}
+	return fmt.Errorf("%s of %s succeeded but couldn't be written to the audit log: %s", record.Operation, record.DN, auditErr)
+}
+
+func auditAddRecord(request *ldap.AddRequest) auditRecord {
+	record := auditRecord{Operation: "add", DN: request.DN}
+	for _, attribute := range request.Attributes {
+		record.Changes = append(record.Changes, auditAttributeChange("", attribute.Type, attribute.Vals))
+	}
+	return record
+}
+
+func auditModifyRecord(request *ldap.ModifyRequest) auditRecord {
+	record := auditRecord{Operation: "modify", DN: request.DN}
+	for _, change := range request.Changes {
+		record.Changes = append(record.Changes, auditAttributeChange(auditChangeOperations[change.Operation], change.Modification.Type, change.Modification.Vals))
+	}
+	return record
+}
+
+func auditModifyDNRecord(request *ldap.ModifyDNRequest) auditRecord {
+	record := auditRecord{Operation: "rename", DN: request.DN}
+	parent := request.NewSuperior
+	if parent == "" {
+		if ldapDN, err := NewLdapDN(request.DN); err == nil {
+			parent = ldapDN.ParentDN()
+		}
+	}
+	record.NewDN = request.NewRDN + "," + parent
+	return record
+}
+
+func auditAttributeChange(operation string, attribute string, values []string) auditChange {
+	change := auditChange{Operation: operation, Attribute: attribute}
+	if sliceContainsFold(auditSecretAttributes, attribute) {
+		change.Redacted = len(values) > 0
+		return change
+	}
+	for _, value := range values {
+		change.Values = append(change.Values, attributeValueString([]byte(value)))
+	}
+	return change
+}
+
+// whoAmIConn is a connection that can ask the server who it is bound as.
+type whoAmIConn interface {
+	WhoAmI(controls []ldap.Control) (*ldap.WhoAmIResult, error)
+}
+
+// whoAmI returns who the connection is bound as, from the server's Who Am I
+// operation: the DN of an authorization ID of the form dn:<DN>, or else the
+// authorization ID as the server gave it, such as the u:DOMAIN\name Active
+// Directory answers with.
+func whoAmI(ctx context.Context, conn ldap.Client) (string, error) {
+	who, ok := conn.(whoAmIConn)
+	if !ok {
+		return "", fmt.Errorf("the connection can't ask the server who it is bound as")
+	}
+	var result *ldap.WhoAmIResult
+	err := doContext(ctx, func() error {
+		var err error
+		result, err = who.WhoAmI(nil)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(result.AuthzID, "dn:"), nil
+}
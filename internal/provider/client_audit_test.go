@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestAdldapAuditConn(t *testing.T) {
+	client, directory := newFakeClient(t)
+	var buffer bytes.Buffer
+	client.Conn = &auditConn{Client: client.Conn, log: &auditLog{w: &buffer}, operator: "CN=terraform,CN=Users," + fakeDomainDN}
+	ctx := context.Background()
+	ouDN := "OU=Audited," + fakeDomainDN
+
+	if _, err := client.CreateOU(ctx, ouDN, map[string][]string{"description": {"Audited"}}); err != nil {
+		t.Fatal(err)
+	}
+	account, err := client.CreateUserAccount(ctx, "audited", "Passw0rd!", ouDN, map[string][]string{"cn": {"Audited User"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := modifyDNContext(ctx, client.Conn, ldap.NewModifyDNRequest(account.DN, "CN=Renamed User", true, "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := delContext(ctx, client.Conn, ldap.NewDelRequest("CN=Missing,"+ouDN, nil)); err == nil {
+		t.Fatal("Error deleting a missing object: expected an error")
+	}
+
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var record auditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Error parsing audit record %q: %s", line, err)
+		}
+		if record.Operator != "CN=terraform,CN=Users,"+fakeDomainDN || record.Time == "" || record.Attempts != 1 {
+			t.Errorf("Error recording who and when: got %v", record)
+		}
+		records = append(records, record)
+	}
+	if len(records) < 4 || records[0].Operation != "add" || records[0].DN != ouDN {
+		t.Fatalf("Error recording writes: got %v", records)
+	}
+
+	// Passwords are named but their values are left out
+	var redacted bool
+	for _, record := range records {
+		for _, change := range record.Changes {
+			if strings.EqualFold(change.Attribute, "unicodePwd") {
+				redacted = change.Redacted && len(change.Values) == 0
+			}
+		}
+	}
+	if !redacted || strings.Contains(buffer.String(), "Passw0rd") {
+		t.Errorf("Error leaving the password out of the audit log: got %s", buffer.String())
+	}
+
+	renamed := records[len(records)-2]
+	if renamed.Operation != "rename" || renamed.NewDN != "CN=Renamed User,"+ouDN {
+		t.Errorf("Error recording a rename: got %v", renamed)
+	}
+	deleted := records[len(records)-1]
+	if deleted.Operation != "delete" || deleted.Error == "" {
+		t.Errorf("Error recording a refused delete: got %v", deleted)
+	}
+	if directory.Entry("CN=Renamed User,"+ouDN) == nil {
+		t.Error("Error passing writes through to the directory")
+	}
+	if _, ok := client.WithControls([]*ldap.ControlString{ldap.NewControlString("1.2.840.113556.1.4.1413", false, "")}).Conn.(*auditConn); !ok {
+		t.Error("Error keeping the audit connection outermost with controls")
+	}
+}
+
+// busyConn answers the first modifies it is sent with busy, as a DC does
+// while it is overloaded.
+type busyConn struct {
+	ldap.Client
+	busy int
+}
+
+func (b *busyConn) Modify(request *ldap.ModifyRequest) error {
+	if b.busy > 0 {
+		b.busy--
+		return ldap.NewError(ldap.LDAPResultBusy, errors.New("00002024: SvcErr: DSID-02080451, problem 5001 (BUSY), data 0"))
+	}
+	return b.Client.Modify(request)
+}
+
+func TestAdldapAuditConn_retried(t *testing.T) {
+	initialDelay, maxDelay := retryInitialDelay, retryMaxDelay
+	retryInitialDelay, retryMaxDelay = time.Millisecond, time.Millisecond
+	defer func() { retryInitialDelay, retryMaxDelay = initialDelay, maxDelay }()
+
+	client, directory := newFakeClient(t)
+	var buffer bytes.Buffer
+	client.Conn = &auditConn{Client: &busyConn{Client: directory, busy: 2}, log: &auditLog{w: &buffer}}
+
+	request := ldap.NewModifyRequest("CN=Users,"+fakeDomainDN, nil)
+	request.Replace("description", []string{"Retried"})
+	if err := modifyContext(context.Background(), client.Conn, request); err != nil {
+		t.Fatal(err)
+	}
+
+	// One write is one record, however many times it was sent
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	var record auditRecord
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &record) != nil || record.Attempts != 3 || record.Error != "" {
+		t.Errorf("Error recording a retried write once: got %v", lines)
+	}
+}
+
+// failingWriter refuses every write, as a full disk would.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+func TestAdldapAuditConn_failingLog(t *testing.T) {
+	client, directory := newFakeClient(t)
+	client.Conn = &auditConn{Client: directory, log: &auditLog{w: failingWriter{}}}
+	ctx := context.Background()
+
+	request := ldap.NewModifyRequest("CN=Users,"+fakeDomainDN, nil)
+	request.Replace("description", []string{"Unaudited"})
+	err := modifyContext(ctx, client.Conn, request)
+	if err == nil || !strings.Contains(err.Error(), "succeeded") || !strings.Contains(err.Error(), "no space left") {
+		t.Errorf("Error reporting an unrecorded write: got %v", err)
+	}
+
+	// Both the refused write and the failed record are returned
+	err = delContext(ctx, client.Conn, ldap.NewDelRequest("CN=Missing,"+fakeDomainDN, nil))
+	if err == nil || !IsNotFound(err) || !strings.Contains(err.Error(), "no space left") {
+		t.Errorf("Error reporting a refused, unrecorded write: got %v", err)
+	}
+}
+
+func TestAdldapWhoAmI(t *testing.T) {
+	_, directory := newFakeClient(t)
+	ctx := context.Background()
+
+	for authzID, expected := range map[string]string{
+		"dn:CN=Terraform,CN=Users," + fakeDomainDN: "CN=Terraform,CN=Users," + fakeDomainDN,
+		`u:EXAMPLE\terraform`:                      `u:EXAMPLE\terraform`,
+	} {
+		directory.authzID = authzID
+		if who, err := whoAmI(ctx, directory); err != nil || who != expected {
+			t.Errorf("Error reading Who Am I's %s: got %q, %v", authzID, who, err)
+		}
+	}
+	if _, err := whoAmI(ctx, &dnCacheConn{Client: directory}); err == nil {
+		t.Error("Error refusing a connection without Who Am I: got no error")
+	}
+}
+
+func TestAdldapClientNew_auditOperator(t *testing.T) {
+	_, directory := newFakeClient(t)
+	directory.authzID = "dn:CN=Terraform,CN=Users," + fakeDomainDN
+	dial := dialClient
+	dialClient = func(context.Context, string) (ldap.Client, error) { return directory, nil }
+	defer func() { dialClient = dial }()
+
+	client := &LdapClient{auditLog: &auditLog{w: &bytes.Buffer{}}}
+	if err := client.New(context.Background(), "ldap://dc1.example.com", "terraform@example.com", "Passw0rd!", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if audit, ok := client.Conn.(*auditConn); !ok || audit.operator != "CN=Terraform,CN=Users,"+fakeDomainDN {
+		t.Errorf("Error recording the operator from Who Am I: got %v", client.Conn)
+	}
+}
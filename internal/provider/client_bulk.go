@@ -0,0 +1,206 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	uac "github.com/audibleblink/msldapuac"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// defaultBulkParallelism is how many operations bulk resources have in flight
+// at once unless configured otherwise.
+const defaultBulkParallelism = 10
+
+// bulkPagingSize is the page size of the searches bulk resources read their
+// objects with, below AD's default MaxPageSize of 1000.
+const bulkPagingSize = 500
+
+// runBatch calls operation for each key, with at most parallelism calls in
+// flight at once, and returns the errors by key.  go-ldap multiplexes
+// concurrent requests over the one connection, so a batch takes about as
+// many round trips as its slowest lane rather than one per key.  Keys not yet
+// started when the context ends fail with its error.
+func runBatch(ctx context.Context, keys []string, parallelism int, operation func(key string) error) map[string]error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallelism)
+	for _, key := range keys {
+		slots <- struct{}{}
+		if err := ctx.Err(); err != nil {
+			<-slots
+			mu.Lock()
+			errs[key] = err
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := operation(key); err != nil {
+				mu.Lock()
+				errs[key] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// AddUserAccount creates the user with a single add that also sets its
+// password and whether it is enabled, and returns its DN without reading it
+// back, for creating users in bulk.  AD only accepts the password over an
+// encrypted connection, and only enables users with one that meets the
+// password policy.
+func (c *LdapClient) AddUserAccount(ctx context.Context, sAMAccountName string, password string, ou string, enabled bool, attributes map[string][]string) (string, error) {
+	dn := accountDN(sAMAccountName, ou, attributes)
+
+	var userAccountControl int64 = uac.NormalAccount
+	if !enabled {
+		userAccountControl |= uac.Accountdisable
+	}
+	accountControl, err := c.accountControlValues(userAccountControl)
+	if err != nil {
+		return dn, err
+	}
+
+	request := ldap.NewAddRequest(dn, nil)
+	request.Attribute("objectClass", []string{objectClassUser})
+	request.Attribute(c.accountNameAttribute(), []string{sAMAccountName})
+	for _, name := range sortedKeys(accountControl) {
+		request.Attribute(name, accountControl[name])
+	}
+	if password != "" {
+		passwordEncoded, err := encodePassword(password)
+		if err != nil {
+			return dn, err
+		}
+		request.Attribute("unicodePwd", []string{passwordEncoded})
+	}
+
+	for _, name := range sortedKeys(attributes) {
+		request.Attribute(name, attributes[name])
+	}
+
+	err = addContext(ctx, c.Conn, request)
+	if IsAlreadyExists(err) {
+		return dn, fmt.Errorf("object \"%s\" already exists: %w", dn, err)
+	}
+
+	return dn, err
+}
+
+// sortedKeys returns the names of the attributes in alphabetical order.
+func sortedKeys(attributes map[string][]string) []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetUsersByGUID reads the users with the objectGUIDs with a single paged
+// search, keyed by objectGUID.  Users that aren't found are left out.
+func (c *LdapClient) GetUsersByGUID(ctx context.Context, guids []string, attributes []string) (map[string]*LdapAccount, error) {
+	filterValues := make([]string, 0, len(guids))
+	for _, guid := range guids {
+		objectGUID, err := parseGUID(guid)
+		if err != nil {
+			return nil, err
+		}
+		filterValues = append(filterValues, guidFilterValue(objectGUID))
+	}
+
+	accounts, err := c.searchAccountsBy(ctx, objectClassUser, "objectGUID", filterValues, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]*LdapAccount, len(accounts))
+	for _, account := range accounts {
+		users[formatGUID(account.Entry.GetRawAttributeValue("objectGUID"))] = account
+	}
+
+	return users, nil
+}
+
+// GetUsersBySAMAccountName reads the users with the sAMAccountNames, or in AD
+// LDS userPrincipalNames, with a single paged search, keyed by lowercase
+// name.  Users that aren't found are left out.
+func (c *LdapClient) GetUsersBySAMAccountName(ctx context.Context, sAMAccountNames []string, attributes []string) (map[string]*LdapAccount, error) {
+	filterValues := make([]string, 0, len(sAMAccountNames))
+	for _, sAMAccountName := range sAMAccountNames {
+		filterValues = append(filterValues, ldap.EscapeFilter(sAMAccountName))
+	}
+
+	accounts, err := c.searchAccountsBy(ctx, objectClassUser, c.accountNameAttribute(), filterValues, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]*LdapAccount, len(accounts))
+	for _, account := range accounts {
+		users[strings.ToLower(account.Entry.GetAttributeValue(c.accountNameAttribute()))] = account
+	}
+
+	return users, nil
+}
+
+// searchAccountsBy finds the accounts of the class whose attribute has any of
+// the values, already escaped for the filter, with a single paged search
+// beneath the search base.  The attribute is always read.
+func (c *LdapClient) searchAccountsBy(ctx context.Context, objectClass string, searchField string, filterValues []string, attributes []string) ([]*LdapAccount, error) {
+	if len(filterValues) == 0 {
+		return nil, nil
+	}
+	if !sliceContainsFold(attributes, searchField) {
+		attributes = append(append([]string{}, attributes...), searchField)
+	}
+
+	var filter strings.Builder
+	fmt.Fprintf(&filter, "(&(objectClass=%s)(|", objectClass)
+	for _, filterValue := range filterValues {
+		fmt.Fprintf(&filter, "(%s=%s)", searchField, filterValue)
+	}
+	filter.WriteString("))")
+
+	searchRequest := ldap.NewSearchRequest(
+		c.SearchBase,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter.String(),
+		attributes,
+		searchControls(attributes),
+	)
+	result, err := searchWithPagingContext(ctx, c.Conn, searchRequest, bulkPagingSize)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*LdapAccount, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		accounts = append(accounts, &LdapAccount{
+			LdapEntry: &LdapEntry{
+				LdapClient:          c,
+				Entry:               entry,
+				requestedAttributes: attributes,
+			},
+		})
+	}
+
+	return accounts, nil
+}
@@ -0,0 +1,230 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// LDAP_SERVER_DIRSYNC_OID returns the objects in a naming context changed
+	// since the cookie from an earlier DirSync search, with only the
+	// attributes that changed.
+	controlTypeDirSync = "1.2.840.113556.1.4.841"
+	// LDAP_DIRSYNC_OBJECT_SECURITY returns only the objects and attributes
+	// the bind account can read, instead of requiring the Replicating
+	// Directory Changes right.
+	dirSyncObjectSecurity = 0x00000001
+	// The most bytes a DirSync search returns before leaving the rest for the
+	// next search
+	dirSyncMaxBytes = 0x7FFFFFFF
+)
+
+// Attributes change searches always read, to identify the objects
+var changeAttributes = []string{"objectGUID", "uSNChanged", "isDeleted"}
+
+// ChangedObject is an object found by a change search, with the attributes
+// read, or for DirSync those that changed.
+type ChangedObject struct {
+	DN         string
+	ObjectGUID string
+	USNChanged int64
+	Deleted    bool
+	Attributes map[string][][]byte
+}
+
+// HighestCommittedUSN returns the highest update sequence number the domain
+// controller has committed.  USNs are local to each domain controller.
+func (c *LdapClient) HighestCommittedUSN(ctx context.Context) (int64, error) {
+	searchRequest := ldap.NewSearchRequest(
+		"",
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"highestCommittedUSN"},
+		nil,
+	)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Entries) == 0 {
+		return 0, &NotFoundError{ObjectClass: "rootDSE", Name: "highestCommittedUSN"}
+	}
+
+	value := result.Entries[0].GetAttributeValue("highestCommittedUSN")
+	usn, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing highestCommittedUSN \"%s\": %s", value, err)
+	}
+	return usn, nil
+}
+
+// ChangesSinceUSN returns the objects beneath the base DN matching the filter
+// whose uSNChanged is above the USN, oldest change first, along with the
+// highestCommittedUSN read before searching, to pass as the USN next time.
+// Deleted objects are only returned with includeDeleted, and only while
+// their tombstones last.
+func (c *LdapClient) ChangesSinceUSN(ctx context.Context, baseDN string, filter string, usn int64, attributes []string, includeDeleted bool) ([]*ChangedObject, int64, error) {
+	highestUSN, err := c.HighestCommittedUSN(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	requested := changeRequestAttributes(attributes)
+	controls := searchControls(requested)
+	if includeDeleted {
+		controls = append(controls, showDeletedControls()...)
+	}
+	searchRequest := ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(&(uSNChanged>=%d)%s)", usn+1, filter),
+		requested,
+		controls,
+	)
+	result, err := searchWithPagingContext(ctx, c.Conn, searchRequest, bulkPagingSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	objects := changedObjects(result.Entries, attributes)
+	sort.SliceStable(objects, func(i, j int) bool { return objects[i].USNChanged < objects[j].USNChanged })
+
+	return objects, highestUSN, nil
+}
+
+// ChangesSinceCookie runs DirSync searches of the naming context at the base
+// DN, from the cookie of an earlier one or from the start without one, until
+// the server has nothing more, and returns the objects changed and the cookie
+// to pass next time.  Deleted objects are always returned.  Without
+// objectSecurity the bind account needs the Replicating Directory Changes
+// right on the naming context.
+func (c *LdapClient) ChangesSinceCookie(ctx context.Context, baseDN string, filter string, cookie []byte, attributes []string, objectSecurity bool) ([]*ChangedObject, []byte, error) {
+	var flags int64
+	if objectSecurity {
+		flags |= dirSyncObjectSecurity
+	}
+	requested := changeRequestAttributes(attributes)
+
+	var objects []*ChangedObject
+	for {
+		searchRequest := ldap.NewSearchRequest(
+			baseDN,
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			filter,
+			requested,
+			append(searchControls(requested), dirSyncControl(flags, cookie)),
+		)
+		result, err := searchContext(ctx, c.Conn, searchRequest)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, changedObjects(result.Entries, attributes)...)
+
+		var moreResults bool
+		control := ldap.FindControl(result.Controls, controlTypeDirSync)
+		if control == nil {
+			return nil, nil, fmt.Errorf("the server returned no DirSync cookie")
+		}
+		moreResults, cookie, err = parseDirSyncResponse(control)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !moreResults {
+			break
+		}
+	}
+
+	return objects, cookie, nil
+}
+
+// dirSyncControl returns the DirSync request control for the cookie.
+func dirSyncControl(flags int64, cookie []byte) ldap.Control {
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "DirSyncRequestValue")
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, flags, "Flags"))
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(dirSyncMaxBytes), "MaxBytes"))
+	value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(cookie), "Cookie"))
+
+	return ldap.NewControlString(controlTypeDirSync, true, string(value.Bytes()))
+}
+
+// parseDirSyncResponse reads whether more changes are waiting, and the cookie
+// to continue from, from a DirSync response control.
+func parseDirSyncResponse(control ldap.Control) (bool, []byte, error) {
+	controlString, ok := control.(*ldap.ControlString)
+	if !ok {
+		return false, nil, fmt.Errorf("unexpected DirSync response control %T", control)
+	}
+	packet, err := ber.DecodePacketErr([]byte(controlString.ControlValue))
+	if err != nil {
+		return false, nil, fmt.Errorf("error decoding DirSync response: %s", err)
+	}
+	if len(packet.Children) != 3 {
+		return false, nil, fmt.Errorf("error decoding DirSync response: expected 3 values, got %d", len(packet.Children))
+	}
+
+	moreResults, ok := packet.Children[0].Value.(int64)
+	if !ok {
+		return false, nil, fmt.Errorf("error decoding DirSync response: MoreResults is not an integer")
+	}
+	return moreResults != 0, packet.Children[2].Data.Bytes(), nil
+}
+
+// changeRequestAttributes adds the attributes identifying changed objects to
+// those requested, which are all user attributes when none are.
+func changeRequestAttributes(attributes []string) []string {
+	requested := append([]string{}, attributes...)
+	if len(requested) == 0 {
+		requested = append(requested, "*")
+	}
+	for _, attribute := range changeAttributes {
+		if !sliceContainsFold(requested, attribute) {
+			requested = append(requested, attribute)
+		}
+	}
+	return requested
+}
+
+// changedObjects converts search results, leaving out of each object's
+// attributes those read only to identify it.
+func changedObjects(entries []*ldap.Entry, attributes []string) []*ChangedObject {
+	objects := make([]*ChangedObject, 0, len(entries))
+	for _, entry := range entries {
+		usn, _ := strconv.ParseInt(entry.GetAttributeValue("uSNChanged"), 10, 64)
+		object := &ChangedObject{
+			DN:         entry.DN,
+			ObjectGUID: formatGUID(entry.GetRawAttributeValue("objectGUID")),
+			USNChanged: usn,
+			Deleted:    entry.GetAttributeValue("isDeleted") == "TRUE",
+			Attributes: make(map[string][][]byte),
+		}
+		for _, attribute := range entry.Attributes {
+			if sliceContainsFold(changeAttributes, attribute.Name) && !sliceContainsFold(attributes, attribute.Name) {
+				continue
+			}
+			object.Attributes[attribute.Name] = attribute.ByteValues
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// attributeValueString returns an attribute value as text, or base64-encoded
+// if it isn't valid UTF-8 text, as for binary values such as objectGUID.
+func attributeValueString(value []byte) string {
+	if !utf8.Valid(value) {
+		return base64.StdEncoding.EncodeToString(value)
+	}
+	for _, r := range string(value) {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return base64.StdEncoding.EncodeToString(value)
+		}
+	}
+	return string(value)
+}
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// dialContext connects to the LDAP URL, giving up at the context's deadline.
+func dialContext(ctx context.Context, url string) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: ldap.DefaultTimeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	return ldap.DialURL(url, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+}
+
+// dialClient connects New to the LDAP URL; tests swap it for a fake directory.
+var dialClient = func(ctx context.Context, url string) (ldap.Client, error) {
+	conn, err := dialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// doContext runs a directory operation, returning the context's error as soon
+// as it is cancelled or its deadline passes.  go-ldap can't abandon a request
+// in flight, so an operation cut short this way still completes on the server.
+func doContext(ctx context.Context, operation func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		return operation()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- operation()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func searchContext(ctx context.Context, conn ldap.Client, request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	var result *ldap.SearchResult
+	err := doContext(ctx, func() error {
+		var err error
+		result, err = conn.Search(request)
+		return err
+	})
+	if err != nil {
+		return result, &LdapOperationError{Operation: "search", DN: request.BaseDN, Filter: request.Filter, Err: err}
+	}
+	return result, nil
+}
+
+// searchWithPagingContext is searchContext for searches that may return more
+// entries than the server's page size.
+func searchWithPagingContext(ctx context.Context, conn ldap.Client, request *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	var result *ldap.SearchResult
+	err := doContext(ctx, func() error {
+		var err error
+		result, err = conn.SearchWithPaging(request, pagingSize)
+		return err
+	})
+	if err != nil {
+		return result, &LdapOperationError{Operation: "search", DN: request.BaseDN, Filter: request.Filter, Err: err}
+	}
+	return result, nil
+}
+
+func bindContext(ctx context.Context, conn ldap.Client, username string, password string) error {
+	err := doContext(ctx, func() error { return conn.Bind(username, password) })
+	if err != nil {
+		return &LdapOperationError{Operation: "bind as", DN: username, Err: err}
+	}
+	return nil
+}
+
+func addContext(ctx context.Context, conn ldap.Client, request *ldap.AddRequest) error {
+	attempts, err := retryContext(ctx, func() error { return conn.Add(request) })
+	if err != nil {
+		err = &LdapOperationError{Operation: "add", DN: request.DN, Err: err}
+	}
+	if audit, ok := conn.(*auditConn); ok {
+		return audit.record(auditAddRecord(request), attempts, err)
+	}
+	return err
+}
+
+func modifyContext(ctx context.Context, conn ldap.Client, request *ldap.ModifyRequest) error {
+	attempts, err := retryContext(ctx, func() error { return conn.Modify(request) })
+	if err != nil {
+		err = &LdapOperationError{Operation: "modify", DN: request.DN, Err: err}
+	}
+	if audit, ok := conn.(*auditConn); ok {
+		return audit.record(auditModifyRecord(request), attempts, err)
+	}
+	return err
+}
+
+func modifyDNContext(ctx context.Context, conn ldap.Client, request *ldap.ModifyDNRequest) error {
+	attempts, err := retryContext(ctx, func() error { return conn.ModifyDN(request) })
+	if err != nil {
+		err = &LdapOperationError{Operation: "rename", DN: request.DN, Err: err}
+	}
+	if audit, ok := conn.(*auditConn); ok {
+		return audit.record(auditModifyDNRecord(request), attempts, err)
+	}
+	return err
+}
+
+func delContext(ctx context.Context, conn ldap.Client, request *ldap.DelRequest) error {
+	err := doContext(ctx, func() error { return conn.Del(request) })
+	if err != nil {
+		err = &LdapOperationError{Operation: "delete", DN: request.DN, Err: err}
+	}
+	if audit, ok := conn.(*auditConn); ok {
+		return audit.record(auditRecord{Operation: "delete", DN: request.DN}, 1, err)
+	}
+	return err
+}
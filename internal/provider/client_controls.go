@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"github.com/go-ldap/ldap/v3"
+)
+
+// controlsConn attaches extra controls to every add, modify, rename, and
+// delete.  Each request is copied first, so the controls aren't added again
+// when an operation is retried.
+type controlsConn struct {
+	ldap.Client
+	controls []*ldap.ControlString
+}
+
+func (c *controlsConn) withControls(controls []ldap.Control) []ldap.Control {
+	withControls := append([]ldap.Control{}, controls...)
+	for _, control := range c.controls {
+		withControls = append(withControls, control)
+	}
+	return withControls
+}
+
+func (c *controlsConn) Add(request *ldap.AddRequest) error {
+	withControls := *request
+	withControls.Controls = c.withControls(request.Controls)
+	return c.Client.Add(&withControls)
+}
+
+func (c *controlsConn) Modify(request *ldap.ModifyRequest) error {
+	withControls := *request
+	withControls.Controls = c.withControls(request.Controls)
+	return c.Client.Modify(&withControls)
+}
+
+func (c *controlsConn) ModifyDN(request *ldap.ModifyDNRequest) error {
+	withControls := *request
+	withControls.Controls = c.withControls(request.Controls)
+	return c.Client.ModifyDN(&withControls)
+}
+
+func (c *controlsConn) Del(request *ldap.DelRequest) error {
+	withControls := *request
+	withControls.Controls = c.withControls(request.Controls)
+	return c.Client.Del(&withControls)
+}
+
+// WithControls returns a copy of the client whose writes carry the controls,
+// such as a resource's ldap_controls.  Searches are sent unchanged.  The
+// controls are attached beneath the audit connection, which must stay
+// outermost to record each write once.
+func (c *LdapClient) WithControls(controls []*ldap.ControlString) *LdapClient {
+	if len(controls) == 0 {
+		return c
+	}
+	withControls := *c
+	if audit, ok := c.Conn.(*auditConn); ok {
+		withAudit := *audit
+		withAudit.Client = &controlsConn{Client: audit.Client, controls: controls}
+		withControls.Conn = &withAudit
+		return &withControls
+	}
+	withControls.Conn = &controlsConn{Client: c.Conn, controls: controls}
+	return &withControls
+}
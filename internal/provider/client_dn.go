@@ -2,6 +2,7 @@ package provider
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/go-ldap/ldap/v3"
@@ -14,12 +15,109 @@ type LdapDN struct {
 func JoinRDNs(rdns []*ldap.RelativeDN) string {
 	var segments []string
 	for _, rdn := range rdns {
-		segment := fmt.Sprintf("%s=%s", rdn.Attributes[0].Type, rdn.Attributes[0].Value)
+		segment := fmt.Sprintf("%s=%s", rdn.Attributes[0].Type, escapeRDNValue(rdn.Attributes[0].Value))
 		segments = append(segments, segment)
 	}
 	return strings.Join(segments, ",")
 }
 
+// escapeRDNValue escapes an attribute value for use in a DN, per RFC 4514.
+func escapeRDNValue(value string) string {
+	var sb strings.Builder
+	for i, r := range value {
+		if strings.ContainsRune(`,+"\<>;=`, r) ||
+			i == 0 && (r == ' ' || r == '#') ||
+			i == len(value)-1 && r == ' ' {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// normalizeDN returns a canonical form of a DN for comparison, ignoring case
+// and insignificant whitespace.  Values that do not parse are returned as is.
+func normalizeDN(distinguishedName string) string {
+	dn, err := ldap.ParseDN(distinguishedName)
+	if err != nil {
+		return distinguishedName
+	}
+
+	var segments []string
+	for _, rdn := range dn.RDNs {
+		var attributes []string
+		for _, attribute := range rdn.Attributes {
+			attributes = append(attributes, strings.ToUpper(attribute.Type)+"="+escapeRDNValue(strings.ToLower(attribute.Value)))
+		}
+		segments = append(segments, strings.Join(attributes, "+"))
+	}
+	return strings.Join(segments, ",")
+}
+
+func dnsEqual(a string, b string) bool {
+	return normalizeDN(a) == normalizeDN(b)
+}
+
+// dnIsDescendant reports whether dn lies beneath ancestor, ignoring case and
+// insignificant whitespace.
+func dnIsDescendant(dn string, ancestor string) bool {
+	return strings.HasSuffix(normalizeDN(dn), ","+normalizeDN(ancestor))
+}
+
+// An RDN attribute type, such as OU or CN
+var attributeTypeRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// dnFromCanonicalName converts a canonical name, such as
+// example.com/Corp/Users, to a DN, naming each container beneath the domain
+// with the RDN type, such as OU.  As in AD's canonicalName, "\/" is a slash
+// within a container's name.
+func dnFromCanonicalName(canonicalName string, rdnType string) (string, error) {
+	if !attributeTypeRegexp.MatchString(rdnType) {
+		return "", fmt.Errorf("\"%s\" is not a valid RDN type", rdnType)
+	}
+
+	var names []string
+	var name strings.Builder
+	for i := 0; i < len(canonicalName); i++ {
+		switch {
+		case canonicalName[i] == '\\' && i+1 < len(canonicalName) && canonicalName[i+1] == '/':
+			name.WriteByte('/')
+			i++
+		case canonicalName[i] == '/':
+			names = append(names, name.String())
+			name.Reset()
+		default:
+			name.WriteByte(canonicalName[i])
+		}
+	}
+	names = append(names, name.String())
+
+	domain := strings.TrimSuffix(names[0], ".")
+	if domain == "" {
+		return "", fmt.Errorf("\"%s\" has no domain", canonicalName)
+	}
+	// A trailing slash names the domain itself
+	if len(names) > 1 && names[len(names)-1] == "" {
+		names = names[:len(names)-1]
+	}
+
+	var segments []string
+	for i := len(names) - 1; i > 0; i-- {
+		if names[i] == "" {
+			return "", fmt.Errorf("\"%s\" has an empty container name", canonicalName)
+		}
+		segments = append(segments, rdnType+"="+escapeRDNValue(names[i]))
+	}
+	for _, component := range strings.Split(domain, ".") {
+		if component == "" {
+			return "", fmt.Errorf("\"%s\" has an invalid domain", canonicalName)
+		}
+		segments = append(segments, "DC="+escapeRDNValue(component))
+	}
+
+	return strings.Join(segments, ","), nil
+}
+
 func NewLdapDN(distinguishedName string) (LdapDN, error) {
 	parsedDN, err := ldap.ParseDN(distinguishedName)
 	if err != nil {
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// dnCache remembers the DN each sAMAccountName lookup found, for the life of
+// the provider process, so that an account several resources refer to in one
+// run is looked up with a base search of its DN rather than a search of the
+// whole subtree.  A nil cache caches nothing.
+type dnCache struct {
+	mu  sync.Mutex
+	dns map[string]string // Lower-cased sAMAccountName to DN
+}
+
+func newDNCache() *dnCache {
+	return &dnCache{dns: map[string]string{}}
+}
+
+func (d *dnCache) get(sAMAccountName string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dn, ok := d.dns[strings.ToLower(sAMAccountName)]
+	return dn, ok
+}
+
+func (d *dnCache) put(sAMAccountName string, dn string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dns[strings.ToLower(sAMAccountName)] = dn
+}
+
+func (d *dnCache) forget(sAMAccountName string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.dns, strings.ToLower(sAMAccountName))
+}
+
+// forgetDN forgets the accounts at or beneath the DN, which moves with
+// everything it contains.
+func (d *dnCache) forgetDN(dn string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for sAMAccountName, cached := range d.dns {
+		if dnsEqual(cached, dn) || dnIsDescendant(cached, dn) {
+			delete(d.dns, sAMAccountName)
+		}
+	}
+}
+
+// dnCacheConn keeps a dnCache current with the client's own writes, forgetting
+// accounts that are renamed, moved, or deleted, or whose sAMAccountName, or
+// in AD LDS userPrincipalName, changes.  Changes made outside the provider are
+// caught when the base search of a cached DN finds nothing.
+type dnCacheConn struct {
+	ldap.Client
+	cache *dnCache
+}
+
+func (c *dnCacheConn) Modify(request *ldap.ModifyRequest) error {
+	for _, change := range request.Changes {
+		if strings.EqualFold(change.Modification.Type, "sAMAccountName") || strings.EqualFold(change.Modification.Type, "userPrincipalName") {
+			c.cache.forgetDN(request.DN)
+		}
+	}
+	return c.Client.Modify(request)
+}
+
+func (c *dnCacheConn) ModifyDN(request *ldap.ModifyDNRequest) error {
+	c.cache.forgetDN(request.DN)
+	return c.Client.ModifyDN(request)
+}
+
+func (c *dnCacheConn) Del(request *ldap.DelRequest) error {
+	c.cache.forgetDN(request.DN)
+	return c.Client.Del(request)
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LdapDomainInfo holds the domain details a machine needs to join offline.
+type LdapDomainInfo struct {
+	DNSName              string
+	NetBIOSName          string
+	GUID                 string
+	SID                  string
+	ForestDNSName        string
+	DomainControllerName string
+}
+
+// dnToDNSName converts the DC components of a naming context DN, such as
+// DC=example,DC=com, to a DNS name.
+func dnToDNSName(distinguishedName string) (string, error) {
+	dn, err := ldap.ParseDN(distinguishedName)
+	if err != nil {
+		return "", err
+	}
+
+	var labels []string
+	for _, rdn := range dn.RDNs {
+		for _, attribute := range rdn.Attributes {
+			if strings.EqualFold(attribute.Type, "DC") {
+				labels = append(labels, attribute.Value)
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return "", fmt.Errorf("%s has no DC components", distinguishedName)
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+func (c *LdapClient) GetDomainInfo(ctx context.Context) (*LdapDomainInfo, error) {
+	searchRequest := ldap.NewSearchRequest(
+		"", // The base dn to search
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"defaultNamingContext", "configurationNamingContext", "rootDomainNamingContext", "dnsHostName"},
+		nil,
+	)
+
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	rootDSE := result.Entries[0]
+	defaultNamingContext := rootDSE.GetAttributeValue("defaultNamingContext")
+
+	info := &LdapDomainInfo{
+		DomainControllerName: rootDSE.GetAttributeValue("dnsHostName"),
+	}
+	info.DNSName, err = dnToDNSName(defaultNamingContext)
+	if err != nil {
+		return nil, err
+	}
+	info.ForestDNSName, err = dnToDNSName(rootDSE.GetAttributeValue("rootDomainNamingContext"))
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := c.GetObjectByDN(ctx, defaultNamingContext, []string{"objectGUID", "objectSid"})
+	if err != nil {
+		return nil, err
+	}
+	info.GUID, err = domain.GetObjectGUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info.SID, err = domain.GetObjectSID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The NetBIOS name lives on the domain's crossRef in the Partitions container
+	searchRequest = ldap.NewSearchRequest(
+		"CN=Partitions,"+rootDSE.GetAttributeValue("configurationNamingContext"),
+		ldap.ScopeSingleLevel, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(&(objectClass=crossRef)(nCName=%s))", ldap.EscapeFilter(defaultNamingContext)),
+		[]string{"nETBIOSName"},
+		nil,
+	)
+	result, err = searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("crossRef for %s not found", defaultNamingContext)
+	}
+	info.NetBIOSName = result.Entries[0].GetAttributeValue("nETBIOSName")
+
+	return info, nil
+}
@@ -0,0 +1,232 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Trust attributes of trustedDomain objects
+const (
+	trustDirectionInbound = 0x1 // The other domain trusts this one
+	trustTypeUplevel      = 0x2 // The other domain is an Active Directory domain
+	crossRefNTDSDomain    = 0x2 // FLAG_CR_NTDS_DOMAIN: the crossRef is a domain's
+)
+
+// domainConfig is how to connect to a domain other than the provider's own.
+// Empty fields are taken from the provider's connection.
+type domainConfig struct {
+	Name         string // The domain's DNS name
+	URL          string
+	SearchBase   string
+	BindAccount  string
+	BindPassword string
+}
+
+// domainRouter holds the provider's connections to other domains, each
+// dialed the first time a resource asks for its domain.
+type domainRouter struct {
+	mu         sync.Mutex
+	configs    []domainConfig
+	discover   bool                   // Also connect to domains in the forest or trusting this one
+	discovered []string               // DNS names of the domains found, read on first use
+	clients    map[string]*LdapClient // Keyed by lowercase DNS name
+}
+
+func newDomainRouter(configs []domainConfig, discover bool) *domainRouter {
+	return &domainRouter{
+		configs:  configs,
+		discover: discover,
+		clients:  map[string]*LdapClient{},
+	}
+}
+
+// ForDomain returns the client for the domain with the DNS name: the client
+// itself for its own domain or an empty name, or else a connection to a
+// domain configured in the provider, or with discover_domains, one in the
+// forest or trusting the client's domain.
+func (c *LdapClient) ForDomain(ctx context.Context, domain string) (*LdapClient, error) {
+	if domain == "" {
+		return c, nil
+	}
+	if c.IsADLDS() {
+		return nil, fmt.Errorf("AD LDS instances have no domains, so domain \"%s\" can't be used", domain)
+	}
+	domain = strings.TrimSuffix(domain, ".")
+
+	defaultNamingContext, err := c.DefaultNamingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ownDomain, err := dnToDNSName(defaultNamingContext)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(domain, ownDomain) {
+		return c, nil
+	}
+	if c.domains == nil {
+		return nil, fmt.Errorf("domain %s isn't configured in the provider", domain)
+	}
+
+	return c.domains.client(ctx, c, domain)
+}
+
+func (r *domainRouter) client(ctx context.Context, c *LdapClient, domain string) (*LdapClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if client, ok := r.clients[strings.ToLower(domain)]; ok {
+		return client, nil
+	}
+
+	config, ok := r.config(domain)
+	if !ok {
+		if !r.discover {
+			return nil, fmt.Errorf("domain %s isn't configured in the provider; add a domain block for it or set discover_domains", domain)
+		}
+		if r.discovered == nil {
+			discovered, err := c.DiscoverDomains(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error discovering domains: %s", err)
+			}
+			r.discovered = discovered
+		}
+		if !sliceContainsFold(r.discovered, domain) {
+			return nil, fmt.Errorf("domain %s isn't configured in the provider, in the forest, or trusting the provider's domain", domain)
+		}
+		config = domainConfig{Name: domain}
+	}
+
+	client, err := c.connectDomain(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to domain %s: %s", domain, err)
+	}
+	r.clients[strings.ToLower(domain)] = client
+
+	return client, nil
+}
+
+func (r *domainRouter) config(domain string) (domainConfig, bool) {
+	for _, config := range r.configs {
+		if strings.EqualFold(strings.TrimSuffix(config.Name, "."), domain) {
+			return config, true
+		}
+	}
+	return domainConfig{}, false
+}
+
+// connectDomain returns a client bound to another domain, with the client's
+// settings and credentials where the domain's configuration has none.
+func (c *LdapClient) connectDomain(ctx context.Context, config domainConfig) (*LdapClient, error) {
+	domainURL := config.URL
+	if domainURL == "" {
+		var err error
+		domainURL, err = domainLdapURL(c.LdapURL, config.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	bindAccount, bindPassword := config.BindAccount, config.BindPassword
+	if bindAccount == "" {
+		bindAccount, bindPassword = c.bindAccount, c.bindPassword
+	}
+
+	client := new(LdapClient)
+	client.ReplicationWait = c.ReplicationWait
+	client.AllowedBaseDNs = c.AllowedBaseDNs
+	client.DirectoryType = c.DirectoryType
+	client.auditLog = c.auditLog
+
+	err := client.New(ctx, domainURL, bindAccount, bindPassword, config.SearchBase, c.ActIdempotently)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// domainLdapURL returns the URL for a domain's DNS name, which resolves to
+// its domain controllers, with the scheme and port of the LDAP URL.
+func domainLdapURL(ldapURL string, domain string) (string, error) {
+	u, err := url.Parse(ldapURL)
+	if err != nil {
+		return "", err
+	}
+
+	host := domain
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	return u.String(), nil
+}
+
+// DiscoverDomains returns the DNS names of the other domains in the forest,
+// from their crossRefs, and of the Active Directory domains that trust the
+// client's, from its trustedDomain objects.
+func (c *LdapClient) DiscoverDomains(ctx context.Context) ([]string, error) {
+	searchRequest := ldap.NewSearchRequest(
+		"",
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"defaultNamingContext", "configurationNamingContext"},
+		nil,
+	)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) == 0 {
+		return nil, &NotFoundError{ObjectClass: "rootDSE", Name: "configurationNamingContext"}
+	}
+	rootDSE := result.Entries[0]
+
+	var domains []string
+	searchRequest = ldap.NewSearchRequest(
+		"CN=Partitions,"+rootDSE.GetAttributeValue("configurationNamingContext"),
+		ldap.ScopeSingleLevel, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=crossRef)(dnsRoot=*))",
+		[]string{"dnsRoot", "systemFlags"},
+		nil,
+	)
+	result, err = searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the forest's domains: %w", err)
+	}
+	for _, entry := range result.Entries {
+		systemFlags, _ := strconv.ParseInt(entry.GetAttributeValue("systemFlags"), 10, 64)
+		if systemFlags&crossRefNTDSDomain != 0 {
+			domains = append(domains, entry.GetAttributeValue("dnsRoot"))
+		}
+	}
+
+	searchRequest = ldap.NewSearchRequest(
+		"CN=System,"+rootDSE.GetAttributeValue("defaultNamingContext"),
+		ldap.ScopeSingleLevel, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=trustedDomain)",
+		[]string{"trustPartner", "trustDirection", "trustType"},
+		nil,
+	)
+	result, err = searchContext(ctx, c.Conn, searchRequest)
+	if err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("error reading the domain's trusts: %w", err)
+	}
+	if result != nil {
+		for _, entry := range result.Entries {
+			trustDirection, _ := strconv.ParseInt(entry.GetAttributeValue("trustDirection"), 10, 64)
+			trustType, _ := strconv.ParseInt(entry.GetAttributeValue("trustType"), 10, 64)
+			if trustDirection&trustDirectionInbound != 0 && trustType == trustTypeUplevel && !sliceContainsFold(domains, entry.GetAttributeValue("trustPartner")) {
+				domains = append(domains, entry.GetAttributeValue("trustPartner"))
+			}
+		}
+	}
+
+	return domains, nil
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+const fakeChildDomainDN = "DC=emea,DC=example,DC=com"
+
+// newFakeForestClient returns a client for the forest root domain whose
+// provider configures the emea child domain, already connected to its own
+// fake directory.
+func newFakeForestClient(t *testing.T) (*LdapClient, *fakeDirectory, *fakeDirectory) {
+	t.Helper()
+
+	client, directory := newFakeClient(t)
+	child, childDirectory := newFakeDomainClient(t, fakeChildDomainDN, "S-1-5-21-2203491712-3471849402-1592314850")
+	client.domains = newDomainRouter([]domainConfig{{Name: "emea.example.com"}}, false)
+	client.domains.clients["emea.example.com"] = child
+
+	return client, directory, childDirectory
+}
+
+func TestAdldapForDomain(t *testing.T) {
+	client, _, _ := newFakeForestClient(t)
+	ctx := context.Background()
+
+	for _, domain := range []string{"", "example.com", "EXAMPLE.com."} {
+		if c, err := client.ForDomain(ctx, domain); err != nil || c != client {
+			t.Errorf("Error routing %q to the provider's domain: got %v", domain, err)
+		}
+	}
+	child, err := client.ForDomain(ctx, "EMEA.example.com")
+	if err != nil || child.SearchBase != fakeChildDomainDN {
+		t.Errorf("Error routing to a configured domain: got %v", err)
+	}
+	if _, err := client.ForDomain(ctx, "apac.example.com"); err == nil || !strings.Contains(err.Error(), "discover_domains") {
+		t.Errorf("Error refusing an unconfigured domain: got %v", err)
+	}
+
+	// Discovered domains must be in the forest or trust the provider's
+	client.domains.discover = true
+	client.domains.discovered = []string{"apac.example.com"}
+	if _, err := client.ForDomain(ctx, "contoso.com"); err == nil || !strings.Contains(err.Error(), "in the forest") {
+		t.Errorf("Error refusing an undiscovered domain: got %v", err)
+	}
+
+	client.DirectoryType = directoryTypeADLDS
+	if _, err := client.ForDomain(ctx, "emea.example.com"); err == nil {
+		t.Error("Error refusing domains in AD LDS")
+	}
+}
+
+func TestAdldapDiscoverDomains(t *testing.T) {
+	client, directory := newFakeClient(t)
+	partitionsDN := "CN=Partitions,CN=Configuration," + fakeDomainDN
+	directory.put("CN=Configuration,"+fakeDomainDN, map[string][]string{"objectClass": {"container"}})
+	directory.put(partitionsDN, map[string][]string{"objectClass": {"container"}})
+	directory.put("CN=EXAMPLE,"+partitionsDN, map[string][]string{"objectClass": {"crossRef"}, "dnsRoot": {"example.com"}, "systemFlags": {"3"}})
+	directory.put("CN=EMEA,"+partitionsDN, map[string][]string{"objectClass": {"crossRef"}, "dnsRoot": {"emea.example.com"}, "systemFlags": {"3"}})
+	directory.put("CN=ForestDnsZones,"+partitionsDN, map[string][]string{"objectClass": {"crossRef"}, "dnsRoot": {"ForestDnsZones.example.com"}, "systemFlags": {"5"}})
+
+	systemDN := "CN=System," + fakeDomainDN
+	directory.put(systemDN, map[string][]string{"objectClass": {"container"}})
+	directory.put("CN=contoso.com,"+systemDN, map[string][]string{"objectClass": {"trustedDomain"}, "trustPartner": {"contoso.com"}, "trustDirection": {"3"}, "trustType": {"2"}})
+	directory.put("CN=fabrikam.com,"+systemDN, map[string][]string{"objectClass": {"trustedDomain"}, "trustPartner": {"fabrikam.com"}, "trustDirection": {"2"}, "trustType": {"2"}})
+	directory.put("CN=KERBEROS.REALM,"+systemDN, map[string][]string{"objectClass": {"trustedDomain"}, "trustPartner": {"KERBEROS.REALM"}, "trustDirection": {"3"}, "trustType": {"3"}})
+
+	domains, err := client.DiscoverDomains(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Outbound-only and non-AD trusts, and application partitions, are left out
+	if !stringSlicesEqual(domains, []string{"example.com", "emea.example.com", "contoso.com"}) {
+		t.Errorf("Error discovering domains: got %v", domains)
+	}
+}
+
+func TestAdldapDomainLdapURL(t *testing.T) {
+	for ldapURL, expected := range map[string]string{
+		"ldaps://dc1.example.com":      "ldaps://emea.example.com",
+		"ldap://dc1.example.com:10389": "ldap://emea.example.com:10389",
+	} {
+		if got, err := domainLdapURL(ldapURL, "emea.example.com"); err != nil || got != expected {
+			t.Errorf("Error building the domain URL for %s: got %q, %v", ldapURL, got, err)
+		}
+	}
+}
+
+func TestAdldapResourceOrganizationalUnit_domain(t *testing.T) {
+	client, directory, childDirectory := newFakeForestClient(t)
+	r := resourceOrganizationalUnit()
+	ouDN := "OU=Staff," + fakeChildDomainDN
+
+	state := fakeApply(t, r, nil, map[string]interface{}{
+		"domain":             "emea.example.com",
+		"distinguished_name": ouDN,
+	}, client)
+	if childDirectory.Entry(ouDN) == nil || directory.Entry(ouDN) != nil {
+		t.Fatal("Error creating the OU in its domain")
+	}
+	if refreshed := fakeRefresh(t, r, state, client); refreshed == nil || refreshed.ID != state.ID {
+		t.Error("Error reading the OU from its domain")
+	}
+
+	// The domain prefixes the ID to import from another domain
+	ctx := context.Background()
+	imported, err := r.Importer.StateContext(ctx, r.Data(&terraform.InstanceState{ID: "emea.example.com:" + ouDN}), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes := imported[0].State().Attributes; attributes["domain"] != "emea.example.com" || attributes["id"] != state.ID {
+		t.Errorf("Error importing from another domain: got %v", attributes)
+	}
+
+	fakeApply(t, r, state, nil, client)
+	if childDirectory.Entry(ouDN) != nil {
+		t.Error("Error deleting the OU from its domain")
+	}
+}
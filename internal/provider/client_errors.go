@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LdapOperationError describes a failed directory operation: what was being
+// done, to which DN, and with what filter, around the error go-ldap returned.
+type LdapOperationError struct {
+	Operation string
+	DN        string
+	Filter    string
+	Err       error
+}
+
+func (e *LdapOperationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s \"%s\"", e.Operation, e.DN)
+	if e.Filter != "" {
+		fmt.Fprintf(&b, " with filter %s", e.Filter)
+	}
+
+	var ldapErr *ldap.Error
+	if !errors.As(e.Err, &ldapErr) || ldapErr.Err == nil {
+		fmt.Fprintf(&b, ": %s", e.Err)
+		return b.String()
+	}
+
+	diagnostic := ldapErr.Err.Error()
+	fmt.Fprintf(&b, ": LDAP result code %d (%s)", ldapErr.ResultCode, ldap.LDAPResultCodeMap[ldapErr.ResultCode])
+	if diagnostic != "" {
+		fmt.Fprintf(&b, ": %s", diagnostic)
+	}
+	if code, ok := adErrorCode(diagnostic); ok {
+		if description, known := adErrorDescriptions[code]; known {
+			fmt.Fprintf(&b, " [%08X: %s]", code, description)
+		}
+	}
+	if ldapErr.MatchedDN != "" {
+		fmt.Fprintf(&b, " (matched DN \"%s\")", ldapErr.MatchedDN)
+	}
+
+	var retryErr *RetryError
+	if errors.As(e.Err, &retryErr) {
+		fmt.Fprintf(&b, " (after %d attempts)", retryErr.Attempts)
+	}
+	return b.String()
+}
+
+func (e *LdapOperationError) Unwrap() error {
+	return e.Err
+}
+
+// Windows error codes AD reports in the diagnostic message of LDAP results.
+var adErrorDescriptions = map[uint32]string{
+	0x00000057: "invalid parameter",
+	0x00000525: "no such user",
+	0x0000052D: "password does not meet the domain password policy",
+	0x0000052E: "invalid credentials",
+	0x0000052F: "account restrictions prevent this sign-in",
+	0x00000530: "sign-in not permitted at this time",
+	0x00000531: "sign-in not permitted from this workstation",
+	0x00000532: "password expired",
+	0x00000533: "account disabled",
+	0x00000701: "account expired",
+	0x00000773: "password must be changed",
+	0x00000775: "account locked out",
+	0x0000200E: "directory service busy",
+	0x0000200F: "directory service unavailable",
+	0x0000202B: "referral to another domain",
+	0x00002071: "object already exists",
+	0x0000208D: "object not found",
+	0x00002098: "insufficient access rights",
+	0x000020F6: "replication busy",
+}
+
+var adDiagnosticCode = regexp.MustCompile(`^([0-9A-Fa-f]{8}):`)
+var adDiagnosticData = regexp.MustCompile(`, data ([0-9A-Fa-f]+),`)
+
+// adErrorCode extracts the Windows error code from an AD diagnostic message.
+// Bind failures report the code as "data", after a generic leading code.
+func adErrorCode(diagnostic string) (uint32, bool) {
+	if match := adDiagnosticData.FindStringSubmatch(diagnostic); match != nil {
+		if code, err := strconv.ParseUint(match[1], 16, 32); err == nil && code != 0 {
+			return uint32(code), true
+		}
+	}
+	if match := adDiagnosticCode.FindStringSubmatch(diagnostic); match != nil {
+		if code, err := strconv.ParseUint(match[1], 16, 32); err == nil {
+			return uint32(code), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,1604 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	uac "github.com/audibleblink/msldapuac"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/go-cty/cty/gocty"
+	fwprovider "github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// fakeDirectory is an in-memory ldap.Client standing in for Active Directory
+// in unit tests.  It keeps a flat map of entries and implements enough of AD's
+// behaviour for the client and resources: filters, scopes, generated
+// identity attributes, objectClass inheritance, SPN uniqueness, renames, and
+// tree delete.  Passwords are write-only, as in AD, and kept in passwords.
+// With recycleBin set, deleted entries are kept in Deleted Objects and can be
+// found with the Show Deleted control and restored.
+type fakeDirectory struct {
+	mu        sync.Mutex
+	baseDN    string
+	domainSID string
+	nextRID   int
+	entries   map[string]map[string][]string // Keyed by normalized DN
+	passwords map[string]string              // Keyed by normalized DN
+	modifies  int                            // Modify requests received
+	searches  int                            // Search requests received
+	usn       int64                          // highestCommittedUSN
+
+	// Like an AD with the Recycle Bin enabled, keep deleted entries in
+	// Deleted Objects rather than removing them
+	recycleBin bool
+
+	// Like AD's MaxValRange policy, the number of values of an attribute
+	// returned before it is split into ranges; zero returns all values
+	maxValRange int
+
+	// The number of changes a DirSync search returns before setting
+	// MoreResults; zero returns all of them
+	dirSyncPageSize int
+
+	// Like an AD LDS instance, have no defaultNamingContext, and no
+	// sAMAccountName or userAccountControl on users
+	adlds bool
+
+	// The authorization ID Who Am I answers with
+	authzID string
+}
+
+const fakeDomainDN = "DC=example,DC=com"
+
+// Structural objectClass chains, as AD stores them on new entries
+var fakeObjectClasses = map[string][]string{
+	"user":               {"top", "person", "organizationalPerson", "user"},
+	"computer":           {"top", "person", "organizationalPerson", "user", "computer"},
+	"group":              {"top", "group"},
+	"organizationalUnit": {"top", "organizationalUnit"},
+	"container":          {"top", "container"},
+}
+
+// Attributes compared as DNs in filters
+var fakeDNAttributes = []string{"distinguishedName", "nCName", "manager", "managedBy", "member", "memberOf", "assistant", "seeAlso", "directReports"}
+
+// Attributes compared byte for byte in filters
+var fakeBinaryAttributes = []string{"objectGUID", "objectSid", "nTSecurityDescriptor", "msDS-ConsistencyGuid"}
+
+// Windows error codes AD puts in the diagnostic message for fake errors
+const (
+	fakeErrorNoObject      = "0000208D: NameErr: DSID-03100241, problem 2001 (NO_OBJECT), data 0"
+	fakeErrorEntryExists   = "00002071: UpdErr: DSID-03050269, problem 6005 (ENTRY_EXISTS), data 0"
+	fakeErrorNotLeaf       = "00002015: UpdErr: DSID-031A1236, problem 6003 (CANT_ON_NON_LEAF), data 0"
+	fakeErrorSPNExists     = "00002082: AtrErr: DSID-03152BA1, #1: 0: 00002082: DSID-03152BA1, problem 1006 (ATT_OR_VALUE_EXISTS), data 0, Att 90303 (servicePrincipalName)"
+	fakeErrorNoAttribute   = "00002080: AtrErr: DSID-03152D2C, #1: 0: 00002080: DSID-03152D2C, problem 1001 (NO_ATTRIBUTE_OR_VAL), data 0"
+	fakeErrorValueExists   = "00002083: AtrErr: DSID-03151818, #1: 0: 00002083: DSID-03151818, problem 1006 (ATT_OR_VALUE_EXISTS), data 0"
+	fakeErrorSAMNameExists = "00000524: UpdErr: DSID-031A11E2, problem 6005 (ENTRY_EXISTS), data 0"
+)
+
+// newFakeClient returns a client bound to a new fake directory holding the
+// domain root and its Users and Computers containers.
+func newFakeClient(t *testing.T) (*LdapClient, *fakeDirectory) {
+	t.Helper()
+	return newFakeDomainClient(t, fakeDomainDN, "S-1-5-21-1004336348-1177238915-682003330")
+}
+
+// newFakeDomainClient is newFakeClient for the domain with the naming context
+// and SID, for the other domains of a forest.
+func newFakeDomainClient(t *testing.T, baseDN string, domainSID string) (*LdapClient, *fakeDirectory) {
+	t.Helper()
+
+	directory := &fakeDirectory{
+		baseDN:    baseDN,
+		domainSID: domainSID,
+		nextRID:   1100,
+		entries:   map[string]map[string][]string{},
+		passwords: map[string]string{},
+	}
+	directory.put(baseDN, map[string][]string{
+		"objectClass":      {"top", "domain", "domainDNS"},
+		"minPwdLength":     {"7"},
+		"pwdHistoryLength": {"24"},
+		"minPwdAge":        {"-864000000000"},
+		"pwdProperties":    {"1"},
+		"lockoutDuration":  {"-18000000000"},
+	})
+	directory.put("CN=Users,"+baseDN, map[string][]string{"objectClass": {"top", "container"}})
+	directory.put("CN=Computers,"+baseDN, map[string][]string{"objectClass": {"top", "container"}})
+	directory.put("CN=Deleted Objects,"+baseDN, map[string][]string{"objectClass": {"top", "container"}, "isDeleted": {"TRUE"}})
+
+	dnsName, err := dnToDNSName(baseDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newDNCache()
+	client := &LdapClient{
+		Conn:       &dnCacheConn{Client: directory, cache: cache},
+		LdapURL:    "ldap://dc1." + dnsName,
+		SearchBase: baseDN,
+		gc:         &globalCatalogConn{conn: directory}, // A single-domain forest's catalog holds the same entries
+		dc:         new(domainControllerName),
+		dnCache:    cache,
+	}
+	return client, directory
+}
+
+// put stores an entry with the attributes AD generates for new objects.
+func (f *fakeDirectory) put(dn string, attributes map[string][]string) {
+	entry := map[string][]string{}
+	for name, values := range attributes {
+		if len(values) > 0 {
+			entry[name] = append([]string{}, values...)
+		}
+	}
+
+	parsedDN, _ := ldap.ParseDN(dn)
+	rdn := parsedDN.RDNs[0].Attributes[0]
+	entry["distinguishedName"] = []string{dn}
+	entry["name"] = []string{rdn.Value}
+	entry[rdn.Type] = []string{rdn.Value}
+
+	guid := make([]byte, 16)
+	rand.Read(guid)
+	entry["objectGUID"] = []string{string(guid)}
+	entry["whenCreated"] = []string{time.Now().UTC().Format("20060102150405.0Z")}
+	entry["nTSecurityDescriptor"] = []string{string(fakeSecurityDescriptor())}
+	f.touch(entry)
+	entry["uSNCreated"] = entry["uSNChanged"]
+
+	if classes := fakeAttribute(entry, "objectClass"); len(classes) == 1 {
+		if chain, ok := fakeObjectClasses[classes[0]]; ok {
+			entry["objectClass"] = append([]string{}, chain...)
+		}
+	}
+	classes := fakeAttribute(entry, "objectClass")
+	if fakeContainsFold(classes, "user") || fakeContainsFold(classes, "group") {
+		f.nextRID++
+		entry["objectSid"] = []string{string(fakeSID(f.domainSID, f.nextRID))}
+	}
+	if fakeContainsFold(classes, "user") && len(fakeAttribute(entry, "userAccountControl")) == 0 && !f.adlds {
+		if fakeContainsFold(classes, "computer") {
+			entry["userAccountControl"] = []string{strconv.Itoa(uac.WorkstationTrustAccount | uac.PasswdNotReqd)}
+		} else {
+			entry["userAccountControl"] = []string{strconv.Itoa(uac.NormalAccount | uac.Accountdisable | uac.PasswdNotReqd)}
+		}
+		entry["pwdLastSet"] = []string{"0"}
+	}
+
+	f.entries[normalizeDN(dn)] = entry
+}
+
+// touch gives a changed entry the next update sequence number.
+func (f *fakeDirectory) touch(entry map[string][]string) {
+	f.usn++
+	entry["uSNChanged"] = []string{strconv.FormatInt(f.usn, 10)}
+}
+
+// fakeSecurityDescriptor returns a self-relative descriptor owned by SYSTEM
+// with a DACL granting SYSTEM full control.
+func fakeSecurityDescriptor() []byte {
+	system := []byte{1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0}
+	allowSystem := append([]byte{0x00, 0x00, 0x14, 0x00, 0xff, 0x01, 0x0f, 0x00}, system...)
+	dacl := append([]byte{0x04, 0x00, 0x1c, 0x00, 0x01, 0x00, 0x00, 0x00}, allowSystem...)
+	header := []byte{0x01, 0x00, 0x04, 0x80, 0x14, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00}
+	return append(append(header, system...), dacl...)
+}
+
+// fakeSID encodes a domain SID with the RID appended.
+func fakeSID(domainSID string, rid int) []byte {
+	parts := strings.Split(domainSID, "-")[2:]
+	authority, _ := strconv.ParseUint(parts[0], 10, 48)
+	sid := []byte{1, byte(len(parts))}
+	for i := 5; i >= 0; i-- {
+		sid = append(sid, byte(authority>>(8*i)))
+	}
+	for _, part := range append(parts[1:], strconv.Itoa(rid)) {
+		value, _ := strconv.ParseUint(part, 10, 32)
+		sid = binary.LittleEndian.AppendUint32(sid, uint32(value))
+	}
+	return sid
+}
+
+func fakeAttribute(entry map[string][]string, name string) []string {
+	for attr, values := range entry {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func fakeSetAttribute(entry map[string][]string, name string, values []string) {
+	for attr := range entry {
+		if strings.EqualFold(attr, name) {
+			delete(entry, attr)
+		}
+	}
+	if len(values) > 0 {
+		entry[name] = values
+	}
+}
+
+func fakeContainsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeValuesEqual compares attribute values the way AD's matching rules do.
+func fakeValuesEqual(name string, a string, b string) bool {
+	switch {
+	case fakeContainsFold(fakeBinaryAttributes, name):
+		return a == b
+	case fakeContainsFold(fakeDNAttributes, name):
+		return dnsEqual(a, b)
+	}
+	return strings.EqualFold(a, b)
+}
+
+func fakeMatchValue(entry map[string][]string, name string, match func(string) bool) bool {
+	for _, value := range fakeAttribute(entry, name) {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeMatch evaluates a compiled search filter against an entry.
+func fakeMatch(entry map[string][]string, filter *ber.Packet) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			matched, err := fakeMatch(entry, child)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			matched, err := fakeMatch(entry, child)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		matched, err := fakeMatch(entry, filter.Children[0])
+		return !matched, err
+	case ldap.FilterPresent:
+		return len(fakeAttribute(entry, ber.DecodeString(filter.Data.Bytes()))) > 0, nil
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		name := ber.DecodeString(filter.Children[0].Data.Bytes())
+		assertion := ber.DecodeString(filter.Children[1].Data.Bytes())
+		return fakeMatchValue(entry, name, func(value string) bool { return fakeValuesEqual(name, value, assertion) }), nil
+	case ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		name := ber.DecodeString(filter.Children[0].Data.Bytes())
+		assertion, err := strconv.ParseInt(ber.DecodeString(filter.Children[1].Data.Bytes()), 10, 64)
+		if err != nil {
+			return false, ldap.NewError(ldap.LDAPResultInappropriateMatching, err)
+		}
+		return fakeMatchValue(entry, name, func(value string) bool {
+			number, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return false
+			}
+			if filter.Tag == ldap.FilterGreaterOrEqual {
+				return number >= assertion
+			}
+			return number <= assertion
+		}), nil
+	case ldap.FilterSubstrings:
+		name := ber.DecodeString(filter.Children[0].Data.Bytes())
+		return fakeMatchValue(entry, name, func(value string) bool {
+			value = strings.ToLower(value)
+			for _, part := range filter.Children[1].Children {
+				substring := strings.ToLower(ber.DecodeString(part.Data.Bytes()))
+				switch part.Tag {
+				case ldap.FilterSubstringsInitial:
+					if !strings.HasPrefix(value, substring) {
+						return false
+					}
+					value = value[len(substring):]
+				case ldap.FilterSubstringsAny:
+					i := strings.Index(value, substring)
+					if i < 0 {
+						return false
+					}
+					value = value[i+len(substring):]
+				case ldap.FilterSubstringsFinal:
+					if !strings.HasSuffix(value, substring) {
+						return false
+					}
+				}
+			}
+			return true
+		}), nil
+	case ldap.FilterExtensibleMatch:
+		var rule, name, assertion string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case ldap.MatchingRuleAssertionMatchingRule:
+				rule = ber.DecodeString(child.Data.Bytes())
+			case ldap.MatchingRuleAssertionType:
+				name = ber.DecodeString(child.Data.Bytes())
+			case ldap.MatchingRuleAssertionMatchValue:
+				assertion = ber.DecodeString(child.Data.Bytes())
+			}
+		}
+		bits, err := strconv.ParseInt(assertion, 10, 64)
+		if err != nil {
+			return false, ldap.NewError(ldap.LDAPResultInappropriateMatching, err)
+		}
+		return fakeMatchValue(entry, name, func(value string) bool {
+			number, _ := strconv.ParseInt(value, 10, 64)
+			switch rule {
+			case "1.2.840.113556.1.4.803": // LDAP_MATCHING_RULE_BIT_AND
+				return number&bits == bits
+			case "1.2.840.113556.1.4.804": // LDAP_MATCHING_RULE_BIT_OR
+				return number&bits != 0
+			}
+			return false
+		}), nil
+	}
+	return false, ldap.NewError(ldap.LDAPResultUnwillingToPerform, fmt.Errorf("unsupported filter %s", ldap.FilterMap[uint64(filter.Tag)]))
+}
+
+func fakeIsDeleted(entry map[string][]string) bool {
+	return fakeContainsFold(fakeAttribute(entry, "isDeleted"), "TRUE")
+}
+
+func fakeShowDeleted(controls []ldap.Control) bool {
+	for _, control := range controls {
+		if control.GetControlType() == controlTypeShowDeleted {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeNoSuchObject(dn string) error {
+	return &ldap.Error{ResultCode: ldap.LDAPResultNoSuchObject, Err: errors.New(fakeErrorNoObject), MatchedDN: fakeDomainDN}
+}
+
+// resolveBase maps the rootDSE and <WKGUID=...> bind forms to entries.
+func (f *fakeDirectory) resolveBase(baseDN string) (string, error) {
+	if strings.HasPrefix(baseDN, "<WKGUID=") {
+		guid := strings.TrimPrefix(strings.SplitN(baseDN, ",", 2)[0], "<WKGUID=")
+		if strings.EqualFold(guid, computersContainerGUID) {
+			return "CN=Computers," + f.baseDN, nil
+		}
+		return "", fakeNoSuchObject(baseDN)
+	}
+	if _, ok := f.entries[normalizeDN(baseDN)]; !ok {
+		return "", fakeNoSuchObject(baseDN)
+	}
+	return baseDN, nil
+}
+
+func (f *fakeDirectory) rootDSE() map[string][]string {
+	configurationDN := "CN=Configuration," + f.baseDN
+	schemaDN := "CN=Schema," + configurationDN
+	if f.adlds {
+		return map[string][]string{
+			"namingContexts":             {configurationDN, schemaDN, f.baseDN},
+			"configurationNamingContext": {configurationDN},
+			"schemaNamingContext":        {schemaDN},
+			"dnsHostName":                {"dc1.example.com"},
+			"highestCommittedUSN":        {strconv.FormatInt(f.usn, 10)},
+		}
+	}
+	return map[string][]string{
+		"defaultNamingContext":       {f.baseDN},
+		"rootDomainNamingContext":    {f.baseDN},
+		"namingContexts":             {f.baseDN, configurationDN, schemaDN},
+		"configurationNamingContext": {configurationDN},
+		"schemaNamingContext":        {schemaDN},
+		"dnsHostName":                {"dc1.example.com"},
+		"highestCommittedUSN":        {strconv.FormatInt(f.usn, 10)},
+	}
+}
+
+// checkADLDSAttribute refuses the attributes AD LDS users don't have.
+func (f *fakeDirectory) checkADLDSAttribute(name string) error {
+	if f.adlds && (strings.EqualFold(name, "sAMAccountName") || strings.EqualFold(name, "userAccountControl")) {
+		return ldap.NewError(ldap.LDAPResultUndefinedAttributeType, fmt.Errorf("00000057: LdapErr: DSID-0C090D8A, comment: Error in attribute conversion operation, data 0, Att %s", name))
+	}
+	return nil
+}
+
+func fakeInScope(dn string, baseDN string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dnsEqual(dn, baseDN)
+	case ldap.ScopeSingleLevel:
+		parsed, err := ldap.ParseDN(dn)
+		if err != nil || len(parsed.RDNs) < 2 {
+			return false
+		}
+		parent := &ldap.DN{RDNs: parsed.RDNs[1:]}
+		return parent.Equal(mustParseFakeDN(baseDN))
+	}
+	return dnsEqual(dn, baseDN) || dnIsDescendant(dn, baseDN)
+}
+
+func mustParseFakeDN(dn string) *ldap.DN {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// fakeSelect returns the requested attributes of an entry: all of them for no
+// request or "*", plus any named.  Attributes with more than maxValRange values
+// are returned as ranges, as are ranges requested as name;range=low-*.
+func fakeSelect(dn string, entry map[string][]string, attributes []string, maxValRange int) *ldap.Entry {
+	all := len(attributes) == 0 || fakeContainsFold(attributes, "*")
+	selected := map[string][]string{}
+	for name, values := range entry {
+		if all || fakeContainsFold(attributes, name) {
+			fakeSelectRange(selected, name, values, 0, maxValRange)
+		}
+	}
+	for _, attribute := range attributes {
+		name, valueRange, found := strings.Cut(attribute, ";range=")
+		if !found {
+			continue
+		}
+		low, _ := strconv.Atoi(strings.TrimSuffix(valueRange, "-*"))
+		fakeSelectRange(selected, name, fakeAttribute(entry, name), low, maxValRange)
+	}
+	return ldap.NewEntry(dn, selected)
+}
+
+// constructed adds to a copy of an entry the constructed attributes requested
+// by name, which AD computes on each read rather than storing:
+// msDS-User-Account-Control-Computed has UF_LOCKOUT while lockoutTime is
+// within the domain's lockoutDuration.
+func (f *fakeDirectory) constructed(entry map[string][]string, attributes []string) map[string][]string {
+	if !fakeContainsFold(attributes, "msDS-User-Account-Control-Computed") || !fakeContainsFold(fakeAttribute(entry, "objectClass"), "user") {
+		return entry
+	}
+
+	var computed int64
+	lockoutTime := fakeInt(entry, "lockoutTime")
+	lockoutDuration := fakeInt(f.entries[normalizeDN(f.baseDN)], "lockoutDuration")
+	if lockoutTime != 0 && time.Now().Before(fileTimeToTime(lockoutTime).Add(time.Duration(-lockoutDuration)*100)) {
+		computed |= 0x10 // UF_LOCKOUT
+	}
+
+	withConstructed := map[string][]string{"msDS-User-Account-Control-Computed": {strconv.FormatInt(computed, 10)}}
+	for name, values := range entry {
+		withConstructed[name] = values
+	}
+	return withConstructed
+}
+
+// fakeInt returns the first value of an integer attribute, or 0 without one.
+func fakeInt(entry map[string][]string, name string) int64 {
+	values := fakeAttribute(entry, name)
+	if len(values) == 0 {
+		return 0
+	}
+	value, _ := strconv.ParseInt(values[0], 10, 64)
+	return value
+}
+
+func fakeSelectRange(selected map[string][]string, name string, values []string, low int, maxValRange int) {
+	if maxValRange == 0 || (low == 0 && len(values) <= maxValRange) {
+		selected[name] = append([]string{}, values...)
+		return
+	}
+	if low >= len(values) {
+		return
+	}
+	high := low + maxValRange
+	if high >= len(values) {
+		selected[fmt.Sprintf("%s;range=%d-*", name, low)] = append([]string{}, values[low:]...)
+		return
+	}
+	selected[fmt.Sprintf("%s;range=%d-%d", name, low, high-1)] = append([]string{}, values[low:high]...)
+}
+
+func (f *fakeDirectory) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.searches++
+
+	if request.BaseDN == "" && request.Scope == ldap.ScopeBaseObject {
+		return &ldap.SearchResult{Entries: []*ldap.Entry{fakeSelect("", f.rootDSE(), request.Attributes, 0)}}, nil
+	}
+	baseDN, err := f.resolveBase(request.BaseDN)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := ldap.CompileFilter(request.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if control := ldap.FindControl(request.Controls, controlTypeDirSync); control != nil {
+		return f.dirSync(request, baseDN, filter, control)
+	}
+
+	var keys []string
+	for key := range f.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	showDeleted := fakeShowDeleted(request.Controls)
+	result := &ldap.SearchResult{}
+	for _, key := range keys {
+		entry := f.entries[key]
+		dn := entry["distinguishedName"][0]
+		if !fakeInScope(dn, baseDN, request.Scope) || (fakeIsDeleted(entry) && !showDeleted) {
+			continue
+		}
+		matched, err := fakeMatch(entry, filter)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			result.Entries = append(result.Entries, fakeSelect(dn, f.constructed(entry, request.Attributes), request.Attributes, f.maxValRange))
+		}
+	}
+	if control := ldap.FindControl(request.Controls, controlTypeServerSort); control != nil {
+		return fakeSortAndWindow(result, request.Controls, control)
+	}
+	if ldap.FindControl(request.Controls, controlTypeVLV) != nil {
+		return nil, ldap.NewError(ldap.LDAPResultUnavailableCriticalExtension, errors.New("the virtual list view control requires the sort control"))
+	}
+	return result, nil
+}
+
+// fakeSortAndWindow sorts search results by the sort control's key, as text,
+// with objects lacking the attribute last, and then returns the window a
+// virtual list view control asks for, if any.  The sorted attribute must have
+// been requested.
+func fakeSortAndWindow(result *ldap.SearchResult, controls []ldap.Control, sortControl ldap.Control) (*ldap.SearchResult, error) {
+	keys, err := ber.DecodePacketErr([]byte(sortControl.(*ldap.ControlString).ControlValue))
+	if err != nil || len(keys.Children) != 1 {
+		return nil, ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("AD sorts by a single key"))
+	}
+	key := keys.Children[0]
+	name := ber.DecodeString(key.Children[0].Data.Bytes())
+	descending := len(key.Children) > 1 && key.Children[1].Data.Bytes()[0] != 0
+	sort.SliceStable(result.Entries, func(i, j int) bool {
+		a := strings.ToLower(result.Entries[i].GetAttributeValue(name))
+		b := strings.ToLower(result.Entries[j].GetAttributeValue(name))
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortResult")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(ldap.LDAPResultSuccess), "sortResult"))
+	result.Controls = append(result.Controls, ldap.NewControlString(controlTypeServerSortResponse, false, string(response.Bytes())))
+
+	vlv := ldap.FindControl(controls, controlTypeVLV)
+	if vlv == nil {
+		return result, nil
+	}
+	value, err := ber.DecodePacketErr([]byte(vlv.(*ldap.ControlString).ControlValue))
+	if err != nil {
+		return nil, ldap.NewError(ldap.LDAPResultProtocolError, err)
+	}
+	before, after := int(value.Children[0].Value.(int64)), int(value.Children[1].Value.(int64))
+	offset := int(value.Children[2].Children[0].Value.(int64))
+	total := len(result.Entries)
+
+	// Offsets count from 1, and past the end target the last object
+	target := offset - 1
+	if target >= total {
+		target = total - 1
+	}
+	low, high := target-before, target+after+1
+	if low < 0 {
+		low = 0
+	}
+	if high > total {
+		high = total
+	}
+	if target < 0 {
+		low, high = 0, 0
+	}
+	result.Entries = result.Entries[low:high]
+
+	response = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "VirtualListViewResponse")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(target+1), "targetPosition"))
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(total), "contentCount"))
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(ldap.LDAPResultSuccess), "virtualListViewResult"))
+	result.Controls = append(result.Controls, ldap.NewControlString(controlTypeVLVResponse, false, string(response.Bytes())))
+	return result, nil
+}
+
+// dirSync answers a DirSync search like AD, with all the matching entries,
+// deleted or not, changed since the cookie, which the fake makes the USN of
+// the last change returned.  Unlike AD, it returns every requested attribute
+// rather than only those changed.
+func (f *fakeDirectory) dirSync(request *ldap.SearchRequest, baseDN string, filter *ber.Packet, control ldap.Control) (*ldap.SearchResult, error) {
+	if !dnsEqual(baseDN, f.baseDN) {
+		return nil, ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("00000057: LdapErr: DSID-0C0911E5, comment: Error processing control, data 0"))
+	}
+	value, err := ber.DecodePacketErr([]byte(control.(*ldap.ControlString).ControlValue))
+	if err != nil {
+		return nil, ldap.NewError(ldap.LDAPResultProtocolError, err)
+	}
+	var since int64
+	if cookie := value.Children[2].Data.Bytes(); len(cookie) > 0 {
+		if since, err = strconv.ParseInt(string(cookie), 10, 64); err != nil {
+			return nil, ldap.NewError(ldap.LDAPResultUnwillingToPerform, err)
+		}
+	}
+
+	var changed []map[string][]string
+	for _, entry := range f.entries {
+		usn, _ := strconv.ParseInt(entry["uSNChanged"][0], 10, 64)
+		if usn <= since || !fakeInScope(entry["distinguishedName"][0], baseDN, request.Scope) {
+			continue
+		}
+		matched, err := fakeMatch(entry, filter)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			changed = append(changed, entry)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		a, _ := strconv.ParseInt(changed[i]["uSNChanged"][0], 10, 64)
+		b, _ := strconv.ParseInt(changed[j]["uSNChanged"][0], 10, 64)
+		return a < b
+	})
+
+	var moreResults int64
+	cookie := strconv.FormatInt(f.usn, 10)
+	if f.dirSyncPageSize > 0 && len(changed) > f.dirSyncPageSize {
+		changed = changed[:f.dirSyncPageSize]
+		moreResults = 1
+		cookie = changed[len(changed)-1]["uSNChanged"][0]
+	}
+
+	result := &ldap.SearchResult{}
+	for _, entry := range changed {
+		result.Entries = append(result.Entries, fakeSelect(entry["distinguishedName"][0], entry, request.Attributes, f.maxValRange))
+	}
+	response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "DirSyncResponseValue")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, moreResults, "MoreResults"))
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(0), "unused"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie, "CookieServer"))
+	result.Controls = []ldap.Control{ldap.NewControlString(controlTypeDirSync, false, string(response.Bytes()))}
+	return result, nil
+}
+
+func (f *fakeDirectory) SearchWithPaging(request *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	return f.Search(request)
+}
+
+// checkSPNs enforces AD's forest-wide uniqueness of servicePrincipalName.
+func (f *fakeDirectory) checkSPNs(dn string, spns []string) error {
+	for key, entry := range f.entries {
+		if key == normalizeDN(dn) || fakeIsDeleted(entry) {
+			continue
+		}
+		for _, spn := range spns {
+			if fakeContainsFold(fakeAttribute(entry, "servicePrincipalName"), spn) {
+				return ldap.NewError(ldap.LDAPResultConstraintViolation, errors.New(fakeErrorSPNExists))
+			}
+		}
+	}
+	return nil
+}
+
+// checkSAMAccountName enforces the domain-wide uniqueness of sAMAccountName.
+func (f *fakeDirectory) checkSAMAccountName(dn string, values []string) error {
+	for key, entry := range f.entries {
+		if key != normalizeDN(dn) && !fakeIsDeleted(entry) && len(values) > 0 && fakeContainsFold(fakeAttribute(entry, "sAMAccountName"), values[0]) {
+			return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New(fakeErrorSAMNameExists))
+		}
+	}
+	return nil
+}
+
+func (f *fakeDirectory) Add(request *ldap.AddRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parsed, err := ldap.ParseDN(request.DN)
+	if err != nil || len(parsed.RDNs) < 2 {
+		return ldap.NewError(ldap.LDAPResultInvalidDNSyntax, fmt.Errorf("invalid DN %q", request.DN))
+	}
+	if _, ok := f.entries[normalizeDN(request.DN)]; ok {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New(fakeErrorEntryExists))
+	}
+	parent := JoinRDNs(parsed.RDNs[1:])
+	if _, ok := f.entries[normalizeDN(parent)]; !ok {
+		return fakeNoSuchObject(parent)
+	}
+
+	attributes := map[string][]string{}
+	var password string
+	for _, attribute := range request.Attributes {
+		if strings.EqualFold(attribute.Type, "unicodePwd") {
+			password = attribute.Vals[0]
+			continue
+		}
+		if err := f.checkADLDSAttribute(attribute.Type); err != nil {
+			return err
+		}
+		fakeSetAttribute(attributes, attribute.Type, attribute.Vals)
+	}
+	if err := f.checkSPNs(request.DN, fakeAttribute(attributes, "servicePrincipalName")); err != nil {
+		return err
+	}
+	if err := f.checkSAMAccountName(request.DN, fakeAttribute(attributes, "sAMAccountName")); err != nil {
+		return err
+	}
+
+	f.put(request.DN, attributes)
+	if password != "" {
+		f.setPassword(request.DN, password)
+	}
+	return nil
+}
+
+func (f *fakeDirectory) setPassword(dn string, encoded string) {
+	f.passwords[normalizeDN(dn)] = encoded
+	f.entries[normalizeDN(dn)]["pwdLastSet"] = []string{strconv.FormatInt(time.Now().UnixNano()/100+116444736000000000, 10)}
+}
+
+// Password returns the password last set on an entry, decoded from unicodePwd.
+func (f *fakeDirectory) Password(dn string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	encoded := []byte(f.passwords[normalizeDN(dn)])
+	units := make([]uint16, 0, len(encoded)/2)
+	for i := 0; i+1 < len(encoded); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(encoded[i:]))
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(utf16.Decode(units)), "\""), "\"")
+}
+
+// Entry returns the stored attributes of an entry, or nil if there is none.
+func (f *fakeDirectory) Entry(dn string) map[string][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.entries[normalizeDN(dn)]
+}
+
+func (f *fakeDirectory) Modify(request *ldap.ModifyRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.modifies++
+	entry, ok := f.entries[normalizeDN(request.DN)]
+	if !ok || (fakeIsDeleted(entry) && !fakeShowDeleted(request.Controls)) {
+		return fakeNoSuchObject(request.DN)
+	}
+
+	// Apply to a copy, so a failed change leaves the entry untouched
+	updated := map[string][]string{}
+	for name, values := range entry {
+		updated[name] = append([]string{}, values...)
+	}
+	var password string
+	for _, change := range request.Changes {
+		name, values := change.Modification.Type, change.Modification.Vals
+		if err := f.checkADLDSAttribute(name); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, "unicodePwd") {
+			if change.Operation != ldap.DeleteAttribute && len(values) > 0 {
+				password = values[0]
+			}
+			continue
+		}
+
+		current := fakeAttribute(updated, name)
+		switch change.Operation {
+		case ldap.AddAttribute:
+			for _, value := range values {
+				if fakeMatchValue(map[string][]string{name: current}, name, func(v string) bool { return fakeValuesEqual(name, v, value) }) {
+					return ldap.NewError(ldap.LDAPResultAttributeOrValueExists, errors.New(fakeErrorValueExists))
+				}
+				current = append(current, value)
+			}
+		case ldap.DeleteAttribute:
+			if len(values) == 0 {
+				if len(current) == 0 {
+					return ldap.NewError(ldap.LDAPResultNoSuchAttribute, errors.New(fakeErrorNoAttribute))
+				}
+				current = nil
+			}
+			for _, value := range values {
+				remaining := []string{}
+				for _, v := range current {
+					if !fakeValuesEqual(name, v, value) {
+						remaining = append(remaining, v)
+					}
+				}
+				if len(remaining) == len(current) {
+					return ldap.NewError(ldap.LDAPResultNoSuchAttribute, errors.New(fakeErrorNoAttribute))
+				}
+				current = remaining
+			}
+		case ldap.ReplaceAttribute:
+			current = append([]string{}, values...)
+		default:
+			return ldap.NewError(ldap.LDAPResultUnwillingToPerform, fmt.Errorf("unsupported modify operation %d", change.Operation))
+		}
+		fakeSetAttribute(updated, name, current)
+	}
+	if err := f.checkSPNs(request.DN, fakeAttribute(updated, "servicePrincipalName")); err != nil {
+		return err
+	}
+	if err := f.checkSAMAccountName(request.DN, fakeAttribute(updated, "sAMAccountName")); err != nil {
+		return err
+	}
+
+	// Restoring a deleted entry removes isDeleted and sets its new DN
+	dn := request.DN
+	if newDN := updated["distinguishedName"][0]; !dnsEqual(newDN, dn) {
+		if fakeIsDeleted(updated) || !fakeIsDeleted(entry) {
+			return ldap.NewError(ldap.LDAPResultUnwillingToPerform, fmt.Errorf("distinguishedName can only be set to restore a deleted object"))
+		}
+		parsed := mustParseFakeDN(newDN)
+		if _, ok := f.entries[normalizeDN(JoinRDNs(parsed.RDNs[1:]))]; !ok {
+			return fakeNoSuchObject(newDN)
+		}
+		if _, ok := f.entries[normalizeDN(newDN)]; ok {
+			return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New(fakeErrorEntryExists))
+		}
+		rdn := parsed.RDNs[0].Attributes[0]
+		updated["name"] = []string{rdn.Value}
+		fakeSetAttribute(updated, rdn.Type, []string{rdn.Value})
+		delete(f.entries, normalizeDN(dn))
+		if password, ok := f.passwords[normalizeDN(dn)]; ok {
+			delete(f.passwords, normalizeDN(dn))
+			f.passwords[normalizeDN(newDN)] = password
+		}
+		dn = newDN
+	}
+
+	f.touch(updated)
+	f.entries[normalizeDN(dn)] = updated
+	if password != "" {
+		f.setPassword(dn, password)
+	}
+	return nil
+}
+
+func (f *fakeDirectory) ModifyDN(request *ldap.ModifyDNRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[normalizeDN(request.DN)]
+	if !ok {
+		return fakeNoSuchObject(request.DN)
+	}
+	parsed := mustParseFakeDN(request.DN)
+	parent := JoinRDNs(parsed.RDNs[1:])
+	if request.NewSuperior != "" {
+		parent = request.NewSuperior
+	}
+	if _, ok := f.entries[normalizeDN(parent)]; !ok {
+		return fakeNoSuchObject(parent)
+	}
+	newDN := request.NewRDN + "," + parent
+	if _, ok := f.entries[normalizeDN(newDN)]; ok && !dnsEqual(newDN, request.DN) {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New(fakeErrorEntryExists))
+	}
+
+	// Move the entry and everything beneath it
+	oldDN := entry["distinguishedName"][0]
+	for key, child := range f.entries {
+		dn := child["distinguishedName"][0]
+		if !dnsEqual(dn, oldDN) && !dnIsDescendant(dn, oldDN) {
+			continue
+		}
+		movedDN := newDN
+		if !dnsEqual(dn, oldDN) {
+			rdns := mustParseFakeDN(dn).RDNs
+			movedDN = JoinRDNs(rdns[:len(rdns)-len(mustParseFakeDN(oldDN).RDNs)]) + "," + newDN
+		}
+		delete(f.entries, key)
+		child["distinguishedName"] = []string{movedDN}
+		f.entries[normalizeDN(movedDN)] = child
+		if password, ok := f.passwords[key]; ok {
+			delete(f.passwords, key)
+			f.passwords[normalizeDN(movedDN)] = password
+		}
+	}
+	rdn := mustParseFakeDN(newDN).RDNs[0].Attributes[0]
+	entry["name"] = []string{rdn.Value}
+	fakeSetAttribute(entry, rdn.Type, []string{rdn.Value})
+	f.touch(entry)
+	return nil
+}
+
+func (f *fakeDirectory) Del(request *ldap.DelRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.entries[normalizeDN(request.DN)]; !ok {
+		return fakeNoSuchObject(request.DN)
+	}
+	treeDelete := false
+	for _, control := range request.Controls {
+		treeDelete = treeDelete || control.GetControlType() == controlTypeTreeDelete
+	}
+
+	var subtree []string
+	for key, entry := range f.entries {
+		if dnIsDescendant(entry["distinguishedName"][0], request.DN) {
+			subtree = append(subtree, key)
+		}
+	}
+	if len(subtree) > 0 && !treeDelete {
+		return ldap.NewError(ldap.LDAPResultNotAllowedOnNonLeaf, errors.New(fakeErrorNotLeaf))
+	}
+	for _, key := range append(subtree, normalizeDN(request.DN)) {
+		if f.recycleBin {
+			f.tombstone(key)
+		}
+		delete(f.entries, key)
+		delete(f.passwords, key)
+	}
+	return nil
+}
+
+// tombstone copies an entry being deleted into Deleted Objects, as AD does
+// with the Recycle Bin enabled.
+func (f *fakeDirectory) tombstone(key string) {
+	entry := f.entries[key]
+	parsed := mustParseFakeDN(entry["distinguishedName"][0])
+	name := parsed.RDNs[0].Attributes[0].Value
+	deletedDN := fmt.Sprintf("CN=%s\\0ADEL:%s,CN=Deleted Objects,%s", escapeRDNValue(name), formatGUID([]byte(entry["objectGUID"][0])), f.baseDN)
+
+	deleted := map[string][]string{}
+	for attribute, values := range entry {
+		deleted[attribute] = values
+	}
+	deleted["distinguishedName"] = []string{deletedDN}
+	deleted["isDeleted"] = []string{"TRUE"}
+	deleted["lastKnownParent"] = []string{JoinRDNs(parsed.RDNs[1:])}
+	deleted["msDS-LastKnownRDN"] = []string{name}
+	deleted["whenChanged"] = []string{time.Now().UTC().Format("20060102150405.0Z")}
+	f.touch(deleted)
+	f.entries[normalizeDN(deletedDN)] = deleted
+	if password, ok := f.passwords[key]; ok {
+		f.passwords[normalizeDN(deletedDN)] = password
+	}
+}
+
+func (f *fakeDirectory) Start()                     {}
+func (f *fakeDirectory) StartTLS(*tls.Config) error { return nil }
+func (f *fakeDirectory) Close() error               { return nil }
+func (f *fakeDirectory) GetLastError() error        { return nil }
+func (f *fakeDirectory) IsClosing() bool            { return false }
+func (f *fakeDirectory) SetTimeout(time.Duration)   {}
+func (f *fakeDirectory) TLSConnectionState() (tls.ConnectionState, bool) {
+	return tls.ConnectionState{}, false
+}
+func (f *fakeDirectory) Bind(username, password string) error { return nil }
+func (f *fakeDirectory) UnauthenticatedBind(username string) error {
+	return nil
+}
+func (f *fakeDirectory) ExternalBind() error                                   { return nil }
+func (f *fakeDirectory) NTLMUnauthenticatedBind(domain, username string) error { return nil }
+func (f *fakeDirectory) Unbind() error                                         { return nil }
+func (f *fakeDirectory) SimpleBind(*ldap.SimpleBindRequest) (*ldap.SimpleBindResult, error) {
+	return &ldap.SimpleBindResult{}, nil
+}
+
+func (f *fakeDirectory) Compare(dn, attribute, value string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[normalizeDN(dn)]
+	if !ok {
+		return false, fakeNoSuchObject(dn)
+	}
+	return fakeMatchValue(entry, attribute, func(v string) bool { return fakeValuesEqual(attribute, v, value) }), nil
+}
+
+// The operations below aren't used by the provider, which has its own DirSync
+// and paging on top of Search.
+
+func (f *fakeDirectory) ModifyWithResult(request *ldap.ModifyRequest) (*ldap.ModifyResult, error) {
+	return &ldap.ModifyResult{}, f.Modify(request)
+}
+
+func (f *fakeDirectory) Extended(*ldap.ExtendedRequest) (*ldap.ExtendedResponse, error) {
+	return nil, fakeUnsupported("extended operations")
+}
+
+func (f *fakeDirectory) SearchAsync(context.Context, *ldap.SearchRequest, int) ldap.Response {
+	panic(fakeUnsupported("asynchronous searches"))
+}
+
+func (f *fakeDirectory) DirSync(*ldap.SearchRequest, int64, int64, []byte) (*ldap.SearchResult, error) {
+	return nil, fakeUnsupported("go-ldap DirSync searches")
+}
+
+func (f *fakeDirectory) DirSyncAsync(context.Context, *ldap.SearchRequest, int, int64, int64, []byte) ldap.Response {
+	panic(fakeUnsupported("asynchronous DirSync"))
+}
+
+func (f *fakeDirectory) Syncrepl(context.Context, *ldap.SearchRequest, int, ldap.ControlSyncRequestMode, []byte, bool) ldap.Response {
+	panic(fakeUnsupported("syncrepl"))
+}
+
+func fakeUnsupported(operation string) error {
+	return ldap.NewError(ldap.LDAPResultUnwillingToPerform, fmt.Errorf("%s aren't supported by the fake directory", operation))
+}
+
+func (f *fakeDirectory) WhoAmI([]ldap.Control) (*ldap.WhoAmIResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &ldap.WhoAmIResult{AuthzID: f.authzID}, nil
+}
+
+func (f *fakeDirectory) PasswordModify(*ldap.PasswordModifyRequest) (*ldap.PasswordModifyResult, error) {
+	return nil, ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("password modify extended operation is not supported by Active Directory"))
+}
+
+// Modifies returns the number of Modify requests received so far.
+func (f *fakeDirectory) Modifies() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.modifies
+}
+
+// Searches returns the number of Search requests received so far.
+func (f *fakeDirectory) Searches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.searches
+}
+
+// fakeApply plans and applies a configuration for a resource against the fake
+// directory, as terraform apply would, returning the new state.  A nil
+// configuration destroys the resource.
+func fakeApply(t *testing.T, r *schema.Resource, state *terraform.InstanceState, config map[string]interface{}, meta interface{}) *terraform.InstanceState {
+	t.Helper()
+
+	newState, diags := fakeTryApply(t, r, state, config, meta)
+	if diags.HasError() {
+		t.Fatalf("Error applying %v: %v", config, diags)
+	}
+	return newState
+}
+
+// fakeTryApply is fakeApply for applies expected to fail, returning the state
+// Terraform would save along with the diagnostics.
+func fakeTryApply(t *testing.T, r *schema.Resource, state *terraform.InstanceState, config map[string]interface{}, meta interface{}) (*terraform.InstanceState, diag.Diagnostics) {
+	t.Helper()
+	ctx := context.Background()
+
+	diff := &terraform.InstanceDiff{Destroy: true}
+	if config != nil {
+		// Terraform passes the configuration as a cty value, for GetRawConfig
+		if state == nil {
+			state = &terraform.InstanceState{}
+		} else {
+			state = state.DeepCopy()
+		}
+		rawConfig, err := fakeCtyValue(config, r.CoreConfigSchema().ImpliedType())
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.RawConfig = rawConfig
+		state.RawPlan = rawConfig
+
+		diff, err = r.Diff(ctx, state, terraform.NewResourceConfigRaw(config), meta)
+		if err != nil {
+			t.Fatalf("Error planning %v: %s", config, err)
+		}
+	}
+	if diff == nil {
+		return state, nil
+	}
+
+	return r.Apply(ctx, state, diff, meta)
+}
+
+// fakeCtyValue converts a configuration value, as given to
+// terraform.NewResourceConfigRaw, to the cty type of the schema.
+func fakeCtyValue(value interface{}, ty cty.Type) (cty.Value, error) {
+	if value == nil {
+		return cty.NullVal(ty), nil
+	}
+
+	switch {
+	case ty.IsObjectType():
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return cty.NilVal, fmt.Errorf("expected a map for %s, got %T", ty.FriendlyName(), value)
+		}
+		attributes := map[string]cty.Value{}
+		for name, attributeType := range ty.AttributeTypes() {
+			attribute, err := fakeCtyValue(object[name], attributeType)
+			if err != nil {
+				return cty.NilVal, fmt.Errorf("%s: %s", name, err)
+			}
+			attributes[name] = attribute
+		}
+		return cty.ObjectVal(attributes), nil
+	case ty.IsListType(), ty.IsSetType():
+		list, ok := value.([]interface{})
+		if !ok {
+			return cty.NilVal, fmt.Errorf("expected a list for %s, got %T", ty.FriendlyName(), value)
+		}
+		if len(list) == 0 {
+			if ty.IsSetType() {
+				return cty.SetValEmpty(ty.ElementType()), nil
+			}
+			return cty.ListValEmpty(ty.ElementType()), nil
+		}
+		var elements []cty.Value
+		for _, element := range list {
+			converted, err := fakeCtyValue(element, ty.ElementType())
+			if err != nil {
+				return cty.NilVal, err
+			}
+			elements = append(elements, converted)
+		}
+		if ty.IsSetType() {
+			return cty.SetVal(elements), nil
+		}
+		return cty.ListVal(elements), nil
+	case ty.IsMapType():
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return cty.NilVal, fmt.Errorf("expected a map for %s, got %T", ty.FriendlyName(), value)
+		}
+		if len(object) == 0 {
+			return cty.MapValEmpty(ty.ElementType()), nil
+		}
+		elements := map[string]cty.Value{}
+		for key, element := range object {
+			converted, err := fakeCtyValue(element, ty.ElementType())
+			if err != nil {
+				return cty.NilVal, err
+			}
+			elements[key] = converted
+		}
+		return cty.MapVal(elements), nil
+	}
+	return gocty.ToCtyValue(value, ty)
+}
+
+// fakeRefresh reads a resource's state back from the fake directory.
+func fakeRefresh(t *testing.T, r *schema.Resource, state *terraform.InstanceState, meta interface{}) *terraform.InstanceState {
+	t.Helper()
+
+	newState, diags := r.RefreshWithoutUpgrade(context.Background(), state, meta)
+	if diags.HasError() {
+		t.Fatalf("Error refreshing %s: %v", state.ID, diags)
+	}
+	return newState
+}
+
+// fakeFrameworkProvider is the framework provider with its resources bound to
+// a client of the fake directory.
+type fakeFrameworkProvider struct {
+	frameworkProvider
+	client *LdapClient
+}
+
+func (p *fakeFrameworkProvider) Configure(ctx context.Context, req fwprovider.ConfigureRequest, resp *fwprovider.ConfigureResponse) {
+	client := &lazyClient{client: p.client, config: providerConfig{DirectoryType: p.client.DirectoryType}}
+	client.once.Do(func() {})
+	resp.ResourceData = client
+	resp.EphemeralResourceData = client
+}
+
+// fakeFrameworkServer returns a configured protocol 6 server for the
+// framework provider, with the schema of the resource.
+func fakeFrameworkServer(t *testing.T, client *LdapClient, typeName string) (tfprotov6.ProviderServer, *tfprotov6.Schema) {
+	t.Helper()
+	ctx := context.Background()
+
+	server := providerserver.NewProtocol6(&fakeFrameworkProvider{client: client})()
+	schemas, err := server.GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerConfig := fakeDynamicValue(t, schemas.Provider.ValueType(), map[string]interface{}{})
+	configured, err := server.ConfigureProvider(ctx, &tfprotov6.ConfigureProviderRequest{Config: providerConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeFrameworkCheck(t, "configuring the provider", configured.Diagnostics)
+
+	resourceSchema, ok := schemas.ResourceSchemas[typeName]
+	if !ok {
+		t.Fatalf("Error finding resource %s", typeName)
+	}
+	return server, resourceSchema
+}
+
+// fakeFrameworkApply plans and applies a configuration for a framework
+// resource against the fake directory, as terraform apply would, returning
+// the new state.  A nil configuration destroys the resource.  The new state
+// must agree with the plan, as Terraform checks.
+func fakeFrameworkApply(t *testing.T, client *LdapClient, typeName string, state tftypes.Value, config map[string]interface{}) tftypes.Value {
+	t.Helper()
+
+	newState, diags := fakeFrameworkTryApply(t, client, typeName, state, config)
+	fakeFrameworkCheck(t, fmt.Sprintf("applying %v", config), diags)
+	return newState
+}
+
+// fakeFrameworkTryApply is fakeFrameworkApply for applies expected to fail,
+// returning the diagnostics instead of failing the test.
+func fakeFrameworkTryApply(t *testing.T, client *LdapClient, typeName string, state tftypes.Value, config map[string]interface{}) (tftypes.Value, []*tfprotov6.Diagnostic) {
+	t.Helper()
+	ctx := context.Background()
+
+	server, resourceSchema := fakeFrameworkServer(t, client, typeName)
+	ty := resourceSchema.ValueType().(tftypes.Object)
+	if state.Type() == nil {
+		state = tftypes.NewValue(ty, nil)
+	}
+	configValue := tftypes.NewValue(ty, nil)
+	proposed := configValue
+	if config != nil {
+		var err error
+		configValue, err = fakeTFValue(ty, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validated, err := server.ValidateResourceConfig(ctx, &tfprotov6.ValidateResourceConfigRequest{
+			TypeName: typeName,
+			Config:   fakeDynamicValueOf(t, ty, configValue),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fakeFrameworkHasError(validated.Diagnostics) {
+			return state, validated.Diagnostics
+		}
+		proposed = fakeProposedNew(resourceSchema.Block.Attributes, ty, state, configValue)
+	}
+
+	planned, err := server.PlanResourceChange(ctx, &tfprotov6.PlanResourceChangeRequest{
+		TypeName:         typeName,
+		PriorState:       fakeDynamicValueOf(t, ty, state),
+		ProposedNewState: fakeDynamicValueOf(t, ty, proposed),
+		Config:           fakeDynamicValueOf(t, ty, configValue),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fakeFrameworkHasError(planned.Diagnostics) {
+		return state, planned.Diagnostics
+	}
+	plannedState, err := planned.PlannedState.Unmarshal(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := server.ApplyResourceChange(ctx, &tfprotov6.ApplyResourceChangeRequest{
+		TypeName:     typeName,
+		PriorState:   fakeDynamicValueOf(t, ty, state),
+		PlannedState: planned.PlannedState,
+		Config:       fakeDynamicValueOf(t, ty, configValue),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newState, err := applied.NewState.Unmarshal(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fakeFrameworkHasError(applied.Diagnostics) {
+		fakeCheckPlanned(t, plannedState, newState)
+	}
+	return newState, applied.Diagnostics
+}
+
+// fakeFrameworkRefresh reads a framework resource's state back from the fake
+// directory.
+func fakeFrameworkRefresh(t *testing.T, client *LdapClient, typeName string, state tftypes.Value) tftypes.Value {
+	t.Helper()
+	ctx := context.Background()
+
+	server, resourceSchema := fakeFrameworkServer(t, client, typeName)
+	ty := resourceSchema.ValueType()
+	read, err := server.ReadResource(ctx, &tfprotov6.ReadResourceRequest{
+		TypeName:     typeName,
+		CurrentState: fakeDynamicValueOf(t, ty, state),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeFrameworkCheck(t, "refreshing", read.Diagnostics)
+
+	newState, err := read.NewState.Unmarshal(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newState
+}
+
+// fakeProposedNew merges the configuration with the prior state the way
+// Terraform does before planning: computed attributes left out of the
+// configuration keep their prior values, including within nested maps.
+func fakeProposedNew(attributes []*tfprotov6.SchemaAttribute, ty tftypes.Object, prior tftypes.Value, config tftypes.Value) tftypes.Value {
+	if config.IsNull() || !config.IsKnown() {
+		return config
+	}
+	var priorValues, configValues map[string]tftypes.Value
+	if !prior.IsNull() && prior.IsKnown() {
+		prior.As(&priorValues)
+	}
+	config.As(&configValues)
+
+	proposed := map[string]tftypes.Value{}
+	for _, attribute := range attributes {
+		configValue := configValues[attribute.Name]
+		priorValue, hasPrior := priorValues[attribute.Name]
+		switch {
+		case attribute.Computed && configValue.IsNull() && hasPrior:
+			proposed[attribute.Name] = priorValue
+		case attribute.NestedType != nil && attribute.NestedType.Nesting == tfprotov6.SchemaObjectNestingModeMap && !configValue.IsNull() && configValue.IsKnown():
+			mapType := ty.AttributeTypes[attribute.Name].(tftypes.Map)
+			elementType := mapType.ElementType.(tftypes.Object)
+			var configElements, priorElements map[string]tftypes.Value
+			configValue.As(&configElements)
+			if hasPrior && !priorValue.IsNull() {
+				priorValue.As(&priorElements)
+			}
+			elements := map[string]tftypes.Value{}
+			for key, element := range configElements {
+				priorElement, ok := priorElements[key]
+				if !ok {
+					priorElement = tftypes.NewValue(elementType, nil)
+				}
+				elements[key] = fakeProposedNew(attribute.NestedType.Attributes, elementType, priorElement, element)
+			}
+			proposed[attribute.Name] = tftypes.NewValue(mapType, elements)
+		default:
+			proposed[attribute.Name] = configValue
+		}
+	}
+	return tftypes.NewValue(ty, proposed)
+}
+
+// fakeCheckPlanned fails the test where the new state differs from a value
+// that was known in the plan.
+func fakeCheckPlanned(t *testing.T, planned tftypes.Value, newState tftypes.Value) {
+	t.Helper()
+
+	tftypes.Walk(planned, func(path *tftypes.AttributePath, value tftypes.Value) (bool, error) {
+		if !value.IsKnown() {
+			return false, nil
+		}
+		if value.Type().Is(tftypes.String) || value.Type().Is(tftypes.Bool) || value.Type().Is(tftypes.Number) {
+			applied, _, err := tftypes.WalkAttributePath(newState, path)
+			if err != nil || !value.Equal(applied.(tftypes.Value)) {
+				t.Errorf("Error applying the plan: %s planned as %s, applied as %v", path, value, applied)
+			}
+		}
+		return true, nil
+	})
+}
+
+// fakeTFValue converts a configuration value, given as for fakeApply, to
+// the type of a framework schema.
+func fakeTFValue(ty tftypes.Type, value interface{}) (tftypes.Value, error) {
+	if value == nil {
+		return tftypes.NewValue(ty, nil), nil
+	}
+
+	switch {
+	case ty.Is(tftypes.Object{}):
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return tftypes.Value{}, fmt.Errorf("expected a map for %s, got %T", ty, value)
+		}
+		attributes := map[string]tftypes.Value{}
+		for name, attributeType := range ty.(tftypes.Object).AttributeTypes {
+			attribute, err := fakeTFValue(attributeType, object[name])
+			if err != nil {
+				return tftypes.Value{}, fmt.Errorf("%s: %s", name, err)
+			}
+			attributes[name] = attribute
+		}
+		return tftypes.NewValue(ty, attributes), nil
+	case ty.Is(tftypes.Map{}):
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return tftypes.Value{}, fmt.Errorf("expected a map for %s, got %T", ty, value)
+		}
+		elements := map[string]tftypes.Value{}
+		for key, element := range object {
+			converted, err := fakeTFValue(ty.(tftypes.Map).ElementType, element)
+			if err != nil {
+				return tftypes.Value{}, fmt.Errorf("%s: %s", key, err)
+			}
+			elements[key] = converted
+		}
+		return tftypes.NewValue(ty, elements), nil
+	case ty.Is(tftypes.Number):
+		number, ok := value.(int)
+		if !ok {
+			return tftypes.Value{}, fmt.Errorf("expected an int for %s, got %T", ty, value)
+		}
+		return tftypes.NewValue(ty, big.NewFloat(float64(number))), nil
+	}
+	return tftypes.NewValue(ty, value), nil
+}
+
+func fakeDynamicValue(t *testing.T, ty tftypes.Type, value map[string]interface{}) *tfprotov6.DynamicValue {
+	t.Helper()
+
+	converted, err := fakeTFValue(ty, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fakeDynamicValueOf(t, ty, converted)
+}
+
+func fakeDynamicValueOf(t *testing.T, ty tftypes.Type, value tftypes.Value) *tfprotov6.DynamicValue {
+	t.Helper()
+
+	dynamicValue, err := tfprotov6.NewDynamicValue(ty, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dynamicValue
+}
+
+func fakeFrameworkHasError(diags []*tfprotov6.Diagnostic) bool {
+	for _, diagnostic := range diags {
+		if diagnostic.Severity == tfprotov6.DiagnosticSeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeFrameworkCheck(t *testing.T, operation string, diags []*tfprotov6.Diagnostic) {
+	t.Helper()
+
+	for _, diagnostic := range diags {
+		if diagnostic.Severity == tfprotov6.DiagnosticSeverityError {
+			t.Fatalf("Error %s: %s: %s", operation, diagnostic.Summary, diagnostic.Detail)
+		}
+	}
+}
+
+func TestAdldapFakeDirectory(t *testing.T) {
+	ctx := context.Background()
+	client, directory := newFakeClient(t)
+
+	ou, err := client.CreateOU(ctx, "OU=Fake,"+fakeDomainDN, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := client.CreateUserAccount(ctx, "fakeuser", "Passw0rd!", "OU=Fake,"+fakeDomainDN, map[string][]string{"cn": {"Fake User"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := directory.Password(account.DN); got != "Passw0rd!" {
+		t.Errorf("Error setting password: got %q", got)
+	}
+	found, err := client.GetAccountBySAMAccountName(ctx, "FAKEUSER", objectClassUser, nil)
+	if err != nil || !dnsEqual(found.DN, account.DN) {
+		t.Fatalf("Error finding account by sAMAccountName: got %v, %v", found, err)
+	}
+	objectGUID, err := found.GetObjectGUID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byGUID, err := client.GetAccountByGUID(ctx, objectGUID, objectClassUser, nil)
+	if err != nil || !dnsEqual(byGUID.DN, account.DN) {
+		t.Fatalf("Error finding account by objectGUID: got %v, %v", byGUID, err)
+	}
+
+	err = account.Rename(ctx, "Renamed User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if directory.Entry("CN=Renamed User,OU=Fake,"+fakeDomainDN) == nil {
+		t.Errorf("Error renaming account: %s not found", "CN=Renamed User,OU=Fake,"+fakeDomainDN)
+	}
+
+	err = ou.Delete(ctx)
+	if err == nil {
+		t.Fatalf("Error deleting non-leaf OU: expected an error")
+	}
+	err = ou.DeleteRecursively(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetAccountBySAMAccountName(ctx, "fakeuser", objectClassUser, nil)
+	if !IsNotFound(err) {
+		t.Errorf("Error deleting OU subtree: got %v", err)
+	}
+}
+
+func TestAdldapFakeDirectory_specialCharacters(t *testing.T) {
+	ctx := context.Background()
+	client, directory := newFakeClient(t)
+	ou := "CN=Users," + fakeDomainDN
+	sAMAccountName := `t(1)*,+<\x`
+	commonName := `Test (1), *Special+<User\>`
+
+	account, err := client.CreateUserAccount(ctx, sAMAccountName, "Passw0rd!", ou, map[string][]string{"cn": {commonName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userDN := "CN=" + escapeRDNValue(commonName) + "," + ou
+	if !dnsEqual(account.DN, userDN) || directory.Entry(userDN) == nil {
+		t.Fatalf("Error creating account: got %s, wanted %s", account.DN, userDN)
+	}
+
+	found, err := client.GetAccountBySAMAccountName(ctx, sAMAccountName, objectClassUser, []string{"cn"})
+	if err != nil || !dnsEqual(found.DN, userDN) {
+		t.Fatalf("Error finding account by sAMAccountName: got %v, %v", found, err)
+	}
+	if _, err := client.GetAccountBySAMAccountName(ctx, "t(1)*", objectClassUser, nil); !IsNotFound(err) {
+		t.Errorf("Error escaping the filter: a wildcard matched, got %v", err)
+	}
+	objectGUID, err := found.GetObjectGUID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamedName := `Renamed (2), *User+<\`
+	if err := found.Rename(ctx, renamedName); err != nil {
+		t.Fatal(err)
+	}
+	renamedDN := "CN=" + escapeRDNValue(renamedName) + "," + ou
+	renamed, err := client.GetAccountByGUID(ctx, objectGUID, objectClassUser, []string{"cn"})
+	if err != nil || !dnsEqual(renamed.DN, renamedDN) {
+		t.Fatalf("Error renaming account: got %v, %v", renamed, err)
+	}
+	if got := fakeAttribute(directory.Entry(renamedDN), "cn"); len(got) != 1 || got[0] != renamedName {
+		t.Errorf("Error renaming account: got cn %v", got)
+	}
+
+	if err := renamed.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetAccountBySAMAccountName(ctx, sAMAccountName, objectClassUser, nil); !IsNotFound(err) {
+		t.Errorf("Error deleting account: got %v", err)
+	}
+}
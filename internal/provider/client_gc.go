@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// globalCatalogURL returns the Global Catalog URL for the LDAP URL: port 3269
+// for ldaps and 3268 for ldap, on the domain controller named, or on the URL's
+// host if none is.
+func globalCatalogURL(ldapURL string, domainController string) (string, error) {
+	u, err := url.Parse(ldapURL)
+	if err != nil {
+		return "", err
+	}
+
+	port := "3268"
+	if strings.EqualFold(u.Scheme, "ldaps") {
+		port = "3269"
+	}
+	host := u.Hostname()
+	if domainController != "" {
+		host = domainController
+	}
+	u.Host = host + ":" + port
+
+	return u.String(), nil
+}
+
+// globalCatalogConn is a client's Global Catalog connection, dialed the first
+// time a lookup needs it and shared by concurrent plans.  A dial that failed
+// is remembered too, so that an unreachable catalog isn't dialed again, until
+// its timeout, for every lookup.  A nil globalCatalogConn dials every time.
+type globalCatalogConn struct {
+	mu   sync.Mutex
+	conn ldap.Client
+	err  error
+}
+
+func (c *LdapClient) globalCatalog(ctx context.Context) (ldap.Client, error) {
+	gc := c.gc
+	if gc == nil {
+		return c.dialGlobalCatalog(ctx)
+	}
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if gc.conn != nil || gc.err != nil {
+		return gc.conn, gc.err
+	}
+	conn, err := c.dialGlobalCatalog(ctx)
+	if err != nil {
+		// A dial cut short by its context may succeed for the next one
+		if ctx.Err() == nil {
+			gc.err = err
+		}
+		return nil, err
+	}
+	gc.conn = conn
+
+	return conn, nil
+}
+
+func (c *LdapClient) dialGlobalCatalog(ctx context.Context) (ldap.Client, error) {
+	// Stay on the domain controller the client is connected to, rather than
+	// whichever one the URL's name resolves to next, so that the catalog
+	// already holds the client's own writes
+	domainController, _ := c.DomainControllerName(ctx)
+	gcURL, err := globalCatalogURL(c.LdapURL, domainController)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialContext(ctx, gcURL)
+	if err != nil {
+		return nil, err
+	}
+	err = bindContext(ctx, conn, c.bindAccount, c.bindPassword)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// FindServicePrincipalHolders returns the DNs of the accounts in the forest
+// that have the SPN, searching the Global Catalog where it is reachable and
+// the domain otherwise.
+func (c *LdapClient) FindServicePrincipalHolders(ctx context.Context, spn string) ([]string, error) {
+	filter := fmt.Sprintf("(servicePrincipalName=%s)", ldap.EscapeFilter(spn))
+
+	var result *ldap.SearchResult
+	gc, err := c.globalCatalog(ctx)
+	if err == nil {
+		searchRequest := ldap.NewSearchRequest(
+			"", // The whole forest
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			filter,
+			[]string{"distinguishedName"},
+			nil,
+		)
+		result, err = searchContext(ctx, gc, searchRequest)
+	}
+	if err != nil {
+		result, err = c.LdapSearch(ctx, filter, []string{"distinguishedName"})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var holders []string
+	for _, entry := range result.Entries {
+		holders = append(holders, entry.DN)
+	}
+
+	return holders, nil
+}
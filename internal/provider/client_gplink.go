@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	gpLinkDisabled = 1
+	gpLinkEnforced = 2
+)
+
+var gpLinkPattern = regexp.MustCompile(`(?i)\[LDAP://([^;\]]+);(\d+)\]`)
+
+// gpLink is one entry of a gPLink attribute, which lists the linked GPOs as
+// [LDAP://<GPO DN>;<options>] from lowest to highest precedence.
+type gpLink struct {
+	DN      string
+	Options int
+}
+
+// GUID returns the GPO GUID from the link DN, lowercase and without braces.
+func (l gpLink) GUID() string {
+	dn, err := NewLdapDN(l.DN)
+	if err != nil || len(dn.RDNs) == 0 {
+		return ""
+	}
+	return normalizeGPOGUID(dn.Name())
+}
+
+func normalizeGPOGUID(guid string) string {
+	return strings.ToLower(strings.Trim(guid, "{}"))
+}
+
+func gpoDN(guid string, domainDN string) string {
+	return fmt.Sprintf("cn={%s},cn=policies,cn=system,%s", strings.ToUpper(normalizeGPOGUID(guid)), domainDN)
+}
+
+func parseGPLink(value string) ([]gpLink, error) {
+	var links []gpLink
+	for _, match := range gpLinkPattern.FindAllStringSubmatch(value, -1) {
+		options, err := strconv.Atoi(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid gPLink options in %s: %s", match[0], err)
+		}
+		links = append(links, gpLink{DN: match[1], Options: options})
+	}
+	return links, nil
+}
+
+func formatGPLink(links []gpLink) string {
+	var sb strings.Builder
+	for _, link := range links {
+		fmt.Fprintf(&sb, "[LDAP://%s;%d]", link.DN, link.Options)
+	}
+	return sb.String()
+}
+
+// mergeGPLinks replaces the links to managed GPOs with the desired links,
+// given in precedence order, ahead of any links managed elsewhere.
+func mergeGPLinks(existing []gpLink, managed map[string]bool, desired []gpLink) []gpLink {
+	var merged []gpLink
+	for _, link := range existing {
+		if !managed[link.GUID()] {
+			merged = append(merged, link)
+		}
+	}
+	for i := len(desired) - 1; i >= 0; i-- {
+		merged = append(merged, desired[i])
+	}
+	return merged
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// PolicyError is returned when a write targets a DN outside the provider's
+// allowed_base_dns.
+type PolicyError struct {
+	Operation      string
+	DN             string
+	AllowedBaseDNs []string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy violation: refusing to %s \"%s\", which is outside allowed_base_dns (%s)", e.Operation, e.DN, strings.Join(e.AllowedBaseDNs, "; "))
+}
+
+// guardedConn refuses adds, modifies, renames, and deletes of entries outside
+// the allowed base DNs, so that a mistaken variable can't change objects
+// elsewhere in the directory.  Reads pass through.
+type guardedConn struct {
+	ldap.Client
+	allowedBaseDNs []string
+}
+
+func (g *guardedConn) check(operation string, dn string) error {
+	for _, baseDN := range g.allowedBaseDNs {
+		if dnsEqual(dn, baseDN) || dnIsDescendant(dn, baseDN) {
+			return nil
+		}
+	}
+	return &PolicyError{Operation: operation, DN: dn, AllowedBaseDNs: g.allowedBaseDNs}
+}
+
+func (g *guardedConn) Add(request *ldap.AddRequest) error {
+	if err := g.check("add", request.DN); err != nil {
+		return err
+	}
+	return g.Client.Add(request)
+}
+
+// Modify checks the entry being modified, except for restores from the Recycle
+// Bin, where the deleted object lives in Deleted Objects and the DN it is
+// restored to is checked instead.
+func (g *guardedConn) Modify(request *ldap.ModifyRequest) error {
+	dn := request.DN
+	for _, change := range request.Changes {
+		if change.Operation == ldap.ReplaceAttribute && strings.EqualFold(change.Modification.Type, "distinguishedName") && len(change.Modification.Vals) == 1 {
+			dn = change.Modification.Vals[0]
+		}
+	}
+	if err := g.check("modify", dn); err != nil {
+		return err
+	}
+	return g.Client.Modify(request)
+}
+
+// ModifyDN checks both the entry and where it is being renamed or moved to.
+func (g *guardedConn) ModifyDN(request *ldap.ModifyDNRequest) error {
+	if err := g.check("rename", request.DN); err != nil {
+		return err
+	}
+	parent := request.NewSuperior
+	if parent == "" {
+		ldapDN, err := NewLdapDN(request.DN)
+		if err != nil {
+			return err
+		}
+		parent = ldapDN.ParentDN()
+	}
+	if err := g.check("move", request.NewRDN+","+parent); err != nil {
+		return err
+	}
+	return g.Client.ModifyDN(request)
+}
+
+func (g *guardedConn) Del(request *ldap.DelRequest) error {
+	if err := g.check("delete", request.DN); err != nil {
+		return err
+	}
+	return g.Client.Del(request)
+}
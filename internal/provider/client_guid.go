@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// parseGUID parses a GUID in string form, optionally wrapped in braces, into
+// the mixed-endian byte order AD uses for objectGUID.
+func parseGUID(guid string) ([]byte, error) {
+	trimmed := strings.Trim(guid, "{}")
+	if len(trimmed) != 36 || trimmed[8] != '-' || trimmed[13] != '-' || trimmed[18] != '-' || trimmed[23] != '-' {
+		return nil, fmt.Errorf("\"%s\" is not a valid GUID", guid)
+	}
+
+	raw, err := hex.DecodeString(strings.ReplaceAll(trimmed, "-", ""))
+	if err != nil {
+		return nil, fmt.Errorf("\"%s\" is not a valid GUID: %s", guid, err)
+	}
+
+	return swapGUIDBytes(raw), nil
+}
+
+// formatGUID renders an objectGUID value in its usual string form.
+func formatGUID(objectGUID []byte) string {
+	if len(objectGUID) != 16 {
+		return ""
+	}
+	b := swapGUIDBytes(objectGUID)
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// guidFilterValue escapes an objectGUID value for use in a search filter.
+func guidFilterValue(objectGUID []byte) string {
+	var sb strings.Builder
+	for _, b := range objectGUID {
+		fmt.Fprintf(&sb, "\\%02x", b)
+	}
+	return sb.String()
+}
+
+// swapGUIDBytes converts between string (big-endian) and objectGUID byte
+// order; the first three groups are little-endian in AD.
+func swapGUIDBytes(in []byte) []byte {
+	out := make([]byte, 16)
+	out[0], out[1], out[2], out[3] = in[3], in[2], in[1], in[0]
+	out[4], out[5] = in[5], in[4]
+	out[6], out[7] = in[7], in[6]
+	copy(out[8:], in[8:])
+	return out
+}
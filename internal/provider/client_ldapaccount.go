@@ -1,12 +1,78 @@
 package provider
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	uac "github.com/audibleblink/msldapuac"
 )
 
+// Kerberos encryption types in msDS-SupportedEncryptionTypes, in bit order.
+var encryptionTypeNames = []string{
+	"DES_CBC_CRC",
+	"DES_CBC_MD5",
+	"RC4_HMAC",
+	"AES128_CTS_HMAC_SHA1_96",
+	"AES256_CTS_HMAC_SHA1_96",
+}
+
+func encryptionTypesToInt(encryptionTypes []string) (int, error) {
+	result := 0
+	for _, encryptionType := range encryptionTypes {
+		found := false
+		for i, name := range encryptionTypeNames {
+			if name == encryptionType {
+				result |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown encryption type \"%s\"", encryptionType)
+		}
+	}
+	return result, nil
+}
+
+func intToEncryptionTypes(value int) []string {
+	encryptionTypes := []string{}
+	for i, name := range encryptionTypeNames {
+		if value&(1<<i) != 0 {
+			encryptionTypes = append(encryptionTypes, name)
+		}
+	}
+	return encryptionTypes
+}
+
+// lapsCredential is a Windows LAPS msLAPS-Password value, which is JSON of the
+// form {"n":"Administrator","t":"...","p":"..."}.
+type lapsCredential struct {
+	AccountName string `json:"n"`
+	Password    string `json:"p"`
+}
+
+func parseLAPSCredential(value string) (*lapsCredential, error) {
+	var credential lapsCredential
+	err := json.Unmarshal([]byte(value), &credential)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing msLAPS-Password: %s", err)
+	}
+	return &credential, nil
+}
+
+// parseLAPSPassword extracts the password from a Windows LAPS msLAPS-Password
+// value.
+func parseLAPSPassword(value string) (string, error) {
+	credential, err := parseLAPSCredential(value)
+	if err != nil {
+		return "", err
+	}
+	return credential.Password, nil
+}
+
 // Type LdapAccount extends LdapEntry
 type LdapAccount struct {
 	*LdapEntry
@@ -14,28 +80,28 @@ type LdapAccount struct {
 
 // LdapAccount receivers
 
-func (a *LdapAccount) Enable() error {
-	return a.RemoveUACFlag(uac.Accountdisable)
+func (a *LdapAccount) Enable(ctx context.Context) error {
+	return a.RemoveUACFlag(ctx, uac.Accountdisable)
 }
 
-func (a *LdapAccount) Disable() error {
-	return a.AddUACFlag(uac.Accountdisable)
+func (a *LdapAccount) Disable(ctx context.Context) error {
+	return a.AddUACFlag(ctx, uac.Accountdisable)
 }
 
-func (a *LdapAccount) Rename(newName string) error {
-	newRDN := fmt.Sprintf("CN=%s", newName)
-	err := a.LdapEntry.Rename(newRDN)
+func (a *LdapAccount) Rename(ctx context.Context, newName string) error {
+	newRDN := fmt.Sprintf("CN=%s", escapeRDNValue(newName))
+	err := a.LdapEntry.Rename(ctx, newRDN)
 	if err != nil {
 		return err
 	}
 
-	// err = a.UpdateAttribute("name", []string{newName})
+	// err = a.UpdateAttribute(ctx, "name", []string{newName})
 
 	return nil
 }
 
-func (a *LdapAccount) IsEnabled() (bool, error) {
-	currentUAC, err := a.GetUserAccountControl()
+func (a *LdapAccount) IsEnabled(ctx context.Context) (bool, error) {
+	currentUAC, err := a.GetUserAccountControl(ctx)
 	if err != nil {
 		return true, err
 	}
@@ -48,8 +114,18 @@ func (a *LdapAccount) IsEnabled() (bool, error) {
 	return !isDisabled, nil
 }
 
-func (a *LdapAccount) GetUserAccountControl() (int64, error) {
-	uacStr, err := a.GetAttributeValue("userAccountControl")
+// GetUserAccountControl returns the account's userAccountControl, which in
+// AD LDS is put together from the attributes it keeps the flags in.
+func (a *LdapAccount) GetUserAccountControl(ctx context.Context) (int64, error) {
+	if a.IsADLDS() {
+		err := a.loadAttributes(ctx, accountControlAttributes)
+		if err != nil {
+			return -1, err
+		}
+		return a.entryAccountControl(a.Entry)
+	}
+
+	uacStr, err := a.GetAttributeValue(ctx, "userAccountControl")
 	if err != nil {
 		return -1, err
 	}
@@ -57,41 +133,44 @@ func (a *LdapAccount) GetUserAccountControl() (int64, error) {
 	return result, err
 }
 
-func (a *LdapAccount) SetUACFlag(uacFlags int64) error {
-	uacStr := fmt.Sprintf("%d", uacFlags)
-	err := a.UpdateAttribute("userAccountControl", []string{uacStr})
+func (a *LdapAccount) SetUACFlag(ctx context.Context, uacFlags int64) error {
+	values, err := a.accountControlValues(uacFlags)
+	if err != nil {
+		return err
+	}
+	err = a.UpdateAttributes(ctx, values)
 
 	return err
 }
 
-func (a *LdapAccount) AddUACFlag(flags int64) error {
-	currentUAC, err := a.GetUserAccountControl()
+func (a *LdapAccount) AddUACFlag(ctx context.Context, flags int64) error {
+	currentUAC, err := a.GetUserAccountControl(ctx)
 	if err != nil {
 		return err
 	}
 
 	newUAC := currentUAC | flags
 
-	err = a.SetUACFlag(newUAC)
+	err = a.SetUACFlag(ctx, newUAC)
 
 	return err
 }
 
-func (a *LdapAccount) RemoveUACFlag(flags int64) error {
-	currentUAC, err := a.GetUserAccountControl()
+func (a *LdapAccount) RemoveUACFlag(ctx context.Context, flags int64) error {
+	currentUAC, err := a.GetUserAccountControl(ctx)
 	if err != nil {
 		return err
 	}
 
 	newUAC := currentUAC &^ flags
 
-	err = a.SetUACFlag(newUAC)
+	err = a.SetUACFlag(ctx, newUAC)
 
 	return err
 }
 
-func (a *LdapAccount) UACFlagIsSet(flags int) (bool, error) {
-	currentUAC, err := a.GetUserAccountControl()
+func (a *LdapAccount) UACFlagIsSet(ctx context.Context, flags int) (bool, error) {
+	currentUAC, err := a.GetUserAccountControl(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -104,22 +183,187 @@ func (a *LdapAccount) UACFlagIsSet(flags int) (bool, error) {
 	return isSet, nil
 }
 
-func (a *LdapAccount) SetPassword(password string) error {
+func (a *LdapAccount) SetPassword(ctx context.Context, password string) error {
 	passwordEncoded, err := encodePassword(password)
 	if err != nil {
 		return err
 	}
 
-	err = a.UpdateAttribute("unicodePwd", []string{passwordEncoded})
+	err = a.UpdateAttribute(ctx, "unicodePwd", []string{passwordEncoded})
 	if err != nil {
+		if isPasswordPolicyError(err) {
+			return a.passwordPolicyError(ctx, password, err)
+		}
 		return err
 	}
 
 	return nil
 }
 
-func (a *LdapAccount) AddServicePrincipal(spn string) error {
-	err := a.AddAttributeWithValues("servicePrincipalName", []string{spn})
+func (a *LdapAccount) GetSupportedEncryptionTypes(ctx context.Context) ([]string, error) {
+	value, err := a.GetAttributeValue(ctx, "msDS-SupportedEncryptionTypes")
+	if err != nil || value == "" {
+		return []string{}, err
+	}
+	encryptionTypes, err := strconv.Atoi(value)
+	if err != nil {
+		return []string{}, err
+	}
+	return intToEncryptionTypes(encryptionTypes), nil
+}
+
+func (a *LdapAccount) SetSupportedEncryptionTypes(ctx context.Context, encryptionTypes []string) error {
+	value, err := encryptionTypesToInt(encryptionTypes)
+	if err != nil {
+		return err
+	}
+	return a.UpdateAttribute(ctx, "msDS-SupportedEncryptionTypes", []string{strconv.Itoa(value)})
+}
+
+// GetLAPSPasswordExpiration returns the expiration of the Windows LAPS or,
+// failing that, legacy LAPS managed password.
+func (a *LdapAccount) GetLAPSPasswordExpiration(ctx context.Context) (time.Time, error) {
+	for _, name := range []string{"msLAPS-PasswordExpirationTime", "ms-Mcs-AdmPwdExpirationTime"} {
+		value, err := a.GetAttributeValue(ctx, name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if value != "" {
+			expiration, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return fileTimeToTime(expiration), nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// GetLAPSPassword returns the Windows LAPS or legacy LAPS managed password, if
+// it is stored unencrypted and the bind account may read it.
+func (a *LdapAccount) GetLAPSPassword(ctx context.Context) (string, error) {
+	value, err := a.GetAttributeValue(ctx, "msLAPS-Password")
+	if err != nil {
+		return "", err
+	}
+	if value != "" {
+		return parseLAPSPassword(value)
+	}
+	return a.GetAttributeValue(ctx, "ms-Mcs-AdmPwd")
+}
+
+// GetLAPSCredential returns the local account and password LAPS manages, if
+// the password is stored unencrypted and the bind account may read it.  Legacy
+// LAPS doesn't record the account, so its name is empty.
+func (a *LdapAccount) GetLAPSCredential(ctx context.Context) (string, string, error) {
+	value, err := a.GetAttributeValue(ctx, "msLAPS-Password")
+	if err != nil {
+		return "", "", err
+	}
+	if value != "" {
+		credential, err := parseLAPSCredential(value)
+		if err != nil {
+			return "", "", err
+		}
+		return credential.AccountName, credential.Password, nil
+	}
+	password, err := a.GetAttributeValue(ctx, "ms-Mcs-AdmPwd")
+	return "", password, err
+}
+
+// GetSIDHistory returns the SIDs the account held in other domains before migration.
+func (a *LdapAccount) GetSIDHistory(ctx context.Context) ([]string, error) {
+	values, err := a.GetRawAttributeValues(ctx, "sIDHistory")
+	if err != nil {
+		return []string{}, err
+	}
+
+	sidHistory := make([]string, len(values))
+	for i, value := range values {
+		sidHistory[i], err = formatSID(value)
+		if err != nil {
+			return []string{}, err
+		}
+	}
+
+	return sidHistory, nil
+}
+
+// IsLockedOut reports whether the account is locked out by the lockout
+// policy, from the UF_LOCKOUT flag of the constructed
+// msDS-User-Account-Control-Computed.  lockoutTime can't tell: AD leaves it
+// set after the lockout duration expires, until the next logon or unlock.
+func (a *LdapAccount) IsLockedOut(ctx context.Context) (bool, error) {
+	computed, err := a.GetAttributeValue(ctx, "msDS-User-Account-Control-Computed")
+	if err != nil || computed == "" {
+		return false, err
+	}
+	flags, err := strconv.ParseInt(computed, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return uac.IsSet(flags, uac.Lockout)
+}
+
+func (a *LdapAccount) Unlock(ctx context.Context) error {
+	return a.UpdateAttribute(ctx, "lockoutTime", []string{"0"})
+}
+
+// ExpirePassword forces the user to change their password at next logon.
+func (a *LdapAccount) ExpirePassword(ctx context.Context) error {
+	return a.UpdateAttribute(ctx, "pwdLastSet", []string{"0"})
+}
+
+func (a *LdapAccount) GetPasswordLastSet(ctx context.Context) (time.Time, error) {
+	pwdLastSetStr, err := a.GetAttributeValue(ctx, "pwdLastSet")
+	if err != nil || pwdLastSetStr == "" {
+		return time.Time{}, err
+	}
+	pwdLastSet, err := strconv.ParseInt(pwdLastSetStr, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fileTimeToTime(pwdLastSet), nil
+}
+
+// GetConsistencyGUID returns msDS-ConsistencyGuid, the source anchor Azure AD
+// Connect matches the account to its cloud object with, or "" when unset.
+func (a *LdapAccount) GetConsistencyGUID(ctx context.Context) (string, error) {
+	value, err := a.GetRawAttributeValue(ctx, "msDS-ConsistencyGuid")
+	if err != nil {
+		return "", err
+	}
+	return formatGUID(value), nil
+}
+
+// SetConsistencyGUID sets msDS-ConsistencyGuid, which is stored in the same
+// byte order as objectGUID.
+func (a *LdapAccount) SetConsistencyGUID(ctx context.Context, guid string) error {
+	value, err := parseGUID(guid)
+	if err != nil {
+		return err
+	}
+	return a.UpdateAttribute(ctx, "msDS-ConsistencyGuid", []string{string(value)})
+}
+
+// GetLastLogonTimestamp returns the replicated lastLogonTimestamp, which lags
+// the real last logon by up to two weeks.
+func (a *LdapAccount) GetLastLogonTimestamp(ctx context.Context) (time.Time, error) {
+	lastLogonStr, err := a.GetAttributeValue(ctx, "lastLogonTimestamp")
+	if err != nil || lastLogonStr == "" {
+		return time.Time{}, err
+	}
+	lastLogon, err := strconv.ParseInt(lastLogonStr, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fileTimeToTime(lastLogon), nil
+}
+
+func (a *LdapAccount) AddServicePrincipal(ctx context.Context, spn string) error {
+	err := a.AddAttributeWithValues(ctx, "servicePrincipalName", []string{spn})
 	if err != nil {
 		return err
 	}
@@ -127,14 +371,14 @@ func (a *LdapAccount) AddServicePrincipal(spn string) error {
 	return nil
 }
 
-func (a *LdapAccount) RemoveServicePrincipal(spn string) error {
-	exists, err := a.HasServicePrincipal(spn)
+func (a *LdapAccount) RemoveServicePrincipal(ctx context.Context, spn string) error {
+	existing, err := a.findServicePrincipal(ctx, spn)
 	if err != nil {
 		return err
 	}
 
-	if exists {
-		err := a.RemoveAttributeValue("servicePrincipalName", []string{spn})
+	if existing != "" {
+		err := a.RemoveAttributeValue(ctx, "servicePrincipalName", []string{existing})
 		if err != nil {
 			return err
 		}
@@ -143,23 +387,34 @@ func (a *LdapAccount) RemoveServicePrincipal(spn string) error {
 	return nil
 }
 
-func (a *LdapAccount) GetServicePrincipals() ([]string, error) {
-	return a.GetAttributeValues("servicePrincipalName")
+func (a *LdapAccount) GetServicePrincipals(ctx context.Context) ([]string, error) {
+	return a.GetAttributeValues(ctx, "servicePrincipalName")
 }
 
-func (a *LdapAccount) HasServicePrincipal(spn string) (bool, error) {
-
-	spns, err := a.GetServicePrincipals()
+// HasServicePrincipal reports whether the account has the SPN, which AD
+// compares case-insensitively.
+func (a *LdapAccount) HasServicePrincipal(ctx context.Context, spn string) (bool, error) {
+	existing, err := a.findServicePrincipal(ctx, spn)
 	if err != nil {
 		return false, err
 	}
 
-	hasSPN := false
+	return existing != "", nil
+}
+
+// findServicePrincipal returns the SPN as stored on the account, or "" if the
+// account does not have it.
+func (a *LdapAccount) findServicePrincipal(ctx context.Context, spn string) (string, error) {
+	spns, err := a.GetServicePrincipals(ctx)
+	if err != nil {
+		return "", err
+	}
+
 	for _, attr := range spns {
-		if attr == spn {
-			hasSPN = true
+		if strings.EqualFold(attr, spn) {
+			return attr, nil
 		}
 	}
 
-	return hasSPN, nil
+	return "", nil
 }
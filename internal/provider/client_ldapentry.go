@@ -1,8 +1,11 @@
 package provider
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-ldap/ldap/v3"
 )
@@ -16,26 +19,49 @@ type LdapEntry struct {
 
 // LdapEntry receivers
 
-func (e *LdapEntry) ParentDN() string {
+// parseDN parses the entry's DN, returning an error rather than failing the
+// whole plugin if the directory handed back one that is malformed.
+func (e *LdapEntry) parseDN() (LdapDN, error) {
 	dn, err := NewLdapDN(e.DN)
 	if err != nil {
-		log.Fatal(err)
+		return dn, fmt.Errorf("error parsing DN \"%s\": %w", e.DN, err)
+	}
+	if len(dn.RDNs) == 0 {
+		return dn, fmt.Errorf("entry has an empty DN")
 	}
 
-	return dn.ParentDN()
+	return dn, nil
 }
 
-func (e *LdapEntry) RDN() string {
-	dn, err := NewLdapDN(e.DN)
+func (e *LdapEntry) ParentDN() (string, error) {
+	dn, err := e.parseDN()
+	if err != nil {
+		return "", err
+	}
+
+	return dn.ParentDN(), nil
+}
+
+func (e *LdapEntry) RDN() (string, error) {
+	dn, err := e.parseDN()
+	if err != nil {
+		return "", err
+	}
+
+	return dn.RDN(), nil
+}
+
+func (e *LdapEntry) Name() (string, error) {
+	dn, err := e.parseDN()
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
-	return dn.RDN()
+	return dn.Name(), nil
 }
 
-func (e *LdapEntry) Refresh() error {
-	ldapObject, err := e.GetObjectByDN(e.DN, e.requestedAttributes)
+func (e *LdapEntry) Refresh(ctx context.Context) error {
+	ldapObject, err := e.GetObjectByDN(ctx, e.DN, e.requestedAttributes)
 	if err != nil {
 		return err
 	}
@@ -46,7 +72,7 @@ func (e *LdapEntry) Refresh() error {
 	return nil
 }
 
-func (e *LdapEntry) Move(destinationContainer string) error {
+func (e *LdapEntry) Move(ctx context.Context, destinationContainer string) error {
 	dn, err := NewLdapDN(e.DN)
 	if err != nil {
 		return err
@@ -58,12 +84,10 @@ func (e *LdapEntry) Move(destinationContainer string) error {
 
 	newDN := JoinRDNs(append(dn.RDNs[:1], destinationDN.RDNs...))
 
-	e.ChangeDN(newDN)
-
-	return nil
+	return e.ChangeDN(ctx, newDN)
 }
 
-func (e *LdapEntry) Rename(newRDN string) error {
+func (e *LdapEntry) Rename(ctx context.Context, newRDN string) error {
 	dn, err := NewLdapDN(e.DN)
 	if err != nil {
 		return err
@@ -75,20 +99,10 @@ func (e *LdapEntry) Rename(newRDN string) error {
 
 	newDN := JoinRDNs(append(rDN.RDNs, dn.RDNs[1:]...))
 
-	e.ChangeDN(newDN)
-
-	return nil
+	return e.ChangeDN(ctx, newDN)
 }
 
-func (e *LdapEntry) ChangeDN(newDistinguishedName string) error {
-	alreadyExists, err := e.ObjectExists(newDistinguishedName, "*")
-	if err != nil {
-		return err
-	}
-	if alreadyExists {
-		return fmt.Errorf("rename failed: an object with distinguishedName \"%s\" already exists", newDistinguishedName)
-	}
-
+func (e *LdapEntry) ChangeDN(ctx context.Context, newDistinguishedName string) error {
 	oldDistinguishedName := e.DN
 
 	oldDN, err := NewLdapDN(oldDistinguishedName)
@@ -99,43 +113,128 @@ func (e *LdapEntry) ChangeDN(newDistinguishedName string) error {
 	if err != nil {
 		return err
 	}
+	if oldDN.Equal(newDN) {
+		return nil
+	}
 
 	newRDN := newDN.RDN()
 	newParentDN := newDN.ParentDN()
+	if oldDN.ParentDN() == newParentDN {
+		newParentDN = ""
+	}
 
-	if !oldDN.Equal(newDN) {
-		if oldDN.ParentDN() == newParentDN {
-			newParentDN = ""
-		} else {
-			newContainerExists, err := e.ContainerExists(newParentDN)
-			if err != nil {
-				return err
-			}
-			if !newContainerExists {
-				return fmt.Errorf("cannot move object %s to non-existent or non-container object \"%s\"", oldDistinguishedName, newParentDN)
-			}
-		}
-
-		request := ldap.NewModifyDNRequest(oldDistinguishedName, newRDN, true, newParentDN)
-		err = e.Conn.ModifyDN(request)
-		if err != nil {
-			return err
+	// The directory checks the new DN is free and its parent exists, so only
+	// failures are looked into, to explain them
+	request := ldap.NewModifyDNRequest(oldDistinguishedName, newRDN, true, newParentDN)
+	err = modifyDNContext(ctx, e.Conn, request)
+	if IsAlreadyExists(err) {
+		return fmt.Errorf("rename failed: an object with distinguishedName \"%s\" already exists", newDistinguishedName)
+	}
+	if err != nil && newParentDN != "" {
+		newContainerExists, existsErr := e.ContainerExists(ctx, newParentDN)
+		if existsErr == nil && !newContainerExists {
+			return fmt.Errorf("cannot move object %s to non-existent or non-container object \"%s\"", oldDistinguishedName, newParentDN)
 		}
 	}
+	if err != nil {
+		return err
+	}
+	e.DN = newDistinguishedName
 
 	return nil
 }
 
-func (e *LdapEntry) Delete() error {
+func (e *LdapEntry) Delete(ctx context.Context) error {
 	request := ldap.NewDelRequest(e.DN, nil)
-	err := e.Conn.Del(request)
+	err := delContext(ctx, e.Conn, request)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// getSecurityDescriptor reads the DACL of the entry's nTSecurityDescriptor,
+// searching for it unless the entry was read with it.
+func (e *LdapEntry) getSecurityDescriptor(ctx context.Context) (*securityDescriptor, error) {
+	if e.wasRequested("nTSecurityDescriptor") {
+		if value := e.Entry.GetRawAttributeValue("nTSecurityDescriptor"); len(value) > 0 {
+			return parseSecurityDescriptor(value)
+		}
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		e.DN,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"nTSecurityDescriptor"},
+		[]ldap.Control{sdFlagsControl(daclSecurityInformation)},
+	)
+
+	result, err := searchContext(ctx, e.Conn, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("object %s not found", e.DN)
+	}
+
+	value := result.Entries[0].GetRawAttributeValue("nTSecurityDescriptor")
+	if len(value) == 0 {
+		return nil, fmt.Errorf("unable to read nTSecurityDescriptor of %s", e.DN)
+	}
+
+	return parseSecurityDescriptor(value)
+}
+
+// setSecurityDescriptor writes back only the DACL of the security descriptor.
+func (e *LdapEntry) setSecurityDescriptor(ctx context.Context, sd *securityDescriptor) error {
+	request := ldap.NewModifyRequest(e.DN, []ldap.Control{sdFlagsControl(daclSecurityInformation)})
+	request.Replace("nTSecurityDescriptor", []string{string(sd.Bytes())})
+
+	err := modifyContext(ctx, e.Conn, request)
 	if err != nil {
 		return err
 	}
+	if e.wasRequested("nTSecurityDescriptor") {
+		e.setCachedAttributeValues("nTSecurityDescriptor", []string{string(sd.Bytes())})
+	}
 	return nil
 }
 
-func (e *LdapEntry) AddAttributeWithValues(name string, value []string) error {
+// IsProtectedFromDeletion reports whether the entry carries the deny-delete
+// ACE set by "Protect object from accidental deletion".
+func (e *LdapEntry) IsProtectedFromDeletion(ctx context.Context) (bool, error) {
+	sd, err := e.getSecurityDescriptor(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return sd.HasACE(denyDeleteACE()), nil
+}
+
+// SetProtectedFromDeletion adds or removes the deny-delete ACE.
+func (e *LdapEntry) SetProtectedFromDeletion(ctx context.Context, protect bool) error {
+	sd, err := e.getSecurityDescriptor(ctx)
+	if err != nil {
+		return err
+	}
+
+	if sd.HasACE(denyDeleteACE()) == protect {
+		return nil
+	}
+	if protect {
+		err = sd.AddACE(denyDeleteACE())
+		if err != nil {
+			return fmt.Errorf("error protecting %s from deletion: %s", e.DN, err)
+		}
+	} else {
+		sd.RemoveACE(denyDeleteACE())
+	}
+
+	return e.setSecurityDescriptor(ctx, sd)
+}
+
+func (e *LdapEntry) AddAttributeWithValues(ctx context.Context, name string, value []string) error {
 	exists := e.HasAttributeWithValues(name, value)
 	if exists {
 		return fmt.Errorf("attribute %s with value %s already exists", name, value)
@@ -144,7 +243,7 @@ func (e *LdapEntry) AddAttributeWithValues(name string, value []string) error {
 	request := ldap.NewModifyRequest(e.DN, nil)
 	request.Add(name, value)
 
-	err := e.Conn.Modify(request)
+	err := modifyContext(ctx, e.Conn, request)
 	if err != nil {
 		return err
 	}
@@ -152,8 +251,8 @@ func (e *LdapEntry) AddAttributeWithValues(name string, value []string) error {
 	return nil
 }
 
-func (e *LdapEntry) GetAttributeValue(name string) (string, error) {
-	value, err := e.GetAttributeValues(name)
+func (e *LdapEntry) GetAttributeValue(ctx context.Context, name string) (string, error) {
+	value, err := e.GetAttributeValues(ctx, name)
 	if err != nil {
 		return "", err
 	}
@@ -163,67 +262,283 @@ func (e *LdapEntry) GetAttributeValue(name string) (string, error) {
 	return "", nil
 }
 
-func (e *LdapEntry) GetAttributeValues(name string) ([]string, error) {
-	attrPresent := false
-	if len(e.Attributes) > 0 {
+func (e *LdapEntry) GetAttributeValues(ctx context.Context, name string) ([]string, error) {
+	err := e.loadAttribute(ctx, name)
+	if err != nil {
+		return []string{}, err
+	}
+
+	attributes := e.Entry.GetEqualFoldAttributeValues(name)
+
+	return attributes, nil
+
+}
+
+func (e *LdapEntry) GetRawAttributeValue(ctx context.Context, name string) ([]byte, error) {
+	err := e.loadAttribute(ctx, name)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return e.Entry.GetEqualFoldRawAttributeValue(name), nil
+}
+
+func (e *LdapEntry) GetRawAttributeValues(ctx context.Context, name string) ([][]byte, error) {
+	err := e.loadAttribute(ctx, name)
+	if err != nil {
+		return [][]byte{}, err
+	}
+
+	return e.Entry.GetEqualFoldRawAttributeValues(name), nil
+}
+
+// loadAttribute refreshes the entry with the named attribute if it was not
+// part of the original request.
+func (e *LdapEntry) loadAttribute(ctx context.Context, name string) error {
+	return e.loadAttributes(ctx, []string{name})
+}
+
+// wasRequested reports whether the attribute was named in the request that
+// read the entry.
+func (e *LdapEntry) wasRequested(name string) bool {
+	for _, requested := range e.requestedAttributes {
+		if strings.EqualFold(requested, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAttributes refreshes the entry once with any of the named attributes
+// that were not part of the original request.
+func (e *LdapEntry) loadAttributes(ctx context.Context, names []string) error {
+	err := e.loadRanges(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, name := range names {
+		// The directory leaves out requested attributes that have no values
+		attrPresent := e.wasRequested(name)
 		for _, attr := range e.Attributes {
-			if attr.Name == name {
+			if strings.EqualFold(attr.Name, name) {
 				attrPresent = true
 			}
 		}
+		if !attrPresent {
+			missing = append(missing, name)
+		}
 	}
-	if !attrPresent {
-		e.requestedAttributes = append(e.requestedAttributes, name)
-		err := e.Refresh()
+	if len(missing) > 0 {
+		// A nil request returned all user attributes, which should be kept
+		if e.requestedAttributes == nil {
+			e.requestedAttributes = []string{"*"}
+		}
+		e.requestedAttributes = append(e.requestedAttributes, missing...)
+		err := e.Refresh(ctx)
+		if err != nil {
+			return fmt.Errorf("error refreshing LdapEntry: %w", err)
+		}
+		err = e.loadRanges(ctx, missing)
 		if err != nil {
-			return []string{}, fmt.Errorf("error refreshing LdapEntry: %s", err)
+			return err
+		}
+
+		// Remember attributes without values, so they aren't fetched again
+		for _, name := range missing {
+			if len(e.Entry.GetEqualFoldRawAttributeValues(name)) == 0 {
+				e.setCachedAttributeValues(name, []string{})
+			}
 		}
 	}
 
-	attributes := e.Entry.GetAttributeValues(name)
+	return nil
+}
 
-	return attributes, nil
+// parseRangedAttribute splits a ranged attribute description, such as
+// member;range=0-1499, into the attribute name and the last value's index.
+// The final range of values ends in "*", reported as a negative index.
+func parseRangedAttribute(description string) (string, int, bool) {
+	name, valueRange, found := strings.Cut(description, ";range=")
+	if !found {
+		return description, 0, false
+	}
+	_, high, found := strings.Cut(valueRange, "-")
+	if !found {
+		return description, 0, false
+	}
+	if high == "*" {
+		return name, -1, true
+	}
+	last, err := strconv.Atoi(high)
+	if err != nil {
+		return description, 0, false
+	}
+	return name, last, true
+}
+
+// loadRanges completes the named attributes that AD returned in ranges, as it
+// does for attributes with more values than its MaxValRange policy, such as
+// the member attribute of large groups, by requesting the rest of the values.
+func (e *LdapEntry) loadRanges(ctx context.Context, names []string) error {
+	for _, name := range names {
+		for i, attr := range e.Entry.Attributes {
+			rangedName, last, ok := parseRangedAttribute(attr.Name)
+			if !ok || !strings.EqualFold(rangedName, name) {
+				continue
+			}
+
+			values := attr.Values
+			for last >= 0 {
+				searchRequest := ldap.NewSearchRequest(
+					e.DN,
+					ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+					"(objectClass=*)",
+					[]string{fmt.Sprintf("%s;range=%d-*", name, last+1)},
+					nil,
+				)
+				result, err := searchContext(ctx, e.Conn, searchRequest)
+				if err != nil {
+					return err
+				}
+				if len(result.Entries) != 1 {
+					return &NotFoundError{ObjectClass: "*", Name: e.DN}
+				}
+
+				next := -1
+				for _, nextAttr := range result.Entries[0].Attributes {
+					if nextName, nextLast, ok := parseRangedAttribute(nextAttr.Name); ok && strings.EqualFold(nextName, name) {
+						values = append(values, nextAttr.Values...)
+						next = nextLast
+					}
+				}
+				if next >= 0 && next <= last {
+					return fmt.Errorf("error reading %s of %s: range retrieval did not advance past value %d", name, e.DN, last)
+				}
+				last = next
+			}
+
+			e.Entry.Attributes = append(e.Entry.Attributes[:i], e.Entry.Attributes[i+1:]...)
+			e.setCachedAttributeValues(name, values)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (e *LdapEntry) GetObjectGUID(ctx context.Context) (string, error) {
+	objectGUID, err := e.GetRawAttributeValue(ctx, "objectGUID")
+	if err != nil {
+		return "", err
+	}
+	return formatGUID(objectGUID), nil
+}
+
+func (e *LdapEntry) GetObjectSID(ctx context.Context) (string, error) {
+	objectSid, err := e.GetRawAttributeValue(ctx, "objectSid")
+	if err != nil || len(objectSid) == 0 {
+		return "", err
+	}
+	return formatSID(objectSid)
+}
 
+func (e *LdapEntry) GetWhenCreated(ctx context.Context) (time.Time, error) {
+	whenCreated, err := e.GetAttributeValue(ctx, "whenCreated")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return generalizedTimeToTime(whenCreated)
 }
 
 func (e *LdapEntry) HasAttributeWithValues(name string, values []string) bool {
-	attributes := e.Entry.GetAttributeValues(name)
+	attributes := e.Entry.GetEqualFoldAttributeValues(name)
 
 	return sliceIsSubset(attributes, values)
 }
 
-func (e *LdapEntry) UpdateAttribute(name string, values []string) error {
+func (e *LdapEntry) UpdateAttribute(ctx context.Context, name string, values []string) error {
 	attributeMap := map[string][]string{}
 	attributeMap[name] = values
 
-	err := e.UpdateAttributes(attributeMap)
+	err := e.UpdateAttributes(ctx, attributeMap)
 	return err
 }
 
-func (e *LdapEntry) UpdateAttributes(attributeMap map[string][]string) error {
+// UpdateAttributes replaces the values of the attributes that differ from the
+// directory.  Empty values are dropped, so an empty string or list clears the
+// attribute.
+func (e *LdapEntry) UpdateAttributes(ctx context.Context, attributeMap map[string][]string) error {
 	request := ldap.NewModifyRequest(e.DN, nil)
 
-	for attr, newValue := range attributeMap {
-		oldValue := e.Entry.GetAttributeValues(attr)
+	names := make([]string, 0, len(attributeMap))
+	for attr := range attributeMap {
+		names = append(names, attr)
+	}
+	err := e.loadAttributes(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	changed := map[string][]string{}
+	for attr, values := range attributeMap {
+		newValue := nonEmptyValues(values)
+		oldValue, err := e.GetAttributeValues(ctx, attr)
+		if err != nil {
+			return err
+		}
 		if !stringSlicesEqual(oldValue, newValue) {
 			request.Replace(attr, newValue)
+			changed[attr] = newValue
 		}
 	}
 	if len(request.Changes) > 0 {
-		err := e.Conn.Modify(request)
+		err := modifyContext(ctx, e.Conn, request)
 		if err != nil {
 			return err
 		}
 	}
+
+	// Keep the cached entry in step, so later comparisons see the new values
+	for attr, values := range changed {
+		e.setCachedAttributeValues(attr, values)
+	}
+
 	return nil
 }
 
-func (e *LdapEntry) RemoveAttributeValue(name string, value []string) error {
+func (e *LdapEntry) setCachedAttributeValues(name string, values []string) {
+	for _, attr := range e.Entry.Attributes {
+		if strings.EqualFold(attr.Name, name) {
+			attr.Values = values
+			attr.ByteValues = nil
+			for _, value := range values {
+				attr.ByteValues = append(attr.ByteValues, []byte(value))
+			}
+			return
+		}
+	}
+	e.Entry.Attributes = append(e.Entry.Attributes, ldap.NewEntryAttribute(name, values))
+}
+
+// nonEmptyValues drops empty strings, which the directory rejects as values.
+func nonEmptyValues(values []string) []string {
+	result := []string{}
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func (e *LdapEntry) RemoveAttributeValue(ctx context.Context, name string, value []string) error {
 	dn := e.DN
 	request := ldap.NewModifyRequest(dn, nil)
 	request.Delete(name, value)
 
-	err := e.Conn.Modify(request)
+	err := modifyContext(ctx, e.Conn, request)
 	if err != nil {
 		return err
 	}
@@ -1,18 +1,22 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-ldap/ldap/v3"
 )
 
+// LDAP_SERVER_TREE_DELETE_OID deletes an object and everything beneath it.
+const controlTypeTreeDelete = "1.2.840.113556.1.4.805"
+
 type LdapOU struct {
 	*LdapEntry
 }
 
 // LdapOU receivers
 
-func (o *LdapOU) IsEmpty() (bool, error) {
+func (o *LdapOU) IsEmpty(ctx context.Context) (bool, error) {
 	searchRequest := ldap.NewSearchRequest(
 		o.DN, // The base dn to search
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
@@ -21,7 +25,7 @@ func (o *LdapOU) IsEmpty() (bool, error) {
 		nil,
 	)
 
-	result, err := o.Conn.Search(searchRequest)
+	result, err := searchContext(ctx, o.Conn, searchRequest)
 	if err != nil {
 		return false, err
 	}
@@ -34,8 +38,8 @@ func (o *LdapOU) IsEmpty() (bool, error) {
 	return true, nil
 }
 
-func (o *LdapOU) Delete() error {
-	isEmpty, err := o.IsEmpty()
+func (o *LdapOU) Delete(ctx context.Context) error {
+	isEmpty, err := o.IsEmpty(ctx)
 	if err != nil {
 		return err
 	}
@@ -43,10 +47,38 @@ func (o *LdapOU) Delete() error {
 		return fmt.Errorf("unable to delete \"%s\": organizational unit is not empty", o.DN)
 	}
 
-	err = o.LdapEntry.Delete()
+	err = o.LdapEntry.Delete(ctx)
 	return err
 }
 
-func (o *LdapOU) Rename(distinguishedName string) error {
-	return o.ChangeDN(distinguishedName)
+// DeleteRecursively deletes the OU along with any objects it still contains.
+func (o *LdapOU) DeleteRecursively(ctx context.Context) error {
+	request := ldap.NewDelRequest(o.DN, []ldap.Control{ldap.NewControlString(controlTypeTreeDelete, true, "")})
+
+	return delContext(ctx, o.Conn, request)
+}
+
+// Relocate renames and/or moves the OU to the new distinguished name, creating
+// missing parent OUs if requested.
+func (o *LdapOU) Relocate(ctx context.Context, distinguishedName string, createParents bool) error {
+	oldDN, err := NewLdapDN(o.DN)
+	if err != nil {
+		return err
+	}
+	newDN, err := NewLdapDN(distinguishedName)
+	if err != nil {
+		return err
+	}
+	if oldDN.AncestorOf(newDN.DN) {
+		return fmt.Errorf("cannot move organizational unit \"%s\" beneath itself to \"%s\"", o.DN, distinguishedName)
+	}
+
+	if createParents {
+		_, err = o.CreateParentOUs(ctx, distinguishedName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return o.ChangeDN(ctx, distinguishedName)
 }
@@ -0,0 +1,566 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldifLineLength is where LDIF lines are folded, as RFC 2849 recommends.
+const ldifLineLength = 76
+
+// ldifPagingSize is the page size of LDIF exports, below AD's default
+// MaxPageSize of 1000.
+const ldifPagingSize = 500
+
+// ExportLDIF searches beneath the base DN and returns the entries found as
+// LDIF content records, along with their DNs and how many matched in all.
+// Parents come before their children, so the output can be imported as it
+// is, unless an order is given, which sorts and windows them on the server.
+func (c *LdapClient) ExportLDIF(ctx context.Context, baseDN string, scope int, filter string, attributes []string, order *SearchOrder) (string, []string, int, error) {
+	searchRequest := ldap.NewSearchRequest(
+		baseDN,
+		scope, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		attributes,
+		searchControls(attributes),
+	)
+
+	var entries []*ldap.Entry
+	total := 0
+	if order != nil {
+		result, matched, err := c.searchOrdered(ctx, searchRequest, order, ldifPagingSize)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		entries, total = result.Entries, matched
+	} else {
+		result, err := searchWithPagingContext(ctx, c.Conn, searchRequest, ldifPagingSize)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		entries, total = sortEntriesParentFirst(result.Entries), len(result.Entries)
+	}
+
+	dns := make([]string, len(entries))
+	for i, entry := range entries {
+		dns[i] = entry.DN
+	}
+	return formatLDIF(entries), dns, total, nil
+}
+
+// sortEntriesParentFirst orders entries by depth, then by DN, so that every
+// entry follows its parent and the order doesn't depend on the server.
+func sortEntriesParentFirst(entries []*ldap.Entry) []*ldap.Entry {
+	type sortable struct {
+		entry *ldap.Entry
+		depth int
+		key   string
+	}
+	keyed := make([]sortable, len(entries))
+	for i, entry := range entries {
+		depth := 0
+		if dn, err := NewLdapDN(entry.DN); err == nil {
+			depth = len(dn.RDNs)
+		}
+		keyed[i] = sortable{entry: entry, depth: depth, key: normalizeDN(entry.DN)}
+	}
+	sort.SliceStable(keyed, func(i, j int) bool {
+		if keyed[i].depth != keyed[j].depth {
+			return keyed[i].depth < keyed[j].depth
+		}
+		return keyed[i].key < keyed[j].key
+	})
+
+	sorted := make([]*ldap.Entry, len(keyed))
+	for i, k := range keyed {
+		sorted[i] = k.entry
+	}
+	return sorted
+}
+
+// formatLDIF renders entries as an RFC 2849 LDIF file of content records,
+// with objectClass first and the other attributes in alphabetical order.
+func formatLDIF(entries []*ldap.Entry) string {
+	var b strings.Builder
+	b.WriteString("version: 1\n")
+	for _, entry := range entries {
+		b.WriteString("\n")
+		b.WriteString(ldifLine("dn", []byte(entry.DN)))
+
+		attributes := make([]*ldap.EntryAttribute, len(entry.Attributes))
+		copy(attributes, entry.Attributes)
+		sort.SliceStable(attributes, func(i, j int) bool {
+			iClass := strings.EqualFold(attributes[i].Name, "objectClass")
+			jClass := strings.EqualFold(attributes[j].Name, "objectClass")
+			if iClass != jClass {
+				return iClass
+			}
+			return strings.ToLower(attributes[i].Name) < strings.ToLower(attributes[j].Name)
+		})
+		for _, attribute := range attributes {
+			for _, value := range attribute.ByteValues {
+				b.WriteString(ldifLine(attribute.Name, value))
+			}
+		}
+	}
+	return b.String()
+}
+
+// ldifLine renders one attribute value, base64-encoding values that aren't
+// safe to write as they are, and folds it.
+func ldifLine(name string, value []byte) string {
+	line := name + ": " + string(value)
+	if !ldifSafeString(value) {
+		line = name + ":: " + base64.StdEncoding.EncodeToString(value)
+	}
+	return foldLDIFLine(line) + "\n"
+}
+
+// ldifSafeString reports whether RFC 2849 allows the value unencoded: ASCII
+// without NUL, CR or LF, not starting with a space, colon or "<", and not
+// ending with a space.
+func ldifSafeString(value []byte) bool {
+	if len(value) == 0 {
+		return true
+	}
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+	if value[len(value)-1] == ' ' {
+		return false
+	}
+	for _, c := range value {
+		if c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// foldLDIFLine splits a line longer than ldifLineLength into continuation
+// lines, which start with a single space.
+func foldLDIFLine(line string) string {
+	if len(line) <= ldifLineLength {
+		return line
+	}
+	var b strings.Builder
+	b.WriteString(line[:ldifLineLength])
+	for rest := line[ldifLineLength:]; len(rest) > 0; {
+		n := ldifLineLength - 1
+		if n > len(rest) {
+			n = len(rest)
+		}
+		fmt.Fprintf(&b, "\n %s", rest[:n])
+		rest = rest[n:]
+	}
+	return b.String()
+}
+
+const (
+	ldifChangeAdd    = "add"
+	ldifChangeDelete = "delete"
+	ldifChangeModify = "modify"
+	ldifChangeModRDN = "modrdn"
+)
+
+// ldifAttribute is an attribute and its values in an LDIF record.
+type ldifAttribute struct {
+	Name   string
+	Values []string
+}
+
+// ldifModification is one add, delete or replace of a modify record.
+type ldifModification struct {
+	Operation string
+	ldifAttribute
+}
+
+// ldifRecord is an LDIF change record.  Content records are parsed as adds.
+type ldifRecord struct {
+	DN            string
+	ChangeType    string
+	Attributes    []ldifAttribute    // Of an add
+	Modifications []ldifModification // Of a modify
+	NewRDN        string             // Of a modrdn
+	DeleteOldRDN  bool               // Of a modrdn
+	NewSuperior   string             // Of a modrdn, empty to keep the parent
+}
+
+// ldifPair is a parsed "name: value" line; the "-" ending a modification has
+// the name "-".
+type ldifPair struct {
+	name  string
+	value string
+	line  int
+}
+
+// parseLDIF parses an RFC 2849 LDIF file of content or change records.
+// Values read from URLs and controls aren't supported.
+func parseLDIF(text string) ([]ldifRecord, error) {
+	var records []ldifRecord
+	var pairs []ldifPair
+	flush := func() error {
+		if len(pairs) == 0 {
+			return nil
+		}
+		if len(records) == 0 && strings.EqualFold(pairs[0].name, "version") {
+			if pairs[0].value != "1" {
+				return fmt.Errorf("line %d: unsupported LDIF version %s", pairs[0].line, pairs[0].value)
+			}
+			pairs = pairs[1:]
+			if len(pairs) == 0 {
+				return nil
+			}
+		}
+		record, err := parseLDIFRecord(pairs)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+		pairs = nil
+		return nil
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var logical []string
+	var start []int
+	inComment := false
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, " "):
+			if inComment {
+				continue
+			}
+			if len(logical) == 0 || logical[len(logical)-1] == "" {
+				return nil, fmt.Errorf("line %d: continuation line without a line to continue", i+1)
+			}
+			logical[len(logical)-1] += line[1:]
+		case strings.HasPrefix(line, "#"):
+			inComment = true
+		default:
+			inComment = false
+			logical = append(logical, line)
+			start = append(start, i+1)
+		}
+	}
+
+	for i, line := range logical {
+		if line == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		pair, err := parseLDIFLine(line, start[i])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func parseLDIFLine(line string, number int) (ldifPair, error) {
+	if line == "-" {
+		return ldifPair{name: "-", line: number}, nil
+	}
+	colon := strings.Index(line, ":")
+	if colon <= 0 {
+		return ldifPair{}, fmt.Errorf("line %d: expected \"name: value\", got %q", number, line)
+	}
+	pair := ldifPair{name: line[:colon], line: number}
+	rest := line[colon+1:]
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return pair, fmt.Errorf("line %d: error decoding base64 value of %s: %s", number, pair.name, err)
+		}
+		pair.value = string(value)
+	case strings.HasPrefix(rest, "<"):
+		return pair, fmt.Errorf("line %d: values read from URLs aren't supported", number)
+	default:
+		pair.value = strings.TrimLeft(rest, " ")
+	}
+	return pair, nil
+}
+
+func parseLDIFRecord(pairs []ldifPair) (ldifRecord, error) {
+	var record ldifRecord
+	if !strings.EqualFold(pairs[0].name, "dn") {
+		return record, fmt.Errorf("line %d: expected a record to start with dn, got %s", pairs[0].line, pairs[0].name)
+	}
+	if _, err := NewLdapDN(pairs[0].value); err != nil || pairs[0].value == "" {
+		return record, fmt.Errorf("line %d: invalid DN %q", pairs[0].line, pairs[0].value)
+	}
+	record.DN = pairs[0].value
+	pairs = pairs[1:]
+
+	if len(pairs) > 0 && strings.EqualFold(pairs[0].name, "control") {
+		return record, fmt.Errorf("line %d: controls aren't supported; use ldap_controls", pairs[0].line)
+	}
+	record.ChangeType = ldifChangeAdd
+	if len(pairs) > 0 && strings.EqualFold(pairs[0].name, "changetype") {
+		record.ChangeType = strings.ToLower(pairs[0].value)
+		if record.ChangeType == "moddn" {
+			record.ChangeType = ldifChangeModRDN
+		}
+		pairs = pairs[1:]
+	}
+
+	switch record.ChangeType {
+	case ldifChangeAdd:
+		for _, pair := range pairs {
+			if pair.name == "-" {
+				return record, fmt.Errorf("line %d: unexpected \"-\" in an add", pair.line)
+			}
+			record.Attributes = appendLDIFValue(record.Attributes, pair.name, pair.value)
+		}
+		if len(record.Attributes) == 0 {
+			return record, fmt.Errorf("record %s adds an object without attributes", record.DN)
+		}
+	case ldifChangeDelete:
+		if len(pairs) > 0 {
+			return record, fmt.Errorf("line %d: unexpected %s in a delete", pairs[0].line, pairs[0].name)
+		}
+	case ldifChangeModRDN:
+		for _, pair := range pairs {
+			switch strings.ToLower(pair.name) {
+			case "newrdn":
+				record.NewRDN = pair.value
+			case "deleteoldrdn":
+				if pair.value != "0" && pair.value != "1" {
+					return record, fmt.Errorf("line %d: deleteoldrdn must be 0 or 1", pair.line)
+				}
+				record.DeleteOldRDN = pair.value == "1"
+			case "newsuperior":
+				record.NewSuperior = pair.value
+			default:
+				return record, fmt.Errorf("line %d: unexpected %s in a modrdn", pair.line, pair.name)
+			}
+		}
+		if record.NewRDN == "" {
+			return record, fmt.Errorf("record %s renames the object without a newrdn", record.DN)
+		}
+	case ldifChangeModify:
+		for len(pairs) > 0 {
+			operation := strings.ToLower(pairs[0].name)
+			if operation != "add" && operation != "delete" && operation != "replace" {
+				return record, fmt.Errorf("line %d: unsupported modification %s", pairs[0].line, pairs[0].name)
+			}
+			modification := ldifModification{Operation: operation, ldifAttribute: ldifAttribute{Name: pairs[0].value}}
+			pairs = pairs[1:]
+			for len(pairs) > 0 && pairs[0].name != "-" {
+				if !strings.EqualFold(pairs[0].name, modification.Name) {
+					return record, fmt.Errorf("line %d: expected a value of %s, got %s", pairs[0].line, modification.Name, pairs[0].name)
+				}
+				modification.Values = append(modification.Values, pairs[0].value)
+				pairs = pairs[1:]
+			}
+			if len(pairs) == 0 {
+				return record, fmt.Errorf("record %s: modification of %s isn't ended with \"-\"", record.DN, modification.Name)
+			}
+			pairs = pairs[1:]
+			if operation == "add" && len(modification.Values) == 0 {
+				return record, fmt.Errorf("record %s adds no values to %s", record.DN, modification.Name)
+			}
+			record.Modifications = append(record.Modifications, modification)
+		}
+	default:
+		return record, fmt.Errorf("record %s has unsupported changetype %s", record.DN, record.ChangeType)
+	}
+
+	return record, nil
+}
+
+func appendLDIFValue(attributes []ldifAttribute, name string, value string) []ldifAttribute {
+	for i := range attributes {
+		if strings.EqualFold(attributes[i].Name, name) {
+			attributes[i].Values = append(attributes[i].Values, value)
+			return attributes
+		}
+	}
+	return append(attributes, ldifAttribute{Name: name, Values: []string{value}})
+}
+
+// formatLDIFRecords renders change records as an LDIF file.
+func formatLDIFRecords(records []ldifRecord) string {
+	var b strings.Builder
+	b.WriteString("version: 1\n")
+	for _, record := range records {
+		b.WriteString("\n")
+		b.WriteString(ldifLine("dn", []byte(record.DN)))
+		b.WriteString(ldifLine("changetype", []byte(record.ChangeType)))
+		switch record.ChangeType {
+		case ldifChangeAdd:
+			for _, attribute := range record.Attributes {
+				for _, value := range attribute.Values {
+					b.WriteString(ldifLine(attribute.Name, []byte(value)))
+				}
+			}
+		case ldifChangeModify:
+			for _, modification := range record.Modifications {
+				b.WriteString(ldifLine(modification.Operation, []byte(modification.Name)))
+				for _, value := range modification.Values {
+					b.WriteString(ldifLine(modification.Name, []byte(value)))
+				}
+				b.WriteString("-\n")
+			}
+		case ldifChangeModRDN:
+			b.WriteString(ldifLine("newrdn", []byte(record.NewRDN)))
+			if record.DeleteOldRDN {
+				b.WriteString("deleteoldrdn: 1\n")
+			} else {
+				b.WriteString("deleteoldrdn: 0\n")
+			}
+			if record.NewSuperior != "" {
+				b.WriteString(ldifLine("newsuperior", []byte(record.NewSuperior)))
+			}
+		}
+	}
+	return b.String()
+}
+
+// ldifWriteOnlyAttributes can be written but never read, so changes to them
+// can't be reversed.
+var ldifWriteOnlyAttributes = []string{"unicodePwd", "userPassword"}
+
+// ApplyLDIF applies the change records in order.  It returns the records that
+// reverse what was applied, in the order to apply them, even when it fails
+// part way, and warnings about changes that can't be reversed.
+func (c *LdapClient) ApplyLDIF(ctx context.Context, records []ldifRecord) ([]ldifRecord, []string, error) {
+	var reverse []ldifRecord
+	var warnings []string
+	for _, record := range records {
+		undo, warning, err := c.applyLDIFRecord(ctx, record)
+		if err != nil {
+			return reverse, warnings, fmt.Errorf("error applying %s of %s: %w", record.ChangeType, record.DN, err)
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		if undo != nil {
+			reverse = append([]ldifRecord{*undo}, reverse...)
+		}
+	}
+	return reverse, warnings, nil
+}
+
+func (c *LdapClient) applyLDIFRecord(ctx context.Context, record ldifRecord) (*ldifRecord, string, error) {
+	switch record.ChangeType {
+	case ldifChangeAdd:
+		request := ldap.NewAddRequest(record.DN, nil)
+		for _, attribute := range record.Attributes {
+			request.Attribute(attribute.Name, attribute.Values)
+		}
+		err := addContext(ctx, c.Conn, request)
+		if err != nil {
+			return nil, "", err
+		}
+		return &ldifRecord{DN: record.DN, ChangeType: ldifChangeDelete}, "", nil
+
+	case ldifChangeDelete:
+		err := delContext(ctx, c.Conn, ldap.NewDelRequest(record.DN, nil))
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, fmt.Sprintf("The delete of %s can't be reversed.", record.DN), nil
+
+	case ldifChangeModify:
+		undo, warning, err := c.reverseLDIFModify(ctx, record)
+		if err != nil {
+			return nil, "", err
+		}
+		request := ldap.NewModifyRequest(record.DN, nil)
+		for _, modification := range record.Modifications {
+			switch modification.Operation {
+			case "add":
+				request.Add(modification.Name, modification.Values)
+			case "delete":
+				request.Delete(modification.Name, modification.Values)
+			case "replace":
+				request.Replace(modification.Name, modification.Values)
+			}
+		}
+		err = modifyContext(ctx, c.Conn, request)
+		if err != nil {
+			return nil, "", err
+		}
+		return undo, warning, nil
+
+	case ldifChangeModRDN:
+		dn, err := NewLdapDN(record.DN)
+		if err != nil {
+			return nil, "", err
+		}
+		parent := dn.ParentDN()
+		if record.NewSuperior != "" {
+			parent = record.NewSuperior
+		}
+		request := ldap.NewModifyDNRequest(record.DN, record.NewRDN, record.DeleteOldRDN, record.NewSuperior)
+		err = modifyDNContext(ctx, c.Conn, request)
+		if err != nil {
+			return nil, "", err
+		}
+		undo := &ldifRecord{DN: record.NewRDN + "," + parent, ChangeType: ldifChangeModRDN, NewRDN: dn.RDN(), DeleteOldRDN: true}
+		if record.NewSuperior != "" {
+			undo.NewSuperior = dn.ParentDN()
+		}
+		return undo, "", nil
+	}
+
+	return nil, "", fmt.Errorf("unsupported changetype %s", record.ChangeType)
+}
+
+// reverseLDIFModify reads the attributes a modify record changes, returning a
+// modify that replaces them with their current values.
+func (c *LdapClient) reverseLDIFModify(ctx context.Context, record ldifRecord) (*ldifRecord, string, error) {
+	var names []string
+	var writeOnly []string
+	for _, modification := range record.Modifications {
+		if sliceContainsFold(ldifWriteOnlyAttributes, modification.Name) {
+			if !sliceContainsFold(writeOnly, modification.Name) {
+				writeOnly = append(writeOnly, modification.Name)
+			}
+			continue
+		}
+		if !sliceContainsFold(names, modification.Name) {
+			names = append(names, modification.Name)
+		}
+	}
+
+	warning := ""
+	if len(writeOnly) > 0 {
+		warning = fmt.Sprintf("The changes to %s of %s can't be reversed.", strings.Join(writeOnly, ", "), record.DN)
+	}
+	if len(names) == 0 {
+		return nil, warning, nil
+	}
+
+	entry, err := c.GetObjectByDN(ctx, record.DN, names)
+	if err != nil {
+		return nil, "", err
+	}
+	undo := &ldifRecord{DN: record.DN, ChangeType: ldifChangeModify}
+	for _, name := range names {
+		values, err := entry.GetRawAttributeValues(ctx, name)
+		if err != nil {
+			return nil, "", err
+		}
+		modification := ldifModification{Operation: "replace", ldifAttribute: ldifAttribute{Name: name}}
+		for _, value := range values {
+			modification.Values = append(modification.Values, string(value))
+		}
+		undo.Modifications = append(undo.Modifications, modification)
+	}
+	return undo, warning, nil
+}
@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// pwdProperties flag requiring complex passwords
+const domainPasswordComplex = 0x1
+
+// PasswordPolicy holds the password rules that apply to an account, from its
+// fine-grained password policy or, failing that, the domain.
+type PasswordPolicy struct {
+	Source        string
+	MinLength     int
+	HistoryLength int
+	MinAge        time.Duration
+	Complexity    bool
+}
+
+// PasswordPolicyError is returned when the directory rejects a password,
+// explaining which rule of the policy it breaks.
+type PasswordPolicyError struct {
+	Account string
+	Reason  string
+	Err     error
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("password for %s was rejected by the password policy: %s: %s", e.Account, e.Reason, e.Err)
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return e.Err
+}
+
+// isPasswordPolicyError reports whether a password change failed on policy,
+// which AD reports as ERROR_PASSWORD_RESTRICTION or a constraint violation.
+func isPasswordPolicyError(err error) bool {
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) {
+		return false
+	}
+	if ldapErr.Err != nil {
+		if code, ok := adErrorCode(ldapErr.Err.Error()); ok && code == 0x0000052D {
+			return true
+		}
+	}
+	return ldapErr.ResultCode == ldap.LDAPResultConstraintViolation
+}
+
+// intervalToDuration converts an AD interval, a negative count of 100ns units,
+// to a time.Duration.
+func intervalToDuration(value string) time.Duration {
+	interval, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || interval >= 0 {
+		return 0
+	}
+	return time.Duration(-interval * 100)
+}
+
+// GetPasswordPolicy reads the policy that applies to the account: its
+// resultant fine-grained password policy if there is one and it can be read,
+// otherwise the domain's.
+func (a *LdapAccount) GetPasswordPolicy(ctx context.Context) (*PasswordPolicy, error) {
+	psoDN, err := a.GetAttributeValue(ctx, "msDS-ResultantPSO")
+	if err == nil && psoDN != "" {
+		pso, err := a.GetObjectByDN(ctx, psoDN, []string{
+			"msDS-MinimumPasswordLength", "msDS-PasswordHistoryLength",
+			"msDS-MinimumPasswordAge", "msDS-PasswordComplexityEnabled",
+		})
+		if err == nil {
+			return &PasswordPolicy{
+				Source:        psoDN,
+				MinLength:     atoiOrZero(pso.Entry.GetEqualFoldAttributeValue("msDS-MinimumPasswordLength")),
+				HistoryLength: atoiOrZero(pso.Entry.GetEqualFoldAttributeValue("msDS-PasswordHistoryLength")),
+				MinAge:        intervalToDuration(pso.Entry.GetEqualFoldAttributeValue("msDS-MinimumPasswordAge")),
+				Complexity:    strings.EqualFold(pso.Entry.GetEqualFoldAttributeValue("msDS-PasswordComplexityEnabled"), "TRUE"),
+			}, nil
+		}
+	}
+
+	domainDN, err := a.DefaultNamingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := a.GetObjectByDN(ctx, domainDN, []string{"minPwdLength", "pwdHistoryLength", "minPwdAge", "pwdProperties"})
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordPolicy{
+		Source:        domainDN,
+		MinLength:     atoiOrZero(domain.Entry.GetEqualFoldAttributeValue("minPwdLength")),
+		HistoryLength: atoiOrZero(domain.Entry.GetEqualFoldAttributeValue("pwdHistoryLength")),
+		MinAge:        intervalToDuration(domain.Entry.GetEqualFoldAttributeValue("minPwdAge")),
+		Complexity:    atoiOrZero(domain.Entry.GetEqualFoldAttributeValue("pwdProperties"))&domainPasswordComplex != 0,
+	}, nil
+}
+
+// passwordCategories counts the character categories AD's complexity rule
+// recognises: uppercase, lowercase, digits, symbols, and other letters.
+func passwordCategories(password string) int {
+	var upper, lower, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsLetter(r):
+			other = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{upper, lower, digit, symbol, other} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// passwordPolicyViolation explains which rule of the policy a rejected password
+// breaks.  Resets by an administrator aren't held to the history or minimum age
+// rules, so those are only suggested once length and complexity are ruled out.
+func passwordPolicyViolation(policy *PasswordPolicy, password string, sAMAccountName string, passwordLastSet time.Time) string {
+	length := len(utf16.Encode([]rune(password)))
+	if length < policy.MinLength {
+		return fmt.Sprintf("it is %d characters long, and %s requires at least %d", length, policy.Source, policy.MinLength)
+	}
+	if policy.Complexity {
+		if categories := passwordCategories(password); categories < 3 {
+			return fmt.Sprintf("%s requires complex passwords, with characters from at least three of uppercase letters, lowercase letters, digits, and symbols, and it has %d", policy.Source, categories)
+		}
+		name := strings.ToLower(strings.TrimSuffix(sAMAccountName, "$"))
+		if len(name) >= 3 && strings.Contains(strings.ToLower(password), name) {
+			return fmt.Sprintf("%s requires complex passwords, which must not contain the account name", policy.Source)
+		}
+	}
+	if policy.MinAge > 0 && !passwordLastSet.IsZero() && time.Since(passwordLastSet) < policy.MinAge {
+		return fmt.Sprintf("it was last changed at %s, and %s requires passwords to be kept for %s", timeToString(passwordLastSet), policy.Source, policy.MinAge)
+	}
+	if policy.HistoryLength > 0 {
+		return fmt.Sprintf("it meets the length and complexity rules of %s, so it may be one of the last %d passwords used, or be refused by a password filter on the domain controller", policy.Source, policy.HistoryLength)
+	}
+	return fmt.Sprintf("it meets the length and complexity rules of %s, so it may be refused by a password filter on the domain controller", policy.Source)
+}
+
+// passwordPolicyError wraps a rejected password change with the reason, when
+// the policy can be read.
+func (a *LdapAccount) passwordPolicyError(ctx context.Context, password string, err error) error {
+	sAMAccountName, lookupErr := a.GetAttributeValue(ctx, "sAMAccountName")
+	if lookupErr != nil {
+		return err
+	}
+	policy, lookupErr := a.GetPasswordPolicy(ctx)
+	if lookupErr != nil {
+		return err
+	}
+	passwordLastSet, _ := a.GetPasswordLastSet(ctx)
+
+	return &PasswordPolicyError{
+		Account: sAMAccountName,
+		Reason:  passwordPolicyViolation(policy, password, sAMAccountName, passwordLastSet),
+		Err:     err,
+	}
+}
@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// LDAP_SERVER_SHOW_DELETED_OID, which returns deleted objects from searches
+// and allows them to be restored
+const controlTypeShowDeleted = "1.2.840.113556.1.4.417"
+
+var deletedObjectAttributes = []string{"objectGUID", "isDeleted", "isRecycled", "lastKnownParent", "msDS-LastKnownRDN", "whenChanged"}
+
+// DeletedObject is an object in the domain's Deleted Objects container.  With
+// the AD Recycle Bin enabled it can be restored, with its objectGUID, SID, and
+// attributes, until the deleted object lifetime passes and it is recycled.
+type DeletedObject struct {
+	DN              string
+	ObjectGUID      string
+	LastKnownParent string
+	LastKnownRDN    string
+	DeletedAt       time.Time
+	Recycled        bool
+}
+
+func showDeletedControls() []ldap.Control {
+	return []ldap.Control{ldap.NewControlString(controlTypeShowDeleted, true, "")}
+}
+
+// findDeletedObjects searches the domain, including deleted objects, for those
+// matching the filter, most recently deleted first.
+func (c *LdapClient) findDeletedObjects(ctx context.Context, filter string) ([]*DeletedObject, error) {
+	defaultNamingContext, err := c.DefaultNamingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		defaultNamingContext,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(&(isDeleted=TRUE)%s)", filter),
+		deletedObjectAttributes,
+		showDeletedControls(),
+	)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []*DeletedObject
+	for _, entry := range result.Entries {
+		deletedAt, _ := generalizedTimeToTime(entry.GetEqualFoldAttributeValue("whenChanged"))
+		object := &DeletedObject{
+			DN:              entry.DN,
+			ObjectGUID:      formatGUID(entry.GetEqualFoldRawAttributeValue("objectGUID")),
+			LastKnownParent: entry.GetEqualFoldAttributeValue("lastKnownParent"),
+			LastKnownRDN:    entry.GetEqualFoldAttributeValue("msDS-LastKnownRDN"),
+			DeletedAt:       deletedAt,
+			Recycled:        strings.EqualFold(entry.GetEqualFoldAttributeValue("isRecycled"), "TRUE"),
+		}
+
+		i := len(deleted)
+		for i > 0 && deleted[i-1].DeletedAt.Before(object.DeletedAt) {
+			i--
+		}
+		deleted = append(deleted[:i], append([]*DeletedObject{object}, deleted[i:]...)...)
+	}
+
+	return deleted, nil
+}
+
+// GetDeletedObjectByGUID finds a deleted or recycled object by its objectGUID.
+func (c *LdapClient) GetDeletedObjectByGUID(ctx context.Context, guid string) (*DeletedObject, error) {
+	objectGUID, err := parseGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := c.findDeletedObjects(ctx, fmt.Sprintf("(objectGUID=%s)", guidFilterValue(objectGUID)))
+	if err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return nil, &NotFoundError{ObjectClass: "deleted object", Name: guid}
+	}
+	return deleted[0], nil
+}
+
+// FindRestorableObject finds the most recently deleted object matching the
+// filter that hasn't been recycled yet.
+func (c *LdapClient) FindRestorableObject(ctx context.Context, filter string) (*DeletedObject, error) {
+	deleted, err := c.findDeletedObjects(ctx, fmt.Sprintf("(!(isRecycled=TRUE))%s", filter))
+	if err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return nil, &NotFoundError{ObjectClass: "deleted object", Name: filter}
+	}
+	return deleted[0], nil
+}
+
+// RestoreDeletedObject restores a deleted object to the distinguished name, by
+// removing isDeleted and setting the new DN in a single modify.
+func (c *LdapClient) RestoreDeletedObject(ctx context.Context, object *DeletedObject, distinguishedName string) error {
+	if object.Recycled {
+		return fmt.Errorf("%s has been recycled and can no longer be restored", object.DN)
+	}
+
+	request := ldap.NewModifyRequest(object.DN, showDeletedControls())
+	request.Delete("isDeleted", nil)
+	request.Replace("distinguishedName", []string{distinguishedName})
+
+	return modifyContext(ctx, c.Conn, request)
+}
+
+// RestoreDeletedAccount restores the most recently deleted account with the
+// sAMAccountName into the OU under its last name, reporting whether there was
+// one to restore.
+func (c *LdapClient) RestoreDeletedAccount(ctx context.Context, sAMAccountName string, ou string) (bool, error) {
+	deleted, err := c.FindRestorableObject(ctx, fmt.Sprintf("(sAMAccountName=%s)", ldap.EscapeFilter(sAMAccountName)))
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, c.RestoreDeletedObject(ctx, deleted, fmt.Sprintf("CN=%s,%s", escapeRDNValue(deleted.LastKnownRDN), ou))
+}
+
+// RestoreDeletedOU restores the most recently deleted OU last seen at the
+// distinguished name, reporting whether there was one to restore.
+func (c *LdapClient) RestoreDeletedOU(ctx context.Context, distinguishedName string) (bool, error) {
+	ldapDN, err := NewLdapDN(distinguishedName)
+	if err != nil {
+		return false, err
+	}
+	filter := fmt.Sprintf("(objectClass=organizationalUnit)(msDS-LastKnownRDN=%s)(lastKnownParent=%s)", ldap.EscapeFilter(ldapDN.Name()), ldap.EscapeFilter(ldapDN.ParentDN()))
+	deleted, err := c.FindRestorableObject(ctx, filter)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, c.RestoreDeletedObject(ctx, deleted, distinguishedName)
+}
+
+// deletedObjectDiagnostics explains why an object a resource manages is
+// missing: deleted and still restorable, deleted and recycled, or not in the
+// directory at all.  Nothing is reported when the resource's ID isn't an
+// objectGUID, or the Deleted Objects container can't be searched.
+func deletedObjectDiagnostics(ctx context.Context, client *LdapClient, kind string, id string) diag.Diagnostics {
+	if _, err := parseGUID(id); err != nil {
+		return nil
+	}
+
+	deleted, err := client.GetDeletedObjectByGUID(ctx, id)
+	if IsNotFound(err) {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("%s no longer exists", kind),
+			Detail:   fmt.Sprintf("The %s with objectGUID %s is neither in the directory nor in Deleted Objects, so it was purged or never existed.  It will be created again.", strings.ToLower(kind), id),
+		}}
+	}
+	if err != nil {
+		return nil
+	}
+
+	if deleted.Recycled {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("%s deleted and recycled outside Terraform", kind),
+			Detail:   fmt.Sprintf("The %s with objectGUID %s, last seen as %s under %s, was deleted and has been recycled, so it can no longer be restored.  It will be created again, with a new objectGUID and SID.", strings.ToLower(kind), id, deleted.LastKnownRDN, deleted.LastKnownParent),
+		}}
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  fmt.Sprintf("%s deleted outside Terraform, pending recycle", kind),
+		Detail:   fmt.Sprintf("The %s with objectGUID %s, last seen as %s under %s, was deleted at %s and can still be restored from the Recycle Bin.  Set restore_deleted to restore it, keeping its objectGUID, SID, and group memberships; otherwise a new one will be created.", strings.ToLower(kind), id, deleted.LastKnownRDN, deleted.LastKnownParent, timeToString(deleted.DeletedAt)),
+	}}
+}
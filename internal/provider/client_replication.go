@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// How often a lookup waiting for an object to replicate is repeated
+var replicationPollInterval = time.Second
+
+// domainControllerName is the DNS name of the domain controller a client is
+// connected to, read from the rootDSE the first time it's needed.  A nil
+// domainControllerName reads it every time.
+type domainControllerName struct {
+	mu   sync.Mutex
+	name string
+}
+
+// DomainControllerName returns the DNS name of the domain controller the
+// client is connected to, whatever name the URL gave.
+func (c *LdapClient) DomainControllerName(ctx context.Context) (string, error) {
+	dc := c.dc
+	if dc == nil {
+		return c.readDomainControllerName(ctx)
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.name != "" {
+		return dc.name, nil
+	}
+	name, err := c.readDomainControllerName(ctx)
+	if err != nil {
+		return "", err
+	}
+	dc.name = name
+
+	return name, nil
+}
+
+func (c *LdapClient) readDomainControllerName(ctx context.Context) (string, error) {
+	searchRequest := ldap.NewSearchRequest(
+		"", // The base dn to search
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"dnsHostName"},
+		nil,
+	)
+	result, err := searchContext(ctx, c.Conn, searchRequest)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Entries) == 0 {
+		return "", &NotFoundError{ObjectClass: "rootDSE", Name: "dnsHostName"}
+	}
+
+	return result.Entries[0].GetAttributeValue("dnsHostName"), nil
+}
+
+// awaitReplication runs a lookup by objectGUID and, while it finds nothing,
+// repeats it for up to the client's ReplicationWait.  An object written
+// through one domain controller may not yet have replicated to the one a
+// later run connects to, and reading it as deleted would drop it from the
+// state.  No wait is needed when a tombstone shows the object was deleted, or
+// when the ID isn't an objectGUID.
+func awaitReplication(ctx context.Context, client *LdapClient, id string, lookup func() error) error {
+	err := lookup()
+	if !IsNotFound(err) || client.ReplicationWait <= 0 {
+		return err
+	}
+	if _, parseErr := parseGUID(id); parseErr != nil {
+		return err
+	}
+	if _, deletedErr := client.GetDeletedObjectByGUID(ctx, id); deletedErr == nil {
+		return err
+	}
+
+	deadline := time.Now().Add(client.ReplicationWait)
+	for IsNotFound(err) && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(replicationPollInterval):
+		}
+		err = lookup()
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Backoff between attempts at a write the directory turned away as transient.
+// Each wait is a random duration up to the current ceiling, which doubles
+// after every attempt.
+var (
+	retryAttempts     = 5
+	retryInitialDelay = 250 * time.Millisecond
+	retryMaxDelay     = 4 * time.Second
+)
+
+// Windows error codes, from the start of the diagnostic message, for which
+// AD answers unwillingToPerform while it is busy or replicating.
+var transientUnwillingCodes = []string{
+	"0000200E", // ERROR_DS_BUSY
+	"0000200F", // ERROR_DS_UNAVAILABLE
+	"000020F6", // ERROR_DS_DRA_BUSY
+}
+
+// RetryError is returned when a write still fails after retrying.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s (after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// isLDAPError reports whether err, or an error it wraps, is an LDAP result
+// with the given code.
+func isLDAPError(err error, code uint16) bool {
+	var ldapErr *ldap.Error
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == code
+}
+
+// isTransientLDAPError reports whether a write may succeed if sent again.
+func isTransientLDAPError(err error) bool {
+	var ldapErr *ldap.Error
+	if !errors.As(err, &ldapErr) {
+		return false
+	}
+
+	switch ldapErr.ResultCode {
+	case ldap.LDAPResultBusy, ldap.LDAPResultUnavailable:
+		return true
+	case ldap.LDAPResultUnwillingToPerform:
+		diagnostic := ""
+		if ldapErr.Err != nil {
+			diagnostic = strings.ToUpper(ldapErr.Err.Error())
+		}
+		for _, code := range transientUnwillingCodes {
+			if strings.HasPrefix(diagnostic, code) {
+				return true
+			}
+		}
+		return strings.Contains(diagnostic, "REPLICAT")
+	}
+	return false
+}
+
+// retryContext runs a directory write with doContext, sending it again with
+// jittered backoff while the directory reports it busy or unavailable.  It
+// returns the number of attempts made with the final error.
+func retryContext(ctx context.Context, operation func() error) (int, error) {
+	delay := retryInitialDelay
+	for attempt := 1; ; attempt++ {
+		err := doContext(ctx, operation)
+		if err == nil || !isTransientLDAPError(err) {
+			if err != nil && attempt > 1 {
+				return attempt, &RetryError{Attempts: attempt, Err: err}
+			}
+			return attempt, err
+		}
+		if attempt >= retryAttempts {
+			return attempt, &RetryError{Attempts: attempt, Err: err}
+		}
+
+		wait := time.Duration(rand.Int63n(int64(delay) + 1))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return attempt, &RetryError{Attempts: attempt, Err: err}
+		}
+		if delay *= 2; delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
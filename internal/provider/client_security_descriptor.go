@@ -0,0 +1,228 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// LDAP_SERVER_SD_FLAGS_OID limits nTSecurityDescriptor reads and writes to
+	// the parts selected by the flags, so the DACL can be changed without
+	// rights to the owner or SACL.
+	controlTypeSDFlags        = "1.2.840.113556.1.4.801"
+	daclSecurityInformation   = 0x4
+	seDaclPresent             = 0x0004
+	seSelfRelative            = 0x8000
+	accessDeniedACEType       = 0x01
+	adsRightDelete            = 0x00010000
+	adsRightActrlDSDeleteTree = 0x00000040
+)
+
+// everyoneSID is the well-known S-1-1-0 SID in binary form.
+var everyoneSID = []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+
+// securityDescriptor is a self-relative Windows security descriptor with its
+// DACL split into raw ACEs.
+type securityDescriptor struct {
+	revision    byte
+	control     uint16
+	owner       []byte
+	group       []byte
+	sacl        []byte
+	aclRevision byte
+	aces        [][]byte // nil when there is no DACL
+}
+
+func sdFlagsControl(flags int64) ldap.Control {
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SDFlagsRequestValue")
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, flags, "Flags"))
+
+	return ldap.NewControlString(controlTypeSDFlags, true, string(value.Bytes()))
+}
+
+// searchControls returns the controls a search for the attributes needs.  A
+// search that reads nTSecurityDescriptor asks for the DACL alone, as reading
+// the SACL takes privileges the bind account usually lacks.
+func searchControls(attributes []string) []ldap.Control {
+	for _, attribute := range attributes {
+		if strings.EqualFold(attribute, "nTSecurityDescriptor") {
+			return []ldap.Control{sdFlagsControl(daclSecurityInformation)}
+		}
+	}
+	return nil
+}
+
+// denyDeleteACE returns the ACE that ADUC adds for "Protect object from
+// accidental deletion": deny Everyone Delete and Delete subtree.
+func denyDeleteACE() []byte {
+	ace := make([]byte, 8, 8+len(everyoneSID))
+	ace[0] = accessDeniedACEType
+	binary.LittleEndian.PutUint16(ace[2:], uint16(8+len(everyoneSID)))
+	binary.LittleEndian.PutUint32(ace[4:], adsRightDelete|adsRightActrlDSDeleteTree)
+
+	return append(ace, everyoneSID...)
+}
+
+func sidLength(b []byte, offset uint32) (int, error) {
+	if int(offset)+8 > len(b) {
+		return 0, fmt.Errorf("SID at offset %d is out of range", offset)
+	}
+	length := 8 + 4*int(b[offset+1])
+	if int(offset)+length > len(b) {
+		return 0, fmt.Errorf("SID at offset %d is truncated", offset)
+	}
+
+	return length, nil
+}
+
+func aclLength(b []byte, offset uint32) (int, error) {
+	if int(offset)+8 > len(b) {
+		return 0, fmt.Errorf("ACL at offset %d is out of range", offset)
+	}
+	length := int(binary.LittleEndian.Uint16(b[offset+2:]))
+	if length < 8 || int(offset)+length > len(b) {
+		return 0, fmt.Errorf("ACL at offset %d is truncated", offset)
+	}
+
+	return length, nil
+}
+
+// parseSecurityDescriptor parses a self-relative nTSecurityDescriptor value.
+func parseSecurityDescriptor(b []byte) (*securityDescriptor, error) {
+	if len(b) < 20 {
+		return nil, fmt.Errorf("security descriptor is too short (%d bytes)", len(b))
+	}
+
+	sd := &securityDescriptor{
+		revision: b[0],
+		control:  binary.LittleEndian.Uint16(b[2:]),
+	}
+	ownerOffset := binary.LittleEndian.Uint32(b[4:])
+	groupOffset := binary.LittleEndian.Uint32(b[8:])
+	saclOffset := binary.LittleEndian.Uint32(b[12:])
+	daclOffset := binary.LittleEndian.Uint32(b[16:])
+
+	if ownerOffset != 0 {
+		length, err := sidLength(b, ownerOffset)
+		if err != nil {
+			return nil, err
+		}
+		sd.owner = b[ownerOffset : int(ownerOffset)+length]
+	}
+	if groupOffset != 0 {
+		length, err := sidLength(b, groupOffset)
+		if err != nil {
+			return nil, err
+		}
+		sd.group = b[groupOffset : int(groupOffset)+length]
+	}
+	if saclOffset != 0 {
+		length, err := aclLength(b, saclOffset)
+		if err != nil {
+			return nil, err
+		}
+		sd.sacl = b[saclOffset : int(saclOffset)+length]
+	}
+	if daclOffset != 0 {
+		length, err := aclLength(b, daclOffset)
+		if err != nil {
+			return nil, err
+		}
+		dacl := b[daclOffset : int(daclOffset)+length]
+		sd.aclRevision = dacl[0]
+		sd.aces = [][]byte{}
+		aceCount := int(binary.LittleEndian.Uint16(dacl[4:]))
+		offset := 8
+		for i := 0; i < aceCount; i++ {
+			if offset+4 > len(dacl) {
+				return nil, fmt.Errorf("ACE %d is out of range", i)
+			}
+			aceSize := int(binary.LittleEndian.Uint16(dacl[offset+2:]))
+			if aceSize < 4 || offset+aceSize > len(dacl) {
+				return nil, fmt.Errorf("ACE %d is truncated", i)
+			}
+			sd.aces = append(sd.aces, dacl[offset:offset+aceSize])
+			offset += aceSize
+		}
+	}
+
+	return sd, nil
+}
+
+// Bytes serializes the security descriptor in self-relative form.
+func (sd *securityDescriptor) Bytes() []byte {
+	var dacl []byte
+	if sd.aces != nil {
+		size := 8
+		for _, ace := range sd.aces {
+			size += len(ace)
+		}
+		dacl = make([]byte, 8, size)
+		dacl[0] = sd.aclRevision
+		binary.LittleEndian.PutUint16(dacl[2:], uint16(size))
+		binary.LittleEndian.PutUint16(dacl[4:], uint16(len(sd.aces)))
+		for _, ace := range sd.aces {
+			dacl = append(dacl, ace...)
+		}
+	}
+
+	result := make([]byte, 20)
+	result[0] = sd.revision
+	control := sd.control | seSelfRelative
+	if dacl != nil {
+		control |= seDaclPresent
+	}
+	binary.LittleEndian.PutUint16(result[2:], control)
+
+	for i, part := range [][]byte{sd.owner, sd.group, sd.sacl, dacl} {
+		if part == nil {
+			continue
+		}
+		binary.LittleEndian.PutUint32(result[4+4*i:], uint32(len(result)))
+		result = append(result, part...)
+	}
+
+	return result
+}
+
+func (sd *securityDescriptor) HasACE(ace []byte) bool {
+	for _, existing := range sd.aces {
+		if bytes.Equal(existing, ace) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddACE puts the ACE first in the DACL, where explicit deny ACEs belong in
+// canonical order.
+func (sd *securityDescriptor) AddACE(ace []byte) error {
+	if sd.aces == nil {
+		return fmt.Errorf("security descriptor has no DACL")
+	}
+	if sd.HasACE(ace) {
+		return nil
+	}
+	sd.aces = append([][]byte{ace}, sd.aces...)
+
+	return nil
+}
+
+func (sd *securityDescriptor) RemoveACE(ace []byte) {
+	var aces [][]byte
+	for _, existing := range sd.aces {
+		if !bytes.Equal(existing, ace) {
+			aces = append(aces, existing)
+		}
+	}
+	if sd.aces != nil && aces == nil {
+		aces = [][]byte{}
+	}
+	sd.aces = aces
+}
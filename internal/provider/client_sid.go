@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// formatSID renders a binary objectSid value in its usual S-R-I-S... string form.
+func formatSID(objectSid []byte) (string, error) {
+	if len(objectSid) < 8 {
+		return "", fmt.Errorf("SID is too short (%d bytes)", len(objectSid))
+	}
+
+	revision := objectSid[0]
+	subAuthorityCount := int(objectSid[1])
+	if len(objectSid) != 8+4*subAuthorityCount {
+		return "", fmt.Errorf("SID length %d does not match sub-authority count %d", len(objectSid), subAuthorityCount)
+	}
+
+	var authority uint64
+	for _, b := range objectSid[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "S-%d-%d", revision, authority)
+	for i := 0; i < subAuthorityCount; i++ {
+		fmt.Fprintf(&sb, "-%d", binary.LittleEndian.Uint32(objectSid[8+4*i:]))
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// RFC 2891 server-side sorting
+	controlTypeServerSort         = "1.2.840.113556.1.4.473"
+	controlTypeServerSortResponse = "1.2.840.113556.1.4.474"
+	// Virtual list view, which returns a window of a sorted result
+	controlTypeVLV         = "2.16.840.1.113730.3.4.9"
+	controlTypeVLVResponse = "2.16.840.1.113730.3.4.10"
+)
+
+// SearchOrder asks a search to sort its results on the server by an
+// attribute, and optionally to return only a window of them.  AD sorts by a
+// single attribute, and pages can't be combined with a window, so a windowed
+// search returns at most the server's MaxPageSize objects.
+type SearchOrder struct {
+	SortBy     string
+	Descending bool
+	Offset     int // The number of sorted objects to skip
+	Limit      int // The most objects to return; zero returns them all
+}
+
+// serverSortControl returns the sort request control for a single key.
+func serverSortControl(attribute string, descending bool) ldap.Control {
+	key := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortKey")
+	key.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "attributeType"))
+	if descending {
+		key.AppendChild(ber.NewBoolean(ber.ClassContext, ber.TypePrimitive, 1, true, "reverseOrder"))
+	}
+	keys := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortKeyList")
+	keys.AppendChild(key)
+
+	return ldap.NewControlString(controlTypeServerSort, true, string(keys.Bytes()))
+}
+
+// vlvControl returns the virtual list view request control for the window of
+// count objects after skipping offset.
+func vlvControl(offset int, count int) ldap.Control {
+	target := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "byOffset")
+	target.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(offset+1), "offset"))
+	target.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(0), "contentCount"))
+
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "VirtualListViewRequest")
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(0), "beforeCount"))
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(count-1), "afterCount"))
+	value.AppendChild(target)
+
+	return ldap.NewControlString(controlTypeVLV, true, string(value.Bytes()))
+}
+
+// decodeControlSequence decodes the value of a response control that go-ldap
+// doesn't know, which is a BER sequence of at least minChildren values.
+func decodeControlSequence(control ldap.Control, minChildren int) (*ber.Packet, error) {
+	controlString, ok := control.(*ldap.ControlString)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response control %T", control)
+	}
+	packet, err := ber.DecodePacketErr([]byte(controlString.ControlValue))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s response: %s", controlString.ControlType, err)
+	}
+	if len(packet.Children) < minChildren {
+		return nil, fmt.Errorf("error decoding %s response: expected %d values, got %d", controlString.ControlType, minChildren, len(packet.Children))
+	}
+	return packet, nil
+}
+
+// controlResultCode reads an LDAP result code out of a response control.
+func controlResultCode(packet *ber.Packet) uint16 {
+	code, _ := packet.Value.(int64)
+	return uint16(code)
+}
+
+// searchOrdered runs a search sorted and windowed by the order, and returns
+// the objects along with how many there are in all.  Without a limit the
+// search is paged, and the total is the number returned.
+func (c *LdapClient) searchOrdered(ctx context.Context, request *ldap.SearchRequest, order *SearchOrder, pagingSize uint32) (*ldap.SearchResult, int, error) {
+	request.Controls = append(request.Controls, serverSortControl(order.SortBy, order.Descending))
+
+	if order.Limit == 0 {
+		result, err := searchWithPagingContext(ctx, c.Conn, request, pagingSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := checkSortResponse(result.Controls); err != nil {
+			return nil, 0, err
+		}
+		return result, len(result.Entries), nil
+	}
+
+	request.Controls = append(request.Controls, vlvControl(order.Offset, order.Limit))
+	result, err := searchContext(ctx, c.Conn, request)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkSortResponse(result.Controls); err != nil {
+		return nil, 0, err
+	}
+
+	control := ldap.FindControl(result.Controls, controlTypeVLVResponse)
+	if control == nil {
+		return nil, 0, fmt.Errorf("the server returned no virtual list view response")
+	}
+	packet, err := decodeControlSequence(control, 3)
+	if err != nil {
+		return nil, 0, err
+	}
+	if code := controlResultCode(packet.Children[2]); code != ldap.LDAPResultSuccess {
+		return nil, 0, fmt.Errorf("error windowing search results: %s", ldap.LDAPResultCodeMap[code])
+	}
+	total, _ := packet.Children[1].Value.(int64)
+
+	// A window starting past the end targets the last object, which isn't in it
+	if len(result.Entries) > 0 && order.Offset >= int(total) {
+		result.Entries = nil
+	}
+	return result, int(total), nil
+}
+
+// checkSortResponse returns the error in a sort response control, if any.
+func checkSortResponse(controls []ldap.Control) error {
+	for _, control := range controls {
+		if control.GetControlType() != controlTypeServerSortResponse {
+			continue
+		}
+		packet, err := decodeControlSequence(control, 1)
+		if err != nil {
+			return err
+		}
+		if code := controlResultCode(packet.Children[0]); code != ldap.LDAPResultSuccess {
+			return fmt.Errorf("error sorting search results: %s", ldap.LDAPResultCodeMap[code])
+		}
+	}
+	return nil
+}
@@ -1,9 +1,41 @@
 package provider
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
+func TestAdldapLdapEntryMalformedDN(t *testing.T) {
+	for _, dn := range []string{"", "not a DN", "CN=Users,DC"} {
+		entry := &LdapEntry{Entry: ldap.NewEntry(dn, nil)}
+		if _, err := entry.ParentDN(); err == nil {
+			t.Errorf("Error rejecting malformed DN %q in ParentDN: got no error", dn)
+		}
+		if _, err := entry.RDN(); err == nil {
+			t.Errorf("Error rejecting malformed DN %q in RDN: got no error", dn)
+		}
+		if _, err := entry.Name(); err == nil {
+			t.Errorf("Error rejecting malformed DN %q in Name: got no error", dn)
+		}
+	}
+
+	entry := &LdapEntry{Entry: ldap.NewEntry(`CN=Smith\, John,CN=Users,DC=example,DC=com`, nil)}
+	name, err := entry.Name()
+	if err != nil || name != "Smith, John" {
+		t.Fatalf("Error reading name: got %q, %v", name, err)
+	}
+}
+
 func TestAdldapLdapDNParentDN(t *testing.T) {
 	cases := []struct {
 		ou     string
@@ -33,6 +65,10 @@ func TestAdldapLdapDNParentDN(t *testing.T) {
 			ou:     "OU=Second Unit,OU=First Unit,DC=example,DC=com",
 			parent: "OU=First Unit,DC=example,DC=com",
 		},
+		{
+			ou:     `OU=Servers,OU=Sales\, EMEA,DC=example,DC=com`,
+			parent: `OU=Sales\, EMEA,DC=example,DC=com`,
+		},
 	}
 
 	for _, c := range cases {
@@ -87,6 +123,85 @@ func TestAdldapLdapDNRDN(t *testing.T) {
 	}
 }
 
+func TestAdldapLdapDNEscapeRDNValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected string
+	}{
+		{
+			value:    "Servers",
+			expected: "Servers",
+		},
+		{
+			value:    "Sales, EMEA",
+			expected: `Sales\, EMEA`,
+		},
+		{
+			value:    "#1 Team ",
+			expected: `\#1 Team\ `,
+		},
+		{
+			value:    `R+D <"Lab">`,
+			expected: `R\+D \<\"Lab\"\>`,
+		},
+	}
+
+	for _, c := range cases {
+		got := escapeRDNValue(c.value)
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for \"%s\": got %s, expected %s", c.value, got, c.expected)
+		}
+		dn, err := NewLdapDN("OU=" + got + ",DC=example,DC=com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dn.Name() != c.value {
+			t.Fatalf("Error round-tripping \"%s\": got %s", c.value, dn.Name())
+		}
+	}
+}
+
+func TestAdldapLdapDNEqual(t *testing.T) {
+	cases := []struct {
+		a        string
+		b        string
+		expected bool
+	}{
+		{
+			a:        "ou=Users,dc=Example,dc=com",
+			b:        "OU=Users, DC=example, DC=com",
+			expected: true,
+		},
+		{
+			a:        `OU=Sales\, EMEA,DC=example,DC=com`,
+			b:        `ou=sales\,  emea,dc=example,dc=com`,
+			expected: false,
+		},
+		{
+			a:        `OU=Sales\, EMEA,DC=example,DC=com`,
+			b:        `ou=sales\, emea,dc=example,dc=com`,
+			expected: true,
+		},
+		{
+			a:        "OU=Users,DC=example,DC=com",
+			b:        "OU=Computers,DC=example,DC=com",
+			expected: false,
+		},
+		{
+			a:        "",
+			b:        "OU=Users,DC=example,DC=com",
+			expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		got := dnsEqual(c.a, c.b)
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for \"%s\" and \"%s\": got %t, expected %t", c.a, c.b, got, c.expected)
+		}
+	}
+}
+
 func TestAdldapClientSliceIsSubset(t *testing.T) {
 	cases := []struct {
 		parent   []string
@@ -133,3 +248,1235 @@ func TestAdldapClientSliceIsSubset(t *testing.T) {
 	}
 
 }
+
+func TestAdldapClientFileTimeToTime(t *testing.T) {
+	cases := []struct {
+		fileTime int64
+		expected time.Time
+	}{
+		{
+			fileTime: 0,
+			expected: time.Time{},
+		},
+		{
+			fileTime: 0x7FFFFFFFFFFFFFFF,
+			expected: time.Time{},
+		},
+		{
+			fileTime: 116444736000000000,
+			expected: time.Unix(0, 0).UTC(),
+		},
+		{
+			fileTime: 132539328000000000,
+			expected: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		got := fileTimeToTime(c.fileTime)
+		if !got.Equal(c.expected) {
+			t.Fatalf("Error matching output and expected for %d: got %s, expected %s", c.fileTime, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapClientGUID(t *testing.T) {
+	cases := []struct {
+		guid     string
+		expected string
+		valid    bool
+	}{
+		{
+			guid:     "f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+			expected: "\\ae\\4f\\1d\\f8\\ec\\7d\\d0\\11\\a7\\65\\00\\a0\\c9\\1e\\6b\\f6",
+			valid:    true,
+		},
+		{
+			guid:     "{F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6}",
+			expected: "\\ae\\4f\\1d\\f8\\ec\\7d\\d0\\11\\a7\\65\\00\\a0\\c9\\1e\\6b\\f6",
+			valid:    true,
+		},
+		{
+			guid:  "jdoe1",
+			valid: false,
+		},
+		{
+			guid:  "CN=f81d4fae-7dec-11d0-a765-00a0c91e6bf6,DC=example,DC=com",
+			valid: false,
+		},
+		{
+			guid:  "g81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+			valid: false,
+		},
+	}
+
+	for _, c := range cases {
+		objectGUID, err := parseGUID(c.guid)
+		if (err == nil) != c.valid {
+			t.Fatalf("Error matching validity for \"%s\": got %t, expected %t", c.guid, err == nil, c.valid)
+		}
+		if !c.valid {
+			continue
+		}
+		if got := guidFilterValue(objectGUID); got != c.expected {
+			t.Fatalf("Error matching output and expected for \"%s\": got %s, expected %s", c.guid, got, c.expected)
+		}
+		if got := formatGUID(objectGUID); got != "f81d4fae-7dec-11d0-a765-00a0c91e6bf6" {
+			t.Fatalf("Error round-tripping \"%s\": got %s", c.guid, got)
+		}
+	}
+}
+
+func TestAdldapClientFormatSID(t *testing.T) {
+	cases := []struct {
+		objectSid []byte
+		expected  string
+		valid     bool
+	}{
+		{
+			objectSid: []byte{1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0},
+			expected:  "S-1-5-18",
+			valid:     true,
+		},
+		{
+			objectSid: []byte{1, 5, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 0x15, 0xcd, 0x5b, 0x07, 0x35, 0x6b, 0x6e, 0x1a, 0x3c, 0x32, 0x42, 0x5b, 0x51, 0x04, 0x00, 0x00},
+			expected:  "S-1-5-21-123456789-443444021-1531064892-1105",
+			valid:     true,
+		},
+		{
+			objectSid: []byte{1, 2, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0},
+			valid:     false,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := formatSID(c.objectSid)
+		if (err == nil) != c.valid {
+			t.Fatalf("Error matching validity for %v: got %t, expected %t", c.objectSid, err == nil, c.valid)
+		}
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for %v: got %s, expected %s", c.objectSid, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapClientGeneralizedTimeToTime(t *testing.T) {
+	got, err := generalizedTimeToTime("20210429153000.0Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2021, time.April, 29, 15, 30, 0, 0, time.UTC)
+	if !got.Equal(expected) {
+		t.Fatalf("Error matching output and expected: got %s, expected %s", got, expected)
+	}
+}
+
+func TestAdldapClientEncodePassword(t *testing.T) {
+	encoded, err := encodePassword(`a"\`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "\"\x00a\x00\"\x00\\\x00\"\x00"
+	if encoded != expected {
+		t.Fatalf("Error encoding password: got %q, expected %q", encoded, expected)
+	}
+
+	cases := []string{
+		"",
+		"Passw0rd!",
+		`back\slash\\`,
+		`"quoted"`,
+		`'single' and "double"`,
+		"tab\tnewline\n",
+		"${template} %{directive}",
+		"Pässwörd€",
+		"密码パスワード",
+		"emoji😀🔑",
+		"\u00a0non-breaking\u200bzero-width",
+		strings.Repeat("\\\"", 64),
+	}
+	for _, password := range cases {
+		encoded, err := encodePassword(password)
+		if err != nil {
+			t.Fatalf("Error encoding %q: %s", password, err)
+		}
+		if len(encoded)%2 != 0 {
+			t.Fatalf("Error encoding %q: odd length %d", password, len(encoded))
+		}
+		units := make([]uint16, len(encoded)/2)
+		for i := range units {
+			units[i] = uint16(encoded[2*i]) | uint16(encoded[2*i+1])<<8
+		}
+		decoded := string(utf16.Decode(units))
+		if decoded != "\""+password+"\"" {
+			t.Fatalf("Error round-tripping %q: got %q", password, decoded)
+		}
+	}
+
+	if _, err := encodePassword("invalid\xff"); err == nil {
+		t.Fatal("Error rejecting invalid UTF-8: got no error")
+	}
+}
+
+func TestAdldapClientDefaultComputerPassword(t *testing.T) {
+	cases := []struct {
+		sAMAccountName string
+		expected       string
+	}{
+		{
+			sAMAccountName: "WEB01$",
+			expected:       "web01",
+		},
+		{
+			sAMAccountName: "VERYLONGCOMPNAM$",
+			expected:       "verylongcompna",
+		},
+	}
+
+	for _, c := range cases {
+		got := defaultComputerPassword(c.sAMAccountName)
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for \"%s\": got %s, expected %s", c.sAMAccountName, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapClientEncryptionTypes(t *testing.T) {
+	cases := []struct {
+		encryptionTypes []string
+		expected        int
+	}{
+		{
+			encryptionTypes: []string{"AES128_CTS_HMAC_SHA1_96", "AES256_CTS_HMAC_SHA1_96"},
+			expected:        24,
+		},
+		{
+			encryptionTypes: []string{"RC4_HMAC", "AES128_CTS_HMAC_SHA1_96", "AES256_CTS_HMAC_SHA1_96"},
+			expected:        28,
+		},
+		{
+			encryptionTypes: []string{},
+			expected:        0,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := encryptionTypesToInt(c.encryptionTypes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for %s: got %d, expected %d", c.encryptionTypes, got, c.expected)
+		}
+		if back := intToEncryptionTypes(got); !stringSlicesEqual(back, c.encryptionTypes) {
+			t.Fatalf("Error round-tripping %s: got %s", c.encryptionTypes, back)
+		}
+	}
+
+	if _, err := encryptionTypesToInt([]string{"AES512"}); err == nil {
+		t.Fatalf("expected error for unknown encryption type")
+	}
+}
+
+func TestAdldapClientParseLAPSPassword(t *testing.T) {
+	got, err := parseLAPSPassword(`{"n":"Administrator","t":"1d8161b41c41cde","p":"A6a3#7%eb!57be4a4B95Z43394ba956de69e5d8975#$8a6d)4f82da6ad500HGx"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "A6a3#7%eb!57be4a4B95Z43394ba956de69e5d8975#$8a6d)4f82da6ad500HGx"
+	if got != expected {
+		t.Fatalf("Error matching output and expected: got %s, expected %s", got, expected)
+	}
+
+	if _, err := parseLAPSPassword("not json"); err == nil {
+		t.Fatalf("expected error for invalid msLAPS-Password")
+	}
+}
+
+func TestAdldapClientLAPSCredential(t *testing.T) {
+	ctx := context.Background()
+	client, directory := newFakeClient(t)
+	directory.put("CN=WS01,CN=Computers,"+fakeDomainDN, map[string][]string{
+		"objectClass":                   {"computer"},
+		"sAMAccountName":                {"WS01$"},
+		"msLAPS-Password":               {`{"n":"LocalAdmin","t":"1d8161b41c41cde","p":"Zx8#q!2w"}`},
+		"msLAPS-PasswordExpirationTime": {"133534656000000000"},
+	})
+	directory.put("CN=WS02,CN=Computers,"+fakeDomainDN, map[string][]string{
+		"objectClass":    {"computer"},
+		"sAMAccountName": {"WS02$"},
+		"ms-Mcs-AdmPwd":  {"Legacy#Pass1"},
+	})
+
+	// Computers are found without the trailing "$" of their sAMAccountName
+	account, err := client.GetComputerByIdentifier(ctx, "WS01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountName, password, err := account.GetLAPSCredential(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accountName != "LocalAdmin" || password != "Zx8#q!2w" {
+		t.Errorf("Error reading Windows LAPS credential: got %q, %q", accountName, password)
+	}
+
+	account, err = client.GetComputerByIdentifier(ctx, "WS02$", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountName, password, err = account.GetLAPSCredential(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accountName != "" || password != "Legacy#Pass1" {
+		t.Errorf("Error reading legacy LAPS credential: got %q, %q", accountName, password)
+	}
+}
+
+func TestAdldapClientSecurityDescriptor(t *testing.T) {
+	system := []byte{1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0}
+	allowSystem := append([]byte{0x00, 0x00, 0x14, 0x00, 0xff, 0x01, 0x0f, 0x00}, system...)
+	dacl := append([]byte{0x04, 0x00, 0x1c, 0x00, 0x01, 0x00, 0x00, 0x00}, allowSystem...)
+	header := []byte{0x01, 0x00, 0x04, 0x80, 0x14, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00}
+	raw := append(append(header, system...), dacl...)
+
+	sd, err := parseSecurityDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sd.Bytes(), raw) {
+		t.Fatalf("Error round-tripping security descriptor: got %x, expected %x", sd.Bytes(), raw)
+	}
+	if sd.HasACE(denyDeleteACE()) {
+		t.Fatalf("unexpected deny-delete ACE")
+	}
+
+	err = sd.AddACE(denyDeleteACE())
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected, err := parseSecurityDescriptor(sd.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(protected.aces) != 2 || !bytes.Equal(protected.aces[0], denyDeleteACE()) {
+		t.Fatalf("Error adding deny-delete ACE: got %x", protected.aces)
+	}
+
+	protected.RemoveACE(denyDeleteACE())
+	if !bytes.Equal(protected.Bytes(), raw) {
+		t.Fatalf("Error removing deny-delete ACE: got %x, expected %x", protected.Bytes(), raw)
+	}
+
+	noDACL, err := parseSecurityDescriptor(header[:16])
+	if err == nil {
+		t.Fatalf("expected error for truncated security descriptor, got %v", noDACL)
+	}
+}
+
+func TestAdldapClientDNToDNSName(t *testing.T) {
+	cases := []struct {
+		dn       string
+		expected string
+		valid    bool
+	}{
+		{
+			dn:       "DC=example,DC=com",
+			expected: "example.com",
+			valid:    true,
+		},
+		{
+			dn:       "dc=corp,dc=example,dc=com",
+			expected: "corp.example.com",
+			valid:    true,
+		},
+		{
+			dn:    "CN=Configuration",
+			valid: false,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := dnToDNSName(c.dn)
+		if (err == nil) != c.valid {
+			t.Fatalf("Error matching validity for %s: got %t, expected %t", c.dn, err == nil, c.valid)
+		}
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for %s: got %s, expected %s", c.dn, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapClientGPLink(t *testing.T) {
+	value := "[LDAP://cn={31B2F340-016D-11D2-945F-00C04FB984F9},cn=policies,cn=system,DC=example,DC=com;0][LDAP://CN={6AC1786C-016F-11D2-945F-00C04FB984F9},CN=Policies,CN=System,DC=example,DC=com;2]"
+
+	links, err := parseGPLink(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].GUID() != "31b2f340-016d-11d2-945f-00c04fb984f9" || links[1].Options != gpLinkEnforced {
+		t.Fatalf("Error parsing gPLink: got %v", links)
+	}
+	if got := formatGPLink(links); got != value {
+		t.Fatalf("Error round-tripping gPLink: got %s, expected %s", got, value)
+	}
+
+	managed := map[string]bool{"6ac1786c-016f-11d2-945f-00c04fb984f9": true, "11111111-2222-3333-4444-555555555555": true}
+	desired := []gpLink{
+		{DN: gpoDN("11111111-2222-3333-4444-555555555555", "DC=example,DC=com"), Options: 0},
+		{DN: gpoDN("{6ac1786c-016f-11d2-945f-00c04fb984f9}", "DC=example,DC=com"), Options: gpLinkDisabled},
+	}
+	expected := "[LDAP://cn={31B2F340-016D-11D2-945F-00C04FB984F9},cn=policies,cn=system,DC=example,DC=com;0]" +
+		"[LDAP://cn={6AC1786C-016F-11D2-945F-00C04FB984F9},cn=policies,cn=system,DC=example,DC=com;1]" +
+		"[LDAP://cn={11111111-2222-3333-4444-555555555555},cn=policies,cn=system,DC=example,DC=com;0]"
+	if got := formatGPLink(mergeGPLinks(links, managed, desired)); got != expected {
+		t.Fatalf("Error merging gPLink: got %s, expected %s", got, expected)
+	}
+}
+
+func TestAdldapClientHasServicePrincipal(t *testing.T) {
+	account := &LdapAccount{
+		LdapEntry: &LdapEntry{
+			Entry: ldap.NewEntry("CN=svc-web,OU=Service Accounts,DC=example,DC=com", map[string][]string{
+				"servicePrincipalName": {"HTTP/web01.example.com", "HTTP/web01"},
+			}),
+		},
+	}
+
+	cases := []struct {
+		spn      string
+		expected string
+	}{
+		{
+			spn:      "HTTP/web01.example.com",
+			expected: "HTTP/web01.example.com",
+		},
+		{
+			spn:      "http/WEB01.example.com",
+			expected: "HTTP/web01.example.com",
+		},
+		{
+			spn:      "HTTP/web02.example.com",
+			expected: "",
+		},
+	}
+
+	for _, c := range cases {
+		got, err := account.findServicePrincipal(context.Background(), c.spn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for %s: got %s, expected %s", c.spn, got, c.expected)
+		}
+		has, _ := account.HasServicePrincipal(context.Background(), c.spn)
+		if has != (c.expected != "") {
+			t.Fatalf("Error matching HasServicePrincipal for %s: got %t", c.spn, has)
+		}
+	}
+}
+
+func TestAdldapClientGlobalCatalogURL(t *testing.T) {
+	cases := []struct {
+		ldapURL          string
+		domainController string
+		expected         string
+	}{
+		{
+			ldapURL:  "ldaps://dc01.example.com",
+			expected: "ldaps://dc01.example.com:3269",
+		},
+		{
+			ldapURL:  "ldap://dc01.example.com:389",
+			expected: "ldap://dc01.example.com:3268",
+		},
+		{
+			ldapURL:          "ldaps://example.com",
+			domainController: "dc02.example.com",
+			expected:         "ldaps://dc02.example.com:3269",
+		},
+	}
+
+	for _, c := range cases {
+		got, err := globalCatalogURL(c.ldapURL, c.domainController)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for %s: got %s, expected %s", c.ldapURL, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapClientGlobalCatalog_unreachable(t *testing.T) {
+	client, directory := newFakeClient(t)
+	userDN := "CN=SPN Holder,CN=Users," + fakeDomainDN
+	directory.put(userDN, map[string][]string{"objectClass": {"user"}, "servicePrincipalName": {"HTTP/app.example.com"}})
+
+	// Nothing listens on the loopback's Global Catalog port
+	client.LdapURL = "ldap://127.0.0.1"
+	client.dc = &domainControllerName{name: "127.0.0.1"}
+	client.gc = new(globalCatalogConn)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.globalCatalog(ctx); err == nil {
+				t.Error("Error dialing an unreachable Global Catalog: got no error")
+			}
+		}()
+	}
+	wg.Wait()
+	if client.gc.err == nil || client.gc.conn != nil {
+		t.Fatalf("Error remembering the failed dial: got %v", client.gc.err)
+	}
+
+	// Lookups fall back to the domain
+	holders, err := client.FindServicePrincipalHolders(ctx, "HTTP/app.example.com")
+	if err != nil || len(holders) != 1 || !dnsEqual(holders[0], userDN) {
+		t.Errorf("Error finding SPN holders without the Global Catalog: got %v, %v", holders, err)
+	}
+}
+
+func TestAdldapClientEntryFilterEscaping(t *testing.T) {
+	names := []string{
+		"tfacctst",
+		"Sales (EMEA)",
+		"*",
+		"admin)(|(sAMAccountName=*",
+		`CN=Smith\, John,OU=Users,DC=example,DC=com`,
+		"Zoë\x00",
+	}
+
+	for _, name := range names {
+		filter := entryFilter("*", "sAMAccountName", ldap.EscapeFilter(name))
+		packet, err := ldap.CompileFilter(filter)
+		if err != nil {
+			t.Fatalf("Error compiling filter for \"%s\": %s", name, err)
+		}
+		if len(packet.Children) != 2 || packet.Children[1].Tag != ldap.FilterEqualityMatch {
+			t.Fatalf("Filter for \"%s\" is not an equality match: %s", name, filter)
+		}
+		if got := packet.Children[1].Children[1].Data.String(); got != name {
+			t.Fatalf("Error matching value for \"%s\": got %s", name, got)
+		}
+	}
+}
+
+func TestAdldapLdapEntryNonEmptyValues(t *testing.T) {
+	cases := []struct {
+		values   []string
+		expected []string
+	}{
+		{
+			values:   []string{""},
+			expected: []string{},
+		},
+		{
+			values:   nil,
+			expected: []string{},
+		},
+		{
+			values:   []string{"a", "", "b"},
+			expected: []string{"a", "b"},
+		},
+	}
+
+	for _, c := range cases {
+		got := nonEmptyValues(c.values)
+		if !stringSlicesEqual(got, c.expected) {
+			t.Fatalf("Error matching output and expected for %q: got %q, expected %q", c.values, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapLdapEntrySetCachedAttributeValues(t *testing.T) {
+	entry := &LdapEntry{
+		Entry: ldap.NewEntry("CN=test,DC=example,DC=com", map[string][]string{
+			"description": {"old"},
+		}),
+		requestedAttributes: []string{"description", "location"},
+	}
+
+	entry.setCachedAttributeValues("Description", []string{})
+	entry.setCachedAttributeValues("location", []string{"Lab"})
+
+	description, err := entry.GetAttributeValues(context.Background(), "description")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(description) != 0 {
+		t.Fatalf("Error clearing cached description: got %q", description)
+	}
+	location, err := entry.GetAttributeValue(context.Background(), "LOCATION")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location != "Lab" {
+		t.Fatalf("Error setting cached location: got %q, expected %q", location, "Lab")
+	}
+}
+
+func TestAdldapClientIsNotFound(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{
+			err:      &NotFoundError{ObjectClass: "*", Name: "tfacctst"},
+			expected: true,
+		},
+		{
+			err:      fmt.Errorf("error adopting account: %w", &NotFoundError{ObjectClass: "*", Name: "tfacctst"}),
+			expected: true,
+		},
+		{
+			err:      ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object")),
+			expected: true,
+		},
+		{
+			err:      ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("access denied")),
+			expected: false,
+		},
+		{
+			err:      nil,
+			expected: false,
+		},
+	}
+
+	for _, c := range cases {
+		if got := IsNotFound(c.err); got != c.expected {
+			t.Fatalf("Error matching output and expected for %v: got %t, expected %t", c.err, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapClientDoContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	err := doContext(cancelled, func() error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || ran {
+		t.Fatalf("Error running operation with cancelled context: got %v, ran %t", err, ran)
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	err = doContext(expired, func() error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Error waiting for operation past deadline: got %v", err)
+	}
+
+	err = doContext(context.Background(), func() error {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+	})
+	if !IsNotFound(err) {
+		t.Fatalf("Error returning operation error: got %v", err)
+	}
+}
+
+func TestAdldapClientRetryContext(t *testing.T) {
+	initialDelay, maxDelay := retryInitialDelay, retryMaxDelay
+	retryInitialDelay, retryMaxDelay = time.Millisecond, time.Millisecond
+	defer func() { retryInitialDelay, retryMaxDelay = initialDelay, maxDelay }()
+
+	busy := ldap.NewError(ldap.LDAPResultBusy, errors.New("busy"))
+	replicating := ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("000020F6: SvcErr: DSID-0320130A, problem 5003 (WILL_NOT_PERFORM)"))
+	unwilling := ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("0000052D: Constraint violation"))
+	violation := ldap.NewError(ldap.LDAPResultConstraintViolation, errors.New("constraint violation"))
+
+	cases := []struct {
+		errs     []error
+		attempts int
+		wantErr  error
+	}{
+		{[]error{nil}, 1, nil},
+		{[]error{busy, replicating, nil}, 3, nil},
+		{[]error{unwilling}, 1, unwilling},
+		{[]error{busy, violation}, 2, violation},
+		{[]error{busy, busy, busy, busy, busy, busy}, retryAttempts, busy},
+	}
+
+	for _, c := range cases {
+		attempts := 0
+		reported, err := retryContext(context.Background(), func() error {
+			err := c.errs[attempts]
+			attempts++
+			return err
+		})
+		if attempts != c.attempts || reported != c.attempts {
+			t.Errorf("Error retrying %v: got %d attempts, reported %d, wanted %d", c.errs, attempts, reported, c.attempts)
+		}
+		if !errors.Is(err, c.wantErr) {
+			t.Errorf("Error retrying %v: got %v, wanted %v", c.errs, err, c.wantErr)
+		}
+		var retryErr *RetryError
+		if errors.As(err, &retryErr) != (err != nil && c.attempts > 1) {
+			t.Errorf("Error retrying %v: got %v, wanted attempt count only after retrying", c.errs, err)
+		}
+	}
+
+	if !isLDAPError(&RetryError{Attempts: 2, Err: violation}, ldap.LDAPResultConstraintViolation) {
+		t.Errorf("Error matching result code through RetryError")
+	}
+}
+
+func TestAdldapClientLdapOperationError(t *testing.T) {
+	cases := []struct {
+		err      *LdapOperationError
+		expected string
+	}{
+		{
+			&LdapOperationError{Operation: "modify", DN: "CN=foo,DC=example,DC=com", Err: ldap.NewError(ldap.LDAPResultConstraintViolation, errors.New("0000052D: Constraint violation - check_password_restrictions: the password does not meet the complexity requirements"))},
+			"modify \"CN=foo,DC=example,DC=com\": LDAP result code 19 (Constraint Violation): 0000052D: Constraint violation - check_password_restrictions: the password does not meet the complexity requirements [0000052D: password does not meet the domain password policy]",
+		},
+		{
+			&LdapOperationError{Operation: "bind as", DN: "admin@example.com", Err: ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 775, v4563"))},
+			"bind as \"admin@example.com\": LDAP result code 49 (Invalid Credentials): 80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 775, v4563 [00000775: account locked out]",
+		},
+		{
+			&LdapOperationError{Operation: "search", DN: "OU=gone,DC=example,DC=com", Filter: "(objectClass=user)", Err: &ldap.Error{ResultCode: ldap.LDAPResultNoSuchObject, MatchedDN: "DC=example,DC=com", Err: errors.New("0000208D: NameErr: DSID-03100241, problem 2001 (NO_OBJECT), data 0")}},
+			"search \"OU=gone,DC=example,DC=com\" with filter (objectClass=user): LDAP result code 32 (No Such Object): 0000208D: NameErr: DSID-03100241, problem 2001 (NO_OBJECT), data 0 [0000208D: object not found] (matched DN \"DC=example,DC=com\")",
+		},
+		{
+			&LdapOperationError{Operation: "add", DN: "CN=foo,DC=example,DC=com", Err: &RetryError{Attempts: 5, Err: ldap.NewError(ldap.LDAPResultBusy, errors.New("busy"))}},
+			"add \"CN=foo,DC=example,DC=com\": LDAP result code 51 (Busy): busy (after 5 attempts)",
+		},
+		{
+			&LdapOperationError{Operation: "delete", DN: "CN=foo,DC=example,DC=com", Err: context.DeadlineExceeded},
+			"delete \"CN=foo,DC=example,DC=com\": context deadline exceeded",
+		},
+	}
+
+	for _, c := range cases {
+		if got := c.err.Error(); got != c.expected {
+			t.Errorf("Error formatting %s error: got\n%s\nwanted\n%s", c.err.Operation, got, c.expected)
+		}
+	}
+
+	if !IsNotFound(cases[2].err) {
+		t.Errorf("Error matching not found through LdapOperationError")
+	}
+}
+
+func TestAdldapClientPasswordPolicyViolation(t *testing.T) {
+	policy := &PasswordPolicy{
+		Source:        "DC=example,DC=com",
+		MinLength:     8,
+		HistoryLength: 24,
+		MinAge:        24 * time.Hour,
+		Complexity:    true,
+	}
+
+	cases := []struct {
+		password        string
+		passwordLastSet time.Time
+		expected        string
+	}{
+		{"Sh0rt!", time.Time{}, "it is 6 characters long, and DC=example,DC=com requires at least 8"},
+		{"alllowercase", time.Time{}, "DC=example,DC=com requires complex passwords, with characters from at least three of uppercase letters, lowercase letters, digits, and symbols, and it has 1"},
+		{"Xjdoe-2024", time.Time{}, "DC=example,DC=com requires complex passwords, which must not contain the account name"},
+		{"C0rrect-Horse", time.Now().Add(-time.Hour), "it was last changed at"},
+		{"C0rrect-Horse", time.Now().Add(-48 * time.Hour), "it meets the length and complexity rules of DC=example,DC=com, so it may be one of the last 24 passwords used"},
+	}
+
+	for _, c := range cases {
+		got := passwordPolicyViolation(policy, c.password, "jdoe", c.passwordLastSet)
+		if !strings.HasPrefix(got, c.expected) {
+			t.Errorf("Error explaining rejection of %q: got %q, wanted prefix %q", c.password, got, c.expected)
+		}
+	}
+
+	if got := intervalToDuration("-864000000000"); got != 24*time.Hour {
+		t.Errorf("Error converting interval: got %s", got)
+	}
+
+	rejected := &LdapOperationError{Operation: "modify", DN: "CN=jdoe,DC=example,DC=com", Err: ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("0000052D: SvcErr: DSID-031A12D2, problem 5003 (WILL_NOT_PERFORM), data 0"))}
+	if !isPasswordPolicyError(rejected) {
+		t.Errorf("Error detecting password policy rejection: %s", rejected)
+	}
+	if isPasswordPolicyError(ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("00002098: SecErr"))) {
+		t.Errorf("Error detecting password policy rejection: access denied matched")
+	}
+}
+
+func TestAdldapLdapEntryRangeRetrieval(t *testing.T) {
+	ctx := context.Background()
+	client, directory := newFakeClient(t)
+	directory.maxValRange = 3
+
+	var spns []string
+	for i := 0; i < 10; i++ {
+		spns = append(spns, fmt.Sprintf("HTTP/web%d.example.com", i))
+	}
+	account, err := client.CreateComputerAccount(ctx, "RANGED$", "", "CN=Computers,"+fakeDomainDN, map[string][]string{"servicePrincipalName": spns})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := client.GetAccountByDN(ctx, account.DN, objectClassUser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fetched.GetServicePrincipals(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stringSlicesEqual(got, spns) {
+		t.Errorf("Error reading ranged attribute: got %v, wanted %v", got, spns)
+	}
+
+	fetched, err = client.GetAccountByDN(ctx, account.DN, objectClassUser, []string{"servicePrincipalName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fetched.UpdateAttribute(ctx, "servicePrincipalName", spns[:9])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := fakeAttribute(directory.Entry(account.DN), "servicePrincipalName"); len(stored) != 9 {
+		t.Errorf("Error updating ranged attribute: got %d values, wanted 9", len(stored))
+	}
+
+	cases := []struct {
+		description string
+		name        string
+		last        int
+		ranged      bool
+	}{
+		{"member;range=0-1499", "member", 1499, true},
+		{"member;range=1500-*", "member", -1, true},
+		{"member", "member", 0, false},
+	}
+	for _, c := range cases {
+		name, last, ranged := parseRangedAttribute(c.description)
+		if name != c.name || last != c.last || ranged != c.ranged {
+			t.Errorf("Error parsing %s: got %s, %d, %t", c.description, name, last, ranged)
+		}
+	}
+}
+
+func TestAdldapClientAllowedBaseDNs(t *testing.T) {
+	client, directory := newFakeClient(t)
+	directory.recycleBin = true
+	client.Conn = &guardedConn{Client: client.Conn, allowedBaseDNs: []string{"CN=Users," + fakeDomainDN}}
+	ctx := context.Background()
+
+	isPolicyError := func(err error) bool {
+		var policyErr *PolicyError
+		return errors.As(err, &policyErr)
+	}
+
+	if _, err := client.CreateOU(ctx, "OU=Outside,"+fakeDomainDN, nil); !isPolicyError(err) {
+		t.Fatalf("Error refusing add outside the allowed base DNs: got %v", err)
+	}
+	if directory.Entry("OU=Outside,"+fakeDomainDN) != nil {
+		t.Fatal("Error refusing add outside the allowed base DNs: the OU was created")
+	}
+
+	account, err := client.CreateUserAccount(ctx, "guarded", "", "cn=users,dc=EXAMPLE,dc=com", map[string][]string{"cn": {"Guarded"}})
+	if err != nil {
+		t.Fatalf("Error adding inside the allowed base DNs: %s", err)
+	}
+	if err := account.UpdateAttribute(ctx, "description", []string{"Inside"}); err != nil {
+		t.Fatalf("Error modifying inside the allowed base DNs: %s", err)
+	}
+	if err := account.Move(ctx, "CN=Computers,"+fakeDomainDN); !isPolicyError(err) {
+		t.Fatalf("Error refusing move out of the allowed base DNs: got %v", err)
+	}
+	if !strings.Contains(fmt.Sprint(account.Move(ctx, "CN=Computers,"+fakeDomainDN)), "outside allowed_base_dns") {
+		t.Fatal("Error explaining the policy violation")
+	}
+	if err := client.Conn.Del(ldap.NewDelRequest("CN=Computers,"+fakeDomainDN, nil)); !isPolicyError(err) {
+		t.Fatalf("Error refusing delete outside the allowed base DNs: got %v", err)
+	}
+
+	// Restores are checked against where the object is restored to
+	if err := client.Conn.Del(ldap.NewDelRequest(account.DN, nil)); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := client.RestoreDeletedAccount(ctx, "guarded", "CN=Computers,"+fakeDomainDN)
+	if !restored || !isPolicyError(err) {
+		t.Fatalf("Error refusing restore outside the allowed base DNs: got %t, %v", restored, err)
+	}
+	restored, err = client.RestoreDeletedAccount(ctx, "guarded", "CN=Users,"+fakeDomainDN)
+	if !restored || err != nil {
+		t.Fatalf("Error restoring inside the allowed base DNs: got %t, %v", restored, err)
+	}
+}
+
+func TestAdldapClientDomainControllerName_concurrent(t *testing.T) {
+	client, directory := newFakeClient(t)
+	ctx := context.Background()
+	searches := directory.Searches()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if name, err := client.DomainControllerName(ctx); err != nil || name != "dc1.example.com" {
+				t.Errorf("Error reading domain controller name: got %q, %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := directory.Searches() - searches; got != 1 {
+		t.Errorf("Error reading the name once: got %d searches", got)
+	}
+}
+
+func TestAdldapClientAwaitReplication(t *testing.T) {
+	client, directory := newFakeClient(t)
+	directory.recycleBin = true
+	client.ReplicationWait = time.Second
+	defer func(interval time.Duration) { replicationPollInterval = interval }(replicationPollInterval)
+	replicationPollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+
+	if name, err := client.DomainControllerName(ctx); err != nil || name != "dc1.example.com" {
+		t.Fatalf("Error reading domain controller name: got %q, %v", name, err)
+	}
+
+	missing := &NotFoundError{ObjectClass: "*", Name: "missing"}
+	guid := "01234567-89ab-cdef-0123-456789abcdef"
+	lookups := 0
+	err := awaitReplication(ctx, client, guid, func() error {
+		lookups++
+		if lookups < 3 {
+			return missing
+		}
+		return nil
+	})
+	if err != nil || lookups != 3 {
+		t.Fatalf("Error waiting for replication: got %v after %d lookups", err, lookups)
+	}
+
+	lookups = 0
+	err = awaitReplication(ctx, client, "tfacctst", func() error {
+		lookups++
+		return missing
+	})
+	if !IsNotFound(err) || lookups != 1 {
+		t.Fatalf("Error skipping the wait for IDs that aren't GUIDs: got %v after %d lookups", err, lookups)
+	}
+
+	ou, err := client.CreateOU(ctx, "OU=Deleted,"+fakeDomainDN, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectGUID, err := ou.GetObjectGUID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Conn.Del(ldap.NewDelRequest(ou.DN, nil)); err != nil {
+		t.Fatal(err)
+	}
+	lookups = 0
+	err = awaitReplication(ctx, client, objectGUID, func() error {
+		lookups++
+		return missing
+	})
+	if !IsNotFound(err) || lookups != 1 {
+		t.Fatalf("Error skipping the wait for deleted objects: got %v after %d lookups", err, lookups)
+	}
+
+	start := time.Now()
+	err = awaitReplication(ctx, client, guid, func() error { return missing })
+	if !IsNotFound(err) || time.Since(start) < client.ReplicationWait {
+		t.Fatalf("Error giving up after ReplicationWait: got %v after %s", err, time.Since(start))
+	}
+}
+
+// controlRecorder records the controls sent with each modify and rename.
+type controlRecorder struct {
+	ldap.Client
+	sent [][]ldap.Control
+}
+
+func (r *controlRecorder) Modify(request *ldap.ModifyRequest) error {
+	r.sent = append(r.sent, request.Controls)
+	return r.Client.Modify(request)
+}
+
+func (r *controlRecorder) ModifyDN(request *ldap.ModifyDNRequest) error {
+	r.sent = append(r.sent, request.Controls)
+	return r.Client.ModifyDN(request)
+}
+
+func TestAdldapClientWithControls(t *testing.T) {
+	client, directory := newFakeClient(t)
+	recorder := &controlRecorder{Client: directory}
+	client.Conn = recorder
+	ctx := context.Background()
+
+	if client.WithControls(nil) != client {
+		t.Fatal("Error returning the client unchanged without controls")
+	}
+
+	permissive := ldap.NewControlString("1.2.840.113556.1.4.1413", false, "")
+	withControls := client.WithControls([]*ldap.ControlString{permissive})
+	request := ldap.NewModifyRequest("CN=Users,"+fakeDomainDN, nil)
+	request.Replace("description", []string{"Users"})
+	for i := 0; i < 2; i++ {
+		if err := modifyContext(ctx, withControls.Conn, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(recorder.sent) != 2 || len(recorder.sent[0]) != 1 || len(recorder.sent[1]) != 1 || recorder.sent[1][0].GetControlType() != permissive.ControlType {
+		t.Fatalf("Error attaching controls once per request: got %v", recorder.sent)
+	}
+	if len(request.Controls) != 0 {
+		t.Fatalf("Error leaving the caller's request unchanged: got %v", request.Controls)
+	}
+	if err := modifyContext(ctx, client.Conn, request); err != nil || len(recorder.sent[2]) != 0 {
+		t.Fatalf("Error leaving the provider's client without controls: got %v, %v", recorder.sent[2], err)
+	}
+
+	rename := ldap.NewModifyDNRequest("CN=Users,"+fakeDomainDN, "CN=People", true, "")
+	if err := modifyDNContext(ctx, withControls.Conn, rename); err != nil || directory.Entry("CN=People,"+fakeDomainDN) == nil {
+		t.Fatalf("Error renaming with controls: %v", err)
+	}
+	if len(recorder.sent) != 4 || len(recorder.sent[3]) != 1 || recorder.sent[3][0].GetControlType() != permissive.ControlType {
+		t.Fatalf("Error attaching controls to a rename: got %v", recorder.sent)
+	}
+
+	d := schema.TestResourceDataRaw(t, map[string]*schema.Schema{"ldap_controls": ldapControlsSchema()}, map[string]interface{}{
+		"ldap_controls": []interface{}{
+			map[string]interface{}{"oid": "1.2.840.113556.1.4.1413", "critical": true, "value_base64": "MAMCAQE="},
+		},
+	})
+	fromResource, err := resourceClient(context.Background(), d, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controls := fromResource.Conn.(*controlsConn).controls
+	if len(controls) != 1 || !controls[0].Criticality || controls[0].ControlValue != "\x30\x03\x02\x01\x01" {
+		t.Fatalf("Error reading ldap_controls: got %v", controls)
+	}
+}
+
+// searchRecorder records the scope of each search.
+type searchRecorder struct {
+	ldap.Client
+	scopes []int
+}
+
+func (r *searchRecorder) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	r.scopes = append(r.scopes, request.Scope)
+	return r.Client.Search(request)
+}
+
+func TestAdldapClientDNCache(t *testing.T) {
+	client, directory := newFakeClient(t)
+	recorder := &searchRecorder{Client: directory}
+	client.Conn = &dnCacheConn{Client: recorder, cache: client.dnCache}
+	ctx := context.Background()
+	userDN := "CN=Cached User,CN=Users," + fakeDomainDN
+	directory.put(userDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"cached"}})
+
+	account, err := client.GetAccountBySAMAccountName(ctx, "cached", objectClassUser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetAccountBySAMAccountName(ctx, "CACHED", objectClassUser, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dn, err := client.GetDN(ctx, "cached"); err != nil || dn != userDN {
+		t.Fatalf("Error getting the cached DN: got %s, %v", dn, err)
+	}
+	if len(recorder.scopes) != 2 || recorder.scopes[0] != ldap.ScopeWholeSubtree || recorder.scopes[1] != ldap.ScopeBaseObject {
+		t.Fatalf("Error searching only the cached DN: got scopes %v", recorder.scopes)
+	}
+
+	// Renames made through the client are forgotten without a failed lookup
+	if err := account.Rename(ctx, "Renamed User"); err != nil {
+		t.Fatal(err)
+	}
+	if dn, err := client.GetDN(ctx, "cached"); err != nil || dn != "CN=Renamed User,CN=Users,"+fakeDomainDN {
+		t.Fatalf("Error forgetting a renamed account: got %s, %v", dn, err)
+	}
+
+	// So are changes of sAMAccountName
+	if err := account.UpdateAttribute(ctx, "sAMAccountName", []string{"recached"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetDN(ctx, "cached"); !IsNotFound(err) {
+		t.Fatalf("Error forgetting a changed sAMAccountName: got %v", err)
+	}
+
+	// Moves made outside the provider are caught by the base search
+	if dn, err := client.GetDN(ctx, "recached"); err != nil || dn != "CN=Renamed User,CN=Users,"+fakeDomainDN {
+		t.Fatalf("Error caching the new sAMAccountName: got %s, %v", dn, err)
+	}
+	if err := directory.ModifyDN(ldap.NewModifyDNRequest("CN=Renamed User,CN=Users,"+fakeDomainDN, "CN=Renamed User", true, "CN=Computers,"+fakeDomainDN)); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := client.GetObjectBySAMAccountName(ctx, "recached", objectClassUser, nil)
+	if err != nil || moved.DN != "CN=Renamed User,CN=Computers,"+fakeDomainDN {
+		t.Fatalf("Error finding an account moved outside the provider: got %s, %v", moved.DN, err)
+	}
+}
+
+func TestAdldapClientLookupObjectClass(t *testing.T) {
+	client, directory := newFakeClient(t)
+	ctx := context.Background()
+	userDN := "CN=Class User,CN=Users," + fakeDomainDN
+	directory.put(userDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"classuser"}})
+	directory.put("CN=WS03,CN=Computers,"+fakeDomainDN, map[string][]string{"objectClass": {"computer"}, "sAMAccountName": {"WS03$"}})
+	directory.put("CN=Class Group,CN=Users,"+fakeDomainDN, map[string][]string{"objectClass": {"group"}, "sAMAccountName": {"classgroup"}})
+
+	if _, err := client.GetAccountByDN(ctx, userDN, objectClassComputer, nil); !IsNotFound(err) {
+		t.Errorf("Error excluding users from computer lookups: got %v", err)
+	}
+	if _, err := client.GetAccountBySAMAccountName(ctx, "classgroup", objectClassUser, nil); !IsNotFound(err) {
+		t.Errorf("Error excluding groups from user lookups: got %v", err)
+	}
+	if _, err := client.GetAccountBySAMAccountName(ctx, "WS03$", objectClassUser, nil); err != nil {
+		t.Errorf("Error including computers in user lookups: %s", err)
+	}
+
+	// sAMAccountNames are unique across every class, so any holder counts
+	exists, err := client.AccountExists(ctx, "classgroup")
+	if err != nil || !exists {
+		t.Errorf("Error finding a group's sAMAccountName: got %t, %v", exists, err)
+	}
+}
+
+func TestAdldapClientGetObjectByDN(t *testing.T) {
+	client, directory := newFakeClient(t)
+	recorder := &searchRecorder{Client: directory}
+	client.Conn = recorder
+	ctx := context.Background()
+	ouDN := "OU=Base Scoped," + fakeDomainDN
+	directory.put(ouDN, map[string][]string{"objectClass": {"organizationalUnit"}, "description": {"base"}})
+
+	entry, err := client.GetObjectByDN(ctx, ouDN, []string{"description"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.DN != ouDN || entry.Entry.GetAttributeValue("description") != "base" {
+		t.Errorf("Error reading the object: got %s", entry.DN)
+	}
+	for _, scope := range recorder.scopes {
+		if scope != ldap.ScopeBaseObject {
+			t.Errorf("Error reading the object with a base search: got scopes %v", recorder.scopes)
+		}
+	}
+
+	if _, err := client.GetObjectByDN(ctx, "OU=Missing,"+fakeDomainDN, nil); !IsNotFound(err) {
+		t.Errorf("Error reporting a missing object: got %v", err)
+	}
+	if _, err := client.GetObjectByDN(ctx, "not a DN", nil); !IsNotFound(err) {
+		t.Errorf("Error reporting a malformed DN: got %v", err)
+	}
+	if _, err := client.GetOUWithAttributes(ctx, ouDN, nil); err != nil {
+		t.Errorf("Error reading the OU: %s", err)
+	}
+	if _, err := client.GetAccountByDN(ctx, ouDN, objectClassUser, nil); !IsNotFound(err) {
+		t.Errorf("Error excluding other classes at the DN: got %v", err)
+	}
+
+	exists, err := client.ContainerExists(ctx, ouDN)
+	if err != nil || !exists {
+		t.Errorf("Error finding the container: got %t, %v", exists, err)
+	}
+	exists, err = client.ObjectExists(ctx, "OU=Missing,"+fakeDomainDN, "organizationalUnit")
+	if err != nil || exists {
+		t.Errorf("Error reporting a missing container: got %t, %v", exists, err)
+	}
+}
+
+func TestAdldapClientCreateWithoutExistenceChecks(t *testing.T) {
+	client, directory := newFakeClient(t)
+	recorder := &searchRecorder{Client: directory}
+	client.Conn = recorder
+	ctx := context.Background()
+	ouDN := "OU=Leaf,OU=Middle,OU=Top," + fakeDomainDN
+
+	ou, err := client.CreateOUAndParents(ctx, ouDN, map[string][]string{"description": {"leaf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ou.DN != ouDN || ou.Entry.GetAttributeValue("objectGUID") == "" {
+		t.Errorf("Error reading the created OU back: got %s", ou.DN)
+	}
+	// One search per missing ancestor and one for the domain, then one to read
+	// each OU back after adding it
+	if len(recorder.scopes) != 6 {
+		t.Errorf("Error creating the OUs without re-checking them: got %d searches", len(recorder.scopes))
+	}
+
+	recorder.scopes = nil
+	_, err = client.CreateOU(ctx, ouDN, nil)
+	if !IsAlreadyExists(err) {
+		t.Errorf("Error reporting an existing OU: got %v", err)
+	}
+	if len(recorder.scopes) != 0 {
+		t.Errorf("Error relying on the add to report an existing OU: got %d searches", len(recorder.scopes))
+	}
+
+	created, err := client.CreateParentOUs(ctx, "OU=Other,OU=Leaf,OU=Middle,OU=Top,"+fakeDomainDN)
+	if err != nil || len(created) != 0 {
+		t.Errorf("Error leaving existing parents alone: got %v, %v", created, err)
+	}
+
+	directory.put("CN=First,CN=Users,"+fakeDomainDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"first"}})
+	_, err = client.CreateUserAccount(ctx, "first", "", "OU=Leaf,OU=Middle,OU=Top,"+fakeDomainDN, nil)
+	if err == nil || IsAlreadyExists(err) {
+		t.Errorf("Error telling a duplicate sAMAccountName from an existing DN: got %v", err)
+	}
+
+	account, err := client.GetAccountBySAMAccountName(ctx, "first", objectClassUser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory.put("CN=Second,CN=Users,"+fakeDomainDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"second"}})
+	err = account.Rename(ctx, "Second")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Error reporting a rename onto an existing object: got %v", err)
+	}
+	err = account.Move(ctx, "OU=Missing,"+fakeDomainDN)
+	if err == nil || !strings.Contains(err.Error(), "non-existent") {
+		t.Errorf("Error reporting a move to a missing container: got %v", err)
+	}
+}
+
+func TestAdldapClientNew_searchBase(t *testing.T) {
+	_, directory := newFakeClient(t)
+	scopedDN := "OU=Scoped," + fakeDomainDN
+	directory.put(scopedDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+	dial := dialClient
+	dialClient = func(context.Context, string) (ldap.Client, error) { return directory, nil }
+	defer func() { dialClient = dial }()
+	ctx := context.Background()
+
+	client := new(LdapClient)
+	if err := client.New(ctx, "ldap://dc1.example.com", "admin@example.com", "Passw0rd!", scopedDN, false); err != nil {
+		t.Fatal(err)
+	}
+	if client.SearchBase != scopedDN {
+		t.Errorf("Error using the configured search base: got %s", client.SearchBase)
+	}
+
+	// Without one, the domain's naming context is searched
+	client = new(LdapClient)
+	if err := client.New(ctx, "ldap://dc1.example.com", "admin@example.com", "Passw0rd!", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if client.SearchBase != fakeDomainDN {
+		t.Errorf("Error detecting the search base: got %s", client.SearchBase)
+	}
+}
@@ -0,0 +1,228 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceChangedObjects() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "`adldap_changed_objects` returns the objects changed since an earlier read, by update sequence number (USN) or with the DirSync control, for incremental reconciliation jobs that would otherwise rescan the whole directory.",
+
+		ReadContext: dataSourceChangedObjectsRead,
+
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Description: "The distinguished name searched beneath.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"domain": {
+				Description:      "The DNS name of the domain to read changes in, as for resources' `domain`.  USNs and cookies only mean anything in the domain they were read from.  Defaults to the provider's domain.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateDNSName,
+			},
+			"distinguished_name": {
+				Description:      "The distinguished name beneath which to look for changes.  DirSync only accepts the head of a naming context, such as the domain's distinguished name.  Defaults to the provider's `search_base`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateDN,
+			},
+			"mode": {
+				Description:  "How to find changes: `usn` for objects whose `uSNChanged` is above `since_usn`, or `dirsync` for the changes since `cookie` with the DirSync control.  USNs are local to each domain controller, so `usn` mode must keep reading from the same one; `server` tells which it was.  DirSync cookies work on any domain controller in the domain, and DirSync returns only the attributes that changed.  Defaults to `usn`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "usn",
+				ValidateFunc: validation.StringInSlice([]string{"usn", "dirsync"}, false),
+			},
+			"filter": {
+				Description: "An LDAP filter the changed objects must match.  Defaults to `(objectClass=*)`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "(objectClass=*)",
+			},
+			"attributes": {
+				Description: "The attributes to return.  Defaults to all attributes the directory returns without being asked by name.",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+			},
+			"since_usn": {
+				Description:   "In `usn` mode, return the objects changed after this USN, usually the `highest_usn` of an earlier read.  Defaults to `0`, which returns every object.",
+				Type:          schema.TypeInt,
+				Optional:      true,
+				ValidateFunc:  validation.IntAtLeast(0),
+				ConflictsWith: []string{"cookie"},
+			},
+			"include_deleted": {
+				Description: "In `usn` mode, also return deleted objects, while their tombstones last.  DirSync always returns them.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"cookie": {
+				Description:      "In `dirsync` mode, the base64-encoded `next_cookie` of an earlier read.  Without one, every object is returned.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateBase64,
+			},
+			"dirsync_object_security": {
+				Description: "In `dirsync` mode, return only the objects and attributes the bind account can read, so that it doesn't need the Replicating Directory Changes right on the naming context.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"objects": {
+				Description: "The changed objects.  In `usn` mode they are in the order they last changed.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"distinguished_name": {
+							Description: "The distinguished name of the object.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"object_guid": {
+							Description: "The objectGUID of the object, which stays the same when it is renamed, moved, or deleted.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"usn_changed": {
+							Description: "The USN of the object's last change on the domain controller read from.",
+							Type:        schema.TypeInt,
+							Computed:    true,
+						},
+						"deleted": {
+							Description: "Whether the object has been deleted.",
+							Type:        schema.TypeBool,
+							Computed:    true,
+						},
+						"attributes": {
+							Description: "The object's attributes, in alphabetical order.  Values that aren't text, such as SIDs, are base64-encoded.",
+							Type:        schema.TypeList,
+							Computed:    true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"name": {
+										Description: "The name of the attribute.",
+										Type:        schema.TypeString,
+										Computed:    true,
+									},
+									"values": {
+										Description: "The values of the attribute.",
+										Type:        schema.TypeList,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+										Computed:    true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"highest_usn": {
+				Description: "In `usn` mode, the domain controller's highest committed USN when the read began, to pass as `since_usn` next time.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"next_cookie": {
+				Description: "In `dirsync` mode, the base64-encoded cookie to pass as `cookie` next time.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"server": {
+				Description: "The DNS name of the domain controller read from.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceChangedObjectsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client, err := domainClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	dn := d.Get("distinguished_name").(string)
+	if dn == "" {
+		dn = client.SearchBase
+	}
+	filter := d.Get("filter").(string)
+	var attributes []string
+	for _, attribute := range d.Get("attributes").([]interface{}) {
+		attributes = append(attributes, attribute.(string))
+	}
+
+	server, err := client.DomainControllerName(ctx)
+	if err != nil {
+		return diag.Errorf("error reading the domain controller's name: %s", err)
+	}
+
+	var objects []*ChangedObject
+	if d.Get("mode").(string) == "dirsync" {
+		cookie, _ := base64.StdEncoding.DecodeString(d.Get("cookie").(string))
+		var nextCookie []byte
+		objects, nextCookie, err = client.ChangesSinceCookie(ctx, dn, filter, cookie, attributes, d.Get("dirsync_object_security").(bool))
+		if err != nil {
+			return diag.Errorf("error reading changes beneath %s with DirSync: %s", dn, err)
+		}
+		d.Set("next_cookie", base64.StdEncoding.EncodeToString(nextCookie))
+		d.Set("highest_usn", 0)
+	} else {
+		var highestUSN int64
+		objects, highestUSN, err = client.ChangesSinceUSN(ctx, dn, filter, int64(d.Get("since_usn").(int)), attributes, d.Get("include_deleted").(bool))
+		if err != nil {
+			return diag.Errorf("error reading changes beneath %s: %s", dn, err)
+		}
+		d.Set("highest_usn", int(highestUSN))
+		d.Set("next_cookie", "")
+	}
+
+	d.SetId(dn)
+	d.Set("server", server)
+	d.Set("objects", flattenChangedObjects(objects))
+
+	return nil
+}
+
+func flattenChangedObjects(objects []*ChangedObject) []interface{} {
+	flattened := make([]interface{}, 0, len(objects))
+	for _, object := range objects {
+		names := make([]string, 0, len(object.Attributes))
+		for name := range object.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		attributes := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			values := make([]interface{}, 0, len(object.Attributes[name]))
+			for _, value := range object.Attributes[name] {
+				values = append(values, attributeValueString(value))
+			}
+			attributes = append(attributes, map[string]interface{}{
+				"name":   name,
+				"values": values,
+			})
+		}
+
+		flattened = append(flattened, map[string]interface{}{
+			"distinguished_name": object.DN,
+			"object_guid":        object.ObjectGUID,
+			"usn_changed":        int(object.USNChanged),
+			"deleted":            object.Deleted,
+			"attributes":         attributes,
+		})
+	}
+	return flattened
+}
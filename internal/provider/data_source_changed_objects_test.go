@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// fakeChangedDNs reads the changed objects' distinguished names.
+func fakeChangedDNs(d *schema.ResourceData) []string {
+	var dns []string
+	for _, object := range d.Get("objects").([]interface{}) {
+		dns = append(dns, object.(map[string]interface{})["distinguished_name"].(string))
+	}
+	return dns
+}
+
+func TestAdldapDataSourceChangedObjects_usn(t *testing.T) {
+	client, directory := newFakeClient(t)
+	directory.recycleBin = true
+	ouDN := "OU=Staff," + fakeDomainDN
+	directory.put(ouDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+	directory.put("CN=jdoe,"+ouDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"jdoe"}})
+	directory.put("CN=asmith,"+ouDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"asmith"}})
+
+	read := func(config map[string]interface{}) *schema.ResourceData {
+		t.Helper()
+		d := schema.TestResourceDataRaw(t, dataSourceChangedObjects().Schema, config)
+		if diags := dataSourceChangedObjectsRead(context.Background(), d, client); diags.HasError() {
+			t.Fatal(diags)
+		}
+		return d
+	}
+
+	// The first read returns everything and the USN to continue from
+	config := map[string]interface{}{
+		"distinguished_name": ouDN,
+		"filter":             "(objectClass=user)",
+		"attributes":         []interface{}{"sAMAccountName", "objectGUID"},
+		"include_deleted":    true,
+	}
+	d := read(config)
+	if dns := fakeChangedDNs(d); len(dns) != 2 || dns[0] != "CN=jdoe,"+ouDN {
+		t.Errorf("Error reading all objects in change order: got %v", dns)
+	}
+	if d.Get("server").(string) != "dc1.example.com" {
+		t.Errorf("Error recording the server: got %q", d.Get("server"))
+	}
+	object := d.Get("objects.0").(map[string]interface{})
+	guid := formatGUID([]byte(directory.Entry("CN=jdoe," + ouDN)["objectGUID"][0]))
+	if object["object_guid"] != guid || len(object["attributes"].([]interface{})) != 2 {
+		t.Errorf("Error reading jdoe: got %v", object)
+	}
+
+	// Only objects changed since are returned, deleted ones included
+	config["since_usn"] = d.Get("highest_usn")
+	modify := ldap.NewModifyRequest("CN=asmith,"+ouDN, nil)
+	modify.Replace("description", []string{"changed"})
+	if err := directory.Modify(modify); err != nil {
+		t.Fatal(err)
+	}
+	if err := directory.Del(ldap.NewDelRequest("CN=jdoe,"+ouDN, nil)); err != nil {
+		t.Fatal(err)
+	}
+	config["distinguished_name"] = fakeDomainDN
+	d = read(config)
+	objects := d.Get("objects").([]interface{})
+	if len(objects) != 2 || objects[0].(map[string]interface{})["distinguished_name"] != "CN=asmith,"+ouDN {
+		t.Fatalf("Error reading changed objects: got %v", objects)
+	}
+	deleted := objects[1].(map[string]interface{})
+	if !deleted["deleted"].(bool) || deleted["object_guid"] != guid {
+		t.Errorf("Error reading a deleted object: got %v", deleted)
+	}
+
+	// Nothing has changed since
+	config["since_usn"] = d.Get("highest_usn")
+	if dns := fakeChangedDNs(read(config)); len(dns) != 0 {
+		t.Errorf("Error reading no changes: got %v", dns)
+	}
+}
+
+func TestAdldapDataSourceChangedObjects_dirSync(t *testing.T) {
+	client, directory := newFakeClient(t)
+	directory.dirSyncPageSize = 2
+	for _, name := range []string{"a", "b", "c"} {
+		directory.put("CN="+name+",CN=Users,"+fakeDomainDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {name}})
+	}
+
+	read := func(config map[string]interface{}) *schema.ResourceData {
+		t.Helper()
+		d := schema.TestResourceDataRaw(t, dataSourceChangedObjects().Schema, config)
+		if diags := dataSourceChangedObjectsRead(context.Background(), d, client); diags.HasError() {
+			t.Fatal(diags)
+		}
+		return d
+	}
+
+	// Searches continue while the server has more changes
+	config := map[string]interface{}{
+		"mode":       "dirsync",
+		"filter":     "(objectClass=user)",
+		"attributes": []interface{}{"sAMAccountName"},
+	}
+	d := read(config)
+	if dns := fakeChangedDNs(d); len(dns) != 3 {
+		t.Errorf("Error reading every page of changes: got %v", dns)
+	}
+	if d.Get("next_cookie").(string) == "" {
+		t.Fatal("Error returning a cookie")
+	}
+
+	config["cookie"] = d.Get("next_cookie")
+	modify := ldap.NewModifyRequest("CN=b,CN=Users,"+fakeDomainDN, nil)
+	modify.Replace("description", []string{"changed"})
+	if err := directory.Modify(modify); err != nil {
+		t.Fatal(err)
+	}
+	if dns := fakeChangedDNs(read(config)); len(dns) != 1 || dns[0] != "CN=b,CN=Users,"+fakeDomainDN {
+		t.Errorf("Error reading changes since the cookie: got %v", dns)
+	}
+
+	// DirSync only searches from the head of a naming context
+	config["distinguished_name"] = "CN=Users," + fakeDomainDN
+	d = schema.TestResourceDataRaw(t, dataSourceChangedObjects().Schema, config)
+	if diags := dataSourceChangedObjectsRead(context.Background(), d, client); !diags.HasError() {
+		t.Error("Error reporting DirSync beneath a naming context")
+	}
+}
+
+func TestAdldapDirSyncControl(t *testing.T) {
+	control := dirSyncControl(dirSyncObjectSecurity, []byte("cookie"))
+	if control.GetControlType() != controlTypeDirSync {
+		t.Fatalf("Error building the DirSync control: got %s", control.GetControlType())
+	}
+
+	// The response has the same shape as the request
+	moreResults, cookie, err := parseDirSyncResponse(control)
+	if err != nil || !moreResults || string(cookie) != "cookie" {
+		t.Errorf("Error parsing DirSync response: got %v, %q, %v", moreResults, cookie, err)
+	}
+	if _, _, err := parseDirSyncResponse(ldap.NewControlString(controlTypeDirSync, false, "")); err == nil {
+		t.Error("Error rejecting an empty DirSync response")
+	}
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+var ldifExportScopes = map[string]int{
+	"base":    ldap.ScopeBaseObject,
+	"one":     ldap.ScopeSingleLevel,
+	"subtree": ldap.ScopeWholeSubtree,
+}
+
+func dataSourceLDIFExport() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "`adldap_ldif_export` renders an object, or the objects beneath it, as LDIF, for audits, backups, or feeding other tools.",
+
+		ReadContext: dataSourceLDIFExportRead,
+
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Description: "The distinguished name the export starts from.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"domain": {
+				Description:      "The DNS name of the domain to export from: one of the provider's `domain` blocks, or with `discover_domains`, any domain in the forest or trusting the provider's.  Defaults to the provider's domain.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateDNSName,
+			},
+			"distinguished_name": {
+				Description:      "The distinguished name of the object to export, or beneath which to export objects.",
+				Type:             schema.TypeString,
+				Required:         true,
+				ValidateDiagFunc: validateDN,
+			},
+			"scope": {
+				Description:  "Which objects to export: `base` for the object alone, `one` for its immediate children, or `subtree` for the object and everything beneath it.  Defaults to `base`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "base",
+				ValidateFunc: validation.StringInSlice([]string{"base", "one", "subtree"}, false),
+			},
+			"filter": {
+				Description: "An LDAP filter the exported objects must match.  Defaults to `(objectClass=*)`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "(objectClass=*)",
+			},
+			"attributes": {
+				Description: "The attributes to export.  Defaults to all attributes the directory returns without being asked by name, which leaves out operational attributes such as `nTSecurityDescriptor`; request those explicitly.",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+			},
+			"sort_by": {
+				Description: "An attribute to sort the exported objects by on the server, instead of putting parents before children, for deterministic listings of large containers.  AD sorts by a single attribute.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"sort_descending": {
+				Description: "Whether to sort by `sort_by` in descending order.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"offset": {
+				Description:  "The number of sorted objects to skip, to export a window of them with the virtual list view control.  Requires `sort_by`.  Defaults to `0`.",
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+				RequiredWith: []string{"sort_by", "limit"},
+			},
+			"limit": {
+				Description:  "The most sorted objects to export, to export a window of them with the virtual list view control.  A window can't span pages, so it is at most the server's `MaxPageSize`, by default 1000.  Requires `sort_by`.  Defaults to exporting every object.",
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(1),
+				RequiredWith: []string{"sort_by"},
+			},
+			"ldif": {
+				Description: "The exported objects as LDIF content records, parents before children, or in `sort_by` order, with `objectClass` first and the other attributes in alphabetical order.  Binary and non-ASCII values are base64-encoded.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"total_count": {
+				Description: "How many objects matched, including any outside the window of `offset` and `limit`.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"distinguished_names": {
+				Description: "The distinguished names of the exported objects, in the order they appear in `ldif`.",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceLDIFExportRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client, err := domainClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	dn := d.Get("distinguished_name").(string)
+
+	var attributes []string
+	for _, attribute := range d.Get("attributes").([]interface{}) {
+		attributes = append(attributes, attribute.(string))
+	}
+
+	var order *SearchOrder
+	if sortBy := d.Get("sort_by").(string); sortBy != "" {
+		order = &SearchOrder{
+			SortBy:     sortBy,
+			Descending: d.Get("sort_descending").(bool),
+			Offset:     d.Get("offset").(int),
+			Limit:      d.Get("limit").(int),
+		}
+	}
+
+	ldif, dns, total, err := client.ExportLDIF(ctx, dn, ldifExportScopes[d.Get("scope").(string)], d.Get("filter").(string), attributes, order)
+	if err != nil {
+		return diag.Errorf("error exporting %s: %s", dn, err)
+	}
+
+	d.SetId(dn)
+	d.Set("ldif", ldif)
+	d.Set("distinguished_names", dns)
+	d.Set("total_count", total)
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestAdldapFormatLDIF(t *testing.T) {
+	entry := ldap.NewEntry("CN=Zoë,OU=Staff,DC=example,DC=com", map[string][]string{
+		"sn":          {"Smith"},
+		"objectClass": {"top", "user"},
+		"description": {" leading space", strings.Repeat("x", 80)},
+		"objectGUID":  {"\x00\x01"},
+	})
+
+	expected := "version: 1\n" +
+		"\n" +
+		"dn:: Q049Wm/DqyxPVT1TdGFmZixEQz1leGFtcGxlLERDPWNvbQ==\n" +
+		"objectClass: top\n" +
+		"objectClass: user\n" +
+		"description:: IGxlYWRpbmcgc3BhY2U=\n" +
+		"description: " + strings.Repeat("x", 63) + "\n" +
+		" " + strings.Repeat("x", 17) + "\n" +
+		"objectGUID:: AAE=\n" +
+		"sn: Smith\n"
+	if got := formatLDIF([]*ldap.Entry{entry}); got != expected {
+		t.Errorf("Error formatting LDIF: got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestAdldapDataSourceLDIFExport_fake(t *testing.T) {
+	client, directory := newFakeClient(t)
+	ouDN := "OU=Export," + fakeDomainDN
+	directory.put(ouDN, map[string][]string{"objectClass": {"organizationalUnit"}, "description": {"exported"}})
+	directory.put("CN=Child,"+ouDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"child"}})
+
+	d := schema.TestResourceDataRaw(t, dataSourceLDIFExport().Schema, map[string]interface{}{
+		"distinguished_name": ouDN,
+		"scope":              "subtree",
+		"attributes":         []interface{}{"objectClass", "description", "sAMAccountName"},
+	})
+	if diags := dataSourceLDIFExportRead(context.Background(), d, client); diags.HasError() {
+		t.Fatal(diags)
+	}
+
+	dns := d.Get("distinguished_names").([]interface{})
+	if len(dns) != 2 || !dnsEqual(dns[0].(string), ouDN) {
+		t.Errorf("Error exporting parents first: got %v", dns)
+	}
+	ldif := d.Get("ldif").(string)
+	for _, line := range []string{"description: exported\n", "sAMAccountName: child\n", "objectClass: organizationalUnit\n"} {
+		if !strings.Contains(ldif, line) {
+			t.Errorf("Error exporting %q: got\n%s", line, ldif)
+		}
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourceLDIFExport().Schema, map[string]interface{}{
+		"distinguished_name": "OU=Missing," + fakeDomainDN,
+	})
+	if diags := dataSourceLDIFExportRead(context.Background(), d, client); !diags.HasError() {
+		t.Errorf("Error reporting a missing base DN")
+	}
+}
+
+func TestAdldapDataSourceLDIFExport_sorted(t *testing.T) {
+	client, directory := newFakeClient(t)
+	ouDN := "OU=Export," + fakeDomainDN
+	directory.put(ouDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+	for _, name := range []string{"delta", "alpha", "echo", "charlie", "bravo"} {
+		directory.put("CN="+name+","+ouDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {name}})
+	}
+
+	read := func(config map[string]interface{}) *schema.ResourceData {
+		t.Helper()
+		d := schema.TestResourceDataRaw(t, dataSourceLDIFExport().Schema, config)
+		if diags := dataSourceLDIFExportRead(context.Background(), d, client); diags.HasError() {
+			t.Fatal(diags)
+		}
+		return d
+	}
+	names := func(d *schema.ResourceData) string {
+		var names []string
+		for _, dn := range d.Get("distinguished_names").([]interface{}) {
+			names = append(names, strings.TrimPrefix(strings.SplitN(dn.(string), ",", 2)[0], "CN="))
+		}
+		return strings.Join(names, " ")
+	}
+
+	config := map[string]interface{}{
+		"distinguished_name": ouDN,
+		"scope":              "one",
+		"sort_by":            "sAMAccountName",
+		"sort_descending":    true,
+	}
+	d := read(config)
+	if got := names(d); got != "echo delta charlie bravo alpha" || d.Get("total_count").(int) != 5 {
+		t.Errorf("Error sorting on the server: got %q of %d", got, d.Get("total_count"))
+	}
+
+	// A window of the sorted objects reports how many there are in all
+	config["sort_descending"] = false
+	config["offset"] = 1
+	config["limit"] = 2
+	d = read(config)
+	if got := names(d); got != "bravo charlie" || d.Get("total_count").(int) != 5 {
+		t.Errorf("Error windowing the sorted objects: got %q of %d", got, d.Get("total_count"))
+	}
+	if !strings.HasPrefix(d.Get("ldif").(string), "version: 1\n\ndn: CN=bravo,") {
+		t.Errorf("Error exporting in sorted order: got\n%s", d.Get("ldif"))
+	}
+
+	config["offset"] = 5
+	if got := names(read(config)); got != "" {
+		t.Errorf("Error windowing past the end: got %q", got)
+	}
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// ephemeralBindCheck binds as an account, to check its password without
+// keeping either in the state.
+type ephemeralBindCheck struct {
+	client *lazyClient
+}
+
+func newEphemeralBindCheck() ephemeral.EphemeralResource {
+	return &ephemeralBindCheck{}
+}
+
+type ephemeralBindCheckModel struct {
+	Account  types.String `tfsdk:"account"`
+	Password types.String `tfsdk:"password"`
+	Success  types.Bool   `tfsdk:"success"`
+}
+
+func (e *ephemeralBindCheck) Metadata(ctx context.Context, req ephemeral.MetadataRequest, resp *ephemeral.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_bind_check"
+}
+
+func (e *ephemeralBindCheck) Schema(ctx context.Context, req ephemeral.SchemaRequest, resp *ephemeral.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Binds to the directory as an account, on a connection of its own, and reports whether the password was accepted, for example to verify credentials after rotating them.  Nothing is stored in the state.  Requires Terraform 1.10 or later.",
+		Attributes: map[string]schema.Attribute{
+			"account": schema.StringAttribute{
+				Description: "The account to bind as: a sAMAccountName, which is resolved to the account's DN, or a full DN, UPN, or `DOMAIN\\name`.",
+				Required:    true,
+			},
+			"password": schema.StringAttribute{
+				Description: "The password to bind with.",
+				Required:    true,
+				Sensitive:   true,
+			},
+			"success": schema.BoolAttribute{
+				Description: "Whether the bind succeeded.  `false` when the directory rejects the credentials, including for an empty password, a disabled or locked account, or an expired password; other failures, such as the server being unreachable, are errors.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func (e *ephemeralBindCheck) Configure(ctx context.Context, req ephemeral.ConfigureRequest, resp *ephemeral.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*lazyClient)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected provider data", fmt.Sprintf("Expected *lazyClient, got %T.", req.ProviderData))
+		return
+	}
+	e.client = client
+}
+
+func (e *ephemeralBindCheck) Open(ctx context.Context, req ephemeral.OpenRequest, resp *ephemeral.OpenResponse) {
+	var model ephemeralBindCheckModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client, err := e.client.Client(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError("Error connecting to the directory", err.Error())
+		return
+	}
+
+	account := model.Account.ValueString()
+	if !strings.ContainsAny(account, "=@\\") {
+		dn, err := client.GetDN(ctx, account)
+		if err != nil {
+			resp.Diagnostics.AddError(fmt.Sprintf("Error resolving account %s", account), err.Error())
+			return
+		}
+		account = dn
+	}
+
+	success, err := client.CheckBind(ctx, account, model.Password.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Error checking bind as %s", account), err.Error())
+		return
+	}
+	model.Success = types.BoolValue(success)
+
+	resp.Diagnostics.Append(resp.Result.Set(ctx, &model)...)
+}
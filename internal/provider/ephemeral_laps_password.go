@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// ephemeralLAPSPassword reads a computer's LAPS-managed password without
+// storing it in the state, unlike the computer resource's read_laps_password.
+type ephemeralLAPSPassword struct {
+	client *lazyClient
+}
+
+func newEphemeralLAPSPassword() ephemeral.EphemeralResource {
+	return &ephemeralLAPSPassword{}
+}
+
+type ephemeralLAPSPasswordModel struct {
+	Computer    types.String `tfsdk:"computer"`
+	AccountName types.String `tfsdk:"account_name"`
+	Password    types.String `tfsdk:"password"`
+	Expiration  types.String `tfsdk:"expiration"`
+}
+
+func (e *ephemeralLAPSPassword) Metadata(ctx context.Context, req ephemeral.MetadataRequest, resp *ephemeral.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_laps_password"
+}
+
+func (e *ephemeralLAPSPassword) Schema(ctx context.Context, req ephemeral.SchemaRequest, resp *ephemeral.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Reads the local administrator password that Windows LAPS or legacy LAPS manages for a computer, for passing to other providers without it being written to the state.  The password must be stored unencrypted and readable by the bind account.  Requires Terraform 1.10 or later.",
+		Attributes: map[string]schema.Attribute{
+			"computer": schema.StringAttribute{
+				Description: "The computer: its sAMAccountName, with or without the trailing `$`, distinguished name, or objectGUID.",
+				Required:    true,
+			},
+			"account_name": schema.StringAttribute{
+				Description: "The name of the local account whose password LAPS manages.  Empty for legacy LAPS, which doesn't record it.",
+				Computed:    true,
+			},
+			"password": schema.StringAttribute{
+				Description: "The LAPS-managed password.",
+				Computed:    true,
+				Sensitive:   true,
+			},
+			"expiration": schema.StringAttribute{
+				Description: "When LAPS will next rotate the password, in RFC 3339 format.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func (e *ephemeralLAPSPassword) Configure(ctx context.Context, req ephemeral.ConfigureRequest, resp *ephemeral.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*lazyClient)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected provider data", fmt.Sprintf("Expected *lazyClient, got %T.", req.ProviderData))
+		return
+	}
+	e.client = client
+}
+
+func (e *ephemeralLAPSPassword) Open(ctx context.Context, req ephemeral.OpenRequest, resp *ephemeral.OpenResponse) {
+	var model ephemeralLAPSPasswordModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client, err := e.client.Client(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError("Error connecting to the directory", err.Error())
+		return
+	}
+
+	computer := model.Computer.ValueString()
+	attributes := []string{"msLAPS-Password", "ms-Mcs-AdmPwd", "msLAPS-PasswordExpirationTime", "ms-Mcs-AdmPwdExpirationTime"}
+	account, err := client.GetComputerByIdentifier(ctx, computer, attributes)
+	if err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Error finding computer %s", computer), err.Error())
+		return
+	}
+	accountName, password, err := account.GetLAPSCredential(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Error reading LAPS password of %s", account.DN), err.Error())
+		return
+	}
+	if password == "" {
+		resp.Diagnostics.AddError(
+			fmt.Sprintf("No LAPS password for %s", account.DN),
+			"The computer has no LAPS password the bind account can read.  LAPS may not manage it, the password may be encrypted, or the bind account may lack the extended right to read it.",
+		)
+		return
+	}
+	expiration, err := account.GetLAPSPasswordExpiration(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Error reading LAPS password expiration of %s", account.DN), err.Error())
+		return
+	}
+
+	model.AccountName = types.StringValue(accountName)
+	model.Password = types.StringValue(password)
+	model.Expiration = types.StringValue(timeToString(expiration))
+
+	resp.Diagnostics.Append(resp.Result.Set(ctx, &model)...)
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+// dnFunction is a provider function taking a DN and returning a part of it.
+type dnFunction struct {
+	name        string
+	summary     string
+	description string
+	part        func(dn *LdapDN) string
+}
+
+func newParentDNFunction() function.Function {
+	return &dnFunction{
+		name:        "parent_dn",
+		summary:     "Return the DN of an object's parent",
+		description: "Returns the DN of the parent of the object with the given DN, such as `OU=Staff,DC=example,DC=com` for `CN=Jane Doe,OU=Staff,DC=example,DC=com`, or an empty string for a DN with a single RDN.  Escaped characters stay escaped.",
+		part:        (*LdapDN).ParentDN,
+	}
+}
+
+func newRDNFunction() function.Function {
+	return &dnFunction{
+		name:        "rdn",
+		summary:     "Return the RDN of a DN",
+		description: "Returns the relative distinguished name, the first component of a DN, such as `CN=Jane Doe` for `CN=Jane Doe,OU=Staff,DC=example,DC=com`.  Escaped characters stay escaped.",
+		part:        (*LdapDN).RDN,
+	}
+}
+
+func newDNNameFunction() function.Function {
+	return &dnFunction{
+		name:        "dn_name",
+		summary:     "Return the name of an object from its DN",
+		description: "Returns the value of the RDN of a DN, the object's name, such as `Jane Doe` for `CN=Jane Doe,OU=Staff,DC=example,DC=com`.  Escaped characters are unescaped.",
+		part:        (*LdapDN).Name,
+	}
+}
+
+func (f *dnFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = f.name
+}
+
+func (f *dnFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:     f.summary,
+		Description: f.description,
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "dn",
+				Description: "The distinguished name.",
+			},
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *dnFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var distinguishedName string
+	resp.Error = req.Arguments.Get(ctx, &distinguishedName)
+	if resp.Error != nil {
+		return
+	}
+
+	dn, err := NewLdapDN(distinguishedName)
+	if err != nil {
+		resp.Error = function.NewArgumentFuncError(0, err.Error())
+		return
+	}
+	if len(dn.RDNs) == 0 {
+		resp.Error = function.NewArgumentFuncError(0, "DN is empty")
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, f.part(&dn))
+}
+
+// dnFromCanonicalFunction builds a DN from a canonical name, so modules can
+// take human-readable OU paths as input.
+type dnFromCanonicalFunction struct{}
+
+func newDNFromCanonicalFunction() function.Function {
+	return &dnFromCanonicalFunction{}
+}
+
+func (f *dnFromCanonicalFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "dn_from_canonical"
+}
+
+func (f *dnFromCanonicalFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:     "Build a DN from a canonical name",
+		Description: "Builds a distinguished name from a canonical name, the domain followed by slash-separated containers as in AD's `canonicalName`, naming each container with the given RDN type.  For example, `example.com/Corp/Users` with `OU` gives `OU=Users,OU=Corp,DC=example,DC=com`.  Container names are escaped for the DN; write `\\/` for a slash within a name.",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "canonical_name",
+				Description: "The canonical name, such as `example.com/Corp/Users`.",
+			},
+			function.StringParameter{
+				Name:        "rdn_type",
+				Description: "The RDN type of the containers, usually `OU`, or `CN` for containers such as `Users`.",
+			},
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *dnFromCanonicalFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var canonicalName, rdnType string
+	resp.Error = req.Arguments.Get(ctx, &canonicalName, &rdnType)
+	if resp.Error != nil {
+		return
+	}
+
+	dn, err := dnFromCanonicalName(canonicalName, rdnType)
+	if err != nil {
+		resp.Error = function.NewFuncError(err.Error())
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, dn)
+}
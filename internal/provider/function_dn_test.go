@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// runStringFunction runs a provider function with string arguments, returning
+// its string result.
+func runStringFunction(f function.Function, args ...string) (string, *function.FuncError) {
+	values := make([]attr.Value, len(args))
+	for i, arg := range args {
+		values[i] = types.StringValue(arg)
+	}
+	req := function.RunRequest{Arguments: function.NewArgumentsData(values)}
+	resp := &function.RunResponse{Result: function.NewResultData(types.StringUnknown())}
+
+	f.Run(context.Background(), req, resp)
+	if resp.Error != nil {
+		return "", resp.Error
+	}
+	return resp.Result.Value().(types.String).ValueString(), nil
+}
+
+func TestAdldapFunctionDN(t *testing.T) {
+	cases := []struct {
+		function function.Function
+		dn       string
+		expected string
+	}{
+		{newParentDNFunction(), "CN=Jane Doe,OU=Staff,DC=example,DC=com", "OU=Staff,DC=example,DC=com"},
+		{newParentDNFunction(), `CN=Doe\, Jane,OU=Sales\+Marketing,DC=example,DC=com`, `OU=Sales\+Marketing,DC=example,DC=com`},
+		{newParentDNFunction(), "DC=com", ""},
+		{newRDNFunction(), "CN=Jane Doe,OU=Staff,DC=example,DC=com", "CN=Jane Doe"},
+		{newRDNFunction(), `CN=Doe\, Jane,OU=Staff,DC=example,DC=com`, `CN=Doe\, Jane`},
+		{newDNNameFunction(), "CN=Jane Doe,OU=Staff,DC=example,DC=com", "Jane Doe"},
+		{newDNNameFunction(), `CN=Doe\, Jane,OU=Staff,DC=example,DC=com`, "Doe, Jane"},
+	}
+
+	for _, c := range cases {
+		got, err := runStringFunction(c.function, c.dn)
+		if err != nil {
+			t.Errorf("Error running function on %s: %s", c.dn, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("Error matching output and expected for %s: got %s, expected %s", c.dn, got, c.expected)
+		}
+	}
+
+	for _, dn := range []string{"", "not a DN"} {
+		if _, err := runStringFunction(newParentDNFunction(), dn); err == nil {
+			t.Errorf("Error expected for %q", dn)
+		}
+	}
+}
+
+func TestAdldapFunctionDNFromCanonical(t *testing.T) {
+	cases := []struct {
+		canonicalName string
+		rdnType       string
+		expected      string
+	}{
+		{"example.com/Corp/Users", "OU", "OU=Users,OU=Corp,DC=example,DC=com"},
+		{"example.com/Users", "CN", "CN=Users,DC=example,DC=com"},
+		{"example.com", "OU", "DC=example,DC=com"},
+		{"example.com/", "OU", "DC=example,DC=com"},
+		{"corp.example.com/Sales, EMEA/R+D", "OU", `OU=R\+D,OU=Sales\, EMEA,DC=corp,DC=example,DC=com`},
+		{`example.com/A\/B`, "OU", "OU=A/B,DC=example,DC=com"},
+	}
+	for _, c := range cases {
+		got, err := runStringFunction(newDNFromCanonicalFunction(), c.canonicalName, c.rdnType)
+		if err != nil {
+			t.Errorf("Error running function on %s: %s", c.canonicalName, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("Error matching output and expected for %s: got %s, expected %s", c.canonicalName, got, c.expected)
+		}
+		if _, err := NewLdapDN(got); err != nil {
+			t.Errorf("Error parsing result for %s: %s", c.canonicalName, err)
+		}
+	}
+
+	invalid := []struct {
+		canonicalName string
+		rdnType       string
+	}{
+		{"", "OU"},
+		{"/Corp", "OU"},
+		{"example..com/Corp", "OU"},
+		{"example.com//Corp", "OU"},
+		{"example.com/Corp", "O U"},
+		{"example.com/Corp", ""},
+	}
+	for _, c := range invalid {
+		if _, err := runStringFunction(newDNFromCanonicalFunction(), c.canonicalName, c.rdnType); err == nil {
+			t.Errorf("Error expected for %q, %q", c.canonicalName, c.rdnType)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+// escapeFunction is a provider function escaping a value for use in LDAP
+// syntax.
+type escapeFunction struct {
+	name        string
+	summary     string
+	description string
+	escape      func(value string) string
+}
+
+func newEscapeFilterFunction() function.Function {
+	return &escapeFunction{
+		name:        "escape_filter",
+		summary:     "Escape a value for use in an LDAP search filter",
+		description: "Escapes a value for use in an LDAP search filter, per RFC 4515, so that characters such as `*`, `(`, `)`, and `\\` match literally instead of changing the filter.  For example, `(cn=${provider::adldap::escape_filter(\"Doe (Jane)\")})` matches only the name `Doe (Jane)`.",
+		escape:      ldap.EscapeFilter,
+	}
+}
+
+func newEscapeDNFunction() function.Function {
+	return &escapeFunction{
+		name:        "escape_dn",
+		summary:     "Escape a value for use in a DN",
+		description: "Escapes an attribute value for use in a distinguished name, per RFC 4514, so that characters such as `,`, `+`, and `=` are part of the value instead of the DN's structure.  For example, `CN=${provider::adldap::escape_dn(\"Doe, Jane\")},OU=Staff,DC=example,DC=com` names `Doe, Jane` in the Staff OU.",
+		escape:      escapeRDNValue,
+	}
+}
+
+func (f *escapeFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = f.name
+}
+
+func (f *escapeFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:     f.summary,
+		Description: f.description,
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "value",
+				Description: "The value to escape.",
+			},
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *escapeFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var value string
+	resp.Error = req.Arguments.Get(ctx, &value)
+	if resp.Error != nil {
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, f.escape(value))
+}
@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+func TestAdldapFunctionEscape(t *testing.T) {
+	cases := []struct {
+		function function.Function
+		value    string
+		expected string
+	}{
+		{newEscapeFilterFunction(), "Doe (Jane)", `Doe \28Jane\29`},
+		{newEscapeFilterFunction(), `a*b\c`, `a\2ab\5cc`},
+		{newEscapeFilterFunction(), "plain", "plain"},
+		{newEscapeDNFunction(), "Doe, Jane", `Doe\, Jane`},
+		{newEscapeDNFunction(), `#1 "A+B"=C `, `\#1 \"A\+B\"\=C\ `},
+		{newEscapeDNFunction(), "plain", "plain"},
+	}
+
+	for _, c := range cases {
+		got, err := runStringFunction(c.function, c.value)
+		if err != nil {
+			t.Errorf("Error running function on %q: %s", c.value, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("Error matching output and expected for %q: got %s, expected %s", c.value, got, c.expected)
+		}
+	}
+}
@@ -2,9 +2,16 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-ldap/ldap/v3"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 // New returns a terraform.ResourceProvider.
@@ -31,15 +38,99 @@ func New() *schema.Provider {
 				DefaultFunc: schema.EnvDefaultFunc("ADLDAP_BIND_PASSWORD", ""),
 			},
 			"search_base": {
-				Description: "The base DN to use for all LDAP searches. Can be specified with the `ADLDAP_SEARCH_BASE` environment variable.  Default is to autodetect default context.",
+				Description: "The base DN to use for all LDAP searches, including lookups of the accounts resources refer to, such as `managed_by` targets and the holders of SPNs, so objects outside it are not found. Can be specified with the `ADLDAP_SEARCH_BASE` environment variable.  Default is to autodetect default context.",
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("ADLDAP_SEARCH_BASE", ""),
 			},
+			"act_idempotently": {
+				Description: "Whether resources adopt existing objects with the same name on create instead of failing. Can be specified with the `ADLDAP_ACT_IDEMPOTENTLY` environment variable.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ADLDAP_ACT_IDEMPOTENTLY", false),
+			},
+			"allowed_base_dns": {
+				Description: "Subtrees the provider may change.  When set, any add, modify, rename, move, or delete of an object outside these DNs fails with a policy violation, as a safety net against a bad variable pointing a resource at the wrong part of the directory.  Reads are unaffected.  Default is no restriction.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateDN,
+				},
+			},
+			"replication_wait": {
+				Description:      "How many seconds a refresh waits for an object it can't find to replicate to the domain controller before treating it as deleted, in case it was written through a different domain controller in an earlier run.  Objects with a tombstone in Deleted Objects are known to be deleted and aren't waited for.  Can be specified with the `ADLDAP_REPLICATION_WAIT` environment variable.  Defaults to `15`; `0` disables the wait.",
+				Type:             schema.TypeInt,
+				Optional:         true,
+				DefaultFunc:      schema.EnvDefaultFunc("ADLDAP_REPLICATION_WAIT", 15),
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(0)),
+			},
+			"directory_type": {
+				Description:      "The kind of directory: `ad` for Active Directory Domain Services, or `adlds` for an AD LDS (ADAM) instance.  AD LDS has no sAMAccountName, so users' `sam_account_name` is kept in userPrincipalName, the name they bind with; it keeps the userAccountControl flags it supports in attributes of their own, such as msDS-UserAccountDisabled; and it has no computer accounts.  Without `search_base`, AD LDS searches the instance's default naming context, or else its first application partition.  Can be specified with the `ADLDAP_DIRECTORY_TYPE` environment variable.  Defaults to `ad`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				DefaultFunc:      schema.EnvDefaultFunc("ADLDAP_DIRECTORY_TYPE", directoryTypeAD),
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{directoryTypeAD, directoryTypeADLDS}, false)),
+			},
+			"audit_log": {
+				Description: "A file to append a JSON audit record to for every add, modify, rename, or delete the provider sends, for evidence of the changes Terraform makes.  Each record is a line with the `time`, the `operator`, who the server's Who Am I operation says the provider is bound as (a DN, or Active Directory's `u:DOMAIN\\name`), the `operation`, the `dn` and any `new_dn`, the `changes` to attributes, leaving out the values of passwords, the number of `attempts` made, since a write the directory reports busy is retried but recorded once, and the `error` if the directory refused it.  `-` writes the records to standard output, which Terraform only records in its log when `TF_LOG` is set.  Can be specified with the `ADLDAP_AUDIT_LOG` environment variable.  Default is no audit log.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ADLDAP_AUDIT_LOG", ""),
+			},
+			"domain": {
+				Description: "Other domains resources can manage objects in by setting their `domain` argument, so one provider can manage a multi-domain forest.  Each is connected to the first time a resource needs it.  To import an object from another domain, prefix its import ID with the domain and a colon, such as `emea.example.com:<id>`.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Description:      "The DNS name of the domain, such as `emea.example.com`.",
+							Type:             schema.TypeString,
+							Required:         true,
+							ValidateDiagFunc: validateDNSName,
+						},
+						"url": {
+							Description: "The URL of the domain's LDAP server.  Defaults to the domain's DNS name with the scheme and port of the provider's `url`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"search_base": {
+							Description:      "The base DN for searches in the domain.  Default is to autodetect the domain's naming context.",
+							Type:             schema.TypeString,
+							Optional:         true,
+							ValidateDiagFunc: validateDN,
+						},
+						"bind_account": {
+							Description: "The full DN or UPN used to bind to the domain.  Defaults to the provider's `bind_account` and `bind_password`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"bind_password": {
+							Description: "The password for the domain's `bind_account`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+						},
+					},
+				},
+			},
+			"discover_domains": {
+				Description: "Whether resources may also set `domain` to a domain without a `domain` block: any other domain in the forest, or any Active Directory domain that trusts the provider's, found from their crossRefs and trustedDomain objects.  They are connected to by DNS name with the provider's credentials.  Can be specified with the `ADLDAP_DISCOVER_DOMAINS` environment variable.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ADLDAP_DISCOVER_DOMAINS", false),
+			},
+		},
+
+		DataSourcesMap: map[string]*schema.Resource{
+			"adldap_changed_objects": dataSourceChangedObjects(),
+			"adldap_ldif_export":     dataSourceLDIFExport(),
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
 			"adldap_computer":            resourceComputer(),
+			"adldap_ldif":                resourceLDIF(),
 			"adldap_organizational_unit": resourceOrganizationalUnit(),
 			"adldap_service_principal":   resourceServicePrincipal(),
 			"adldap_user":                resourceUser(),
@@ -50,21 +141,247 @@ func New() *schema.Provider {
 }
 
 func providerConfigure(c context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
-	ldapURL := d.Get("url").(string)
-	bindAccount := d.Get("bind_account").(string)
-	bindPassword := d.Get("bind_password").(string)
-	searchBase := d.Get("search_base").(string)
+	config := providerConfig{
+		URL:             d.Get("url").(string),
+		BindAccount:     d.Get("bind_account").(string),
+		BindPassword:    d.Get("bind_password").(string),
+		SearchBase:      d.Get("search_base").(string),
+		ActIdempotently: d.Get("act_idempotently").(bool),
+		ReplicationWait: time.Duration(d.Get("replication_wait").(int)) * time.Second,
+		DirectoryType:   d.Get("directory_type").(string),
+		DiscoverDomains: d.Get("discover_domains").(bool),
+		AuditLog:        d.Get("audit_log").(string),
+	}
+	for _, baseDN := range d.Get("allowed_base_dns").([]interface{}) {
+		config.AllowedBaseDNs = append(config.AllowedBaseDNs, baseDN.(string))
+	}
+	for _, raw := range d.Get("domain").([]interface{}) {
+		block := raw.(map[string]interface{})
+		config.Domains = append(config.Domains, domainConfig{
+			Name:         block["name"].(string),
+			URL:          block["url"].(string),
+			SearchBase:   block["search_base"].(string),
+			BindAccount:  block["bind_account"].(string),
+			BindPassword: block["bind_password"].(string),
+		})
+	}
+
+	client, err := config.connect(c)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
 
+	return client, nil
+}
+
+// providerConfig is the provider configuration, read by both the SDK provider
+// and the framework provider serving ephemeral resources.
+type providerConfig struct {
+	URL             string
+	BindAccount     string
+	BindPassword    string
+	SearchBase      string
+	ActIdempotently bool
+	AllowedBaseDNs  []string
+	ReplicationWait time.Duration
+	DirectoryType   string
+	Domains         []domainConfig
+	DiscoverDomains bool
+	AuditLog        string // Path of the audit log, or "-" for standard output
+}
+
+// connect returns a client bound to the directory with the configuration.
+func (p providerConfig) connect(ctx context.Context) (*LdapClient, error) {
 	client := new(LdapClient)
+	client.ReplicationWait = p.ReplicationWait
+	client.AllowedBaseDNs = p.AllowedBaseDNs
+	client.DirectoryType = p.DirectoryType
+	client.domains = newDomainRouter(p.Domains, p.DiscoverDomains)
+	if p.AuditLog != "" {
+		var err error
+		client.auditLog, err = openAuditLog(p.AuditLog)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	err := client.New(ldapURL, bindAccount, bindPassword, searchBase, false)
+	err := client.New(ctx, p.URL, p.BindAccount, p.BindPassword, p.SearchBase, p.ActIdempotently)
 	if err != nil {
-		return nil, diag.FromErr(err)
+		return nil, err
 	}
 
 	return client, nil
 }
 
+// ldapControlsSchema is the ldap_controls block shared by resources, for
+// attaching server controls to the adds, modifies, and deletes they make.
+func ldapControlsSchema() *schema.Schema {
+	return &schema.Schema{
+		Description: "Server controls to attach to the adds, modifies, renames, moves, and deletes this resource makes, for advanced cases such as relaxing constraints with LDAP_SERVER_PERMISSIVE_MODIFY_OID.  Searches are sent without them.",
+		Type:        schema.TypeList,
+		Optional:    true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"oid": {
+					Description:      "The OID identifying the control.",
+					Type:             schema.TypeString,
+					Required:         true,
+					ValidateDiagFunc: validateOID,
+				},
+				"critical": {
+					Description: "Whether the server must refuse the operation rather than ignore a control it doesn't support.  Defaults to `false`.",
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     false,
+				},
+				"value": {
+					Description: "The control value, sent as is.  Conflicts with `value_base64`.",
+					Type:        schema.TypeString,
+					Optional:    true,
+				},
+				"value_base64": {
+					Description:      "The control value, base64 encoded, for BER-encoded values that aren't valid strings.  Conflicts with `value`.",
+					Type:             schema.TypeString,
+					Optional:         true,
+					ValidateDiagFunc: validateBase64,
+				},
+			},
+		},
+	}
+}
+
+// ignoreAttributesSchema is the ignore_attributes argument shared by
+// resources whose attributes other systems may also write.
+func ignoreAttributesSchema() *schema.Schema {
+	return &schema.Schema{
+		Description: "LDAP names of attributes co-managed by other systems, such as Exchange, whose changes outside Terraform never produce a diff.  Their arguments keep the value last applied, and values in the configuration are still written when they change.  Names are case-insensitive.",
+		Type:        schema.TypeSet,
+		Optional:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Set:         hashCaseInsensitive,
+	}
+}
+
+// isIgnoredAttribute reports whether the attribute is in ignore_attributes.
+func isIgnoredAttribute(d *schema.ResourceData, attribute string) bool {
+	return d.Get("ignore_attributes").(*schema.Set).Contains(attribute)
+}
+
+// keepIgnoredAttributes captures the arguments, and map argument keys, whose
+// attributes are in ignore_attributes, returning a function that puts them
+// back, so that deferring it at the start of a Read hides changes made outside
+// Terraform.  arguments maps argument names to attribute names; mapArguments
+// maps map arguments to the prefix that names the attribute of each key.  The
+// first Read after an import has nothing to keep, so reads everything.
+func keepIgnoredAttributes(d *schema.ResourceData, arguments map[string]string, mapArguments map[string]string) func() {
+	ignored := map[string]bool{}
+	for _, name := range d.Get("ignore_attributes").(*schema.Set).List() {
+		ignored[strings.ToLower(name.(string))] = true
+	}
+	if len(ignored) == 0 || d.Get("object_guid").(string) == "" {
+		return func() {}
+	}
+
+	prior := map[string]interface{}{}
+	for argument, attribute := range arguments {
+		if ignored[strings.ToLower(attribute)] {
+			prior[argument] = d.Get(argument)
+		}
+	}
+	priorMaps := map[string]map[string]interface{}{}
+	for argument := range mapArguments {
+		priorMaps[argument] = d.Get(argument).(map[string]interface{})
+	}
+
+	return func() {
+		for argument, value := range prior {
+			d.Set(argument, value)
+		}
+		for argument, prefix := range mapArguments {
+			kept := map[string]interface{}{}
+			for key, value := range d.Get(argument).(map[string]interface{}) {
+				if !ignored[strings.ToLower(prefix+key)] {
+					kept[key] = value
+				}
+			}
+			for key, value := range priorMaps[argument] {
+				if ignored[strings.ToLower(prefix+key)] {
+					kept[key] = value
+				}
+			}
+			d.Set(argument, kept)
+		}
+	}
+}
+
+// domainSchema is the domain argument shared by resources and data sources,
+// for managing objects in another of the provider's domains.
+func domainSchema() *schema.Schema {
+	return &schema.Schema{
+		Description:      "The DNS name of the domain to manage the object in: one of the provider's `domain` blocks, or with `discover_domains`, any domain in the forest or trusting the provider's.  Changing it forces a new resource.  Defaults to the provider's domain.",
+		Type:             schema.TypeString,
+		Optional:         true,
+		ForceNew:         true,
+		ValidateDiagFunc: validateDNSName,
+		DiffSuppressFunc: suppressEquivalentDNSName,
+	}
+}
+
+// domainClient returns the client for the resource's domain.
+func domainClient(ctx context.Context, d *schema.ResourceData, meta interface{}) (*LdapClient, error) {
+	domain, _ := d.Get("domain").(string)
+	return meta.(*LdapClient).ForDomain(ctx, domain)
+}
+
+// diffDomainClient returns the client for the domain of a resource being
+// planned, or nil if there is no client or the domain isn't known yet.
+func diffDomainClient(ctx context.Context, d *schema.ResourceDiff, meta interface{}) (*LdapClient, error) {
+	client, ok := meta.(*LdapClient)
+	if !ok || client == nil || !d.GetRawConfig().GetAttr("domain").IsKnown() {
+		return nil, nil
+	}
+	return client.ForDomain(ctx, d.Get("domain").(string))
+}
+
+// importDomain reads the domain from an import ID of the form
+// <domain>:<identifier>, leaving the identifier as the ID, and returns the
+// domain's client.
+func importDomain(ctx context.Context, d *schema.ResourceData, meta interface{}) (*LdapClient, error) {
+	if domain, identifier, ok := strings.Cut(d.Id(), ":"); ok && dnsNameRegexp.MatchString(domain) {
+		d.Set("domain", domain)
+		d.SetId(identifier)
+	}
+	return domainClient(ctx, d, meta)
+}
+
+// resourceClient returns the client for the resource's domain, with the
+// resource's ldap_controls attached to its writes.
+func resourceClient(ctx context.Context, d *schema.ResourceData, meta interface{}) (*LdapClient, error) {
+	client, err := domainClient(ctx, d, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var controls []*ldap.ControlString
+	for i, raw := range d.Get("ldap_controls").([]interface{}) {
+		block := raw.(map[string]interface{})
+		value := block["value"].(string)
+		if encoded := block["value_base64"].(string); encoded != "" {
+			if value != "" {
+				return nil, fmt.Errorf("ldap_controls.%d: only one of value and value_base64 may be set", i)
+			}
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("ldap_controls.%d: error decoding value_base64: %s", i, err)
+			}
+			value = string(decoded)
+		}
+		controls = append(controls, ldap.NewControlString(block["oid"].(string), block["critical"].(bool), value))
+	}
+
+	return client.WithControls(controls), nil
+}
+
 func setToStingArray(set *schema.Set) []string {
 	list := set.List()
 	arr := make([]string, len(list))
@@ -74,3 +391,162 @@ func setToStingArray(set *schema.Set) []string {
 	}
 	return arr
 }
+
+// mapAttributeChanges maps a map argument to attribute values, naming each
+// attribute by prefixing its key and clearing any removed from the configuration.
+func mapAttributeChanges(d *schema.ResourceData, key string, prefix string) map[string][]string {
+	oldValues, newValues := d.GetChange(key)
+	changes := map[string][]string{}
+	for k := range oldValues.(map[string]interface{}) {
+		changes[prefix+k] = []string{}
+	}
+	for k, v := range newValues.(map[string]interface{}) {
+		changes[prefix+k] = []string{v.(string)}
+	}
+	return changes
+}
+
+func atoiOrZero(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+// intAttributeValue formats an optional integer argument as attribute values,
+// clearing the attribute when the argument is unset.
+func intAttributeValue(i int) []string {
+	if i == 0 {
+		return []string{}
+	}
+	return []string{strconv.Itoa(i)}
+}
+
+// suppressEquivalentDN ignores differences in case and whitespace between DNs.
+func suppressEquivalentDN(k, old, new string, d *schema.ResourceData) bool {
+	return dnsEqual(old, new)
+}
+
+// suppressEquivalentDNSName ignores differences in case and a trailing dot
+// between DNS names.
+func suppressEquivalentDNSName(k, old, new string, d *schema.ResourceData) bool {
+	return strings.EqualFold(strings.TrimSuffix(old, "."), strings.TrimSuffix(new, "."))
+}
+
+// hashDN hashes DN set elements so that equivalent DNs are the same element.
+func hashDN(v interface{}) int {
+	return schema.HashString(normalizeDN(v.(string)))
+}
+
+// hashCaseInsensitive hashes set elements, such as SPNs, that the directory
+// compares case-insensitively.
+func hashCaseInsensitive(v interface{}) int {
+	return schema.HashString(strings.ToLower(v.(string)))
+}
+
+// setDN stores a DN read from the directory, keeping the existing value if it
+// is equivalent so that the configured spelling persists.
+func setDN(d *schema.ResourceData, key string, value string) {
+	if current, ok := d.Get(key).(string); ok && current != "" && dnsEqual(current, value) {
+		return
+	}
+	d.Set(key, value)
+}
+
+func timeToString(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// importResource completes an import once the importer has set the ID, so the
+// imported state has every attribute for configuration generated from it.  It
+// sets the arguments that have defaults, which would otherwise be left null
+// and each plan a change, and reads all the others.
+func importResource(ctx context.Context, d *schema.ResourceData, meta interface{}, r *schema.Resource) ([]*schema.ResourceData, error) {
+	for key, s := range r.Schema {
+		if s.Default != nil && !s.Computed {
+			if err := d.Set(key, s.Default); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, diagnostic := range r.ReadContext(ctx, d, meta) {
+		if diagnostic.Severity == diag.Error {
+			return nil, fmt.Errorf("%s: %s", diagnostic.Summary, diagnostic.Detail)
+		}
+	}
+	if d.Id() == "" {
+		return nil, fmt.Errorf("imported object is no longer in the directory")
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// resourceAccountStateUpgradeV0 replaces the sAMAccountName ID of version 0 user and
+// computer states with the objectGUID, so renames no longer change the ID.
+// Accounts that can't be found keep their ID for Read to resolve or remove;
+// any other error fails the upgrade rather than leave a version 0 ID behind.
+func resourceAccountStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	client, ok := meta.(*LdapClient)
+	id, _ := rawState["id"].(string)
+	if !ok || client == nil || id == "" {
+		return rawState, nil
+	}
+	if _, err := parseGUID(id); err == nil {
+		return rawState, nil
+	}
+
+	account, err := client.GetAccountBySAMAccountName(ctx, id, objectClassUser, []string{"objectGUID"})
+	if IsNotFound(err) {
+		return rawState, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	objectGUID, err := account.GetObjectGUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rawState["id"] = objectGUID
+	rawState["object_guid"] = objectGUID
+
+	return rawState, nil
+}
+
+// setAccountIdentity sets the computed identity attributes shared by account resources.
+func setAccountIdentity(ctx context.Context, d *schema.ResourceData, account *LdapAccount) error {
+	objectGUID, err := account.GetObjectGUID(ctx)
+	if err != nil {
+		return err
+	}
+	sid, err := account.GetObjectSID(ctx)
+	if err != nil {
+		return err
+	}
+	whenCreated, err := account.GetWhenCreated(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.Set("distinguished_name", account.DN)
+	d.Set("object_guid", objectGUID)
+	d.Set("sid", sid)
+	d.Set("when_created", timeToString(whenCreated))
+
+	return nil
+}
+
+// adminSDHolderWarning warns that an account marked with adminCount=1, as
+// SDProp marks members of protected groups such as Domain Admins, has its ACL
+// replaced by AdminSDHolder's every hour.
+func adminSDHolderWarning(kind string, name string) diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  "Object protected by AdminSDHolder",
+		Detail:   fmt.Sprintf("%s %s has adminCount=1, so it is, or once was, in a protected group such as Domain Admins.  Every hour the SDProp process on the PDC emulator replaces its ACL with that of AdminSDHolder and disables inheritance, reverting ACL changes made here or delegated from its OU, such as protection from accidental deletion, which then show as drift.  If it no longer belongs to a protected group, clear adminCount and re-enable inheritance on it.", kind, name),
+	}
+}
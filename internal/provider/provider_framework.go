@@ -0,0 +1,314 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	fwprovider "github.com/hashicorp/terraform-plugin-framework/provider"
+	fwschema "github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-mux/tf5to6server"
+	"github.com/hashicorp/terraform-plugin-mux/tf6muxserver"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// NewProviderServer returns the provider's protocol 6 server: the SDK
+// provider with most resources, upgraded from protocol 5, muxed with a
+// framework provider for the ephemeral resources, functions, and resources
+// the SDK can't serve.  Protocol 6 is needed for nested attributes.
+func NewProviderServer(ctx context.Context) (func() tfprotov6.ProviderServer, error) {
+	sdkServer, err := tf5to6server.UpgradeServer(ctx, New().GRPCProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	muxServer, err := tf6muxserver.NewMuxServer(ctx,
+		func() tfprotov6.ProviderServer { return sdkServer },
+		providerserver.NewProtocol6(newFrameworkProvider()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return muxServer.ProviderServer, nil
+}
+
+// frameworkProvider serves what only terraform-plugin-framework supports.
+// Terraform sends the muxed providers the same configuration, so its schema
+// mirrors the SDK provider's exactly.
+type frameworkProvider struct{}
+
+func newFrameworkProvider() fwprovider.Provider {
+	return &frameworkProvider{}
+}
+
+type frameworkProviderModel struct {
+	URL             types.String `tfsdk:"url"`
+	BindAccount     types.String `tfsdk:"bind_account"`
+	BindPassword    types.String `tfsdk:"bind_password"`
+	SearchBase      types.String `tfsdk:"search_base"`
+	ActIdempotently types.Bool   `tfsdk:"act_idempotently"`
+	AllowedBaseDNs  types.List   `tfsdk:"allowed_base_dns"`
+	ReplicationWait types.Int64  `tfsdk:"replication_wait"`
+	DirectoryType   types.String `tfsdk:"directory_type"`
+	Domains         types.List   `tfsdk:"domain"`
+	DiscoverDomains types.Bool   `tfsdk:"discover_domains"`
+	AuditLog        types.String `tfsdk:"audit_log"`
+}
+
+type frameworkDomainModel struct {
+	Name         types.String `tfsdk:"name"`
+	URL          types.String `tfsdk:"url"`
+	SearchBase   types.String `tfsdk:"search_base"`
+	BindAccount  types.String `tfsdk:"bind_account"`
+	BindPassword types.String `tfsdk:"bind_password"`
+}
+
+func (p *frameworkProvider) Metadata(ctx context.Context, req fwprovider.MetadataRequest, resp *fwprovider.MetadataResponse) {
+	resp.TypeName = "adldap"
+}
+
+func (p *frameworkProvider) Schema(ctx context.Context, req fwprovider.SchemaRequest, resp *fwprovider.SchemaResponse) {
+	sdkSchema := New().Schema
+	domainSchema := sdkSchema["domain"].Elem.(*schema.Resource).Schema
+
+	resp.Schema = fwschema.Schema{
+		Attributes: map[string]fwschema.Attribute{
+			"url": fwschema.StringAttribute{
+				Description: sdkSchema["url"].Description,
+				Optional:    true,
+			},
+			"bind_account": fwschema.StringAttribute{
+				Description: sdkSchema["bind_account"].Description,
+				Optional:    true,
+			},
+			"bind_password": fwschema.StringAttribute{
+				Description: sdkSchema["bind_password"].Description,
+				Optional:    true,
+				Sensitive:   true,
+			},
+			"search_base": fwschema.StringAttribute{
+				Description: sdkSchema["search_base"].Description,
+				Optional:    true,
+			},
+			"act_idempotently": fwschema.BoolAttribute{
+				Description: sdkSchema["act_idempotently"].Description,
+				Optional:    true,
+			},
+			"allowed_base_dns": fwschema.ListAttribute{
+				Description: sdkSchema["allowed_base_dns"].Description,
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"replication_wait": fwschema.Int64Attribute{
+				Description: sdkSchema["replication_wait"].Description,
+				Optional:    true,
+			},
+			"directory_type": fwschema.StringAttribute{
+				Description: sdkSchema["directory_type"].Description,
+				Optional:    true,
+			},
+			"discover_domains": fwschema.BoolAttribute{
+				Description: sdkSchema["discover_domains"].Description,
+				Optional:    true,
+			},
+			"audit_log": fwschema.StringAttribute{
+				Description: sdkSchema["audit_log"].Description,
+				Optional:    true,
+			},
+		},
+		Blocks: map[string]fwschema.Block{
+			"domain": fwschema.ListNestedBlock{
+				Description: sdkSchema["domain"].Description,
+				NestedObject: fwschema.NestedBlockObject{
+					Attributes: map[string]fwschema.Attribute{
+						"name": fwschema.StringAttribute{
+							Description: domainSchema["name"].Description,
+							Required:    true,
+						},
+						"url": fwschema.StringAttribute{
+							Description: domainSchema["url"].Description,
+							Optional:    true,
+						},
+						"search_base": fwschema.StringAttribute{
+							Description: domainSchema["search_base"].Description,
+							Optional:    true,
+						},
+						"bind_account": fwschema.StringAttribute{
+							Description: domainSchema["bind_account"].Description,
+							Optional:    true,
+						},
+						"bind_password": fwschema.StringAttribute{
+							Description: domainSchema["bind_password"].Description,
+							Optional:    true,
+							Sensitive:   true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Configure reads the configuration, applying the same environment variable
+// defaults as the SDK provider.  The SDK provider validates the values, so
+// they are only read here.
+func (p *frameworkProvider) Configure(ctx context.Context, req fwprovider.ConfigureRequest, resp *fwprovider.ConfigureResponse) {
+	var model frameworkProviderModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client := &lazyClient{}
+	resp.EphemeralResourceData = client
+	resp.ResourceData = client
+
+	config, err := model.providerConfig(ctx)
+	if err != nil {
+		client.configErr = err
+		return
+	}
+	client.config = config
+}
+
+func (p *frameworkProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
+	return nil
+}
+
+func (p *frameworkProvider) Resources(ctx context.Context) []func() fwresource.Resource {
+	return []func() fwresource.Resource{
+		newUsersResource,
+	}
+}
+
+func (p *frameworkProvider) EphemeralResources(ctx context.Context) []func() ephemeral.EphemeralResource {
+	return []func() ephemeral.EphemeralResource{
+		newEphemeralBindCheck,
+		newEphemeralLAPSPassword,
+	}
+}
+
+func (p *frameworkProvider) Functions(ctx context.Context) []func() function.Function {
+	return []func() function.Function{
+		newParentDNFunction,
+		newRDNFunction,
+		newDNNameFunction,
+		newDNFromCanonicalFunction,
+		newEscapeFilterFunction,
+		newEscapeDNFunction,
+	}
+}
+
+func (m frameworkProviderModel) providerConfig(ctx context.Context) (providerConfig, error) {
+	var config providerConfig
+	if m.URL.IsUnknown() || m.BindAccount.IsUnknown() || m.BindPassword.IsUnknown() || m.SearchBase.IsUnknown() || m.ActIdempotently.IsUnknown() || m.AllowedBaseDNs.IsUnknown() || m.ReplicationWait.IsUnknown() || m.DirectoryType.IsUnknown() || m.Domains.IsUnknown() || m.DiscoverDomains.IsUnknown() || m.AuditLog.IsUnknown() {
+		return config, fmt.Errorf("the provider configuration depends on values that aren't known until apply")
+	}
+
+	config.URL = stringOrEnv(m.URL, "ADLDAP_URL")
+	config.BindAccount = stringOrEnv(m.BindAccount, "ADLDAP_BIND_ACCOUNT")
+	config.BindPassword = stringOrEnv(m.BindPassword, "ADLDAP_BIND_PASSWORD")
+	config.SearchBase = stringOrEnv(m.SearchBase, "ADLDAP_SEARCH_BASE")
+	config.DirectoryType = stringOrEnv(m.DirectoryType, "ADLDAP_DIRECTORY_TYPE")
+	config.AuditLog = stringOrEnv(m.AuditLog, "ADLDAP_AUDIT_LOG")
+
+	config.ActIdempotently = m.ActIdempotently.ValueBool()
+	if m.ActIdempotently.IsNull() {
+		if value := os.Getenv("ADLDAP_ACT_IDEMPOTENTLY"); value != "" {
+			actIdempotently, err := strconv.ParseBool(value)
+			if err != nil {
+				return config, fmt.Errorf("error parsing ADLDAP_ACT_IDEMPOTENTLY: %s", err)
+			}
+			config.ActIdempotently = actIdempotently
+		}
+	}
+
+	replicationWait := m.ReplicationWait.ValueInt64()
+	if m.ReplicationWait.IsNull() {
+		replicationWait = 15
+		if value := os.Getenv("ADLDAP_REPLICATION_WAIT"); value != "" {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return config, fmt.Errorf("error parsing ADLDAP_REPLICATION_WAIT: %s", err)
+			}
+			replicationWait = seconds
+		}
+	}
+	config.ReplicationWait = time.Duration(replicationWait) * time.Second
+
+	config.DiscoverDomains = m.DiscoverDomains.ValueBool()
+	if m.DiscoverDomains.IsNull() {
+		if value := os.Getenv("ADLDAP_DISCOVER_DOMAINS"); value != "" {
+			discoverDomains, err := strconv.ParseBool(value)
+			if err != nil {
+				return config, fmt.Errorf("error parsing ADLDAP_DISCOVER_DOMAINS: %s", err)
+			}
+			config.DiscoverDomains = discoverDomains
+		}
+	}
+
+	if !m.AllowedBaseDNs.IsNull() {
+		if diags := m.AllowedBaseDNs.ElementsAs(ctx, &config.AllowedBaseDNs, false); diags.HasError() {
+			return config, fmt.Errorf("error reading allowed_base_dns")
+		}
+	}
+
+	var domains []frameworkDomainModel
+	if !m.Domains.IsNull() {
+		if diags := m.Domains.ElementsAs(ctx, &domains, false); diags.HasError() {
+			return config, fmt.Errorf("error reading domain")
+		}
+	}
+	for _, domain := range domains {
+		if domain.Name.IsUnknown() || domain.URL.IsUnknown() || domain.SearchBase.IsUnknown() || domain.BindAccount.IsUnknown() || domain.BindPassword.IsUnknown() {
+			return config, fmt.Errorf("the provider configuration depends on values that aren't known until apply")
+		}
+		config.Domains = append(config.Domains, domainConfig{
+			Name:         domain.Name.ValueString(),
+			URL:          domain.URL.ValueString(),
+			SearchBase:   domain.SearchBase.ValueString(),
+			BindAccount:  domain.BindAccount.ValueString(),
+			BindPassword: domain.BindPassword.ValueString(),
+		})
+	}
+
+	return config, nil
+}
+
+func stringOrEnv(value types.String, key string) string {
+	if value.IsNull() {
+		return os.Getenv(key)
+	}
+	return value.ValueString()
+}
+
+// lazyClient connects to the directory the first time an ephemeral resource
+// or framework resource needs it, so runs that use none don't open a second
+// connection alongside the SDK provider's.
+type lazyClient struct {
+	config    providerConfig
+	configErr error // Why the configuration couldn't be read, if it couldn't
+	once      sync.Once
+	client    *LdapClient
+	err       error
+}
+
+func (l *lazyClient) Client(ctx context.Context) (*LdapClient, error) {
+	if l.configErr != nil {
+		return nil, l.configErr
+	}
+	l.once.Do(func() {
+		l.client, l.err = l.config.connect(ctx)
+	})
+	return l.client, l.err
+}
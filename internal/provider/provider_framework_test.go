@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+)
+
+func TestAdldapProviderServer(t *testing.T) {
+	ctx := context.Background()
+	providerServer, err := NewProviderServer(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The mux server refuses providers whose schemas differ
+	resp, err := providerServer().GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, diagnostic := range resp.Diagnostics {
+		t.Errorf("Error getting provider schema: %s: %s", diagnostic.Summary, diagnostic.Detail)
+	}
+	for _, name := range []string{"adldap_user", "adldap_users"} {
+		if _, ok := resp.ResourceSchemas[name]; !ok {
+			t.Errorf("Error serving resources: %s missing", name)
+		}
+	}
+	if _, ok := resp.DataSourceSchemas["adldap_ldif_export"]; !ok {
+		t.Error("Error serving data sources: adldap_ldif_export missing")
+	}
+	for _, name := range []string{"adldap_bind_check", "adldap_laps_password"} {
+		if _, ok := resp.EphemeralResourceSchemas[name]; !ok {
+			t.Errorf("Error serving ephemeral resources: %s missing", name)
+		}
+	}
+	for _, name := range []string{"parent_dn", "rdn", "dn_name", "dn_from_canonical", "escape_filter", "escape_dn"} {
+		if _, ok := resp.Functions[name]; !ok {
+			t.Errorf("Error serving functions: %s missing", name)
+		}
+	}
+}
+
+func TestAdldapFrameworkProviderConfig(t *testing.T) {
+	t.Setenv("ADLDAP_URL", "ldaps://dc.example.com")
+	t.Setenv("ADLDAP_ACT_IDEMPOTENTLY", "true")
+	t.Setenv("ADLDAP_REPLICATION_WAIT", "")
+
+	model := frameworkProviderModel{
+		URL:             types.StringNull(),
+		BindAccount:     types.StringValue("admin@example.com"),
+		BindPassword:    types.StringNull(),
+		SearchBase:      types.StringNull(),
+		ActIdempotently: types.BoolNull(),
+		AllowedBaseDNs:  types.ListValueMust(types.StringType, []attr.Value{types.StringValue("OU=Managed,DC=example,DC=com")}),
+		ReplicationWait: types.Int64Null(),
+	}
+	config, err := model.providerConfig(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.URL != "ldaps://dc.example.com" || config.BindAccount != "admin@example.com" {
+		t.Errorf("Error applying environment defaults: got url %q, bind_account %q", config.URL, config.BindAccount)
+	}
+	if !config.ActIdempotently {
+		t.Error("Error applying environment defaults: act_idempotently false")
+	}
+	if config.ReplicationWait != 15*time.Second {
+		t.Errorf("Error applying default replication_wait: got %s", config.ReplicationWait)
+	}
+	if len(config.AllowedBaseDNs) != 1 || config.AllowedBaseDNs[0] != "OU=Managed,DC=example,DC=com" {
+		t.Errorf("Error reading allowed_base_dns: got %v", config.AllowedBaseDNs)
+	}
+
+	model.URL = types.StringUnknown()
+	if _, err := model.providerConfig(context.Background()); err == nil {
+		t.Error("Error expected for an unknown url")
+	}
+}
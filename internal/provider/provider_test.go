@@ -1,9 +1,14 @@
 package provider
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"testing"
 
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
@@ -32,6 +37,117 @@ func init() {
 	testAccProviderMeta, _ = testProviderConfigure(testConfig.url, testConfig.searchBase, testConfig.bindAccount, testConfig.bindPassword)
 }
 
+// TestMain runs the sweepers when invoked with -sweep, for example:
+//
+//	go test ./internal/provider -v -sweep=all
+func TestMain(m *testing.M) {
+	resource.TestMain(m)
+}
+
+// testSweepPrefix begins the sAMAccountName of every account the acceptance
+// tests create, so the sweepers can find those left behind.
+const testSweepPrefix = "tfacc"
+
+// testSweepEntries deletes, or otherwise cleans up, every entry matching the
+// filter beneath the search base.  The region is ignored; the directory comes
+// from the same environment variables as the acceptance tests.
+func testSweepEntries(filter string, sweep func(ctx context.Context, entry *LdapEntry) error) error {
+	ctx := context.Background()
+	client, err := testProviderConfigure(testConfig.url, testConfig.searchBase, testConfig.bindAccount, testConfig.bindPassword)
+	if err != nil {
+		return fmt.Errorf("error connecting to sweep: %w", err)
+	}
+
+	results, err := client.LdapSearch(ctx, filter, []string{"distinguishedName"})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, result := range results.Entries {
+		entry, err := client.GetObjectByDN(ctx, result.DN, nil)
+		if IsNotFound(err) {
+			continue // Already removed with its parent
+		}
+		if err == nil {
+			err = sweep(ctx, entry)
+		}
+		if err != nil && !IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("error sweeping %s: %w", result.DN, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func TestAdldapResourceAccountStateUpgradeV0(t *testing.T) {
+	// States already keyed by objectGUID are left alone without a lookup
+	rawState := map[string]interface{}{
+		"id":          "0b5f3e8e-1d2c-4a3b-9f8e-7d6c5b4a3f2e",
+		"object_guid": "0b5f3e8e-1d2c-4a3b-9f8e-7d6c5b4a3f2e",
+	}
+	got, err := resourceAccountStateUpgradeV0(context.Background(), rawState, new(LdapClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["id"] != rawState["id"] {
+		t.Fatalf("Error matching upgraded ID: got %s, expected %s", got["id"], rawState["id"])
+	}
+
+	client, directory := newFakeClient(t)
+	ctx := context.Background()
+	account, err := client.CreateUserAccount(ctx, "upgraded", "Passw0rd!", "CN=Users,"+fakeDomainDN, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectGUID, err := account.GetObjectGUID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 0 states were keyed by sAMAccountName
+	got, err = resourceAccountStateUpgradeV0(ctx, map[string]interface{}{"id": "upgraded", "sam_account_name": "upgraded"}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["id"] != objectGUID || got["object_guid"] != objectGUID {
+		t.Errorf("Error upgrading a sAMAccountName ID: got %v, expected %s", got, objectGUID)
+	}
+
+	// Accounts that are gone keep their ID for Read to remove
+	got, err = resourceAccountStateUpgradeV0(ctx, map[string]interface{}{"id": "gone"}, client)
+	if err != nil || got["id"] != "gone" {
+		t.Errorf("Error keeping the ID of a missing account: got %v, %v", got, err)
+	}
+
+	client.Conn = &unavailableConn{Client: directory}
+	if _, err := resourceAccountStateUpgradeV0(ctx, map[string]interface{}{"id": "upgraded"}, client); err == nil {
+		t.Error("Error failing the upgrade when the directory can't be searched: got no error")
+	}
+}
+
+func TestAdldapResourceStateUpgradersFrozen(t *testing.T) {
+	for name, r := range map[string]*schema.Resource{
+		"adldap_user":                resourceUser(),
+		"adldap_computer":            resourceComputer(),
+		"adldap_organizational_unit": resourceOrganizationalUnit(),
+	} {
+		// Attributes added since version 0 aren't in its type
+		if r.StateUpgraders[0].Type.HasAttribute("domain") {
+			t.Errorf("Error freezing the version 0 schema of %s: got the current schema", name)
+		}
+	}
+}
+
+// unavailableConn refuses every search, as a domain controller that can't be
+// reached does.
+type unavailableConn struct {
+	ldap.Client
+}
+
+func (unavailableConn) Search(*ldap.SearchRequest) (*ldap.SearchResult, error) {
+	return nil, ldap.NewError(ldap.LDAPResultUnavailable, errors.New("000020AF: SvcErr: DSID-031A1254, problem 5002 (UNAVAILABLE), data 0"))
+}
+
 // Acceptance tests
 
 func TestAccProvider(t *testing.T) {
@@ -50,7 +166,7 @@ func testAccPreCheck(t *testing.T) {
 func testProviderConfigure(ldapURL string, searchBase string, bindAccount string, bindPassword string) (*LdapClient, error) {
 	client := new(LdapClient)
 
-	err := client.New(ldapURL, bindAccount, bindPassword, searchBase, false)
+	err := client.New(context.Background(), ldapURL, bindAccount, bindPassword, searchBase, false)
 	if err != nil {
 		return client, err
 	}
@@ -2,13 +2,27 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	uac "github.com/audibleblink/msldapuac"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
+// Arguments holding a single attribute, for ignore_attributes
+var computerAttributes = map[string]string{
+	"samaccountname":             "sAMAccountName",
+	"description":                "description",
+	"location":                   "location",
+	"managed_by":                 "managedBy",
+	"dns_host_name":              "dNSHostName",
+	"supported_encryption_types": "msDS-SupportedEncryptionTypes",
+}
+
 func resourceComputer() *schema.Resource {
-	return &schema.Resource{
+	r := &schema.Resource{
 		// This description is used by the documentation generator and the language server.
 		Description: "`adldap_computer` manages a computer account in Active Directory.",
 
@@ -16,13 +30,14 @@ func resourceComputer() *schema.Resource {
 		ReadContext:   resourceComputerRead,
 		UpdateContext: resourceComputerUpdate,
 		DeleteContext: resourceComputerDelete,
+		CustomizeDiff: resourceComputerCustomizeDiff,
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceComputerImport,
 		},
 
 		Schema: map[string]*schema.Schema{
 			"id": {
-				Description: "The ID (SAMAccountName) of the user.",
+				Description: "The ID (objectGUID) of the computer.",
 				Type:        schema.TypeString,
 				Computed:    true,
 			},
@@ -32,37 +47,572 @@ func resourceComputer() *schema.Resource {
 				Required:    true,
 			},
 			"organizational_unit": {
-				Description: "The OU that the computer should be in.",
+				Description:      "The OU that the computer should be in.  Defaults to the domain's Computers container, following any redirection with `redircmp`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				DiffSuppressFunc: suppressEquivalentDN,
+			},
+			"dns_host_name": {
+				Description: "The fully qualified DNS name of the computer (`dNSHostName`).  Set by domain join if not specified.",
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+				Computed:    true,
+			},
+			"manage_host_spns": {
+				Description: "Whether to maintain the `HOST/{name}` and `HOST/{dns_host_name}` service principal names, as domain join does.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"enabled": {
+				Description: "Whether the account is enabled.  Defaults to `true`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"password_not_required": {
+				Description: "Whether the account may have an empty password (`PASSWD_NOTREQD`), as set by ADUC when pre-staging computers.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"password": {
+				Description:   "The password for the computer account, used to pre-stage it for offline or automated domain join.",
+				Type:          schema.TypeString,
+				Sensitive:     true,
+				Optional:      true,
+				ConflictsWith: []string{"use_default_password"},
+			},
+			"use_default_password": {
+				Description:   "Whether to set the password to the lowercase computer name, as ADUC does for pre-Windows 2000 computers, so the machine can join with `net join`/`djoin` without credentials.  Renaming the computer resets the password to its new name.  Defaults to `false`.",
+				Type:          schema.TypeBool,
+				Optional:      true,
+				Default:       false,
+				ConflictsWith: []string{"password"},
+			},
+			"custom_attributes": {
+				Description: "Additional single-valued attributes to manage on the computer, keyed by LDAP attribute name, e.g. `extensionAttribute1` for an asset tag.",
+				Type:        schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional:         true,
+				ValidateDiagFunc: validateAttributeNameKeys,
+			},
+			"trusted_for_delegation": {
+				Description: "Whether the computer is trusted for unconstrained Kerberos delegation (`TRUSTED_FOR_DELEGATION`).  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"trusted_to_auth_for_delegation": {
+				Description: "Whether the computer may use protocol transition for constrained delegation (`TRUSTED_TO_AUTH_FOR_DELEGATION`).  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"adopt_existing": {
+				Description: "Whether to adopt an existing computer with the same `samaccountname` on create, converging it on the configuration, instead of failing.  The password of an adopted computer is left untouched.  The provider's `act_idempotently` enables this for all resources.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"restore_deleted": {
+				Description: "Whether to restore the most recently deleted computer with the same `samaccountname` from the AD Recycle Bin on create, keeping its objectGUID, SID, and group memberships, and converge it on the configuration as if adopted.  Computers that have been recycled can't be restored and are created again.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"protect_from_accidental_deletion": {
+				Description: "Whether to deny Everyone the right to delete the computer, as the ADUC \"Protect object from accidental deletion\" checkbox does.  The protection is lifted automatically when the resource is destroyed.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"supported_encryption_types": {
+				Description: "Kerberos encryption types supported by the computer (`msDS-SupportedEncryptionTypes`): any of `DES_CBC_CRC`, `DES_CBC_MD5`, `RC4_HMAC`, `AES128_CTS_HMAC_SHA1_96`, and `AES256_CTS_HMAC_SHA1_96`.  Left unmanaged if not specified.",
+				Type:        schema.TypeSet,
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(encryptionTypeNames, false)),
+				},
+				Optional: true,
+				Computed: true,
+			},
+			"distinguished_name": {
+				Description: "The distinguished name of the computer.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"object_guid": {
+				Description: "The objectGUID of the computer.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"sid": {
+				Description: "The security identifier (objectSid) of the computer.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"when_created": {
+				Description: "When the computer was created, in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"operating_system": {
+				Description: "The operating system reported by the computer (`operatingSystem`).",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"operating_system_version": {
+				Description: "The operating system version reported by the computer (`operatingSystemVersion`).",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"last_logon_timestamp": {
+				Description: "When the computer last logged on to the domain (`lastLogonTimestamp`), in RFC 3339 format.  Empty for pre-staged computers that have never joined.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"offline_domain_join": {
+				Description: "The fields needed to build an offline domain join (`djoin`) provisioning blob, populated when Terraform sets the password from `password` or `use_default_password`.  Empty for an adopted, restored, or idempotently created computer, whose password is left alone.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Sensitive:   true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"machine_name": {
+							Description: "The NetBIOS name of the computer.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"machine_password": {
+							Description: "The password of the computer account.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"domain_dns_name": {
+							Description: "The DNS name of the domain.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"domain_netbios_name": {
+							Description: "The NetBIOS name of the domain.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"domain_guid": {
+							Description: "The objectGUID of the domain.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"domain_sid": {
+							Description: "The security identifier of the domain.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"forest_dns_name": {
+							Description: "The DNS name of the forest root domain.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"domain_controller_name": {
+							Description: "The DNS name of the domain controller the account was read from, which has the password immediately.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+					},
+				},
+			},
+			"read_laps_password": {
+				Description: "Whether to read the LAPS-managed local administrator password into `laps_password`.  The password is stored in state; prefer the `adldap_laps_password` ephemeral resource where supported.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"laps_password": {
+				Description: "The LAPS-managed local administrator password, if `read_laps_password` is set and it is stored unencrypted.",
+				Type:        schema.TypeString,
+				Sensitive:   true,
+				Computed:    true,
+			},
+			"laps_password_expiration": {
+				Description: "When the LAPS-managed local administrator password expires, in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"description": {
+				Description: "Description property of the computer.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"location": {
+				Description: "Location of the computer.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"managed_by": {
+				Description:      "Distinguished name of the user or group that manages the computer (`managedBy`).",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateDN,
+				DiffSuppressFunc: suppressEquivalentDN,
+			},
+			"domain":            domainSchema(),
+			"ignore_attributes": ignoreAttributesSchema(),
+			"ldap_controls":     ldapControlsSchema(),
+		},
+	}
+
+	r.SchemaVersion = 1
+	r.StateUpgraders = []schema.StateUpgrader{
+		{
+			Version: 0,
+			Type:    resourceComputerV0().CoreConfigSchema().ImpliedType(),
+			Upgrade: resourceAccountStateUpgradeV0,
+		},
+	}
+
+	return r
+}
+
+// resourceComputerV0 is the computer schema at version 0, keyed by
+// sAMAccountName, frozen like resourceUserV0.
+func resourceComputerV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"samaccountname": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"organizational_unit": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"dns_host_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"manage_host_spns": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"enabled": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"password_not_required": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"password": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"use_default_password": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"custom_attributes": {
+				Type: schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+			},
+			"trusted_for_delegation": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"trusted_to_auth_for_delegation": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"protect_from_accidental_deletion": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"supported_encryption_types": {
+				Type: schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+				Computed: true,
+			},
+			"distinguished_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"object_guid": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"sid": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"when_created": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"operating_system": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"operating_system_version": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"last_logon_timestamp": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"offline_domain_join": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"machine_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"machine_password": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"domain_dns_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"domain_netbios_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"domain_guid": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"domain_sid": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"forest_dns_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"domain_controller_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"read_laps_password": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"laps_password": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"laps_password_expiration": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"location": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"managed_by": {
+				Type:     schema.TypeString,
+				Optional: true,
 			},
 		},
 	}
 }
 
 func resourceComputerCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*LdapClient)
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	attributesMap := make(map[string][]string)
 
 	sAMAccountName := d.Get("samaccountname").(string)
 	ou := d.Get("organizational_unit").(string)
+	if ou == "" {
+		var err error
+		ou, err = client.GetWellKnownContainer(ctx, computersContainerGUID)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	description := d.Get("description").(string)
+	if description != "" {
+		attributesMap["description"] = []string{description}
+	}
+
+	location := d.Get("location").(string)
+	if location != "" {
+		attributesMap["location"] = []string{location}
+	}
+
+	managedBy := d.Get("managed_by").(string)
+	if managedBy != "" {
+		attributesMap["managedBy"] = []string{managedBy}
+	}
+
+	for k, v := range d.Get("custom_attributes").(map[string]interface{}) {
+		attributesMap[k] = []string{v.(string)}
+	}
+
+	dnsHostName := d.Get("dns_host_name").(string)
+	if dnsHostName != "" {
+		attributesMap["dNSHostName"] = []string{dnsHostName}
+	}
+
+	if d.Get("manage_host_spns").(bool) {
+		attributesMap["servicePrincipalName"] = computerHostSPNs(sAMAccountName, dnsHostName)
+	}
+
+	account, err := client.GetAccountBySAMAccountName(ctx, sAMAccountName, objectClassComputer, computerAttributeNames(d))
+	exists := err == nil
+	if err != nil && !IsNotFound(err) {
+		return diag.FromErr(err)
+	}
+
+	restored := false
+	if !exists && d.Get("restore_deleted").(bool) {
+		restored, err = client.RestoreDeletedAccount(ctx, sAMAccountName, ou)
+		if err != nil {
+			return diag.Errorf("error restoring deleted computer %s: %s", sAMAccountName, err)
+		}
+	}
+	if restored {
+		account, err = client.GetAccountBySAMAccountName(ctx, sAMAccountName, objectClassComputer, computerAttributeNames(d))
+		if err != nil {
+			return diag.Errorf("error reading restored computer %s: %s", sAMAccountName, err)
+		}
+	}
 
-	_, err := client.CreateComputerAccount(sAMAccountName, ou, nil)
+	adopted := restored || (exists && (d.Get("adopt_existing").(bool) || client.ActIdempotently))
+	if adopted {
+		err = adoptComputerAccount(ctx, d, account, ou, attributesMap)
+		if err != nil {
+			return diag.Errorf("error adopting computer %s: %s", sAMAccountName, err)
+		}
+	} else {
+		account, err = client.CreateComputerAccount(ctx, sAMAccountName, computerPassword(d), ou, attributesMap)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.Get("password_not_required").(bool) {
+		err = account.AddUACFlag(ctx, uac.PasswdNotReqd)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if !d.Get("enabled").(bool) {
+		err = account.Disable(ctx)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	var diags diag.Diagnostics
+	if d.Get("trusted_for_delegation").(bool) {
+		err = account.AddUACFlag(ctx, uac.TrustedForDelegation)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		diags = append(diags, unconstrainedDelegationWarning(sAMAccountName))
+	}
+
+	if d.Get("trusted_to_auth_for_delegation").(bool) {
+		err = account.AddUACFlag(ctx, uac.TrustedToAuthForDelegation)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if encryptionTypes, ok := d.GetOk("supported_encryption_types"); ok {
+		err = account.SetSupportedEncryptionTypes(ctx, setToStingArray(encryptionTypes.(*schema.Set)))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.Get("protect_from_accidental_deletion").(bool) {
+		err = account.SetProtectedFromDeletion(ctx, true)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	err = setAccountIdentity(ctx, d, account)
 	if err != nil {
 		return diag.FromErr(err)
 	}
+	// An adopted computer keeps a password Terraform never set
+	offlineDomainJoin := []interface{}{}
+	if !adopted {
+		offlineDomainJoin, err = computerOfflineDomainJoin(ctx, d, client)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	d.Set("offline_domain_join", offlineDomainJoin)
+	d.Set("operating_system", "")
+	d.Set("operating_system_version", "")
+	d.Set("last_logon_timestamp", "")
+	d.Set("laps_password", "")
+	d.Set("laps_password_expiration", "")
 
-	d.SetId(sAMAccountName)
+	d.SetId(d.Get("object_guid").(string))
 
-	return nil
+	return diags
 }
 
 func resourceComputerRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*LdapClient)
-	attributes := []string{}
+	client, err := domainClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer keepIgnoredAttributes(d, computerAttributes, map[string]string{"custom_attributes": ""})()
+	customAttributes := d.Get("custom_attributes").(map[string]interface{})
+	attributes := computerAttributeNames(d)
 
-	// Use the samAccountName as the resource ID
-	account, err := client.GetAccountBySAMAccountName(d.Id(), attributes)
+	// States from before the objectGUID became the ID may still hold a
+	// sAMAccountName
+	var account *LdapAccount
+	err = awaitReplication(ctx, client, d.Id(), func() error {
+		var err error
+		account, err = client.GetAccountByIdentifier(ctx, d.Id(), objectClassComputer, attributes)
+		return err
+	})
 	if err != nil {
+		if IsNotFound(err) {
+			diags := deletedObjectDiagnostics(ctx, client, "Computer", d.Id())
+			d.SetId("")
+			return diags
+		}
 		return diag.FromErr(err)
 	}
 
@@ -72,21 +622,109 @@ func resourceComputerRead(ctx context.Context, d *schema.ResourceData, meta inte
 		return diag.FromErr(err)
 	}
 
-	d.Set("samaccountname", d.Id())
-	d.Set("organizational_unit", parent)
+	accountEnabled, err := account.IsEnabled(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	passwordNotRequired, err := account.UACFlagIsSet(ctx, uac.PasswdNotReqd)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	trustedForDelegation, err := account.UACFlagIsSet(ctx, uac.TrustedForDelegation)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	trustedToAuthForDelegation, err := account.UACFlagIsSet(ctx, uac.TrustedToAuthForDelegation)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	encryptionTypes, err := account.GetSupportedEncryptionTypes(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	err = setAccountIdentity(ctx, d, account)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	protectedFromDeletion, err := account.IsProtectedFromDeletion(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	lastLogonTimestamp, err := account.GetLastLogonTimestamp(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	lapsPasswordExpiration, err := account.GetLAPSPasswordExpiration(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	lapsPassword := ""
+	if d.Get("read_laps_password").(bool) {
+		lapsPassword, err = account.GetLAPSPassword(ctx)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	description, _ := account.GetAttributeValue(ctx, "description")
+	location, _ := account.GetAttributeValue(ctx, "location")
+	managedBy, _ := account.GetAttributeValue(ctx, "managedBy")
+	dnsHostName, _ := account.GetAttributeValue(ctx, "dNSHostName")
+	operatingSystem, _ := account.GetAttributeValue(ctx, "operatingSystem")
+	operatingSystemVersion, _ := account.GetAttributeValue(ctx, "operatingSystemVersion")
+	for k := range customAttributes {
+		value, _ := account.GetAttributeValue(ctx, k)
+		if value == "" {
+			delete(customAttributes, k)
+		} else {
+			customAttributes[k] = value
+		}
+	}
 
+	sAMAccountName, _ := account.GetAttributeValue(ctx, "sAMAccountName")
+	d.SetId(d.Get("object_guid").(string))
+	d.Set("samaccountname", sAMAccountName)
+	setDN(d, "organizational_unit", parent)
+	d.Set("description", description)
+	d.Set("location", location)
+	setDN(d, "managed_by", managedBy)
+	d.Set("dns_host_name", dnsHostName)
+	d.Set("custom_attributes", customAttributes)
+	d.Set("operating_system", operatingSystem)
+	d.Set("operating_system_version", operatingSystemVersion)
+	d.Set("last_logon_timestamp", timeToString(lastLogonTimestamp))
+	d.Set("laps_password", lapsPassword)
+	d.Set("laps_password_expiration", timeToString(lapsPasswordExpiration))
+	d.Set("enabled", accountEnabled)
+	d.Set("password_not_required", passwordNotRequired)
+	d.Set("trusted_for_delegation", trustedForDelegation)
+	d.Set("trusted_to_auth_for_delegation", trustedToAuthForDelegation)
+	d.Set("supported_encryption_types", encryptionTypes)
+	d.Set("protect_from_accidental_deletion", protectedFromDeletion)
+
+	if adminCount, _ := account.GetAttributeValue(ctx, "adminCount"); adminCount == "1" {
+		return diag.Diagnostics{adminSDHolderWarning("Computer", sAMAccountName)}
+	}
 	return nil
 }
 
 func resourceComputerUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	var account *LdapAccount
-	var err error
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	sAMAccountName := d.Get("samaccountname").(string)
 
-	client := meta.(*LdapClient)
-	sAMAccountName := d.Id()
+	account, err := client.GetAccountByIdentifier(ctx, d.Id(), objectClassComputer, computerAttributeNames(d))
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	if d.HasChanges("organizational_unit", "samaccountname") {
-		account, err = client.GetAccountBySAMAccountName(sAMAccountName, nil)
+	// The deny-delete ACE also blocks moves and renames, so lift it first and
+	// reapply it once everything else is done
+	protectionChanging := d.HasChanges("protect_from_accidental_deletion", "organizational_unit", "samaccountname")
+	if protectionChanging {
+		err = account.SetProtectedFromDeletion(ctx, false)
 		if err != nil {
 			return diag.FromErr(err)
 		}
@@ -95,35 +733,439 @@ func resourceComputerUpdate(ctx context.Context, d *schema.ResourceData, meta in
 	if d.HasChange("organizational_unit") {
 		_, newOU := d.GetChange("organizational_unit")
 
-		err = account.Move(newOU.(string))
+		err = account.Move(ctx, newOU.(string))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	passwordChanging := computerPasswordChanging(d)
+	if passwordChanging {
+		password := computerPassword(d)
+		if password != "" {
+			err = account.SetPassword(ctx, password)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if d.HasChange("enabled") {
+		if d.Get("enabled").(bool) {
+			err = account.Enable(ctx)
+		} else {
+			err = account.Disable(ctx)
+		}
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("password_not_required") {
+		if d.Get("password_not_required").(bool) {
+			err = account.AddUACFlag(ctx, uac.PasswdNotReqd)
+		} else {
+			err = account.RemoveUACFlag(ctx, uac.PasswdNotReqd)
+		}
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	var diags diag.Diagnostics
+	if d.HasChange("trusted_for_delegation") {
+		if d.Get("trusted_for_delegation").(bool) {
+			err = account.AddUACFlag(ctx, uac.TrustedForDelegation)
+			diags = append(diags, unconstrainedDelegationWarning(sAMAccountName))
+		} else {
+			err = account.RemoveUACFlag(ctx, uac.TrustedForDelegation)
+		}
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	}
 
+	if d.HasChange("trusted_to_auth_for_delegation") {
+		if d.Get("trusted_to_auth_for_delegation").(bool) {
+			err = account.AddUACFlag(ctx, uac.TrustedToAuthForDelegation)
+		} else {
+			err = account.RemoveUACFlag(ctx, uac.TrustedToAuthForDelegation)
+		}
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("supported_encryption_types") {
+		err = account.SetSupportedEncryptionTypes(ctx, setToStingArray(d.Get("supported_encryption_types").(*schema.Set)))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("description") {
+		_, newDescription := d.GetChange("description")
+		err = account.UpdateAttribute(ctx, "description", []string{newDescription.(string)})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("location") {
+		_, newLocation := d.GetChange("location")
+		err = account.UpdateAttribute(ctx, "location", []string{newLocation.(string)})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("managed_by") {
+		_, newManagedBy := d.GetChange("managed_by")
+		err = account.UpdateAttribute(ctx, "managedBy", []string{newManagedBy.(string)})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChange("custom_attributes") {
+		err = account.UpdateAttributes(ctx, mapAttributeChanges(d, "custom_attributes", ""))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	oldDNSHostName, _ := d.GetChange("dns_host_name")
+	if newDNSHostName := computerDNSHostName(d); newDNSHostName != oldDNSHostName.(string) {
+		err = account.UpdateAttribute(ctx, "dNSHostName", []string{newDNSHostName})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.HasChanges("samaccountname", "dns_host_name", "manage_host_spns") {
+		err = updateComputerHostSPNs(ctx, d, account)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Rename last so the CN and sAMAccountName change together.  The CN goes
+	// first, and is put back if the sAMAccountName can't follow, so that a
+	// failed rename leaves the computer and its state under the old name
 	if d.HasChange("samaccountname") {
-		_, newSAMAccountName := d.GetChange("samaccountname")
-		account.UpdateAttribute("sAMAccountName", []string{newSAMAccountName.(string)})
+		oldSAMAccountName, newSAMAccountName := d.GetChange("samaccountname")
+
+		err = account.Rename(ctx, strings.TrimSuffix(newSAMAccountName.(string), "$"))
+		if err != nil {
+			d.Set("samaccountname", oldSAMAccountName)
+			return diag.FromErr(err)
+		}
+
+		err = account.UpdateAttribute(ctx, "sAMAccountName", []string{newSAMAccountName.(string)})
+		if err != nil {
+			d.Set("samaccountname", oldSAMAccountName)
+			if rollbackErr := account.Rename(ctx, strings.TrimSuffix(oldSAMAccountName.(string), "$")); rollbackErr != nil {
+				return diag.Errorf("%s; renaming the computer back to %s also failed: %s", err, oldSAMAccountName, rollbackErr)
+			}
+			return diag.FromErr(err)
+		}
+	}
+
+	if protectionChanging && d.Get("protect_from_accidental_deletion").(bool) {
+		err = account.SetProtectedFromDeletion(ctx, true)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
-		d.SetId(newSAMAccountName.(string))
+	if computerOfflineDomainJoinChanging(d, passwordChanging) {
+		offlineDomainJoin, err := computerOfflineDomainJoin(ctx, d, client)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		d.Set("offline_domain_join", offlineDomainJoin)
 	}
 
+	return append(diags, resourceComputerRead(ctx, d, meta)...)
+}
+
+// resourceComputerCustomizeDiff marks the values a move or rename changes in
+// the directory as unknown.
+func resourceComputerCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" {
+		return nil
+	}
+	if d.HasChanges("samaccountname", "organizational_unit") {
+		err := d.SetNewComputed("distinguished_name")
+		if err != nil {
+			return err
+		}
+	}
+	if computerOfflineDomainJoinChanging(d, computerPasswordChanging(d)) {
+		err := d.SetNewComputed("offline_domain_join")
+		if err != nil {
+			return err
+		}
+	}
+	if d.HasChange("samaccountname") && d.GetRawConfig().GetAttr("dns_host_name").IsNull() {
+		return d.SetNewComputed("dns_host_name")
+	}
 	return nil
 }
 
+func resourceComputerImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	client, err := importDomain(ctx, d, meta)
+	if err != nil {
+		return nil, err
+	}
+	identifier := d.Id()
+
+	// Accept a sAMAccountName (with or without the trailing "$"), DN, or
+	// objectGUID, and use the objectGUID as the resource ID
+	account, err := client.GetComputerByIdentifier(ctx, identifier, []string{"objectGUID"})
+	if err != nil {
+		return nil, err
+	}
+
+	objectGUID, err := account.GetObjectGUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.SetId(objectGUID)
+
+	return importResource(ctx, d, meta, resourceComputer())
+}
+
 func resourceComputerDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*LdapClient)
-	sAMAccountName := d.Get("samaccountname").(string)
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	account, err := client.GetAccountBySAMAccountName(sAMAccountName, nil)
+	account, err := client.GetAccountByIdentifier(ctx, d.Id(), objectClassComputer, []string{"objectGUID"})
+	if IsNotFound(err) {
+		return nil
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	err = account.Delete()
+	// Only lift protection this resource manages; a deny-delete ACE added
+	// outside Terraform still blocks the destroy
+	if d.Get("protect_from_accidental_deletion").(bool) {
+		err = account.SetProtectedFromDeletion(ctx, false)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	err = account.Delete(ctx)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
 	return nil
 }
+
+// adoptComputerAccount converges an existing computer, read with
+// computerAttributeNames, on the configuration instead of creating it.  Its
+// password is left alone so that a joined machine keeps its secure channel.
+func adoptComputerAccount(ctx context.Context, d *schema.ResourceData, account *LdapAccount, ou string, attributes map[string][]string) error {
+	parentDN, err := account.ParentDN()
+	if err != nil {
+		return err
+	}
+	if !dnsEqual(parentDN, ou) {
+		err = account.Move(ctx, ou)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Clear the simple attributes that aren't configured
+	for _, attribute := range []string{"description", "location", "managedBy"} {
+		if _, ok := attributes[attribute]; !ok && !isIgnoredAttribute(d, attribute) {
+			attributes[attribute] = []string{}
+		}
+	}
+	err = account.UpdateAttributes(ctx, attributes)
+	if err != nil {
+		return err
+	}
+
+	// Flags the create path only ever sets are cleared here
+	for flag, key := range map[int64]string{
+		uac.PasswdNotReqd:              "password_not_required",
+		uac.TrustedForDelegation:       "trusted_for_delegation",
+		uac.TrustedToAuthForDelegation: "trusted_to_auth_for_delegation",
+	} {
+		if !d.Get(key).(bool) {
+			err = account.RemoveUACFlag(ctx, flag)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if d.Get("enabled").(bool) {
+		err = account.Enable(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unconstrainedDelegationWarning(sAMAccountName string) diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  "Unconstrained delegation enabled",
+		Detail:   fmt.Sprintf("Computer %s is trusted for unconstrained delegation, so any user authenticating to it exposes a forwardable ticket.  Prefer constrained or resource-based constrained delegation where possible.", sAMAccountName),
+	}
+}
+
+func computerOfflineDomainJoin(ctx context.Context, d *schema.ResourceData, client *LdapClient) ([]interface{}, error) {
+	password := computerPassword(d)
+	if password == "" {
+		return []interface{}{}, nil
+	}
+
+	domain, err := client.GetDomainInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"machine_name":           strings.TrimSuffix(d.Get("samaccountname").(string), "$"),
+			"machine_password":       password,
+			"domain_dns_name":        domain.DNSName,
+			"domain_netbios_name":    domain.NetBIOSName,
+			"domain_guid":            domain.GUID,
+			"domain_sid":             domain.SID,
+			"forest_dns_name":        domain.ForestDNSName,
+			"domain_controller_name": domain.DomainControllerName,
+		},
+	}, nil
+}
+
+// computerChanges is the part of schema.ResourceData and schema.ResourceDiff
+// that decides what an update changes.
+type computerChanges interface {
+	Get(key string) interface{}
+	GetChange(key string) (interface{}, interface{})
+	HasChange(key string) bool
+	HasChanges(keys ...string) bool
+}
+
+// computerPasswordChanging reports whether an update sets the computer's
+// password.  A default password follows the computer's name, so a rename
+// resets it.
+func computerPasswordChanging(d computerChanges) bool {
+	return d.HasChanges("password", "use_default_password") || (d.Get("use_default_password").(bool) && d.HasChange("samaccountname"))
+}
+
+// computerOfflineDomainJoinChanging reports whether an update changes the
+// offline domain join fields.  They are only ever populated when Terraform
+// sets the password, and then follow a rename of the computer.
+func computerOfflineDomainJoinChanging(d computerChanges, passwordChanging bool) bool {
+	if passwordChanging {
+		return true
+	}
+	offlineDomainJoin, _ := d.GetChange("offline_domain_join")
+	return d.HasChange("samaccountname") && len(offlineDomainJoin.([]interface{})) > 0
+}
+
+func computerPassword(d *schema.ResourceData) string {
+	if d.Get("use_default_password").(bool) {
+		return defaultComputerPassword(d.Get("samaccountname").(string))
+	}
+	return d.Get("password").(string)
+}
+
+// computerDNSHostName returns the DNS host name the computer should have after
+// an update.  When it is not configured it follows a rename of the computer.
+func computerDNSHostName(d *schema.ResourceData) string {
+	if !d.GetRawConfig().GetAttr("dns_host_name").IsNull() {
+		return d.Get("dns_host_name").(string)
+	}
+
+	oldDNSHostName, _ := d.GetChange("dns_host_name")
+	if !d.HasChange("samaccountname") {
+		return oldDNSHostName.(string)
+	}
+	oldSAMAccountName, newSAMAccountName := d.GetChange("samaccountname")
+
+	return renameDNSHostName(oldDNSHostName.(string), strings.TrimSuffix(oldSAMAccountName.(string), "$"), strings.TrimSuffix(newSAMAccountName.(string), "$"))
+}
+
+// renameDNSHostName replaces the host label of a DNS host name when it matches
+// the computer's old name.
+func renameDNSHostName(dnsHostName string, oldName string, newName string) string {
+	labels := strings.SplitN(dnsHostName, ".", 2)
+	if !strings.EqualFold(labels[0], oldName) {
+		return dnsHostName
+	}
+	labels[0] = strings.ToLower(newName)
+	return strings.Join(labels, ".")
+}
+
+// computerHostSPNs returns the HOST service principal names domain join
+// registers for a computer.
+func computerHostSPNs(sAMAccountName string, dnsHostName string) []string {
+	spns := []string{fmt.Sprintf("HOST/%s", strings.TrimSuffix(sAMAccountName, "$"))}
+	if dnsHostName != "" {
+		spns = append(spns, fmt.Sprintf("HOST/%s", dnsHostName))
+	}
+	return spns
+}
+
+// updateComputerHostSPNs replaces the HOST SPNs derived from the old name and
+// DNS host name with those derived from the new ones.
+func updateComputerHostSPNs(ctx context.Context, d *schema.ResourceData, account *LdapAccount) error {
+	oldSAMAccountName, newSAMAccountName := d.GetChange("samaccountname")
+	oldDNSHostName, _ := d.GetChange("dns_host_name")
+	newDNSHostName := computerDNSHostName(d)
+	oldManaged, newManaged := d.GetChange("manage_host_spns")
+
+	var oldSPNs, newSPNs []string
+	if oldManaged.(bool) {
+		oldSPNs = computerHostSPNs(oldSAMAccountName.(string), oldDNSHostName.(string))
+	}
+	if newManaged.(bool) {
+		newSPNs = computerHostSPNs(newSAMAccountName.(string), newDNSHostName)
+	}
+
+	for _, spn := range oldSPNs {
+		if !sliceIsSubset(newSPNs, []string{spn}) {
+			err := account.RemoveServicePrincipal(ctx, spn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, spn := range newSPNs {
+		exists, err := account.HasServicePrincipal(ctx, spn)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			err = account.AddServicePrincipal(ctx, spn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// computerAttributeNames lists the attributes a computer is read with,
+// including its custom_attributes.
+func computerAttributeNames(d *schema.ResourceData) []string {
+	names := []string{"sAMAccountName", "description", "location", "managedBy", "dNSHostName", "userAccountControl", "msDS-SupportedEncryptionTypes", "objectGUID", "objectSid", "whenCreated", "msLAPS-PasswordExpirationTime", "ms-Mcs-AdmPwdExpirationTime", "operatingSystem", "operatingSystemVersion", "lastLogonTimestamp", "nTSecurityDescriptor", "adminCount"}
+	for k := range d.Get("custom_attributes").(map[string]interface{}) {
+		names = append(names, k)
+	}
+	return names
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -16,6 +17,23 @@ var (
 	testComputerOU2 = os.Getenv("ADLDAP_TEST_COMPUTER_OU2")
 )
 
+func init() {
+	resource.AddTestSweepers("adldap_computer", &resource.Sweeper{
+		Name:         "adldap_computer",
+		Dependencies: []string{"adldap_service_principal"},
+		F: func(region string) error {
+			filter := fmt.Sprintf("(&(objectClass=computer)(sAMAccountName=%s*))", testSweepPrefix)
+			return testSweepEntries(filter, func(ctx context.Context, entry *LdapEntry) error {
+				err := entry.SetProtectedFromDeletion(ctx, false)
+				if err != nil {
+					return err
+				}
+				return entry.Delete(ctx)
+			})
+		},
+	})
+}
+
 func init() {
 	if testComputerOU == "" {
 		testComputerOU = testAccProviderMeta.SearchBase
@@ -52,6 +70,63 @@ func TestAccAdldapResourceComputer(t *testing.T) {
 	})
 }
 
+func TestAccAdldapResourceComputer_clearAttributes(t *testing.T) {
+	computerName := fmt.Sprintf("tfaccclr-%d$", rand.New(rand.NewSource(time.Now().UnixNano())).Intn(99999))
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAdldapResourceComputerDescription(computerName, testComputerOU, "Terraform acceptance test"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"adldap_computer.foo", "description", "Terraform acceptance test"),
+					resource.TestCheckResourceAttr(
+						"adldap_computer.foo", "location", "Terraform acceptance test"),
+				),
+			},
+			{
+				Config: testAccAdldapResourceComputer(computerName, testComputerOU),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"adldap_computer.foo", "description", ""),
+					resource.TestCheckResourceAttr(
+						"adldap_computer.foo", "location", ""),
+				),
+			},
+		},
+	})
+}
+
+func TestAccAdldapResourceComputer_adoptExisting(t *testing.T) {
+	computerName := fmt.Sprintf("tfaccadp-%d$", rand.New(rand.NewSource(time.Now().UnixNano())).Intn(99999))
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				PreConfig: func() {
+					_, err := testAccProviderMeta.CreateComputerAccount(context.Background(), computerName, "", testComputerOU, map[string][]string{
+						"description": {"Created outside Terraform"},
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testAccAdldapResourceComputerAdopt(computerName, testComputerOU),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"adldap_computer.foo", "samaccountname", computerName),
+					resource.TestCheckResourceAttr(
+						"adldap_computer.foo", "description", ""),
+				),
+			},
+		},
+	})
+}
+
 func testAccAdldapResourceComputer(computerName string, computerOU string) string {
 	return fmt.Sprintf(`
 resource "adldap_computer" "foo" {
@@ -60,3 +135,222 @@ resource "adldap_computer" "foo" {
 }
 `, computerName, computerOU)
 }
+
+func TestAdldapComputerHostSPNs(t *testing.T) {
+	cases := []struct {
+		sAMAccountName string
+		dnsHostName    string
+		expected       []string
+	}{
+		{
+			sAMAccountName: "WEB01$",
+			dnsHostName:    "web01.example.com",
+			expected:       []string{"HOST/WEB01", "HOST/web01.example.com"},
+		},
+		{
+			sAMAccountName: "WEB01$",
+			dnsHostName:    "",
+			expected:       []string{"HOST/WEB01"},
+		},
+	}
+
+	for _, c := range cases {
+		got := computerHostSPNs(c.sAMAccountName, c.dnsHostName)
+		if !stringSlicesEqual(got, c.expected) {
+			t.Fatalf("Error matching output and expected for \"%s\": got %s, expected %s", c.sAMAccountName, got, c.expected)
+		}
+	}
+}
+
+func TestAdldapComputerRenameDNSHostName(t *testing.T) {
+	cases := []struct {
+		dnsHostName string
+		oldName     string
+		newName     string
+		expected    string
+	}{
+		{
+			dnsHostName: "web01.example.com",
+			oldName:     "WEB01",
+			newName:     "WEB02",
+			expected:    "web02.example.com",
+		},
+		{
+			dnsHostName: "frontend.example.com",
+			oldName:     "WEB01",
+			newName:     "WEB02",
+			expected:    "frontend.example.com",
+		},
+		{
+			dnsHostName: "",
+			oldName:     "WEB01",
+			newName:     "WEB02",
+			expected:    "",
+		},
+	}
+
+	for _, c := range cases {
+		got := renameDNSHostName(c.dnsHostName, c.oldName, c.newName)
+		if got != c.expected {
+			t.Fatalf("Error matching output and expected for \"%s\": got %s, expected %s", c.dnsHostName, got, c.expected)
+		}
+	}
+}
+
+func testAccAdldapResourceComputerDescription(computerName string, computerOU string, description string) string {
+	return fmt.Sprintf(`
+resource "adldap_computer" "foo" {
+  samaccountname      = "%[1]s"
+  organizational_unit = "%[2]s"
+  description         = "%[3]s"
+  location            = "%[3]s"
+}
+`, computerName, computerOU, description)
+}
+
+func testAccAdldapResourceComputerAdopt(computerName string, computerOU string) string {
+	return fmt.Sprintf(`
+resource "adldap_computer" "foo" {
+  samaccountname      = "%s"
+  organizational_unit = "%s"
+  adopt_existing      = true
+}
+`, computerName, computerOU)
+}
+
+func TestAdldapResourceComputer_fake(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceComputer()
+	computerDN := "CN=FAKEPC,CN=Computers," + fakeDomainDN
+
+	config := map[string]interface{}{
+		"samaccountname":      "FAKEPC$",
+		"organizational_unit": "CN=Computers," + fakeDomainDN,
+		"dns_host_name":       "fakepc.example.com",
+		"manage_host_spns":    true,
+		"description":         "Fake computer",
+	}
+	state := fakeApply(t, r, nil, config, client)
+	entry := directory.Entry(computerDN)
+	if entry == nil {
+		t.Fatalf("Error creating computer: %s not found", computerDN)
+	}
+	if !fakeContainsFold(fakeAttribute(entry, "servicePrincipalName"), "HOST/fakepc.example.com") {
+		t.Errorf("Error managing host SPNs: got %v", fakeAttribute(entry, "servicePrincipalName"))
+	}
+
+	searches := directory.Searches()
+	fakeRefresh(t, r, state, client)
+	if got := directory.Searches() - searches; got != 1 {
+		t.Errorf("Error reading the computer in one search: got %d search requests", got)
+	}
+
+	config["enabled"] = false
+	delete(config, "description")
+	state = fakeApply(t, r, state, config, client)
+	state = fakeRefresh(t, r, state, client)
+	entry = directory.Entry(computerDN)
+	if state.Attributes["enabled"] != "false" || fakeAttribute(entry, "description") != nil {
+		t.Errorf("Error disabling computer and clearing description: got %v", entry)
+	}
+
+	fakeApply(t, r, state, nil, client)
+	if directory.Entry(computerDN) != nil {
+		t.Errorf("Error destroying computer: %s still exists", computerDN)
+	}
+}
+
+func TestAdldapResourceComputer_offlineDomainJoin(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceComputer()
+	ctx := context.Background()
+	ou := "CN=Computers," + fakeDomainDN
+	partitionsDN := "CN=Partitions,CN=Configuration," + fakeDomainDN
+	directory.put("CN=Configuration,"+fakeDomainDN, map[string][]string{"objectClass": {"container"}})
+	directory.put(partitionsDN, map[string][]string{"objectClass": {"container"}})
+	directory.put("CN=EXAMPLE,"+partitionsDN, map[string][]string{"objectClass": {"crossRef"}, "nCName": {fakeDomainDN}, "nETBIOSName": {"EXAMPLE"}})
+
+	_, err := client.CreateComputerAccount(ctx, "JOINEDPC$", "secure-channel", ou, map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := fakeApply(t, r, nil, map[string]interface{}{
+		"samaccountname":      "JOINEDPC$",
+		"organizational_unit": ou,
+		"password":            "configured",
+		"adopt_existing":      true,
+	}, client)
+	if got := directory.Password("CN=JOINEDPC," + ou); got != "secure-channel" {
+		t.Errorf("Error leaving an adopted computer's password alone: got %q", got)
+	}
+	if got := state.Attributes["offline_domain_join.#"]; got != "0" {
+		t.Errorf("Error leaving offline_domain_join empty for an adopted computer: got %s entries", got)
+	}
+	if state = fakeRefresh(t, r, state, client); state.Attributes["offline_domain_join.#"] != "0" {
+		t.Errorf("Error keeping offline_domain_join empty on refresh: got %v", state.Attributes)
+	}
+
+	config := map[string]interface{}{
+		"samaccountname":       "STAGEDPC$",
+		"organizational_unit":  ou,
+		"use_default_password": true,
+	}
+	state = fakeApply(t, r, nil, config, client)
+	if got := state.Attributes["offline_domain_join.0.machine_password"]; got != "stagedpc" {
+		t.Errorf("Error reporting the default password: got %q", got)
+	}
+
+	config["samaccountname"] = "RENAMEDPC$"
+	state = fakeApply(t, r, state, config, client)
+	if got := directory.Password("CN=RENAMEDPC," + ou); got != "renamedpc" {
+		t.Errorf("Error resetting the default password on rename: got %q", got)
+	}
+	if got := state.Attributes["offline_domain_join.0.machine_password"]; got != "renamedpc" {
+		t.Errorf("Error reporting the renamed default password: got %q", got)
+	}
+	if got := state.Attributes["offline_domain_join.0.machine_name"]; got != "RENAMEDPC" {
+		t.Errorf("Error reporting the renamed machine: got %q", got)
+	}
+}
+
+func TestAdldapResourceComputer_failedRename(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceComputer()
+	ou := "CN=Computers," + fakeDomainDN
+	computerDN := "CN=FAKEPC," + ou
+
+	config := map[string]interface{}{
+		"samaccountname":      "FAKEPC$",
+		"organizational_unit": ou,
+	}
+	state := fakeApply(t, r, nil, config, client)
+
+	// The CN is taken, so the rename fails before anything changes
+	directory.put("CN=TAKENCN,"+ou, map[string][]string{"objectClass": {"contact"}})
+	config["samaccountname"] = "TAKENCN$"
+	failed, diags := fakeTryApply(t, r, state, config, client)
+	if !diags.HasError() {
+		t.Fatal("Error renaming onto a taken CN: expected an error")
+	}
+	if got := failed.Attributes["samaccountname"]; got != "FAKEPC$" {
+		t.Errorf("Error keeping the old samaccountname in state: got %q", got)
+	}
+
+	// The sAMAccountName is taken, so the CN is renamed back
+	directory.put("CN=Taken,CN=Users,"+fakeDomainDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"TAKENSAM$"}})
+	config["samaccountname"] = "TAKENSAM$"
+	failed, diags = fakeTryApply(t, r, state, config, client)
+	if !diags.HasError() {
+		t.Fatal("Error renaming onto a taken sAMAccountName: expected an error")
+	}
+	if got := failed.Attributes["samaccountname"]; got != "FAKEPC$" {
+		t.Errorf("Error keeping the old samaccountname in state: got %q", got)
+	}
+	entry := directory.Entry(computerDN)
+	if entry == nil || directory.Entry("CN=TAKENSAM,"+ou) != nil {
+		t.Fatalf("Error renaming the CN back to %s", computerDN)
+	}
+	if got := fakeAttribute(entry, "sAMAccountName"); len(got) != 1 || got[0] != "FAKEPC$" {
+		t.Errorf("Error leaving the sAMAccountName alone: got %v", got)
+	}
+}
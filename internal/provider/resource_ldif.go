@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceLDIF() *schema.Resource {
+	return &schema.Resource{
+		// This description is used by the documentation generator and the language server.
+		Description: "`adldap_ldif` applies an LDIF document of adds, modifies, renames, and deletes, and reverses it on destroy, as an escape hatch for changes the provider doesn't model.  Changing the document reverses the old one before applying the new one.  Changes made outside Terraform aren't detected.",
+
+		CreateContext: resourceLDIFCreate,
+		ReadContext:   resourceLDIFRead,
+		UpdateContext: resourceLDIFUpdate,
+		DeleteContext: resourceLDIFDelete,
+
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Description: "The SHA-256 hash of the LDIF document.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"ldif": {
+				Description:      "The LDIF document to apply, as in RFC 2849.  Records without a `changetype` add objects.  Values read from URLs and per-record controls aren't supported; use `ldap_controls` instead.",
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				ValidateDiagFunc: validateLDIF,
+			},
+			"reverse_ldif": {
+				Description: "The LDIF document applied on destroy, recorded when `ldif` was applied: adds are deleted, modified attributes get back the values they had, and renames are undone, in reverse order.  Deletes and changes to write-only attributes such as `unicodePwd` can't be reversed.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"domain":        domainSchema(),
+			"ldap_controls": ldapControlsSchema(),
+		},
+	}
+}
+
+func validateLDIF(i interface{}, path cty.Path) diag.Diagnostics {
+	records, err := parseLDIF(i.(string))
+	if err != nil {
+		return diag.Errorf("invalid LDIF: %s", err)
+	}
+	if len(records) == 0 {
+		return diag.Errorf("invalid LDIF: the document has no records")
+	}
+	return nil
+}
+
+func resourceLDIFCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	ldif := d.Get("ldif").(string)
+	records, err := parseLDIF(ldif)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	reverse, warnings, err := client.ApplyLDIF(ctx, records)
+	if err != nil {
+		// Leave the directory as it was rather than half changed
+		if _, _, rollbackErr := client.ApplyLDIF(ctx, reverse); rollbackErr != nil {
+			return diag.Errorf("%s; rolling back the records already applied also failed: %s", err, rollbackErr)
+		}
+		return diag.FromErr(err)
+	}
+	for _, warning := range warnings {
+		diags = append(diags, diag.Diagnostic{Severity: diag.Warning, Summary: "Change can't be reversed", Detail: warning})
+	}
+
+	sum := sha256.Sum256([]byte(ldif))
+	d.SetId(hex.EncodeToString(sum[:]))
+	d.Set("reverse_ldif", formatLDIFRecords(reverse))
+
+	return diags
+}
+
+// resourceLDIFRead keeps the state as it is: the document may touch any
+// object, so there is nothing general to compare it with.
+func resourceLDIFRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return nil
+}
+
+// resourceLDIFUpdate has nothing to do: only ldap_controls can change in
+// place, and they apply to the reversal on destroy.
+func resourceLDIFUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return nil
+}
+
+func resourceLDIFDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	records, err := parseLDIF(d.Get("reverse_ldif").(string))
+	if err != nil {
+		return diag.Errorf("error parsing reverse_ldif: %s", err)
+	}
+
+	for _, record := range records {
+		_, _, err = client.ApplyLDIF(ctx, []ldifRecord{record})
+		// Objects already deleted outside Terraform are left alone
+		if record.ChangeType == ldifChangeDelete && IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return diag.Errorf("error reversing LDIF: %s", err)
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestAdldapParseLDIF(t *testing.T) {
+	text := "version: 1\r\n" +
+		"\r\n" +
+		"# A comment that is\r\n" +
+		"  folded\r\n" +
+		"dn: OU=New,DC=example,DC=com\r\n" +
+		"objectClass: organizationalUnit\r\n" +
+		"description:: IGxlYWRpbmc=\r\n" +
+		"\r\n" +
+		"dn: CN=Jane,OU=Staff,DC=exam\r\n" +
+		" ple,DC=com\r\n" +
+		"changetype: modify\r\n" +
+		"replace: description\r\n" +
+		"description: one\r\n" +
+		"description: two\r\n" +
+		"-\r\n" +
+		"delete: seeAlso\r\n" +
+		"-\r\n" +
+		"\r\n" +
+		"dn: CN=Old,DC=example,DC=com\r\n" +
+		"changetype: moddn\r\n" +
+		"newrdn: CN=New\r\n" +
+		"deleteoldrdn: 1\r\n"
+
+	records, err := parseLDIF(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ldifRecord{
+		{DN: "OU=New,DC=example,DC=com", ChangeType: ldifChangeAdd, Attributes: []ldifAttribute{
+			{Name: "objectClass", Values: []string{"organizationalUnit"}},
+			{Name: "description", Values: []string{" leading"}},
+		}},
+		{DN: "CN=Jane,OU=Staff,DC=example,DC=com", ChangeType: ldifChangeModify, Modifications: []ldifModification{
+			{Operation: "replace", ldifAttribute: ldifAttribute{Name: "description", Values: []string{"one", "two"}}},
+			{Operation: "delete", ldifAttribute: ldifAttribute{Name: "seeAlso"}},
+		}},
+		{DN: "CN=Old,DC=example,DC=com", ChangeType: ldifChangeModRDN, NewRDN: "CN=New", DeleteOldRDN: true},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Error parsing LDIF: got %+v", records)
+	}
+
+	// Formatted records parse back to the same records
+	reparsed, err := parseLDIF(formatLDIFRecords(records))
+	if err != nil || !reflect.DeepEqual(reparsed, expected) {
+		t.Errorf("Error formatting LDIF records: got %+v, %v", reparsed, err)
+	}
+
+	for _, invalid := range []string{
+		"objectClass: top\n",
+		"dn: CN=X,DC=example,DC=com\nchangetype: modify\nreplace: description\ndescription: x\n",
+		"dn: CN=X,DC=example,DC=com\nchangetype: modify\nreplace: description\nsn: x\n-\n",
+		"dn: CN=X,DC=example,DC=com\nchangetype: modrdn\ndeleteoldrdn: 1\n",
+		"dn: CN=X,DC=example,DC=com\nchangetype: delete\ndescription: x\n",
+		"dn: CN=X,DC=example,DC=com\njpegPhoto:< file:///photo.jpg\n",
+		"dn: CN=X,DC=example,DC=com\ncontrol: 1.2.840.113556.1.4.805 true\nchangetype: delete\n",
+		"version: 2\n\ndn: CN=X,DC=example,DC=com\nchangetype: delete\n",
+	} {
+		if _, err := parseLDIF(invalid); err == nil {
+			t.Errorf("Error rejecting invalid LDIF %q", invalid)
+		}
+	}
+}
+
+func TestAdldapResourceLDIF_fake(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceLDIF()
+	userDN := "CN=Existing,CN=Users," + fakeDomainDN
+	directory.put(userDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"existing"}, "description": {"before"}})
+	ouDN := "OU=From LDIF," + fakeDomainDN
+
+	ldif := strings.Join([]string{
+		"dn: " + ouDN,
+		"objectClass: organizationalUnit",
+		"",
+		"dn: " + userDN,
+		"changetype: modify",
+		"replace: description",
+		"description: after",
+		"-",
+		"add: seeAlso",
+		"seeAlso: " + ouDN,
+		"-",
+		"",
+		"dn: " + userDN,
+		"changetype: modrdn",
+		"newrdn: CN=Moved",
+		"deleteoldrdn: 1",
+		"newsuperior: " + ouDN,
+	}, "\n")
+	state := fakeApply(t, r, nil, map[string]interface{}{"ldif": ldif}, client)
+	movedDN := "CN=Moved," + ouDN
+	entry := directory.Entry(movedDN)
+	if directory.Entry(ouDN) == nil || entry == nil || fakeAttribute(entry, "description")[0] != "after" {
+		t.Fatalf("Error applying LDIF: got %v", entry)
+	}
+	if !strings.Contains(state.Attributes["reverse_ldif"], "changetype: delete") {
+		t.Errorf("Error recording the reverse LDIF: got\n%s", state.Attributes["reverse_ldif"])
+	}
+
+	fakeApply(t, r, state, nil, client)
+	entry = directory.Entry(userDN)
+	if directory.Entry(ouDN) != nil || entry == nil {
+		t.Fatalf("Error reversing LDIF: %s or %s left behind", ouDN, movedDN)
+	}
+	if fakeAttribute(entry, "description")[0] != "before" || fakeAttribute(entry, "seeAlso") != nil {
+		t.Errorf("Error restoring modified attributes: got %v", entry)
+	}
+
+	// A record that fails rolls back those applied before it
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"ldif": "dn: " + ouDN + "\nobjectClass: organizationalUnit\n\ndn: CN=Missing," + fakeDomainDN + "\nchangetype: delete\n",
+	})
+	if diags := resourceLDIFCreate(context.Background(), d, client); !diags.HasError() {
+		t.Fatal("Error reporting a failed record")
+	}
+	if directory.Entry(ouDN) != nil {
+		t.Errorf("Error rolling back: %s left behind", ouDN)
+	}
+}
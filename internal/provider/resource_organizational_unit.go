@@ -2,66 +2,433 @@ package provider
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
+// ouAttributes maps the OU resource's simple string arguments to their LDAP
+// attributes.
+var ouAttributes = map[string]string{
+	"description": "description",
+	"managed_by":  "managedBy",
+	"street":      "street",
+	"city":        "l",
+	"state":       "st",
+	"postal_code": "postalCode",
+	"country":     "c",
+}
+
 func resourceOrganizationalUnit() *schema.Resource {
-	return &schema.Resource{
+	r := &schema.Resource{
 		Description: "`adldap_organizational_unit` manages an OU in Active Directory.",
 
 		CreateContext: resourceOrganizationalUnitCreate,
 		ReadContext:   resourceOrganizationalUnitRead,
 		UpdateContext: resourceOrganizationalUnitUpdate,
 		DeleteContext: resourceOrganizationalUnitDelete,
+		CustomizeDiff: resourceOrganizationalUnitCustomizeDiff,
 		Importer: &schema.ResourceImporter{
 			StateContext: resourceOrganizationalUnitImport,
 		},
 
 		Schema: map[string]*schema.Schema{
 			"id": {
-				Description: "The ID (DN) of the organizational unit.",
+				Description: "The ID (objectGUID) of the organizational unit.",
 				Type:        schema.TypeString,
 				Computed:    true,
 			},
 			"distinguished_name": {
-				Description: "The full distinguished name of the organizational unit.",
-				Type:        schema.TypeString,
-				Required:    true,
+				Description:      "The full distinguished name of the organizational unit, beneath the provider search base.  Exactly one of `distinguished_name` or `name` and `parent_dn` must be specified.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				ExactlyOneOf:     []string{"distinguished_name", "name"},
+				ValidateDiagFunc: validateOUDN,
+				DiffSuppressFunc: suppressEquivalentDN,
+			},
+			"name": {
+				Description:  "The name of the organizational unit, used with `parent_dn` instead of `distinguished_name`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				RequiredWith: []string{"parent_dn"},
+			},
+			"parent_dn": {
+				Description:      "The distinguished name of the container the organizational unit is in, used with `name` instead of `distinguished_name`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				RequiredWith:     []string{"name"},
+				ValidateDiagFunc: validateDN,
+				DiffSuppressFunc: suppressEquivalentDN,
 			},
 			"create_parents": {
-				Description: "Whether to create all required parent OUs. These parent OUs will not be managed or removed automatically unless specified in another resource. Defaults to `false`.",
+				Description: "Whether to create all required parent OUs, including when the OU is moved. These parent OUs will not be managed or removed automatically unless specified in another resource. Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Default:     false,
+				Optional:    true,
+			},
+			"adopt_existing": {
+				Description: "Whether to adopt an existing organizational unit with the same distinguished name on create, converging it on the configuration, instead of failing.  The provider's `act_idempotently` enables this for all resources.  Defaults to `false`.",
 				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"restore_deleted": {
+				Description: "Whether to restore the most recently deleted organizational unit last seen at the same distinguished name from the AD Recycle Bin on create, keeping its objectGUID and linked group policies, and converge it on the configuration as if adopted.  Only the OU itself is restored, not its deleted children.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"protect_from_accidental_deletion": {
+				Description: "Whether to deny Everyone the right to delete the organizational unit or its subtree, as the ADUC \"Protect object from accidental deletion\" checkbox does.  The protection is lifted automatically when the resource is destroyed.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
 				Default:     false,
+			},
+			"manage_parents": {
+				Description: "Like `create_parents`, but parent OUs created by this resource are recorded in `created_parents` and deleted, if empty, when it is destroyed.  Parent OUs shared with other resources are only recorded by the resource that created them.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Default:     false,
+				Optional:    true,
+			},
+			"created_parents": {
+				Description: "The parent OUs created by this resource when `manage_parents` is set, from the top down.",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"delete_recursively": {
+				Description: "Whether destroying the organizational unit also deletes any objects it still contains.  Otherwise destroying a non-empty OU fails.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"gp_link": {
+				Description: "Group Policy objects linked to the organizational unit, in link order.  Links to other GPOs, such as those managed in GPMC, are preserved with lower precedence and not reported.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"gpo_guid": {
+							Description:      "The GUID of the linked GPO.",
+							Type:             schema.TypeString,
+							Required:         true,
+							ValidateDiagFunc: validateGUID,
+							DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+								return normalizeGPOGUID(old) == normalizeGPOGUID(new)
+							},
+						},
+						"enforced": {
+							Description: "Whether the link is enforced.  Defaults to `false`.",
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+						},
+						"enabled": {
+							Description: "Whether the link is enabled.  Defaults to `true`.",
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     true,
+						},
+					},
+				},
+			},
+			"object_guid": {
+				Description: "The objectGUID of the organizational unit.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"canonical_name": {
+				Description: "The canonical name of the organizational unit, such as `example.com/Corp/Servers`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"description": {
+				Description: "Description of the organizational unit.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"managed_by": {
+				Description:      "Distinguished name of the user or group that manages the organizational unit (`managedBy`).",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateDN,
+				DiffSuppressFunc: suppressEquivalentDN,
+			},
+			"street": {
+				Description: "Street address of the organizational unit.",
+				Type:        schema.TypeString,
 				Optional:    true,
 			},
+			"city": {
+				Description: "City of the organizational unit (`l`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"state": {
+				Description: "State or province of the organizational unit (`st`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"postal_code": {
+				Description: "Postal code of the organizational unit.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"country": {
+				Description:      "Two-letter ISO 3166 country code of the organizational unit (`c`).",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringLenBetween(2, 2)),
+			},
+			"domain":            domainSchema(),
+			"ignore_attributes": ignoreAttributesSchema(),
+			"ldap_controls":     ldapControlsSchema(),
+		},
+	}
+
+	r.SchemaVersion = 1
+	r.StateUpgraders = []schema.StateUpgrader{
+		{
+			Version: 0,
+			Type:    resourceOrganizationalUnitV0().CoreConfigSchema().ImpliedType(),
+			Upgrade: resourceOrganizationalUnitStateUpgradeV0,
+		},
+	}
+
+	return r
+}
+
+// resourceOrganizationalUnitV0 is the OU schema at version 0, when the ID
+// was the DN, frozen for its state upgrader.
+func resourceOrganizationalUnitV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"distinguished_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"parent_dn": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"create_parents": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"protect_from_accidental_deletion": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"manage_parents": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"created_parents": {
+				Type:     schema.TypeList,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Computed: true,
+			},
+			"delete_recursively": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"gp_link": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"gpo_guid": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"enforced": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"enabled": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"object_guid": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"canonical_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"managed_by": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"street": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"city": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"state": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"postal_code": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"country": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
 		},
 	}
 }
 
+// resourceOrganizationalUnitStateUpgradeV0 replaces the DN ID of version 0
+// states with the objectGUID.  OUs that can't be found keep their ID for Read
+// to resolve or remove; other errors fail the upgrade.
+func resourceOrganizationalUnitStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	client, ok := meta.(*LdapClient)
+	id, _ := rawState["id"].(string)
+	if !ok || client == nil || id == "" {
+		return rawState, nil
+	}
+
+	ou, err := client.GetOUByIdentifier(ctx, id, []string{"objectGUID"})
+	if IsNotFound(err) {
+		return rawState, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	objectGUID, err := ou.GetObjectGUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rawState["id"] = objectGUID
+	rawState["object_guid"] = objectGUID
+
+	return rawState, nil
+}
+
 func resourceOrganizationalUnitCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	client := meta.(*LdapClient)
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	dn := d.Get("distinguished_name").(string)
-	createParents :=  d.Get("create_parents").(bool)
+	createParents := d.Get("create_parents").(bool)
+
+	attributesMap := make(map[string][]string)
+	for key, attribute := range ouAttributes {
+		value := d.Get(key).(string)
+		if value != "" {
+			attributesMap[attribute] = []string{value}
+		}
+	}
+
+	ou, err := client.GetOUWithAttributes(ctx, dn, ouAttributeNames())
+	exists := err == nil
+	if err != nil && !IsNotFound(err) {
+		return diag.FromErr(err)
+	}
+
+	restored := false
+	if !exists && d.Get("restore_deleted").(bool) {
+		restored, err = client.RestoreDeletedOU(ctx, dn)
+		if err != nil {
+			return diag.Errorf("error restoring deleted organizational unit %s: %s", dn, err)
+		}
+	}
+	if restored {
+		ou, err = client.GetOUWithAttributes(ctx, dn, ouAttributeNames())
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
-	if createParents {
-		_, err := client.CreateOUAndParents(dn)
+	createdParents := []string{}
+	if restored || (exists && (d.Get("adopt_existing").(bool) || client.ActIdempotently)) {
+		err = adoptOrganizationalUnit(ctx, d, ou, attributesMap)
+	} else if d.Get("manage_parents").(bool) {
+		createdParents, err = client.CreateParentOUs(ctx, dn)
+		if err == nil {
+			ou, err = client.CreateOU(ctx, dn, attributesMap)
+		}
+		// Nothing records the parents unless the OU is created, so remove them
 		if err != nil {
+			parents := make([]interface{}, len(createdParents))
+			for i, parent := range createdParents {
+				parents[i] = parent
+			}
+			if cleanupErr := deleteCreatedParentOUs(ctx, client, parents); cleanupErr != nil {
+				return diag.Errorf("%s; deleting the parent organizational units created for it also failed: %s", err, cleanupErr)
+			}
 			return diag.FromErr(err)
 		}
+	} else if createParents {
+		ou, err = client.CreateOUAndParents(ctx, dn, attributesMap)
 	} else {
-		_, err := client.CreateOU(dn)
+		ou, err = client.CreateOU(ctx, dn, attributesMap)
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.Set("created_parents", createdParents)
+
+	if d.Get("protect_from_accidental_deletion").(bool) {
+		err = ou.SetProtectedFromDeletion(ctx, true)
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	}
 
-	d.SetId(dn)
+	if len(d.Get("gp_link").([]interface{})) > 0 {
+		err = updateOrganizationalUnitGPLinks(ctx, d, client, ou)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	err = setOrganizationalUnitIdentity(ctx, d, ou)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(d.Get("object_guid").(string))
 	d.Set("distinguished_name", dn)
+	err = setOrganizationalUnitName(d, dn)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	return diags
 }
@@ -69,22 +436,68 @@ func resourceOrganizationalUnitCreate(ctx context.Context, d *schema.ResourceDat
 func resourceOrganizationalUnitRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	client := meta.(*LdapClient)
+	client, err := domainClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer keepIgnoredAttributes(d, ouAttributes, nil)()
+
+	// The ID is the objectGUID; states the upgrader couldn't resolve may still
+	// hold the DN and are migrated here
+	var ou *LdapOU
+	err = awaitReplication(ctx, client, d.Id(), func() error {
+		var err error
+		ou, err = client.GetOUByIdentifier(ctx, d.Id(), ouAttributeNames())
+		return err
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			diags = append(diags, deletedObjectDiagnostics(ctx, client, "Organizational unit", d.Id())...)
+			d.SetId("")
+			return diags
+		}
+		return diag.FromErr(err)
+	}
 
-	dn := d.Id()
-	exists, err := client.ObjectExists(dn, "organizationalUnit")
+	// Lookup by objectGUID finds the OU even after it was renamed or moved
+	// outside Terraform, so report that as drift rather than a deletion
+	if priorDN := d.Get("distinguished_name").(string); priorDN != "" && !dnsEqual(priorDN, ou.DN) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Organizational unit renamed or moved outside Terraform",
+			Detail:   fmt.Sprintf("Organizational unit %s is now %s.  It will be moved back unless the configuration is updated to match.", priorDN, ou.DN),
+		})
+	}
+	setDN(d, "distinguished_name", ou.DN)
+	err = setOrganizationalUnitName(d, ou.DN)
 	if err != nil {
 		return diag.FromErr(err)
 	}
+	for key, attribute := range ouAttributes {
+		value, _ := ou.GetAttributeValue(ctx, attribute)
+		if key == "managed_by" {
+			setDN(d, key, value)
+		} else {
+			d.Set(key, value)
+		}
+	}
 
-	if exists {
-		d.SetId(dn)
-		d.Set("distinguished_name", dn)
-		d.Set("create_parents", false)
-	} else {
-		d.SetId("")
-		return nil
+	gpLinks, err := organizationalUnitGPLinks(ctx, d, ou)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("gp_link", gpLinks)
+
+	protectedFromDeletion, err := ou.IsProtectedFromDeletion(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	err = setOrganizationalUnitIdentity(ctx, d, ou)
+	if err != nil {
+		return diag.FromErr(err)
 	}
+	d.Set("protect_from_accidental_deletion", protectedFromDeletion)
+	d.SetId(d.Get("object_guid").(string))
 
 	return diags
 }
@@ -92,23 +505,70 @@ func resourceOrganizationalUnitRead(ctx context.Context, d *schema.ResourceData,
 func resourceOrganizationalUnitUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	client := meta.(*LdapClient)
-	dn := d.Id()
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	ou, err := client.GetOUByIdentifier(ctx, d.Id(), ouAttributeNames())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The deny-delete ACE also blocks moves and renames, so lift it first and
+	// reapply it once everything else is done
+	protectionChanging := d.HasChanges("protect_from_accidental_deletion", "distinguished_name")
+	if protectionChanging {
+		err = ou.SetProtectedFromDeletion(ctx, false)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	attributeMap := map[string][]string{}
+	for key, attribute := range ouAttributes {
+		if d.HasChange(key) {
+			attributeMap[attribute] = []string{}
+			if value := d.Get(key).(string); value != "" {
+				attributeMap[attribute] = []string{value}
+			}
+		}
+	}
+	err = ou.UpdateAttributes(ctx, attributeMap)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if d.HasChange("gp_link") {
+		err = updateOrganizationalUnitGPLinks(ctx, d, client, ou)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
 	if d.HasChange("distinguished_name") {
 		_, newDN := d.GetChange("distinguished_name")
 
-		ou, err := client.GetOU(dn)
+		err = ou.Relocate(ctx, newDN.(string), d.Get("create_parents").(bool))
 		if err != nil {
 			return diag.FromErr(err)
 		}
 
-		err = ou.Rename(newDN.(string))
+		err = ou.Refresh(ctx)
 		if err != nil {
 			return diag.FromErr(err)
 		}
+		err = setOrganizationalUnitIdentity(ctx, d, ou)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
-		d.SetId(newDN.(string))
+	if protectionChanging && d.Get("protect_from_accidental_deletion").(bool) {
+		err = ou.SetProtectedFromDeletion(ctx, true)
+		if err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
 	return diags
@@ -117,39 +577,290 @@ func resourceOrganizationalUnitUpdate(ctx context.Context, d *schema.ResourceDat
 func resourceOrganizationalUnitDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	client := meta.(*LdapClient)
-	ouDN := d.Get("distinguished_name").(string)
-
-	ou, err := client.GetOU(ouDN)
+	client, err := resourceClient(ctx, d, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	err = ou.Delete()
-	if err != nil {
+	ou, err := client.GetOUByIdentifier(ctx, d.Id(), ouAttributeNames())
+	if err != nil && !IsNotFound(err) {
 		return diag.FromErr(err)
 	}
 
+	// An OU deleted outside Terraform only leaves its created parents to clean up
+	if err == nil {
+		// Only lift protection this resource manages; a deny-delete ACE added
+		// outside Terraform still blocks the destroy
+		if d.Get("protect_from_accidental_deletion").(bool) {
+			err = ou.SetProtectedFromDeletion(ctx, false)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		if d.Get("delete_recursively").(bool) {
+			err = ou.DeleteRecursively(ctx)
+		} else {
+			err = ou.Delete(ctx)
+		}
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.Get("manage_parents").(bool) {
+		err = deleteCreatedParentOUs(ctx, client, d.Get("created_parents").([]interface{}))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	return diags
 }
 
 func resourceOrganizationalUnitImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	client, err := importDomain(ctx, d, meta)
+	if err != nil {
+		return nil, err
+	}
 
-	client := meta.(*LdapClient)
-
-	dn := d.Id()
-	exists, err := client.ObjectExists(dn, "organizationalUnit")
+	// Accept a DN or objectGUID, and use the objectGUID as the resource ID
+	ou, err := client.GetOUByIdentifier(ctx, d.Id(), []string{"objectGUID"})
+	if err != nil {
+		return nil, err
+	}
+	objectGUID, err := ou.GetObjectGUID(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if exists {
-		d.SetId(dn)
-		d.Set("distinguished_name", dn)
-		d.Set("create_parents", false)
-	} else {
+	d.SetId(objectGUID)
+
+	return importResource(ctx, d, meta, resourceOrganizationalUnit())
+}
+
+// resourceOrganizationalUnitCustomizeDiff keeps distinguished_name and the
+// name and parent_dn pair in step, whichever of them is configured.
+func resourceOrganizationalUnitCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	config := d.GetRawConfig()
+
+	if !config.GetAttr("name").IsNull() {
+		if !config.GetAttr("name").IsKnown() || !config.GetAttr("parent_dn").IsKnown() {
+			err := d.SetNewComputed("distinguished_name")
+			if err != nil {
+				return err
+			}
+			return d.SetNewComputed("canonical_name")
+		}
+		dn := fmt.Sprintf("OU=%s,%s", escapeRDNValue(d.Get("name").(string)), d.Get("parent_dn").(string))
+		if !dnsEqual(dn, d.Get("distinguished_name").(string)) {
+			err := validateOUSearchBase(ctx, d, meta, dn)
+			if err != nil {
+				return err
+			}
+			err = d.SetNew("distinguished_name", dn)
+			if err != nil {
+				return err
+			}
+			return d.SetNewComputed("canonical_name")
+		}
+		return nil
+	}
+
+	if !config.GetAttr("distinguished_name").IsKnown() {
+		for _, key := range []string{"name", "parent_dn", "canonical_name"} {
+			err := d.SetNewComputed(key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if d.HasChange("distinguished_name") {
+		err := validateOUSearchBase(ctx, d, meta, d.Get("distinguished_name").(string))
+		if err != nil {
+			return err
+		}
+		dn, err := NewLdapDN(d.Get("distinguished_name").(string))
+		if err != nil {
+			return err
+		}
+		err = d.SetNew("name", dn.Name())
+		if err != nil {
+			return err
+		}
+		err = d.SetNew("parent_dn", dn.ParentDN())
+		if err != nil {
+			return err
+		}
+		return d.SetNewComputed("canonical_name")
+	}
+
+	return nil
+}
+
+// validateOUSearchBase checks at plan time that an OU will be created within
+// the search base of its domain, where CreateOU requires it.
+func validateOUSearchBase(ctx context.Context, d *schema.ResourceDiff, meta interface{}, dn string) error {
+	client, err := diffDomainClient(ctx, d, meta)
+	if err != nil {
+		return err
+	}
+	if client == nil || client.SearchBase == "" {
+		return nil
+	}
+	if !dnIsDescendant(dn, client.SearchBase) {
+		return fmt.Errorf("organizational unit \"%s\" is not beneath search base \"%s\"", dn, client.SearchBase)
+	}
+	return nil
+}
+
+func setOrganizationalUnitIdentity(ctx context.Context, d *schema.ResourceData, ou *LdapOU) error {
+	objectGUID, err := ou.GetObjectGUID(ctx)
+	if err != nil {
+		return err
+	}
+	canonicalName, err := ou.GetAttributeValue(ctx, "canonicalName")
+	if err != nil {
+		return err
+	}
+
+	d.Set("object_guid", objectGUID)
+	d.Set("canonical_name", canonicalName)
+
+	return nil
+}
+
+func setOrganizationalUnitName(d *schema.ResourceData, distinguishedName string) error {
+	dn, err := NewLdapDN(distinguishedName)
+	if err != nil {
+		return err
+	}
+	d.Set("name", dn.Name())
+	setDN(d, "parent_dn", dn.ParentDN())
+
+	return nil
+}
+
+// organizationalUnitGPLinks returns the links to GPOs managed by the resource,
+// in link order.
+func organizationalUnitGPLinks(ctx context.Context, d *schema.ResourceData, ou *LdapOU) ([]interface{}, error) {
+	managed := map[string]bool{}
+	for _, link := range d.Get("gp_link").([]interface{}) {
+		managed[normalizeGPOGUID(link.(map[string]interface{})["gpo_guid"].(string))] = true
+	}
+
+	value, err := ou.GetAttributeValue(ctx, "gPLink")
+	if err != nil {
 		return nil, err
 	}
+	links, err := parseGPLink(value)
+	if err != nil {
+		return nil, err
+	}
+
+	gpLinks := []interface{}{}
+	for i := len(links) - 1; i >= 0; i-- {
+		if managed[links[i].GUID()] {
+			gpLinks = append(gpLinks, map[string]interface{}{
+				"gpo_guid": links[i].GUID(),
+				"enforced": links[i].Options&gpLinkEnforced != 0,
+				"enabled":  links[i].Options&gpLinkDisabled == 0,
+			})
+		}
+	}
+
+	return gpLinks, nil
+}
+
+func updateOrganizationalUnitGPLinks(ctx context.Context, d *schema.ResourceData, client *LdapClient, ou *LdapOU) error {
+	domainDN, err := client.DefaultNamingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	oldLinks, newLinks := d.GetChange("gp_link")
+	managed := map[string]bool{}
+	for _, link := range oldLinks.([]interface{}) {
+		managed[normalizeGPOGUID(link.(map[string]interface{})["gpo_guid"].(string))] = true
+	}
+	var desired []gpLink
+	for _, link := range newLinks.([]interface{}) {
+		l := link.(map[string]interface{})
+		guid := normalizeGPOGUID(l["gpo_guid"].(string))
+		managed[guid] = true
+
+		options := 0
+		if !l["enabled"].(bool) {
+			options |= gpLinkDisabled
+		}
+		if l["enforced"].(bool) {
+			options |= gpLinkEnforced
+		}
+		desired = append(desired, gpLink{DN: gpoDN(guid, domainDN), Options: options})
+	}
+
+	value, err := ou.GetAttributeValue(ctx, "gPLink")
+	if err != nil {
+		return err
+	}
+	existing, err := parseGPLink(value)
+	if err != nil {
+		return err
+	}
+
+	merged := mergeGPLinks(existing, managed, desired)
+	if len(merged) == 0 {
+		return ou.UpdateAttribute(ctx, "gPLink", []string{})
+	}
+	return ou.UpdateAttribute(ctx, "gPLink", []string{formatGPLink(merged)})
+}
 
-	return []*schema.ResourceData{d}, nil
+// deleteCreatedParentOUs deletes the recorded parent OUs from the bottom up,
+// stopping at the first that still contains other objects.
+func deleteCreatedParentOUs(ctx context.Context, client *LdapClient, createdParents []interface{}) error {
+	for i := len(createdParents) - 1; i >= 0; i-- {
+		parentDN := createdParents[i].(string)
+		parent, err := client.GetOU(ctx, parentDN)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		isEmpty, err := parent.IsEmpty(ctx)
+		if err != nil {
+			return err
+		}
+		if !isEmpty {
+			return nil
+		}
+		err = parent.Delete(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// adoptOrganizationalUnit converges an existing OU, read with
+// ouAttributeNames, on the configured attributes instead of creating it.
+func adoptOrganizationalUnit(ctx context.Context, d *schema.ResourceData, ou *LdapOU, attributes map[string][]string) error {
+	// Clear the attributes that aren't configured
+	for _, attribute := range ouAttributes {
+		if _, ok := attributes[attribute]; !ok && !isIgnoredAttribute(d, attribute) {
+			attributes[attribute] = []string{}
+		}
+	}
+
+	return ou.UpdateAttributes(ctx, attributes)
+}
+
+func ouAttributeNames() []string {
+	names := []string{"objectGUID", "canonicalName", "gPLink", "nTSecurityDescriptor"}
+	for _, attribute := range ouAttributes {
+		names = append(names, attribute)
+	}
+	return names
 }
@@ -1,6 +1,8 @@
 package provider
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -11,11 +13,32 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
+// testOUPrefix begins the name of every OU the acceptance tests create.
+const testOUPrefix = "Terraform Acceptance Test"
+
+func init() {
+	resource.AddTestSweepers("adldap_organizational_unit", &resource.Sweeper{
+		Name:         "adldap_organizational_unit",
+		Dependencies: []string{"adldap_user", "adldap_computer"},
+		F: func(region string) error {
+			filter := fmt.Sprintf("(&(objectClass=organizationalUnit)(ou=%s*))", ldap.EscapeFilter(testOUPrefix))
+			return testSweepEntries(filter, func(ctx context.Context, entry *LdapEntry) error {
+				err := entry.SetProtectedFromDeletion(ctx, false)
+				if err != nil {
+					return err
+				}
+				ou := &LdapOU{LdapEntry: entry}
+				return ou.DeleteRecursively(ctx)
+			})
+		},
+	})
+}
+
 func TestAccAdldapResourceOrganizationalUnit(t *testing.T) {
 	rInt := rand.New(rand.NewSource(time.Now().UnixNano())).Int()
 	searchBase := testAccProviderMeta.SearchBase
-	testOU := fmt.Sprintf("OU=Terraform Acceptance Test %d,%s", rInt, searchBase)
-	testOU2 := fmt.Sprintf("OU=Terraform Acceptance Test %d-step2,%s", rInt, searchBase)
+	testOU := fmt.Sprintf("OU=%s %d,%s", testOUPrefix, rInt, searchBase)
+	testOU2 := fmt.Sprintf("OU=%s %d-step2,%s", testOUPrefix, rInt, searchBase)
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:  func() { testAccPreCheck(t) },
@@ -26,6 +49,7 @@ func TestAccAdldapResourceOrganizationalUnit(t *testing.T) {
 				Check: resource.ComposeTestCheckFunc(
 					testAccAdldapCheckOrganizationalUnitExists("adldap_organizational_unit.testou"),
 					resource.TestCheckResourceAttr("adldap_organizational_unit.testou", "distinguished_name", testOU),
+					resource.TestCheckResourceAttr("adldap_organizational_unit.testou", "description", "Terraform acceptance test"),
 				),
 			},
 			{
@@ -55,7 +79,7 @@ func TestAccAdldapOuExists(t *testing.T) {
 		},
 	}
 	for _, c := range cases {
-		got, err := testAccProviderMeta.ObjectExists(c.ou, "organizationalUnit")
+		got, err := testAccProviderMeta.ObjectExists(context.Background(), c.ou, "organizationalUnit")
 		if err != nil {
 			t.Error(err)
 		}
@@ -72,6 +96,7 @@ func testAccAdldapOrganizationalUnit(ou string) string {
 resource "adldap_organizational_unit" "testou" {
   distinguished_name = "%s"
   create_parents = true
+  description = "Terraform acceptance test"
 }`, ou)
 }
 
@@ -113,7 +138,7 @@ func testAccAdldapCheckOrganizationalUnitExists(resourceName string) resource.Te
 
 func testAccAdldapOrganizationalUnitDestroyed(ou string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		exists, err := testAccProviderMeta.ObjectExists(ou, "organizationalUnit")
+		exists, err := testAccProviderMeta.ObjectExists(context.Background(), ou, "organizationalUnit")
 		if err != nil {
 			return err
 		}
@@ -123,3 +148,154 @@ func testAccAdldapOrganizationalUnitDestroyed(ou string) resource.TestCheckFunc
 		return nil
 	}
 }
+
+func TestAdldapResourceOrganizationalUnit_fake(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceOrganizationalUnit()
+	ouDN := "OU=Servers,OU=Fake Parent," + fakeDomainDN
+
+	state := fakeApply(t, r, nil, map[string]interface{}{
+		"distinguished_name":               ouDN,
+		"manage_parents":                   true,
+		"protect_from_accidental_deletion": true,
+	}, client)
+	if directory.Entry(ouDN) == nil {
+		t.Fatalf("Error creating OU: %s not found", ouDN)
+	}
+	if state.Attributes["created_parents.#"] != "1" || !dnsEqual(state.Attributes["created_parents.0"], "OU=Fake Parent,"+fakeDomainDN) {
+		t.Errorf("Error recording created parents: got %v", state.Attributes)
+	}
+	ou, err := client.GetOU(context.Background(), ouDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected, err := ou.IsProtectedFromDeletion(context.Background())
+	if err != nil || !protected {
+		t.Errorf("Error protecting OU from deletion: got %t, %v", protected, err)
+	}
+
+	renamedDN := "OU=Renamed,OU=Fake Parent," + fakeDomainDN
+	state = fakeApply(t, r, state, map[string]interface{}{
+		"distinguished_name":               renamedDN,
+		"manage_parents":                   true,
+		"protect_from_accidental_deletion": true,
+	}, client)
+	searches := directory.Searches()
+	state = fakeRefresh(t, r, state, client)
+	if !dnsEqual(state.Attributes["distinguished_name"], renamedDN) || directory.Entry(ouDN) != nil {
+		t.Errorf("Error renaming OU: got %s", state.Attributes["distinguished_name"])
+	}
+	if got := directory.Searches() - searches; got != 1 {
+		t.Errorf("Error reading the OU in one search: got %d search requests", got)
+	}
+	if state.Attributes["protect_from_accidental_deletion"] != "true" {
+		t.Errorf("Error reading protection from the OU's search: got %v", state.Attributes)
+	}
+
+	fakeApply(t, r, state, nil, client)
+	if directory.Entry(renamedDN) != nil || directory.Entry("OU=Fake Parent,"+fakeDomainDN) != nil {
+		t.Errorf("Error destroying OU and its created parents")
+	}
+}
+
+// refusingAddConn refuses to add one DN, as AD does when the bind account
+// may create the parent OUs but not the OU itself.
+type refusingAddConn struct {
+	ldap.Client
+	dn string
+}
+
+func (r *refusingAddConn) Add(request *ldap.AddRequest) error {
+	if dnsEqual(request.DN, r.dn) {
+		return ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("00000005: SecErr: DSID-03152E29, problem 4003 (INSUFF_ACCESS_RIGHTS), data 0"))
+	}
+	return r.Client.Add(request)
+}
+
+func TestAdldapResourceOrganizationalUnit_failedCreateParents(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceOrganizationalUnit()
+	ouDN := "OU=Servers,OU=Site,OU=Region," + fakeDomainDN
+	client.Conn = &refusingAddConn{Client: client.Conn, dn: ouDN}
+
+	_, diags := fakeTryApply(t, r, nil, map[string]interface{}{
+		"distinguished_name": ouDN,
+		"manage_parents":     true,
+	}, client)
+	if !diags.HasError() {
+		t.Fatal("Error creating a refused OU: expected an error")
+	}
+	for _, parentDN := range []string{"OU=Site,OU=Region," + fakeDomainDN, "OU=Region," + fakeDomainDN} {
+		if directory.Entry(parentDN) != nil {
+			t.Errorf("Error removing the parent %s created for a refused OU", parentDN)
+		}
+	}
+}
+
+func TestAdldapResourceOrganizationalUnit_import(t *testing.T) {
+	client, _ := newFakeClient(t)
+	r := resourceOrganizationalUnit()
+	ctx := context.Background()
+	ouDN := "OU=Imported," + fakeDomainDN
+
+	if _, err := client.CreateOU(ctx, ouDN, map[string][]string{"description": {"Created outside Terraform"}, "l": {"Mumbai"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := r.Importer.StateContext(ctx, r.Data(&terraform.InstanceState{ID: ouDN}), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := imported[0].State().Attributes
+	expected := map[string]string{
+		"name":               "Imported",
+		"description":        "Created outside Terraform",
+		"city":               "Mumbai",
+		"create_parents":     "false",
+		"manage_parents":     "false",
+		"delete_recursively": "false",
+		"adopt_existing":     "false",
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("Error importing %s: got %q, expected %q", key, attributes[key], value)
+		}
+	}
+	if !dnsEqual(attributes["distinguished_name"], ouDN) {
+		t.Errorf("Error importing distinguished_name: got %q", attributes["distinguished_name"])
+	}
+}
+
+func TestAdldapResourceOrganizationalUnitStateUpgradeV0(t *testing.T) {
+	client, directory := newFakeClient(t)
+	ctx := context.Background()
+	ouDN := "OU=Upgraded," + fakeDomainDN
+	ou, err := client.CreateOU(ctx, ouDN, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectGUID, err := ou.GetObjectGUID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 0 states were keyed by DN
+	got, err := resourceOrganizationalUnitStateUpgradeV0(ctx, map[string]interface{}{"id": ouDN, "distinguished_name": ouDN}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["id"] != objectGUID || got["object_guid"] != objectGUID {
+		t.Errorf("Error upgrading a DN ID: got %v, expected %s", got, objectGUID)
+	}
+
+	missingDN := "OU=Gone," + fakeDomainDN
+	got, err = resourceOrganizationalUnitStateUpgradeV0(ctx, map[string]interface{}{"id": missingDN}, client)
+	if err != nil || got["id"] != missingDN {
+		t.Errorf("Error keeping the ID of a missing OU: got %v, %v", got, err)
+	}
+
+	client.Conn = &unavailableConn{Client: directory}
+	if _, err := resourceOrganizationalUnitStateUpgradeV0(ctx, map[string]interface{}{"id": ouDN}, client); err == nil {
+		t.Error("Error failing the upgrade when the directory can't be searched: got no error")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/go-ldap/ldap/v3"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -12,50 +13,91 @@ import (
 func resourceServicePrincipal() *schema.Resource {
 	return &schema.Resource{
 		// This description is used by the documentation generator and the language server.
-		Description: "`adldap_service_principal` manages an SPN attached to a user in Active Directory.",
+		Description: "`adldap_service_principal` manages an SPN, or authoritatively all SPNs, attached to an account in Active Directory.",
 
 		CreateContext: resourceServicePrincipalCreate,
 		ReadContext:   resourceServicePrincipalRead,
+		UpdateContext: resourceServicePrincipalUpdate,
 		DeleteContext: resourceServicePrincipalDelete,
+		CustomizeDiff: resourceServicePrincipalCustomizeDiff,
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceServicePrincipalImport,
 		},
 
 		Schema: map[string]*schema.Schema{
 			"id": {
-				Description: "The ID of the SPN in {spn}---{samaccountname} format.",
+				Description: "The ID of the SPN in {spn}---{samaccountname} format, or the samaccountname when `spns` is used.",
 				Type:        schema.TypeString,
 				Computed:    true,
 			},
 			"samaccountname": {
-				Description: "The account on which to attach the service principal.",
+				Description: "The user, computer or group managed service account on which to attach the service principal.  The trailing `$` of computer and managed service account names may be omitted.",
 				Type:        schema.TypeString,
 				Required:    true,
-				ForceNew:    true,
 			},
 			"spn": {
-				Description: "The service principal name, usually in `{service}/{fqdn}` format",
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
+				Description:  "The service principal name, usually in `{service}/{fqdn}` format.  Exactly one of `spn` or `spns` must be specified.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ExactlyOneOf: []string{"spn", "spns"},
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					return strings.EqualFold(old, new)
+				},
 			},
+			"spns": {
+				Description: "The complete set of service principal names for the account.  SPNs added outside Terraform are removed, and an empty set clears them all.",
+				Type:        schema.TypeSet,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Set:         hashCaseInsensitive,
+				Optional:    true,
+			},
+			"domain":        domainSchema(),
+			"ldap_controls": ldapControlsSchema(),
 		},
 	}
 }
 
+// servicePrincipalAccount looks up the user, computer or managed service
+// account to attach SPNs to.  The trailing "$" of computer and managed service
+// account names may be omitted.
+func servicePrincipalAccount(ctx context.Context, client *LdapClient, sAMAccountName string) (*LdapAccount, error) {
+	account, err := client.GetAccountBySAMAccountName(ctx, sAMAccountName, objectClassUser, []string{"servicePrincipalName"})
+	if err != nil && !strings.HasSuffix(sAMAccountName, "$") {
+		if computer, computerErr := client.GetAccountBySAMAccountName(ctx, sAMAccountName+"$", objectClassComputer, []string{"servicePrincipalName"}); computerErr == nil {
+			return computer, nil
+		}
+	}
+	return account, err
+}
+
 func resourceServicePrincipalCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	client := meta.(*LdapClient)
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	spn := d.Get("spn").(string)
 	sAMAccountName := d.Get("samaccountname").(string)
 
-	account, err := client.GetAccountBySAMAccountName(sAMAccountName, nil)
+	account, err := servicePrincipalAccount(ctx, client, sAMAccountName)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	err = account.AddServicePrincipal(spn)
+	// GetOk treats an empty set as unset, but spns = [] clears the account's SPNs
+	if !d.GetRawConfig().GetAttr("spns").IsNull() {
+		err = account.UpdateAttribute(ctx, "servicePrincipalName", setToStingArray(d.Get("spns").(*schema.Set)))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		d.SetId(sAMAccountName)
+		return diags
+	}
+
+	err = account.AddServicePrincipal(ctx, spn)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -70,7 +112,30 @@ func resourceServicePrincipalCreate(ctx context.Context, d *schema.ResourceData,
 func resourceServicePrincipalRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	client := meta.(*LdapClient)
+	client, err := domainClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Authoritative resources are identified by the account alone
+	if !strings.Contains(d.Id(), "---") {
+		account, err := servicePrincipalAccount(ctx, client, d.Id())
+		if err != nil {
+			if IsNotFound(err) {
+				d.SetId("")
+				return nil
+			}
+			return diag.FromErr(err)
+		}
+		spns, err := account.GetServicePrincipals(ctx)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		d.Set("samaccountname", d.Id())
+		d.Set("spns", spns)
+		return diags
+	}
 
 	spnStrings := strings.Split(d.Id(), "---")
 	if len(spnStrings) != 2 {
@@ -82,43 +147,295 @@ func resourceServicePrincipalRead(ctx context.Context, d *schema.ResourceData, m
 
 	id := fmt.Sprintf("%s---%s", spn, sAMAccountName)
 
-	account, err := client.GetAccountBySAMAccountName(sAMAccountName, []string{"servicePrincipalName"})
+	account, err := servicePrincipalAccount(ctx, client, sAMAccountName)
 	if err != nil {
+		if IsNotFound(err) {
+			d.SetId("")
+			return nil
+		}
 		return diag.FromErr(err)
 	}
 
-	exists, err := account.HasServicePrincipal(spn)
+	exists, err := account.HasServicePrincipal(ctx, spn)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	if exists {
-		d.SetId(id)
-		d.Set("spn", spn)
-		d.Set("samaccountname", sAMAccountName)
-	} else {
-		return diag.Errorf("SPN \"%s\" does not exist.  Unable to import.", spn)
+	// Import reports the missing SPN when the ID is cleared
+	if !exists {
+		d.SetId("")
+		return nil
 	}
 
+	d.SetId(id)
+	d.Set("spn", spn)
+	d.Set("samaccountname", sAMAccountName)
+
 	return diags
 }
 
-func resourceServicePrincipalDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+func resourceServicePrincipalImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	client, err := importDomain(ctx, d, meta)
+	if err != nil {
+		return nil, err
+	}
+	id := d.Id()
+
+	// A sAMAccountName can't contain "/", so anything else is a bare SPN whose
+	// owning account has to be looked up to build the ID
+	if strings.Contains(id, "---") || !strings.Contains(id, "/") {
+		return []*schema.ResourceData{d}, nil
+	}
+
+	account, err := client.GetAccountByServicePrincipal(ctx, id, []string{"sAMAccountName", "servicePrincipalName"})
+	if err != nil {
+		return nil, err
+	}
+	sAMAccountName, err := account.GetAttributeValue(ctx, "sAMAccountName")
+	if err != nil {
+		return nil, err
+	}
+	// Keep the SPN as stored, since the lookup is case-insensitive
+	spn, err := account.findServicePrincipal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if spn == "" {
+		spn = id
+	}
+	d.SetId(fmt.Sprintf("%s---%s", spn, sAMAccountName))
+
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceServicePrincipalUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	client := meta.(*LdapClient)
-	spn := d.Get("spn").(string)
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	sAMAccountName := d.Get("samaccountname").(string)
 
-	account, err := client.GetAccountBySAMAccountName(sAMAccountName, nil)
+	if d.HasChange("samaccountname") {
+		oldSAMAccountName, _ := d.GetChange("samaccountname")
+		oldSPNs, _ := d.GetChange("spns")
+
+		from, err := servicePrincipalAccount(ctx, client, oldSAMAccountName.(string))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		to, err := servicePrincipalAccount(ctx, client, sAMAccountName)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		// The names may differ only by the trailing "$" of the same account
+		if !dnsEqual(from.DN, to.DN) {
+			remove := []string{d.Get("spn").(string)}
+			add := remove
+			if !strings.Contains(d.Id(), "---") {
+				remove = setToStingArray(oldSPNs.(*schema.Set))
+				add = setToStingArray(d.Get("spns").(*schema.Set))
+			}
+			err = moveServicePrincipals(ctx, from, to, remove, add)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		if strings.Contains(d.Id(), "---") {
+			d.SetId(fmt.Sprintf("%s---%s", d.Get("spn").(string), sAMAccountName))
+		} else {
+			d.SetId(sAMAccountName)
+		}
+	}
+
+	// Authoritative SPNs also replace any the new account already had
+	if !strings.Contains(d.Id(), "---") && (d.HasChange("spns") || d.HasChange("samaccountname")) {
+		account, err := servicePrincipalAccount(ctx, client, sAMAccountName)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		err = account.UpdateAttribute(ctx, "servicePrincipalName", setToStingArray(d.Get("spns").(*schema.Set)))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return diags
+}
+
+func resourceServicePrincipalDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	client, err := resourceClient(ctx, d, meta)
 	if err != nil {
 		return diag.FromErr(err)
 	}
+	sAMAccountName := d.Get("samaccountname").(string)
 
-	err = account.RemoveServicePrincipal(spn)
+	account, err := servicePrincipalAccount(ctx, client, sAMAccountName)
+	if IsNotFound(err) {
+		return diags
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
+	spns := []string{d.Get("spn").(string)}
+	if !strings.Contains(d.Id(), "---") {
+		spns = setToStingArray(d.Get("spns").(*schema.Set))
+	}
+	for _, spn := range spns {
+		err = account.RemoveServicePrincipal(ctx, spn)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	return diags
 }
+
+// moveServicePrincipals moves SPNs between accounts, adding them to the new
+// account before removing them from the old one so that they are never missing.
+// Domain controllers that enforce SPN uniqueness reject the add while the old
+// account still holds the SPN, in which case the SPNs are removed first.  Either
+// way, a failure part way through restores the SPNs to the old account.
+func moveServicePrincipals(ctx context.Context, from *LdapAccount, to *LdapAccount, remove []string, add []string) error {
+	added, err := addServicePrincipals(ctx, to, add)
+	if err != nil && !isLDAPError(err, ldap.LDAPResultConstraintViolation) {
+		removeServicePrincipals(ctx, to, added)
+		return err
+	}
+
+	if err == nil {
+		err = removeServicePrincipals(ctx, from, remove)
+		if err != nil {
+			removeServicePrincipals(ctx, to, added)
+			return fmt.Errorf("unable to remove SPNs from %s, rolled back: %s", from.DN, err)
+		}
+		return nil
+	}
+
+	// SPN uniqueness is enforced, so make way on the old account first
+	removeServicePrincipals(ctx, to, added)
+	err = removeServicePrincipals(ctx, from, remove)
+	if err != nil {
+		addServicePrincipals(ctx, from, remove)
+		return fmt.Errorf("unable to remove SPNs from %s, rolled back: %s", from.DN, err)
+	}
+	_, err = addServicePrincipals(ctx, to, add)
+	if err != nil {
+		removeServicePrincipals(ctx, to, add)
+		addServicePrincipals(ctx, from, remove)
+		return fmt.Errorf("unable to add SPNs to %s, rolled back: %s", to.DN, err)
+	}
+
+	return nil
+}
+
+// addServicePrincipals adds the SPNs the account doesn't already have, and
+// returns those it added.
+func addServicePrincipals(ctx context.Context, account *LdapAccount, spns []string) ([]string, error) {
+	var added []string
+	err := account.Refresh(ctx)
+	if err != nil {
+		return added, err
+	}
+	for _, spn := range spns {
+		exists, err := account.HasServicePrincipal(ctx, spn)
+		if err != nil {
+			return added, err
+		}
+		if exists {
+			continue
+		}
+		err = account.AddServicePrincipal(ctx, spn)
+		if err != nil {
+			return added, err
+		}
+		added = append(added, spn)
+	}
+	return added, nil
+}
+
+func removeServicePrincipals(ctx context.Context, account *LdapAccount, spns []string) error {
+	err := account.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+	for _, spn := range spns {
+		err = account.RemoveServicePrincipal(ctx, spn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceServicePrincipalCustomizeDiff fails the plan if an SPN being added is
+// already registered on another account anywhere in the forest.
+func resourceServicePrincipalCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	client, err := diffDomainClient(ctx, d, meta)
+	if err != nil || client == nil {
+		return err
+	}
+	config := d.GetRawConfig()
+	if !config.GetAttr("samaccountname").IsKnown() || !config.GetAttr("spn").IsKnown() || !config.GetAttr("spns").IsWhollyKnown() {
+		return nil
+	}
+
+	var added []string
+	retargeted := d.Id() == "" || d.HasChange("samaccountname")
+	if spn := d.Get("spn").(string); spn != "" && (retargeted || d.HasChange("spn")) {
+		added = append(added, spn)
+	}
+	if d.HasChange("spns") || retargeted {
+		oldSPNs, newSPNs := d.GetChange("spns")
+		for _, spn := range setToStingArray(newSPNs.(*schema.Set)) {
+			if retargeted || !oldSPNs.(*schema.Set).Contains(spn) {
+				added = append(added, spn)
+			}
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	// The account may not exist yet, in which case every holder is a conflict.
+	// When retargeting, the old account is expected to hold the SPNs too.
+	var accountDNs []string
+	if account, err := servicePrincipalAccount(ctx, client, d.Get("samaccountname").(string)); err == nil {
+		accountDNs = append(accountDNs, account.DN)
+	}
+	if d.Id() != "" && d.HasChange("samaccountname") {
+		oldSAMAccountName, _ := d.GetChange("samaccountname")
+		if account, err := servicePrincipalAccount(ctx, client, oldSAMAccountName.(string)); err == nil {
+			accountDNs = append(accountDNs, account.DN)
+		}
+	}
+	for _, spn := range added {
+		holders, err := client.FindServicePrincipalHolders(ctx, spn)
+		if err != nil {
+			return err
+		}
+		for _, holder := range holders {
+			if !servicePrincipalHolderExpected(holder, accountDNs) {
+				return fmt.Errorf("SPN \"%s\" is already registered on %s; duplicate SPNs break Kerberos authentication to the service", spn, holder)
+			}
+		}
+	}
+
+	return nil
+}
+
+func servicePrincipalHolderExpected(holder string, accountDNs []string) bool {
+	for _, accountDN := range accountDNs {
+		if dnsEqual(holder, accountDN) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,11 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +19,32 @@ var (
 	testAccount string = os.Getenv("ADLDAP_TEST_ACCOUNT")
 )
 
+func init() {
+	resource.AddTestSweepers("adldap_service_principal", &resource.Sweeper{
+		Name: "adldap_service_principal",
+		F: func(region string) error {
+			prefix := strings.SplitN(testSpn, "%", 2)[0]
+			filter := fmt.Sprintf("(servicePrincipalName=%s*)", ldap.EscapeFilter(prefix))
+			return testSweepEntries(filter, func(ctx context.Context, entry *LdapEntry) error {
+				account := &LdapAccount{LdapEntry: entry}
+				spns, err := account.GetServicePrincipals(ctx)
+				if err != nil {
+					return err
+				}
+				for _, spn := range spns {
+					if strings.HasPrefix(strings.ToLower(spn), strings.ToLower(prefix)) {
+						err = account.RemoveServicePrincipal(ctx, spn)
+						if err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+		},
+	})
+}
+
 func TestAccAdldapServicePrincipal(t *testing.T) {
 	rInt := rand.New(rand.NewSource(time.Now().UnixNano())).Int()
 	uniqueSpn := fmt.Sprintf(testSpn, rInt)
@@ -41,6 +69,62 @@ func TestAccAdldapServicePrincipal(t *testing.T) {
 	})
 }
 
+func TestAccAdldapServicePrincipal_computer(t *testing.T) {
+	rInt := rand.New(rand.NewSource(time.Now().UnixNano())).Intn(99999)
+	uniqueSpn := fmt.Sprintf(testSpn, rInt)
+	computerName := fmt.Sprintf("tfaccspn-%d", rInt)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAdldapServicePrincipalComputer(computerName, testComputerOU, uniqueSpn),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAdldapCheckServicePrincipalExists("adldap_service_principal.testspn"),
+					resource.TestCheckResourceAttr("adldap_service_principal.testspn", "spn", uniqueSpn),
+				),
+			},
+			{
+				ResourceName:      "adldap_service_principal.testspn",
+				ImportState:       true,
+				ImportStateId:     uniqueSpn,
+				ImportStateVerify: true,
+				// The imported ID uses the stored sAMAccountName, with its "$"
+				ImportStateVerifyIgnore: []string{"id", "samaccountname"},
+			},
+		},
+	})
+}
+
+func TestAccAdldapServicePrincipal_retarget(t *testing.T) {
+	rInt := rand.New(rand.NewSource(time.Now().UnixNano())).Intn(99999)
+	uniqueSpn := fmt.Sprintf(testSpn, rInt)
+	computerName := fmt.Sprintf("tfaccspn-%d", rInt)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAdldapServicePrincipalRetarget(computerName, testComputerOU, uniqueSpn, "a"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAdldapCheckServicePrincipalExists("adldap_service_principal.testspn"),
+					resource.TestCheckResourceAttr("adldap_service_principal.testspn", "samaccountname", computerName+"a$"),
+				),
+			},
+			{
+				Config: testAccAdldapServicePrincipalRetarget(computerName, testComputerOU, uniqueSpn, "b"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAdldapCheckServicePrincipalExists("adldap_service_principal.testspn"),
+					resource.TestCheckResourceAttr("adldap_service_principal.testspn", "samaccountname", computerName+"b$"),
+					resource.TestCheckResourceAttr("adldap_service_principal.testspn", "id", fmt.Sprintf("%s---%sb$", uniqueSpn, computerName)),
+				),
+			},
+		},
+	})
+}
+
 // Support functions
 
 func testAccAdldapServicePrincipal(samaccountname string, spn string) string {
@@ -66,8 +150,8 @@ func testAccAdldapCheckServicePrincipalExists(resourceName string) resource.Test
 		searchRequest := ldap.NewSearchRequest(
 			testAccProviderMeta.SearchBase, // The base dn to search
 			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-			fmt.Sprintf("(&(objectClass=organizationalPerson)(samAccountName=%s))", rs.Primary.Attributes["samaccountname"]), // The filter to apply
-			[]string{"servicePrincipalNames"}, // A list attributes to retrieve
+			fmt.Sprintf("(|(samAccountName=%[1]s)(samAccountName=%[1]s$))", rs.Primary.Attributes["samaccountname"]), // The filter to apply
+			[]string{"servicePrincipalName"}, // A list attributes to retrieve
 			nil,
 		)
 		t, err := client.Search(searchRequest)
@@ -76,10 +160,98 @@ func testAccAdldapCheckServicePrincipalExists(resourceName string) resource.Test
 			return err
 		}
 
-		if t == nil {
+		if t == nil || len(t.Entries) == 0 {
 			return fmt.Errorf("SPN %s not found", rs.Primary.Attributes["spn"])
 		}
+		for _, spn := range t.Entries[0].GetAttributeValues("servicePrincipalName") {
+			if strings.EqualFold(spn, rs.Primary.Attributes["spn"]) {
+				return nil
+			}
+		}
+		return fmt.Errorf("SPN %s not found", rs.Primary.Attributes["spn"])
+	}
+}
+
+func testAccAdldapServicePrincipalComputer(computerName string, computerOU string, spn string) string {
+	return fmt.Sprintf(`
+resource "adldap_computer" "foo" {
+  samaccountname      = "%s$"
+  organizational_unit = "%s"
+}
+
+resource "adldap_service_principal" "testspn" {
+  samaccountname = trimsuffix(adldap_computer.foo.samaccountname, "$")
+  spn = "%s"
+}`, computerName, computerOU, spn)
+}
+
+func testAccAdldapServicePrincipalRetarget(computerName string, computerOU string, spn string, target string) string {
+	return fmt.Sprintf(`
+resource "adldap_computer" "a" {
+  samaccountname      = "%[1]sa$"
+  organizational_unit = "%[2]s"
+}
+
+resource "adldap_computer" "b" {
+  samaccountname      = "%[1]sb$"
+  organizational_unit = "%[2]s"
+}
 
-		return nil
+resource "adldap_service_principal" "testspn" {
+  samaccountname = adldap_computer.%[4]s.samaccountname
+  spn = "%[3]s"
+}`, computerName, computerOU, spn, target)
+}
+
+func TestAdldapServicePrincipal_fake(t *testing.T) {
+	ctx := context.Background()
+	client, directory := newFakeClient(t)
+	computers := "CN=Computers," + fakeDomainDN
+	for _, name := range []string{"FAKEA$", "FAKEB$"} {
+		_, err := client.CreateComputerAccount(ctx, name, "", computers, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := resourceServicePrincipal()
+	spn := "HTTP/fake.example.com"
+
+	state := fakeApply(t, r, nil, map[string]interface{}{"samaccountname": "FAKEA", "spn": spn}, client)
+	if !fakeContainsFold(fakeAttribute(directory.Entry("CN=FAKEA,"+computers), "servicePrincipalName"), spn) {
+		t.Fatalf("Error adding SPN to FAKEA$")
+	}
+
+	state = fakeApply(t, r, state, map[string]interface{}{"samaccountname": "FAKEB", "spn": spn}, client)
+	if fakeContainsFold(fakeAttribute(directory.Entry("CN=FAKEA,"+computers), "servicePrincipalName"), spn) ||
+		!fakeContainsFold(fakeAttribute(directory.Entry("CN=FAKEB,"+computers), "servicePrincipalName"), spn) {
+		t.Errorf("Error moving SPN from FAKEA$ to FAKEB$")
+	}
+	if state.ID != spn+"---FAKEB" {
+		t.Errorf("Error updating ID after retargeting: got %s", state.ID)
+	}
+
+	fakeApply(t, r, state, nil, client)
+	if fakeContainsFold(fakeAttribute(directory.Entry("CN=FAKEB,"+computers), "servicePrincipalName"), spn) {
+		t.Errorf("Error removing SPN from FAKEB$")
+	}
+}
+
+func TestAdldapServicePrincipal_emptySPNs(t *testing.T) {
+	ctx := context.Background()
+	client, directory := newFakeClient(t)
+	computerDN := "CN=FAKEPC,CN=Computers," + fakeDomainDN
+	_, err := client.CreateComputerAccount(ctx, "FAKEPC$", "", "CN=Computers,"+fakeDomainDN, map[string][]string{"servicePrincipalName": {"HTTP/stale.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := resourceServicePrincipal()
+
+	// An empty set is authoritative too, clearing the SPNs added elsewhere
+	state := fakeApply(t, r, nil, map[string]interface{}{"samaccountname": "FAKEPC$", "spns": []interface{}{}}, client)
+	if state.ID != "FAKEPC$" {
+		t.Errorf("Error using the account as the ID of an empty set: got %s", state.ID)
+	}
+	if got := fakeAttribute(directory.Entry(computerDN), "servicePrincipalName"); len(got) != 0 {
+		t.Errorf("Error clearing SPNs: got %v", got)
 	}
 }
@@ -2,36 +2,69 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 const DONT_EXPIRE_PASSWORD = 65536
+const DONT_REQ_PREAUTH = 4194304
+
+// Arguments holding a single attribute, for ignore_attributes
+var userAttributes = map[string]string{
+	"sam_account_name":        "sAMAccountName",
+	"display_name":            "displayName",
+	"common_name":             "cn",
+	"user_principal_name":     "userPrincipalName",
+	"service_principal_names": "servicePrincipalName",
+	"description":             "description",
+	"email_address":           "mail",
+	"given_name":              "givenName",
+	"initials":                "initials",
+	"surname":                 "sn",
+	"notes":                   "info",
+	"web_page":                "wWWHomePage",
+	"other_home_pages":        "url",
+	"mail_nickname":           "mailNickname",
+	"hide_from_address_lists": "msExchHideFromAddressLists",
+	"target_address":          "targetAddress",
+	"assistant":               "assistant",
+	"see_also":                "seeAlso",
+	"uid_number":              "uidNumber",
+	"gid_number":              "gidNumber",
+	"login_shell":             "loginShell",
+	"unix_home_directory":     "unixHomeDirectory",
+}
 
 func resourceUser() *schema.Resource {
-	return &schema.Resource{
+	r := &schema.Resource{
 		Description: "`adldap_user` manages a user account in Active Directory.",
 
 		CreateContext: resourceUserCreate,
 		ReadContext:   resourceUserRead,
 		UpdateContext: resourceUserUpdate,
 		DeleteContext: resourceUserDelete,
+		CustomizeDiff: resourceUserCustomizeDiff,
 		Importer: &schema.ResourceImporter{
 			StateContext: resourceUserImport,
 		},
 
 		Schema: map[string]*schema.Schema{
 			"id": {
-				Description: "The ID (SAMAccountName) of the user.",
+				Description: "The ID (objectGUID) of the user.",
 				Type:        schema.TypeString,
 				Computed:    true,
 			},
 			"organizational_unit": {
-				Description: "The OU that the user should be in.",
-				Type:        schema.TypeString,
-				Required:    true,
+				Description:      "The OU that the user should be in.",
+				Type:             schema.TypeString,
+				Required:         true,
+				DiffSuppressFunc: suppressEquivalentDN,
 			},
 			"display_name": {
 				Description: "Full name of the user object.  Defaults to the `samaccountname` of the resource.",
@@ -39,16 +72,23 @@ func resourceUser() *schema.Resource {
 				Optional:    true,
 				Computed:    true,
 			},
-			"email_address": {
-				Description: "User's Email Address",
+			"common_name": {
+				Description: "The common name (CN) of the user object, which forms its RDN.  Defaults to `display_name` at creation and does not follow later changes to it.",
 				Type:        schema.TypeString,
 				Optional:    true,
+				Computed:    true,
+			},
+			"email_address": {
+				Description:      "User's Email Address",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateEmailAddress,
 			},
 			"enabled": {
 				Description: "Whether the account is enabled.  Defaults to `true`.",
 				Type:        schema.TypeBool,
 				Optional:    true,
-				Default:     false,
+				Default:     true,
 			},
 			"dont_expire_password": {
 				Description: "Whether the account's password expires according to directory settings.  Defaults to `false`.",
@@ -56,15 +96,23 @@ func resourceUser() *schema.Resource {
 				Optional:    true,
 				Default:     false,
 			},
+			"dont_require_preauth": {
+				Description: "Whether Kerberos pre-authentication is not required for the account (`DONT_REQ_PREAUTH`).  This exposes the account to offline password attacks; only enable it for legacy applications that need it.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
 			"sam_account_name": {
-				Description: "The SAMAccountName of the user.",
-				Type:        schema.TypeString,
-				Required:    true,
+				Description:      "The SAMAccountName of the user.  In AD LDS, which has no sAMAccountName, it is kept in userPrincipalName and may be a user principal name.",
+				Type:             schema.TypeString,
+				Required:         true,
+				ValidateDiagFunc: validateUserSAMAccountName,
 			},
 			"user_principal_name": {
-				Description: "The user principal name of the user.",
-				Type:        schema.TypeString,
-				Optional:    true,
+				Description:      "The user principal name of the user.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateUserPrincipalName,
 			},
 			"service_principal_names": {
 				Description: "A list of the service principal names for the user.",
@@ -72,14 +120,152 @@ func resourceUser() *schema.Resource {
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
+				Set:      hashCaseInsensitive,
 				Optional: true,
 			},
 			"password": {
-				Description: "The password for the user.",
+				Description:   "The password for the user.  Stored in state; prefer `password_wo` where supported.",
+				Type:          schema.TypeString,
+				Sensitive:     true,
+				Optional:      true,
+				ConflictsWith: []string{"password_wo"},
+			},
+			"password_wo": {
+				Description:   "Write-only password for the user.  Never stored in state; requires Terraform 1.11 or later.  Change `password_wo_version` to set a new value.",
+				Type:          schema.TypeString,
+				Sensitive:     true,
+				Optional:      true,
+				WriteOnly:     true,
+				ConflictsWith: []string{"password"},
+			},
+			"password_wo_version": {
+				Description:  "Any change to this value sets the password to the current value of `password_wo`.",
+				Type:         schema.TypeInt,
+				Optional:     true,
+				RequiredWith: []string{"password_wo"},
+			},
+			"adopt_existing": {
+				Description: "Whether to adopt an existing account with the same `sam_account_name` on create, converging it on the configuration, instead of failing.  The provider's `act_idempotently` enables this for all resources.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"restore_deleted": {
+				Description: "Whether to restore the most recently deleted account with the same `sam_account_name` from the AD Recycle Bin on create, keeping its objectGUID, SID, and group memberships, and converge it on the configuration as if adopted.  Accounts that have been recycled can't be restored and are created again.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"set_password_on_adopt": {
+				Description: "Whether to set the configured password when an existing account is adopted because of `adopt_existing` or the provider's `act_idempotently`.  Defaults to `true`; set to `false` to leave the existing password untouched.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"expire_password_trigger": {
+				Description: "Any change to this value after creation immediately expires the current password (`pwdLastSet = 0`), so the user must change it at next logon.",
 				Type:        schema.TypeString,
-				Sensitive:   true,
 				Optional:    true,
 			},
+			"enforce_password": {
+				Description: "Whether to reset `password` on the next apply when the password has been changed outside Terraform.  Defaults to `false`, which only emits a warning.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"distinguished_name": {
+				Description: "The distinguished name of the user.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"object_guid": {
+				Description: "The objectGUID of the user.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"consistency_guid": {
+				Description:      "The `msDS-ConsistencyGuid` of the user, which Azure AD Connect uses as the source anchor that matches it to its cloud account.  Setting it replaces the current value; removing it from the configuration leaves the value alone.  Conflicts with `seed_consistency_guid`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				ValidateDiagFunc: validateGUID,
+				ConflictsWith:    []string{"seed_consistency_guid"},
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					return strings.EqualFold(strings.Trim(old, "{}"), strings.Trim(new, "{}"))
+				},
+			},
+			"seed_consistency_guid": {
+				Description: "Whether to set `msDS-ConsistencyGuid` from the objectGUID when the user has none, as Azure AD Connect does when it first exports a user.  A value set later, even outside Terraform, is left alone.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"sid": {
+				Description: "The security identifier (objectSid) of the user.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"when_created": {
+				Description: "When the user was created, in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"on_destroy": {
+				Description:      "What to do with the account when the resource is destroyed: `delete` or `disable`.  Defaults to `delete`.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "delete",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"delete", "disable"}, false)),
+			},
+			"on_destroy_description": {
+				Description: "Description to set on the account when it is disabled on destroy.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"on_destroy_name_prefix": {
+				Description: "Prefix to add to the account's common name when it is disabled on destroy, e.g. `DISABLED-`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"on_destroy_move_to": {
+				Description:      "Distinguished name of the OU, such as an archive of disabled users, to move the account to when it is disabled on destroy.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateDN,
+				DiffSuppressFunc: suppressEquivalentDN,
+			},
+			"locked_out": {
+				Description: "Whether the account is locked out, from `UF_LOCKOUT` in `msDS-User-Account-Control-Computed`; a lockout whose duration has expired is not reported.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"auto_unlock": {
+				Description: "Whether to unlock the account on the next apply when it is found to be locked out.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"direct_reports": {
+				Description: "Distinguished names of the objects that list this user as their manager (`directReports`).",
+				Type:        schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed: true,
+			},
+			"sid_history": {
+				Description: "SIDs the user held in other domains before migration (`sIDHistory`).",
+				Type:        schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed: true,
+			},
+			"password_last_set": {
+				Description: "When the password was last set (`pwdLastSet`), in RFC 3339 format.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
 			"description": {
 				Description: "Description property of the user.",
 				Type:        schema.TypeString,
@@ -96,21 +282,337 @@ func resourceUser() *schema.Resource {
 				Optional:    true,
 			},
 			"initials": {
-				Description:  "Initials that represent part of a user's name. Maximum 6 char.",
-				Type:         schema.TypeString,
-				Optional:     true,
+				Description:      "Initials that represent part of a user's name. Maximum 6 char.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateInitials,
+			},
+			"notes": {
+				Description: "Notes about the user (`info`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"web_page": {
+				Description: "The user's web page (`wWWHomePage`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"other_home_pages": {
+				Description: "Additional web pages for the user (`url`).",
+				Type:        schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+			},
+			"assistant": {
+				Description:      "Distinguished name of the user's assistant.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: validateDN,
+				DiffSuppressFunc: suppressEquivalentDN,
+			},
+			"see_also": {
+				Description: "Distinguished names of related objects (`seeAlso`).",
+				Type:        schema.TypeSet,
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateDN,
+				},
+				Set:      hashDN,
+				Optional: true,
+			},
+			"mail_nickname": {
+				Description: "The Exchange alias of the user (`mailNickname`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"hide_from_address_lists": {
+				Description: "Whether the user is hidden from Exchange address lists (`msExchHideFromAddressLists`).  Requires the Exchange schema extensions.  Defaults to `false`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"target_address": {
+				Description: "The external address mail is routed to, e.g. `SMTP:jdoe@example.mail.onmicrosoft.com` (`targetAddress`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"uid_number": {
+				Description: "The RFC 2307 numeric user ID (`uidNumber`).",
+				Type:        schema.TypeInt,
+				Optional:    true,
+			},
+			"gid_number": {
+				Description: "The RFC 2307 numeric primary group ID (`gidNumber`).",
+				Type:        schema.TypeInt,
+				Optional:    true,
+			},
+			"login_shell": {
+				Description: "The RFC 2307 login shell (`loginShell`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"unix_home_directory": {
+				Description: "The RFC 2307 home directory (`unixHomeDirectory`).",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"extension_attributes": {
+				Description: "Values for `extensionAttribute1` to `extensionAttribute15`, keyed by number (`\"1\"` to `\"15\"`).",
+				Type:        schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional:         true,
+				ValidateDiagFunc: validateExtensionAttributeKeys,
+			},
+			"domain":            domainSchema(),
+			"ignore_attributes": ignoreAttributesSchema(),
+			"ldap_controls":     ldapControlsSchema(),
+		},
+	}
+
+	r.SchemaVersion = 1
+	r.StateUpgraders = []schema.StateUpgrader{
+		{
+			Version: 0,
+			Type:    resourceUserV0().CoreConfigSchema().ImpliedType(),
+			Upgrade: resourceAccountStateUpgradeV0,
+		},
+	}
+
+	return r
+}
+
+// resourceUserV0 is the user schema at version 0, when the ID was the
+// sAMAccountName.  It is frozen so that later schema changes can't change
+// the states its upgrader is given.
+func resourceUserV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"organizational_unit": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"display_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"common_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"email_address": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"enabled": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"dont_expire_password": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"dont_require_preauth": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"sam_account_name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"user_principal_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"service_principal_names": {
+				Type: schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+			},
+			"password": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"password_wo": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"password_wo_version": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"set_password_on_adopt": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"expire_password_trigger": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"enforce_password": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"distinguished_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"object_guid": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"sid": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"when_created": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"on_destroy": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"on_destroy_description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"on_destroy_name_prefix": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"on_destroy_move_to": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"locked_out": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"auto_unlock": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"direct_reports": {
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed: true,
+			},
+			"sid_history": {
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed: true,
+			},
+			"password_last_set": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"given_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"surname": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"initials": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"notes": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"web_page": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"other_home_pages": {
+				Type: schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+			},
+			"assistant": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"see_also": {
+				Type: schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+			},
+			"mail_nickname": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"hide_from_address_lists": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"target_address": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"uid_number": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"gid_number": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"login_shell": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"unix_home_directory": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"extension_attributes": {
+				Type: schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
 			},
 		},
 	}
 }
 
 func resourceUserCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*LdapClient)
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	attributesMap := make(map[string][]string)
 
 	sAMAccountName := d.Get("sam_account_name").(string)
-	
+
 	userPrincipalName := d.Get("user_principal_name").(string)
 	if userPrincipalName != "" {
 		attributesMap["userPrincipalName"] = []string{userPrincipalName}
@@ -122,7 +624,10 @@ func resourceUserCreate(ctx context.Context, d *schema.ResourceData, meta interf
 	}
 
 	distinguishedName := d.Get("organizational_unit").(string)
-	password := d.Get("password").(string)
+	password, diags := userPassword(d)
+	if diags.HasError() {
+		return diags
+	}
 	description := d.Get("description").(string)
 	if description != "" {
 		attributesMap["description"] = []string{description}
@@ -136,186 +641,515 @@ func resourceUserCreate(ctx context.Context, d *schema.ResourceData, meta interf
 	}
 	displayName := d.Get("display_name").(string)
 	attributesMap["displayName"] = []string{displayName}
-	
+
+	commonName := d.Get("common_name").(string)
+	if commonName != "" {
+		attributesMap["cn"] = []string{commonName}
+	}
+
 	mail := d.Get("email_address").(string)
 	if mail != "" {
 		attributesMap["mail"] = []string{mail}
 	}
-	
+
 	givenName := d.Get("given_name").(string)
 	if givenName != "" {
 		attributesMap["givenName"] = []string{givenName}
 	}
-	
+
 	sn := d.Get("surname").(string)
 	if sn != "" {
 		attributesMap["sn"] = []string{sn}
 	}
-	
+
 	initials := d.Get("initials").(string)
 	if initials != "" {
 		attributesMap["initials"] = []string{initials}
 	}
 
-	account, err := client.CreateUserAccount(sAMAccountName, password, distinguishedName, attributesMap)
+	info := d.Get("notes").(string)
+	if info != "" {
+		attributesMap["info"] = []string{info}
+	}
+
+	wWWHomePage := d.Get("web_page").(string)
+	if wWWHomePage != "" {
+		attributesMap["wWWHomePage"] = []string{wWWHomePage}
+	}
+
+	url := setToStingArray(d.Get("other_home_pages").(*schema.Set))
+	if len(url) > 0 {
+		attributesMap["url"] = url
+	}
+
+	assistant := d.Get("assistant").(string)
+	if assistant != "" {
+		attributesMap["assistant"] = []string{assistant}
+	}
+
+	seeAlso := setToStingArray(d.Get("see_also").(*schema.Set))
+	if len(seeAlso) > 0 {
+		attributesMap["seeAlso"] = seeAlso
+	}
+
+	mailNickname := d.Get("mail_nickname").(string)
+	if mailNickname != "" {
+		attributesMap["mailNickname"] = []string{mailNickname}
+	}
+
+	if d.Get("hide_from_address_lists").(bool) {
+		attributesMap["msExchHideFromAddressLists"] = []string{"TRUE"}
+	}
+
+	targetAddress := d.Get("target_address").(string)
+	if targetAddress != "" {
+		attributesMap["targetAddress"] = []string{targetAddress}
+	}
+
+	uidNumber := d.Get("uid_number").(int)
+	if uidNumber != 0 {
+		attributesMap["uidNumber"] = []string{strconv.Itoa(uidNumber)}
+	}
+
+	gidNumber := d.Get("gid_number").(int)
+	if gidNumber != 0 {
+		attributesMap["gidNumber"] = []string{strconv.Itoa(gidNumber)}
+	}
+
+	loginShell := d.Get("login_shell").(string)
+	if loginShell != "" {
+		attributesMap["loginShell"] = []string{loginShell}
+	}
+
+	unixHomeDirectory := d.Get("unix_home_directory").(string)
+	if unixHomeDirectory != "" {
+		attributesMap["unixHomeDirectory"] = []string{unixHomeDirectory}
+	}
+
+	for k, v := range d.Get("extension_attributes").(map[string]interface{}) {
+		attributesMap["extensionAttribute"+k] = []string{v.(string)}
+	}
+
+	requestedAttributes := make([]string, 0, len(attributesMap))
+	for k := range attributesMap {
+		requestedAttributes = append(requestedAttributes, k)
+	}
+	account, err := client.GetAccountBySAMAccountName(ctx, sAMAccountName, objectClassUser, requestedAttributes)
+	exists := err == nil
+	if err != nil && !IsNotFound(err) {
+		return diag.FromErr(err)
+	}
+
+	restored := false
+	if !exists && d.Get("restore_deleted").(bool) {
+		restored, err = client.RestoreDeletedAccount(ctx, sAMAccountName, distinguishedName)
+		if err != nil {
+			return diag.Errorf("error restoring deleted account %s: %s", sAMAccountName, err)
+		}
+	}
+	if restored {
+		account, err = client.GetAccountBySAMAccountName(ctx, sAMAccountName, objectClassUser, requestedAttributes)
+		if err != nil {
+			return diag.Errorf("error reading restored account %s: %s", sAMAccountName, err)
+		}
+	}
+
+	if restored || (exists && (d.Get("adopt_existing").(bool) || client.ActIdempotently)) {
+		err = adoptUserAccount(ctx, d, account, password, distinguishedName, attributesMap)
+		if err != nil {
+			return diag.Errorf("error adopting account %s: %s", sAMAccountName, err)
+		}
+	} else {
+		account, err = client.CreateUserAccount(ctx, sAMAccountName, password, distinguishedName, attributesMap)
+		if err != nil {
+			return diag.Errorf("error creating account %s: %s", sAMAccountName, err)
+		}
+	}
+
+	if enabled {
+		err = account.Enable(ctx)
+	} else {
+		err = account.Disable(ctx)
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if dontExpirePassword {
+		err = account.AddUACFlag(ctx, DONT_EXPIRE_PASSWORD)
+	} else {
+		err = account.RemoveUACFlag(ctx, DONT_EXPIRE_PASSWORD)
+	}
 	if err != nil {
-		return diag.Errorf("error creating account %s: %s", sAMAccountName, err)
+		return diag.FromErr(err)
 	}
 
-	if enabled {
-		err = account.Enable()
+	if d.Get("dont_require_preauth").(bool) {
+		err = account.AddUACFlag(ctx, DONT_REQ_PREAUTH)
 		if err != nil {
 			return diag.FromErr(err)
 		}
+		diags = append(diags, dontRequirePreauthWarning(sAMAccountName))
 	}
 
-	if dontExpirePassword {
-		err = account.AddUACFlag(DONT_EXPIRE_PASSWORD)
-		if err != nil {
-			return diag.FromErr(err)
-		}
+	err = setUserPasswordLastSet(ctx, d, account)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
-	d.SetId(sAMAccountName)
+	err = setAccountIdentity(ctx, d, account)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	return nil
+	err = updateUserConsistencyGUID(ctx, d, account, d.Get("consistency_guid").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	directReports, err := account.GetAttributeValues(ctx, "directReports")
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("direct_reports", directReports)
+	d.Set("locked_out", false)
+	d.Set("sid_history", []string{})
+
+	name, err := account.Name()
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(d.Get("object_guid").(string))
+	d.Set("common_name", name)
+
+	return diags
 }
 
 func resourceUserRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*LdapClient)
-	requestedAttributes := []string{"displayName", "givenName", "sn", "mail", "initials"}
+	client, err := domainClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer keepIgnoredAttributes(d, userAttributes, map[string]string{"extension_attributes": "extensionAttribute"})()
+	requestedAttributes := userAttributeNames()
 
-	// Use the samAccountName as the resource ID
-	account, err := client.GetAccountBySAMAccountName(d.Id(), requestedAttributes)
+	// States from before the objectGUID became the ID may still hold a
+	// sAMAccountName
+	var account *LdapAccount
+	err = awaitReplication(ctx, client, d.Id(), func() error {
+		var err error
+		account, err = client.GetAccountByIdentifier(ctx, d.Id(), objectClassUser, requestedAttributes)
+		return err
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "no entry returned") {
-			d.SetId("")	
-			return nil		
+		if IsNotFound(err) {
+			diags := deletedObjectDiagnostics(ctx, client, "User", d.Id())
+			d.SetId("")
+			return diags
 		}
 		return diag.FromErr(err)
 	}
 
-	distinguishedName := account.ParentDN()
-	givenName, _ := account.GetAttributeValue("givenName")
-	sn, _ := account.GetAttributeValue("sn")
-	initials, _ := account.GetAttributeValue("initials")
-	mail, _ := account.GetAttributeValue("mail")
-	displayName, _ := account.GetAttributeValue("displayName")
-	userPrincipalName, _ := account.GetAttributeValue("userPrincipalName")
-	servicePrincipalName, _ := account.GetAttributeValues("servicePrincipalName")
-	description, _ := account.GetAttributeValue("description")
-	dontExpirePassword, err := account.UACFlagIsSet(DONT_EXPIRE_PASSWORD)
+	distinguishedName, err := account.ParentDN()
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	commonName, err := account.Name()
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	givenName, _ := account.GetAttributeValue(ctx, "givenName")
+	sn, _ := account.GetAttributeValue(ctx, "sn")
+	initials, _ := account.GetAttributeValue(ctx, "initials")
+	info, _ := account.GetAttributeValue(ctx, "info")
+	wWWHomePage, _ := account.GetAttributeValue(ctx, "wWWHomePage")
+	url, _ := account.GetAttributeValues(ctx, "url")
+	assistant, _ := account.GetAttributeValue(ctx, "assistant")
+	seeAlso, _ := account.GetAttributeValues(ctx, "seeAlso")
+	mailNickname, _ := account.GetAttributeValue(ctx, "mailNickname")
+	hideFromAddressLists, _ := account.GetAttributeValue(ctx, "msExchHideFromAddressLists")
+	targetAddress, _ := account.GetAttributeValue(ctx, "targetAddress")
+	uidNumber, _ := account.GetAttributeValue(ctx, "uidNumber")
+	gidNumber, _ := account.GetAttributeValue(ctx, "gidNumber")
+	loginShell, _ := account.GetAttributeValue(ctx, "loginShell")
+	unixHomeDirectory, _ := account.GetAttributeValue(ctx, "unixHomeDirectory")
+	extensionAttributes, _ := getExtensionAttributes(ctx, account)
+	directReports, _ := account.GetAttributeValues(ctx, "directReports")
+	lockedOut, err := account.IsLockedOut(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	sidHistory, err := account.GetSIDHistory(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	mail, _ := account.GetAttributeValue(ctx, "mail")
+	displayName, _ := account.GetAttributeValue(ctx, "displayName")
+	userPrincipalName, _ := account.GetAttributeValue(ctx, "userPrincipalName")
+	servicePrincipalName, _ := account.GetAttributeValues(ctx, "servicePrincipalName")
+	description, _ := account.GetAttributeValue(ctx, "description")
+	sAMAccountName, _ := account.GetAttributeValue(ctx, client.accountNameAttribute())
+	if client.IsADLDS() {
+		// The userPrincipalName is the sam_account_name
+		userPrincipalName = ""
+	}
+	dontExpirePassword, err := account.UACFlagIsSet(ctx, DONT_EXPIRE_PASSWORD)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	dontRequirePreauth, err := account.UACFlagIsSet(ctx, DONT_REQ_PREAUTH)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	accountEnabled, err := account.IsEnabled(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	passwordLastSet, err := account.GetPasswordLastSet(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	consistencyGUID, err := account.GetConsistencyGUID(ctx)
 	if err != nil {
 		return diag.FromErr(err)
 	}
+	diags := userPasswordDrift(d, sAMAccountName, timeToString(passwordLastSet))
+	if adminCount, _ := account.GetAttributeValue(ctx, "adminCount"); adminCount == "1" {
+		diags = append(diags, adminSDHolderWarning("User", sAMAccountName))
+	}
 
-	accountEnabled, err := account.IsEnabled()
+	err = setAccountIdentity(ctx, d, account)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	d.Set("sam_account_name", d.Id())
-	d.Set("organizational_unit", distinguishedName)
+	d.SetId(d.Get("object_guid").(string))
+	d.Set("sam_account_name", sAMAccountName)
+	setDN(d, "organizational_unit", distinguishedName)
 	d.Set("display_name", displayName)
+	d.Set("common_name", commonName)
 	d.Set("user_principal_name", userPrincipalName)
 	d.Set("service_principal_names", servicePrincipalName)
 	d.Set("description", description)
 	d.Set("dont_expire_password", dontExpirePassword)
+	d.Set("dont_require_preauth", dontRequirePreauth)
 	d.Set("enabled", accountEnabled)
 	d.Set("given_name", givenName)
 	d.Set("surname", sn)
 	d.Set("initials", initials)
+	d.Set("notes", info)
+	d.Set("web_page", wWWHomePage)
+	d.Set("other_home_pages", url)
+	setDN(d, "assistant", assistant)
+	d.Set("see_also", seeAlso)
+	d.Set("mail_nickname", mailNickname)
+	d.Set("hide_from_address_lists", strings.EqualFold(hideFromAddressLists, "TRUE"))
+	d.Set("target_address", targetAddress)
+	d.Set("uid_number", atoiOrZero(uidNumber))
+	d.Set("gid_number", atoiOrZero(gidNumber))
+	d.Set("login_shell", loginShell)
+	d.Set("unix_home_directory", unixHomeDirectory)
+	d.Set("extension_attributes", extensionAttributes)
+	d.Set("direct_reports", directReports)
+	d.Set("locked_out", lockedOut)
+	d.Set("sid_history", sidHistory)
 	d.Set("email_address", mail)
+	d.Set("password_last_set", timeToString(passwordLastSet))
+	d.Set("consistency_guid", consistencyGUID)
+	// A cleared value shows as a change, so the next apply seeds it again
+	d.Set("seed_consistency_guid", d.Get("seed_consistency_guid").(bool) && consistencyGUID != "")
 
-	return nil
+	return diags
 }
 
 func resourceUserUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var err error
 
-	client := meta.(*LdapClient)
-	sAMAccountName := d.Id()
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	sAMAccountName := d.Get("sam_account_name").(string)
 
-	account, err := client.GetAccountBySAMAccountName(sAMAccountName, nil)
+	account, err := client.GetAccountByIdentifier(ctx, d.Id(), objectClassUser, userAttributeNames())
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
 	if d.HasChange("organizational_unit") {
 		_, newOU := d.GetChange("organizational_unit")
-		err = account.Move(newOU.(string))
+		err = account.Move(ctx, newOU.(string))
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	}
 
-	if d.HasChange("display_name") {
-		_, newName := d.GetChange("display_name")
-		err = account.UpdateAttribute("displayName", []string{newName.(string)})
+	if d.HasChange("common_name") {
+		_, newCommonName := d.GetChange("common_name")
+		err = account.Rename(ctx, newCommonName.(string))
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	}
 
+	// Send the attribute changes as a single modify, so they apply together
+	changes := map[string][]string{}
+
+	if d.HasChange("display_name") {
+		_, newName := d.GetChange("display_name")
+		changes["displayName"] = []string{newName.(string)}
+	}
+
 	if d.HasChange("given_name") {
 		_, newName := d.GetChange("given_name")
-		err = account.UpdateAttribute("givenName", []string{newName.(string)})
-		if err != nil {
-			return diag.FromErr(err)
-		}
+		changes["givenName"] = []string{newName.(string)}
 	}
 
 	if d.HasChange("surname") {
 		_, newName := d.GetChange("surname")
-		err = account.UpdateAttribute("sn", []string{newName.(string)})
-		if err != nil {
-			return diag.FromErr(err)
-		}
+		changes["sn"] = []string{newName.(string)}
 	}
 
 	if d.HasChange("initials") {
 		_, newInitial := d.GetChange("initials")
-		err = account.UpdateAttribute("initials", []string{newInitial.(string)})
-		if err != nil {
-			return diag.FromErr(err)
+		changes["initials"] = []string{newInitial.(string)}
+	}
+
+	if d.HasChange("notes") {
+		_, newInfo := d.GetChange("notes")
+		changes["info"] = []string{newInfo.(string)}
+	}
+
+	if d.HasChange("web_page") {
+		_, newWWWHomePage := d.GetChange("web_page")
+		changes["wWWHomePage"] = []string{newWWWHomePage.(string)}
+	}
+
+	if d.HasChange("other_home_pages") {
+		_, newURLs := d.GetChange("other_home_pages")
+		changes["url"] = setToStingArray(newURLs.(*schema.Set))
+	}
+
+	if d.HasChange("assistant") {
+		_, newAssistant := d.GetChange("assistant")
+		changes["assistant"] = []string{newAssistant.(string)}
+	}
+
+	if d.HasChange("see_also") {
+		_, newSeeAlso := d.GetChange("see_also")
+		changes["seeAlso"] = setToStingArray(newSeeAlso.(*schema.Set))
+	}
+
+	if d.HasChange("mail_nickname") {
+		_, newMailNickname := d.GetChange("mail_nickname")
+		changes["mailNickname"] = []string{newMailNickname.(string)}
+	}
+
+	if d.HasChange("hide_from_address_lists") {
+		hideFromAddressLists := []string{}
+		if d.Get("hide_from_address_lists").(bool) {
+			hideFromAddressLists = []string{"TRUE"}
+		}
+		changes["msExchHideFromAddressLists"] = hideFromAddressLists
+	}
+
+	if d.HasChange("target_address") {
+		_, newTargetAddress := d.GetChange("target_address")
+		changes["targetAddress"] = []string{newTargetAddress.(string)}
+	}
+
+	if d.HasChange("uid_number") {
+		changes["uidNumber"] = intAttributeValue(d.Get("uid_number").(int))
+	}
+
+	if d.HasChange("gid_number") {
+		changes["gidNumber"] = intAttributeValue(d.Get("gid_number").(int))
+	}
+
+	if d.HasChange("login_shell") {
+		_, newLoginShell := d.GetChange("login_shell")
+		changes["loginShell"] = []string{newLoginShell.(string)}
+	}
+
+	if d.HasChange("unix_home_directory") {
+		_, newUnixHomeDirectory := d.GetChange("unix_home_directory")
+		changes["unixHomeDirectory"] = []string{newUnixHomeDirectory.(string)}
+	}
+
+	if d.HasChange("extension_attributes") {
+		for attr, values := range mapAttributeChanges(d, "extension_attributes", "extensionAttribute") {
+			changes[attr] = values
 		}
 	}
 
 	if d.HasChange("email_address") {
 		_, newMail := d.GetChange("email_address")
-		err = account.UpdateAttribute("mail", []string{newMail.(string)})
-		if err != nil {
-			return diag.FromErr(err)
-		}
+		changes["mail"] = []string{newMail.(string)}
 	}
 
 	if d.HasChange("user_principal_name") {
 		_, newUPN := d.GetChange("user_principal_name")
-		err = account.UpdateAttribute("userPrincipalName", []string{newUPN.(string)})
-		if err != nil {
-			return diag.FromErr(err)
-		}
+		changes["userPrincipalName"] = []string{newUPN.(string)}
 	}
 
 	if d.HasChange("service_principal_names") {
 		_, newSPNs := d.GetChange("service_principal_names")
-		err = account.UpdateAttribute("servicePrincipalName", setToStingArray(newSPNs.(*schema.Set)))
+		changes["servicePrincipalName"] = setToStingArray(newSPNs.(*schema.Set))
+	}
+
+	if d.HasChange("description") {
+		_, newDescription := d.GetChange("description")
+		changes["description"] = []string{newDescription.(string)}
+	}
+
+	err = account.UpdateAttributes(ctx, changes)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if (d.HasChange("password") && d.Get("password").(string) != "") || d.HasChange("password_wo_version") {
+		newPassword, diags := userPassword(d)
+		if diags.HasError() {
+			return diags
+		}
+		if newPassword != "" {
+			err = account.SetPassword(ctx, newPassword)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			err = setUserPasswordLastSet(ctx, d, account)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	if d.HasChange("expire_password_trigger") {
+		err = account.ExpirePassword(ctx)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		err = setUserPasswordLastSet(ctx, d, account)
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	}
 
-	if d.HasChange("description") {
-		_, newDescription := d.GetChange("description")
-		err = account.UpdateAttribute("description", []string{newDescription.(string)})
+	if d.HasChange("consistency_guid") || d.HasChange("seed_consistency_guid") {
+		guid := ""
+		if d.HasChange("consistency_guid") {
+			guid = d.Get("consistency_guid").(string)
+		}
+		err = updateUserConsistencyGUID(ctx, d, account, guid)
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	}
 
-	if d.HasChange("password") && d.Get("password").(string)!="" {
-		_, newPassword := d.GetChange("password")
-		err = account.SetPassword(newPassword.(string))
+	if d.HasChange("locked_out") && !d.Get("locked_out").(bool) {
+		err = account.Unlock(ctx)
 		if err != nil {
 			return diag.FromErr(err)
 		}
@@ -324,9 +1158,9 @@ func resourceUserUpdate(ctx context.Context, d *schema.ResourceData, meta interf
 	if d.HasChange("enabled") {
 		_, newEnabledState := d.GetChange("enabled")
 		if newEnabledState.(bool) {
-			err = account.Enable()
+			err = account.Enable(ctx)
 		} else {
-			err = account.Disable()
+			err = account.Disable(ctx)
 		}
 		if err != nil {
 			return diag.FromErr(err)
@@ -336,9 +1170,23 @@ func resourceUserUpdate(ctx context.Context, d *schema.ResourceData, meta interf
 	if d.HasChange("dont_expire_password") {
 		_, newDontExpirePassword := d.GetChange("dont_expire_password")
 		if newDontExpirePassword.(bool) {
-			err = account.AddUACFlag(DONT_EXPIRE_PASSWORD)
+			err = account.AddUACFlag(ctx, DONT_EXPIRE_PASSWORD)
+		} else {
+			err = account.RemoveUACFlag(ctx, DONT_EXPIRE_PASSWORD)
+		}
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	var diags diag.Diagnostics
+	if d.HasChange("dont_require_preauth") {
+		_, newDontRequirePreauth := d.GetChange("dont_require_preauth")
+		if newDontRequirePreauth.(bool) {
+			err = account.AddUACFlag(ctx, DONT_REQ_PREAUTH)
+			diags = append(diags, dontRequirePreauthWarning(sAMAccountName))
 		} else {
-			err = account.RemoveUACFlag(DONT_EXPIRE_PASSWORD)
+			err = account.RemoveUACFlag(ctx, DONT_REQ_PREAUTH)
 		}
 		if err != nil {
 			return diag.FromErr(err)
@@ -348,73 +1196,280 @@ func resourceUserUpdate(ctx context.Context, d *schema.ResourceData, meta interf
 	// Change samaccountname last to avoid having to refresh the object
 	if d.HasChange("sam_account_name") {
 		_, newSAMAccountName := d.GetChange("sam_account_name")
-		err = account.UpdateAttribute("sAMAccountName", []string{newSAMAccountName.(string)})
+		err = account.UpdateAttribute(ctx, client.accountNameAttribute(), []string{newSAMAccountName.(string)})
 		if err != nil {
 			return diag.FromErr(err)
 		}
-		d.SetId(newSAMAccountName.(string))
 	}
 
+	return diags
+}
+
+func resourceUserCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if client, ok := meta.(*LdapClient); ok && client.IsADLDS() && d.Get("user_principal_name").(string) != "" {
+		return fmt.Errorf("user_principal_name can't be set in AD LDS, which keeps sam_account_name in userPrincipalName")
+	}
+	if client, ok := meta.(*LdapClient); ok && !client.IsADLDS() && strings.Contains(d.Get("sam_account_name").(string), "@") {
+		return fmt.Errorf("sam_account_name %q is a user principal name, which only AD LDS keeps in place of a sAMAccountName", d.Get("sam_account_name").(string))
+	}
+	if d.Id() != "" && d.Get("auto_unlock").(bool) && d.Get("locked_out").(bool) {
+		return d.SetNew("locked_out", false)
+	}
 	return nil
 }
 
 func resourceUserDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*LdapClient)
-	sAMAccountName := d.Id()
+	client, err := resourceClient(ctx, d, meta)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	account, err := client.GetAccountBySAMAccountName(sAMAccountName, nil)
+	account, err := client.GetAccountByIdentifier(ctx, d.Id(), objectClassUser, append([]string{"objectGUID"}, accountControlAttributes...))
+	if IsNotFound(err) {
+		return nil
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	err = account.Delete()
+	if d.Get("on_destroy").(string) == "disable" {
+		err = disableUserOnDestroy(ctx, d, account)
+	} else {
+		err = account.Delete(ctx)
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
 	return nil
 }
 
-func resourceUserImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
-	client := meta.(*LdapClient)
-	requestedAttributes := []string{"displayName", "givenName", "sn", "mail", "initials"}
+// disableUserOnDestroy disables, and optionally annotates, renames, and
+// archives an account instead of deleting it.
+func disableUserOnDestroy(ctx context.Context, d *schema.ResourceData, account *LdapAccount) error {
+	err := account.Disable(ctx)
+	if err != nil {
+		return err
+	}
+
+	description := d.Get("on_destroy_description").(string)
+	if description != "" {
+		err = account.UpdateAttribute(ctx, "description", []string{description})
+		if err != nil {
+			return err
+		}
+	}
+
+	namePrefix := d.Get("on_destroy_name_prefix").(string)
+	if namePrefix != "" {
+		name, err := account.Name()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(name, namePrefix) {
+			err = account.Rename(ctx, namePrefix+name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	moveTo := d.Get("on_destroy_move_to").(string)
+	if moveTo != "" {
+		err = account.Move(ctx, moveTo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// userAttributeNames lists the attributes a user is read with.
+func userAttributeNames() []string {
+	names := append([]string{"sAMAccountName", "userPrincipalName", "servicePrincipalName", "description", "displayName", "givenName", "sn", "mail", "initials", "info", "wWWHomePage", "url", "assistant", "seeAlso", "mailNickname", "msExchHideFromAddressLists", "targetAddress", "uidNumber", "gidNumber", "loginShell", "unixHomeDirectory", "pwdLastSet", "objectGUID", "objectSid", "whenCreated", "directReports", "msDS-User-Account-Control-Computed", "sIDHistory", "msDS-ConsistencyGuid", "adminCount"}, accountControlAttributes...)
+	return append(names, extensionAttributeNames()...)
+}
+
+func extensionAttributeNames() []string {
+	names := make([]string, 15)
+	for i := range names {
+		names[i] = fmt.Sprintf("extensionAttribute%d", i+1)
+	}
+	return names
+}
+
+// getExtensionAttributes returns the set extensionAttributeN values keyed by N.
+func getExtensionAttributes(ctx context.Context, account *LdapAccount) (map[string]string, error) {
+	extensionAttributes := map[string]string{}
+	for i, name := range extensionAttributeNames() {
+		value, err := account.GetAttributeValue(ctx, name)
+		if err != nil {
+			return extensionAttributes, err
+		}
+		if value != "" {
+			extensionAttributes[fmt.Sprintf("%d", i+1)] = value
+		}
+	}
+	return extensionAttributes, nil
+}
+
+func dontRequirePreauthWarning(sAMAccountName string) diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  "Kerberos pre-authentication disabled",
+		Detail:   fmt.Sprintf("Account %s does not require Kerberos pre-authentication, which allows anyone to request encrypted material for offline password cracking (AS-REP roasting).  Ensure the account has a long, random password.", sAMAccountName),
+	}
+}
+
+// adoptUserAccount converges an existing account, read with the configured
+// attributes, on the configuration instead of creating it.  The password is
+// only set when set_password_on_adopt is true.
+func adoptUserAccount(ctx context.Context, d *schema.ResourceData, account *LdapAccount, password string, ou string, attributes map[string][]string) error {
+	if commonName, ok := attributes["cn"]; ok {
+		delete(attributes, "cn")
+		err := account.Rename(ctx, commonName[0])
+		if err != nil {
+			return err
+		}
+	}
 
-	// Use the samAccountName as the resource ID
-	account, err := client.GetAccountBySAMAccountName(d.Id(), requestedAttributes)
+	parentDN, err := account.ParentDN()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if parentDN != ou {
+		err = account.Move(ctx, ou)
+		if err != nil {
+			return err
+		}
 	}
 
-	distinguishedName := account.ParentDN()
-	givenName, _ := account.GetAttributeValue("givenName")
-	sn, _ := account.GetAttributeValue("sn")
-	initials, _ := account.GetAttributeValue("initials")
-	mail, _ := account.GetAttributeValue("mail")
-	displayName, _ := account.GetAttributeValue("displayName")
-	userPrincipalName, _ := account.GetAttributeValue("userPrincipalName")
-	servicePrincipalName, _ := account.GetAttributeValues("servicePrincipalName")
-	description, _ := account.GetAttributeValue("description")
-	dontExpirePassword, err := account.UACFlagIsSet(DONT_EXPIRE_PASSWORD)
+	err = account.UpdateAttributes(ctx, attributes)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	accountEnabled, err := account.IsEnabled()
+	if password != "" && d.Get("set_password_on_adopt").(bool) {
+		err = account.SetPassword(ctx, password)
+		if err != nil {
+			return fmt.Errorf("error setting password: %s", err)
+		}
+	}
+
+	// The create path only ever sets DONT_REQ_PREAUTH, so it is cleared here
+	if !d.Get("dont_require_preauth").(bool) {
+		err = account.RemoveUACFlag(ctx, DONT_REQ_PREAUTH)
+		if err != nil {
+			return err
+		}
+	}
+
+	return account.Refresh(ctx)
+}
+
+// updateUserConsistencyGUID sets msDS-ConsistencyGuid to the GUID, or, when
+// no GUID is given and seed_consistency_guid is set, to the objectGUID if the
+// user has none yet, and records the result.
+func updateUserConsistencyGUID(ctx context.Context, d *schema.ResourceData, account *LdapAccount, guid string) error {
+	current, err := account.GetConsistencyGUID(ctx)
+	if err != nil {
+		return err
+	}
+	if guid == "" && current == "" && d.Get("seed_consistency_guid").(bool) {
+		guid, err = account.GetObjectGUID(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if guid != "" && !strings.EqualFold(strings.Trim(guid, "{}"), current) {
+		err = account.SetConsistencyGUID(ctx, guid)
+		if err != nil {
+			return err
+		}
+		current = strings.ToLower(strings.Trim(guid, "{}"))
+	}
+
+	d.Set("consistency_guid", current)
+	return nil
+}
+
+// setUserPasswordLastSet records pwdLastSet after Terraform has set the
+// password, so later reads can tell out-of-band changes apart from our own.
+func setUserPasswordLastSet(ctx context.Context, d *schema.ResourceData, account *LdapAccount) error {
+	err := account.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+
+	passwordLastSet, err := account.GetPasswordLastSet(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.Set("password_last_set", timeToString(passwordLastSet))
+
+	return nil
+}
+
+// userPasswordDrift warns when the password has been changed since Terraform
+// last set it, and clears the stored password when enforce_password is set so
+// that the next plan resets it.
+func userPasswordDrift(d *schema.ResourceData, sAMAccountName string, passwordLastSet string) diag.Diagnostics {
+	knownPasswordLastSet := d.Get("password_last_set").(string)
+	password := d.Get("password").(string)
+	managed := password != "" || d.Get("password_wo_version").(int) != 0
+
+	if !managed || knownPasswordLastSet == "" || knownPasswordLastSet == passwordLastSet {
+		return nil
+	}
+
+	detail := fmt.Sprintf("The password for %s was last set at %q, but Terraform last set it at %q.", sAMAccountName, passwordLastSet, knownPasswordLastSet)
+	if d.Get("enforce_password").(bool) && password != "" {
+		d.Set("password", "")
+		detail += "  The managed password will be reset on the next apply."
+	} else {
+		detail += "  The managed password value is stale."
+	}
+
+	return diag.Diagnostics{
+		{
+			Severity: diag.Warning,
+			Summary:  "Password changed outside of Terraform",
+			Detail:   detail,
+		},
+	}
+}
+
+// userPassword returns the configured password, preferring the write-only
+// password_wo argument, which is only available from the raw config.
+func userPassword(d *schema.ResourceData) (string, diag.Diagnostics) {
+	passwordWO, diags := d.GetRawConfigAt(cty.GetAttrPath("password_wo"))
+	if diags.HasError() {
+		return "", diags
+	}
+	if passwordWO.IsKnown() && !passwordWO.IsNull() {
+		return passwordWO.AsString(), nil
+	}
+
+	return d.Get("password").(string), nil
+}
+
+func resourceUserImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	client, err := importDomain(ctx, d, meta)
 	if err != nil {
 		return nil, err
 	}
 
-	d.Set("sam_account_name", d.Id())
-	d.Set("organizational_unit", distinguishedName)
-	d.Set("display_name", displayName)
-	d.Set("user_principal_name", userPrincipalName)
-	d.Set("service_principal_names", servicePrincipalName)
-	d.Set("description", description)
-	d.Set("dont_expire_password", dontExpirePassword)
-	d.Set("enabled", accountEnabled)
-	d.Set("given_name", givenName)
-	d.Set("surname", sn)
-	d.Set("initials", initials)
-	d.Set("email_address", mail)
+	// Accept a sAMAccountName, DN, or objectGUID, and use the objectGUID as the resource ID
+	account, err := client.GetAccountByIdentifier(ctx, d.Id(), objectClassUser, []string{"objectGUID"})
+	if err != nil {
+		return nil, err
+	}
+	objectGUID, err := account.GetObjectGUID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.SetId(objectGUID)
 
-	return []*schema.ResourceData{d}, nil
+	return importResource(ctx, d, meta, resourceUser())
 }
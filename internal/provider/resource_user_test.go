@@ -1,13 +1,17 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/sethvargo/go-password/password"
@@ -22,6 +26,19 @@ var (
 	testUserOU2      = os.Getenv("ADLDAP_TEST_USER_OU2")
 )
 
+func init() {
+	resource.AddTestSweepers("adldap_user", &resource.Sweeper{
+		Name:         "adldap_user",
+		Dependencies: []string{"adldap_service_principal"},
+		F: func(region string) error {
+			filter := fmt.Sprintf("(&(objectClass=user)(!(objectClass=computer))(sAMAccountName=%s*))", testSweepPrefix)
+			return testSweepEntries(filter, func(ctx context.Context, entry *LdapEntry) error {
+				return entry.Delete(ctx)
+			})
+		},
+	})
+}
+
 func init() {
 	if testUserOU == "" {
 		testUserOU = testAccProviderMeta.SearchBase
@@ -33,8 +50,6 @@ func TestAccAdldapResourceUser(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	testUserPassword2 = strings.ReplaceAll(testUserPassword2, "\\", "\\\\")
-	testUserPassword2 = strings.ReplaceAll(testUserPassword2, "\"", "\\\"")
 
 	resource.UnitTest(t, resource.TestCase{
 		PreCheck:  func() { testAccPreCheck(t) },
@@ -44,11 +59,11 @@ func TestAccAdldapResourceUser(t *testing.T) {
 				Config: testAccAdldapResourceUser(testUser, testUserPassword, testUserFullName, testUserOU),
 				Check: resource.ComposeTestCheckFunc(
 					resource.TestCheckResourceAttr(
-						"adldap_user.foo", "samaccountname", testUser),
+						"adldap_user.foo", "sam_account_name", testUser),
 					resource.TestCheckTypeSetElemAttr(
-						"adldap_user.foo", "spns.*", fmt.Sprintf("TFTEST/%s", testUser)),
+						"adldap_user.foo", "service_principal_names.*", fmt.Sprintf("TFTEST/%s", testUser)),
 					resource.TestCheckTypeSetElemAttr(
-						"adldap_user.foo", "spns.*", fmt.Sprintf("TFTEST-2/%s", testUser)),
+						"adldap_user.foo", "service_principal_names.*", fmt.Sprintf("TFTEST-2/%s", testUser)),
 					testAccAdldapUserBind(testUser, testUserPassword),
 				),
 			},
@@ -63,7 +78,7 @@ func TestAccAdldapResourceUser(t *testing.T) {
 				Config: testAccAdldapResourceUser(testUser, testUserPassword, testUserFullName+"-2", testUserOU2),
 				Check: resource.ComposeTestCheckFunc(
 					resource.TestCheckResourceAttr(
-						"adldap_user.foo", "name", testUserFullName+"-2"),
+						"adldap_user.foo", "display_name", testUserFullName+"-2"),
 				),
 			},
 			{
@@ -76,11 +91,35 @@ func TestAccAdldapResourceUser(t *testing.T) {
 				Config: testAccAdldapResourceUser(testUser+"b", testUserPassword2, testUserFullName+"-2", testUserOU2),
 				Check: resource.ComposeTestCheckFunc(
 					resource.TestCheckResourceAttr(
-						"adldap_user.foo", "samaccountname", testUser+"b"),
+						"adldap_user.foo", "sam_account_name", testUser+"b"),
 					resource.TestCheckTypeSetElemAttr(
-						"adldap_user.foo", "spns.*", fmt.Sprintf("TFTEST/%s", testUser+"b")),
+						"adldap_user.foo", "service_principal_names.*", fmt.Sprintf("TFTEST/%s", testUser+"b")),
 					resource.TestCheckTypeSetElemAttr(
-						"adldap_user.foo", "spns.*", fmt.Sprintf("TFTEST-2/%s", testUser+"b")),
+						"adldap_user.foo", "service_principal_names.*", fmt.Sprintf("TFTEST-2/%s", testUser+"b")),
+				),
+			},
+		},
+	})
+}
+
+func TestAccAdldapResourceUser_specialCharacters(t *testing.T) {
+	userName := fmt.Sprintf("tfacc(%d)", rInt)
+	fullName := fmt.Sprintf("Test (%d), *Special+<User>", rInt)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAdldapResourceUser(userName, testUserPassword, fullName, testUserOU),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"adldap_user.foo", "sam_account_name", userName),
+					resource.TestCheckResourceAttr(
+						"adldap_user.foo", "display_name", fullName),
+					resource.TestCheckResourceAttr(
+						"adldap_user.foo", "common_name", fullName),
+					testAccAdldapUserBind(userName, testUserPassword),
 				),
 			},
 		},
@@ -90,26 +129,439 @@ func TestAccAdldapResourceUser(t *testing.T) {
 func testAccAdldapResourceUser(userName string, password string, fullName string, userOU string) string {
 	return fmt.Sprintf(`
 resource "adldap_user" "foo" {
-  samaccountname      = "%s"
-  password            = "%s"
-  organizational_unit = "%s"
-  name                = "%s"
-  upn                 = "%s@example.com"
-  spns                = ["TFTEST/%s","TFTEST-2/%s"]
+  sam_account_name        = "%s"
+  password                = "%s"
+  organizational_unit     = "%s"
+  display_name            = "%s"
+  user_principal_name     = "%s@example.com"
+  service_principal_names = ["TFTEST/%s","TFTEST-2/%s"]
 }
-`, userName, password, userOU, fullName, userName, userName, userName)
+`, userName, testAccEscapeHCL(password), userOU, testAccEscapeHCL(fullName), userName, userName, userName)
+}
+
+// testAccEscapeHCL escapes a value for a quoted HCL string, so generated
+// passwords reach the provider unchanged.
+func testAccEscapeHCL(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", "$${", "%{", "%%{").Replace(value)
 }
 
 func testAccAdldapUserBind(samaccountname string, password string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		dn, err := testAccProviderMeta.GetDN(samaccountname)
+		dn, err := testAccProviderMeta.GetDN(context.Background(), samaccountname)
 		if err != nil {
 			return err
 		}
-		_, err = testProviderConfigure(testConfig.url, testConfig.searchBase, dn, password)
+		success, err := testAccProviderMeta.CheckBind(context.Background(), dn, password)
 		if err != nil {
 			return fmt.Errorf("error binding to test account %s: %s", samaccountname, err)
 		}
+		if !success {
+			return fmt.Errorf("error binding to test account %s: credentials rejected", samaccountname)
+		}
 		return nil
 	}
 }
+
+func TestAdldapResourceUser_fake(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceUser()
+	ou := "CN=Users," + fakeDomainDN
+
+	config := map[string]interface{}{
+		"organizational_unit": ou,
+		"sam_account_name":    "fakeuser",
+		"display_name":        "Fake User",
+		"password":            "Passw0rd!",
+	}
+	state := fakeApply(t, r, nil, config, client)
+	userDN := "CN=Fake User," + ou
+	if directory.Entry(userDN) == nil {
+		t.Fatalf("Error creating user: %s not found", userDN)
+	}
+	if got := directory.Password(userDN); got != "Passw0rd!" {
+		t.Errorf("Error setting password: got %q", got)
+	}
+	if state.ID != state.Attributes["object_guid"] || state.Attributes["enabled"] != "true" {
+		t.Errorf("Error creating user: got ID %s, attributes %v", state.ID, state.Attributes)
+	}
+
+	config["given_name"] = "Fake"
+	config["surname"] = "User"
+	config["description"] = "Changed together"
+	config["extension_attributes"] = map[string]interface{}{"1": "one"}
+	modifies := directory.Modifies()
+	state = fakeApply(t, r, state, config, client)
+	if got := directory.Modifies() - modifies; got != 1 {
+		t.Errorf("Error batching attribute changes: got %d modify requests, wanted 1", got)
+	}
+	entry := directory.Entry(userDN)
+	if fakeAttribute(entry, "sn")[0] != "User" || fakeAttribute(entry, "extensionAttribute1")[0] != "one" {
+		t.Errorf("Error updating attributes: got %v", entry)
+	}
+
+	searches := directory.Searches()
+	fakeRefresh(t, r, state, client)
+	if got := directory.Searches() - searches; got != 1 {
+		t.Errorf("Error reading the user in one search: got %d search requests", got)
+	}
+
+	delete(config, "description")
+	config["sam_account_name"] = "renameduser"
+	state = fakeApply(t, r, state, config, client)
+	state = fakeRefresh(t, r, state, client)
+	entry = directory.Entry(userDN)
+	if fakeAttribute(entry, "description") != nil || state.Attributes["sam_account_name"] != "renameduser" {
+		t.Errorf("Error clearing description and renaming: got %v", entry)
+	}
+
+	fakeApply(t, r, state, nil, client)
+	if directory.Entry(userDN) != nil {
+		t.Errorf("Error destroying user: %s still exists", userDN)
+	}
+}
+
+func TestAdldapResourceUser_restoreDeleted(t *testing.T) {
+	client, directory := newFakeClient(t)
+	directory.recycleBin = true
+	r := resourceUser()
+	ou := "CN=Users," + fakeDomainDN
+	userDN := "CN=Deleted User," + ou
+
+	config := map[string]interface{}{
+		"organizational_unit": ou,
+		"sam_account_name":    "deleteduser",
+		"display_name":        "Deleted User",
+		"password":            "Passw0rd!",
+	}
+	state := fakeApply(t, r, nil, config, client)
+	objectGUID := state.ID
+	if err := client.Conn.Del(ldap.NewDelRequest(userDN, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, diags := r.RefreshWithoutUpgrade(context.Background(), state, client)
+	if refreshed != nil || len(diags) != 1 || !strings.Contains(diags[0].Summary, "pending recycle") {
+		t.Fatalf("Error reporting deleted user: got %v, %v", refreshed, diags)
+	}
+
+	config["restore_deleted"] = true
+	config["description"] = "Restored"
+	state = fakeApply(t, r, nil, config, client)
+	if state.ID != objectGUID {
+		t.Errorf("Error restoring user: got objectGUID %s, wanted %s", state.ID, objectGUID)
+	}
+	entry := directory.Entry(userDN)
+	if entry == nil || fakeIsDeleted(entry) || fakeAttribute(entry, "description")[0] != "Restored" {
+		t.Errorf("Error restoring user: got %v", entry)
+	}
+
+	fakeApply(t, r, state, nil, client)
+	for _, entry := range directory.entries {
+		if fakeIsDeleted(entry) {
+			entry["isRecycled"] = []string{"TRUE"}
+		}
+	}
+	refreshed, diags = r.RefreshWithoutUpgrade(context.Background(), state, client)
+	if refreshed != nil || len(diags) != 1 || !strings.Contains(diags[0].Summary, "recycled") {
+		t.Fatalf("Error reporting recycled user: got %v, %v", refreshed, diags)
+	}
+	state = fakeApply(t, r, nil, config, client)
+	if state.ID == objectGUID {
+		t.Errorf("Error recreating recycled user: got the recycled objectGUID %s", state.ID)
+	}
+}
+
+func TestAdldapResourceUser_adoptExisting(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceUser()
+	ctx := context.Background()
+	ou := "CN=Users," + fakeDomainDN
+
+	account, err := client.CreateUserAccount(ctx, "roastable", "Passw0rd!", ou, map[string][]string{"cn": {"roastable"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := account.AddUACFlag(ctx, DONT_REQ_PREAUTH); err != nil {
+		t.Fatal(err)
+	}
+
+	state := fakeApply(t, r, nil, map[string]interface{}{
+		"organizational_unit":  ou,
+		"sam_account_name":     "roastable",
+		"password":             "Passw0rd!",
+		"adopt_existing":       true,
+		"dont_require_preauth": false,
+	}, client)
+	userAccountControl, _ := strconv.ParseInt(fakeAttribute(directory.Entry("CN=roastable,"+ou), "userAccountControl")[0], 10, 64)
+	if userAccountControl&DONT_REQ_PREAUTH != 0 {
+		t.Errorf("Error clearing DONT_REQ_PREAUTH on adoption: got userAccountControl %d", userAccountControl)
+	}
+	if got := state.Attributes["dont_require_preauth"]; got != "false" {
+		t.Errorf("Error reading dont_require_preauth after adoption: got %s", got)
+	}
+}
+
+func TestAdldapResourceUser_userPrincipalNameAsSAMAccountName(t *testing.T) {
+	client, _ := newFakeClient(t)
+	r := resourceUser()
+
+	// Only AD LDS keeps sam_account_name in userPrincipalName
+	config := map[string]interface{}{
+		"organizational_unit": "CN=Users," + fakeDomainDN,
+		"sam_account_name":    "jdoe@example.com",
+	}
+	rawConfig, err := fakeCtyValue(config, r.CoreConfigSchema().ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Diff(context.Background(), &terraform.InstanceState{RawConfig: rawConfig, RawPlan: rawConfig}, terraform.NewResourceConfigRaw(config), client)
+	if err == nil || !strings.Contains(err.Error(), "only AD LDS") {
+		t.Errorf("Error refusing a user principal name as sam_account_name in AD: got %v", err)
+	}
+}
+
+func TestAdldapResourceUser_adminSDHolder(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceUser()
+	ou := "CN=Users," + fakeDomainDN
+
+	state := fakeApply(t, r, nil, map[string]interface{}{
+		"organizational_unit": ou,
+		"sam_account_name":    "adminuser",
+		"password":            "Passw0rd!",
+	}, client)
+	if _, diags := r.RefreshWithoutUpgrade(context.Background(), state, client); len(diags) != 0 {
+		t.Fatalf("Error reading an unprotected user: got %v", diags)
+	}
+
+	// SDProp marks members of protected groups
+	modify := ldap.NewModifyRequest("CN=adminuser,"+ou, nil)
+	modify.Replace("adminCount", []string{"1"})
+	if err := directory.Modify(modify); err != nil {
+		t.Fatal(err)
+	}
+	_, diags := r.RefreshWithoutUpgrade(context.Background(), state, client)
+	if len(diags) != 1 || diags[0].Severity != diag.Warning || !strings.Contains(diags[0].Detail, "adminuser") {
+		t.Errorf("Error warning about an AdminSDHolder-protected user: got %v", diags)
+	}
+}
+
+func TestAdldapResourceUser_lockout(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceUser()
+	ou := "CN=Users," + fakeDomainDN
+	userDN := "CN=lockeduser," + ou
+	config := map[string]interface{}{
+		"organizational_unit": ou,
+		"sam_account_name":    "lockeduser",
+		"password":            "Passw0rd!",
+		"auto_unlock":         true,
+	}
+	state := fakeApply(t, r, nil, config, client)
+	lockOut := func(at time.Time) {
+		modify := ldap.NewModifyRequest(userDN, nil)
+		modify.Replace("lockoutTime", []string{strconv.FormatInt(at.UnixNano()/100+116444736000000000, 10)})
+		if err := directory.Modify(modify); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// AD leaves lockoutTime set once the lockout duration has expired
+	lockOut(time.Now().Add(-2 * time.Hour))
+	state = fakeRefresh(t, r, state, client)
+	if state.Attributes["locked_out"] != "false" {
+		t.Errorf("Error reading an expired lockout: got locked_out %s", state.Attributes["locked_out"])
+	}
+	modifies := directory.Modifies()
+	state = fakeApply(t, r, state, config, client)
+	if got := directory.Modifies() - modifies; got != 0 {
+		t.Errorf("Error unlocking an expired lockout: got %d modify requests, wanted 0", got)
+	}
+
+	lockOut(time.Now().Add(-time.Minute))
+	state = fakeRefresh(t, r, state, client)
+	if state.Attributes["locked_out"] != "true" {
+		t.Fatalf("Error reading a lockout: got locked_out %s", state.Attributes["locked_out"])
+	}
+	fakeApply(t, r, state, config, client)
+	if got := fakeAttribute(directory.Entry(userDN), "lockoutTime"); len(got) != 1 || got[0] != "0" {
+		t.Errorf("Error unlocking with auto_unlock: got lockoutTime %v", got)
+	}
+}
+
+func TestAdldapResourceUser_ignoreAttributes(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceUser()
+	ou := "CN=Users," + fakeDomainDN
+	userDN := "CN=Ignoring User," + ou
+
+	state := fakeApply(t, r, nil, map[string]interface{}{
+		"organizational_unit":  ou,
+		"sam_account_name":     "ignoringuser",
+		"display_name":         "Ignoring User",
+		"description":          "Terraform",
+		"extension_attributes": map[string]interface{}{"1": "one", "2": "two"},
+		"ignore_attributes":    []interface{}{"Description", "extensionAttribute2"},
+	}, client)
+
+	request := ldap.NewModifyRequest(userDN, nil)
+	request.Replace("description", []string{"Exchange"})
+	request.Replace("extensionAttribute1", []string{"drifted"})
+	request.Replace("extensionAttribute2", []string{"Exchange"})
+	if err := directory.Modify(request); err != nil {
+		t.Fatal(err)
+	}
+
+	state = fakeRefresh(t, r, state, client)
+	if state.Attributes["description"] != "Terraform" || state.Attributes["extension_attributes.2"] != "two" {
+		t.Errorf("Error ignoring attribute changes: got %v", state.Attributes)
+	}
+	if state.Attributes["extension_attributes.1"] != "drifted" {
+		t.Errorf("Error reading attribute changes that aren't ignored: got %v", state.Attributes)
+	}
+}
+
+func TestAdldapResourceUser_import(t *testing.T) {
+	client, _ := newFakeClient(t)
+	r := resourceUser()
+	ctx := context.Background()
+
+	_, err := client.CreateUserAccount(ctx, "importeduser", "", "CN=Users,"+fakeDomainDN, map[string][]string{
+		"cn":          {"Imported User"},
+		"displayName": {"Imported User"},
+		"description": {"Created outside Terraform"},
+		"uidNumber":   {"1001"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := r.Importer.StateContext(ctx, r.Data(&terraform.InstanceState{ID: "importeduser"}), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := imported[0].State().Attributes
+	expected := map[string]string{
+		"sam_account_name":      "importeduser",
+		"display_name":          "Imported User",
+		"common_name":           "Imported User",
+		"description":           "Created outside Terraform",
+		"uid_number":            "1001",
+		"adopt_existing":        "false",
+		"set_password_on_adopt": "true",
+		"enabled":               "false",
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("Error importing %s: got %q, expected %q", key, attributes[key], value)
+		}
+	}
+	if attributes["id"] != attributes["object_guid"] || attributes["object_guid"] == "" {
+		t.Errorf("Error importing ID: got %v", attributes)
+	}
+}
+
+func TestAdldapResourceUser_consistencyGUID(t *testing.T) {
+	client, directory := newFakeClient(t)
+	r := resourceUser()
+	ou := "CN=Users," + fakeDomainDN
+	userDN := "CN=Hybrid User," + ou
+
+	config := map[string]interface{}{
+		"organizational_unit":   ou,
+		"sam_account_name":      "hybriduser",
+		"display_name":          "Hybrid User",
+		"seed_consistency_guid": true,
+	}
+	state := fakeApply(t, r, nil, config, client)
+	if state.Attributes["consistency_guid"] != state.ID {
+		t.Errorf("Error seeding msDS-ConsistencyGuid from objectGUID: got %s, expected %s", state.Attributes["consistency_guid"], state.ID)
+	}
+	if got := fakeAttribute(directory.Entry(userDN), "msDS-ConsistencyGuid"); len(got) != 1 || got[0] != fakeAttribute(directory.Entry(userDN), "objectGUID")[0] {
+		t.Errorf("Error storing msDS-ConsistencyGuid in objectGUID byte order: got %v", got)
+	}
+
+	// A cleared value is seeded again
+	request := ldap.NewModifyRequest(userDN, nil)
+	request.Replace("msDS-ConsistencyGuid", []string{})
+	if err := directory.Modify(request); err != nil {
+		t.Fatal(err)
+	}
+	state = fakeRefresh(t, r, state, client)
+	if state.Attributes["seed_consistency_guid"] != "false" {
+		t.Errorf("Error reporting a cleared msDS-ConsistencyGuid: got %v", state.Attributes)
+	}
+	state = fakeApply(t, r, state, config, client)
+	if state.Attributes["consistency_guid"] != state.ID {
+		t.Errorf("Error seeding msDS-ConsistencyGuid again: got %s", state.Attributes["consistency_guid"])
+	}
+
+	delete(config, "seed_consistency_guid")
+	config["consistency_guid"] = "{0E6F3A1C-2B4D-4E5F-8A9B-C0D1E2F3A4B5}"
+	state = fakeApply(t, r, state, config, client)
+	state = fakeRefresh(t, r, state, client)
+	if state.Attributes["consistency_guid"] != "0e6f3a1c-2b4d-4e5f-8a9b-c0d1e2f3a4b5" {
+		t.Errorf("Error setting msDS-ConsistencyGuid: got %s", state.Attributes["consistency_guid"])
+	}
+}
+
+func TestAdldapResourceUser_adlds(t *testing.T) {
+	client, directory := newFakeADLDSClient(t)
+	r := resourceUser()
+	ou := "CN=Users," + fakeDomainDN
+
+	// The sam_account_name is kept in userPrincipalName, and enabled in
+	// msDS-UserAccountDisabled
+	config := map[string]interface{}{
+		"organizational_unit":  ou,
+		"sam_account_name":     "ldsuser",
+		"password":             "Passw0rd!",
+		"dont_expire_password": true,
+	}
+	state := fakeApply(t, r, nil, config, client)
+	userDN := "CN=ldsuser," + ou
+	entry := directory.Entry(userDN)
+	if entry == nil || fakeAttribute(entry, "userPrincipalName")[0] != "ldsuser" || fakeAttribute(entry, "sAMAccountName") != nil {
+		t.Fatalf("Error creating user: got %v", entry)
+	}
+	if fakeAttribute(entry, "msDS-UserAccountDisabled")[0] != "FALSE" || fakeAttribute(entry, "msDS-UserDontExpirePassword")[0] != "TRUE" {
+		t.Errorf("Error enabling user: got %v", entry)
+	}
+
+	refreshed := fakeRefresh(t, r, state, client)
+	if refreshed.Attributes["sam_account_name"] != "ldsuser" || refreshed.Attributes["enabled"] != "true" || refreshed.Attributes["user_principal_name"] != "" {
+		t.Errorf("Error reading user: got %v", refreshed.Attributes)
+	}
+
+	config["enabled"] = false
+	config["sam_account_name"] = "renamed"
+	state = fakeApply(t, r, state, config, client)
+	entry = directory.Entry(userDN)
+	if fakeAttribute(entry, "msDS-UserAccountDisabled")[0] != "TRUE" || fakeAttribute(entry, "userPrincipalName")[0] != "renamed" {
+		t.Errorf("Error disabling and renaming user: got %v", entry)
+	}
+
+	// A user principal name can stand in for the sAMAccountName
+	config["sam_account_name"] = "lds.user.contractor@example.com"
+	fakeApply(t, r, state, config, client)
+	entry = directory.Entry(userDN)
+	if fakeAttribute(entry, "userPrincipalName")[0] != "lds.user.contractor@example.com" {
+		t.Errorf("Error keeping a user principal name in sam_account_name: got %v", entry)
+	}
+
+	// AD LDS has no userPrincipalName to spare
+	config["user_principal_name"] = "ldsuser@example.com"
+	rawConfig, err := fakeCtyValue(config, r.CoreConfigSchema().ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Diff(context.Background(), &terraform.InstanceState{RawConfig: rawConfig, RawPlan: rawConfig}, terraform.NewResourceConfigRaw(config), client)
+	if err == nil {
+		t.Error("Error refusing user_principal_name in AD LDS")
+	}
+
+	// AD LDS has no computer accounts
+	if _, err := client.CreateComputerAccount(context.Background(), "host$", "", "CN=Computers,"+fakeDomainDN, nil); err == nil {
+		t.Error("Error refusing to create a computer in AD LDS")
+	}
+}
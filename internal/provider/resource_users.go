@@ -0,0 +1,837 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	uac "github.com/audibleblink/msldapuac"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/id"
+)
+
+// Attributes of the users in adldap_users, all read with the one search
+var usersResourceAttributeNames = append([]string{"sAMAccountName", "displayName", "givenName", "sn", "mail", "userPrincipalName", "description", "objectGUID", "objectSid", "adminCount"}, accountControlAttributes...)
+
+// usersResource manages many users with batched adds, modifies, and deletes
+// and a single search per read, for fleets too large to manage as adldap_user
+// resources.  It is served by the framework provider because the SDK can't
+// take a map of objects.
+type usersResource struct {
+	client *lazyClient
+}
+
+func newUsersResource() resource.Resource {
+	return &usersResource{}
+}
+
+type usersResourceModel struct {
+	ID          types.String `tfsdk:"id"`
+	Domain      types.String `tfsdk:"domain"`
+	Parallelism types.Int64  `tfsdk:"parallelism"`
+	Users       types.Map    `tfsdk:"users"`
+}
+
+type usersResourceUserModel struct {
+	SAMAccountName     types.String `tfsdk:"sam_account_name"`
+	OrganizationalUnit types.String `tfsdk:"organizational_unit"`
+	Password           types.String `tfsdk:"password"`
+	Enabled            types.Bool   `tfsdk:"enabled"`
+	DisplayName        types.String `tfsdk:"display_name"`
+	GivenName          types.String `tfsdk:"given_name"`
+	Surname            types.String `tfsdk:"surname"`
+	EmailAddress       types.String `tfsdk:"email_address"`
+	UserPrincipalName  types.String `tfsdk:"user_principal_name"`
+	Description        types.String `tfsdk:"description"`
+	DistinguishedName  types.String `tfsdk:"distinguished_name"`
+	ObjectGUID         types.String `tfsdk:"object_guid"`
+	SID                types.String `tfsdk:"sid"`
+}
+
+// usersResourceUserType is the type of the objects in the users map.
+var usersResourceUserType = types.ObjectType{AttrTypes: map[string]attr.Type{
+	"sam_account_name":    types.StringType,
+	"organizational_unit": types.StringType,
+	"password":            types.StringType,
+	"enabled":             types.BoolType,
+	"display_name":        types.StringType,
+	"given_name":          types.StringType,
+	"surname":             types.StringType,
+	"email_address":       types.StringType,
+	"user_principal_name": types.StringType,
+	"description":         types.StringType,
+	"distinguished_name":  types.StringType,
+	"object_guid":         types.StringType,
+	"sid":                 types.StringType,
+}}
+
+// stringAttributes returns the user's arguments holding a single attribute,
+// keyed by LDAP name.
+func (u *usersResourceUserModel) stringAttributes() map[string]*types.String {
+	return map[string]*types.String{
+		"displayName":       &u.DisplayName,
+		"givenName":         &u.GivenName,
+		"sn":                &u.Surname,
+		"mail":              &u.EmailAddress,
+		"userPrincipalName": &u.UserPrincipalName,
+		"description":       &u.Description,
+	}
+}
+
+// attributes returns the values the user is created with, by LDAP name.
+func (u usersResourceUserModel) attributes() map[string][]string {
+	attributes := make(map[string][]string)
+	for name, value := range u.stringAttributes() {
+		if value.ValueString() != "" {
+			attributes[name] = []string{value.ValueString()}
+		}
+	}
+	return attributes
+}
+
+// changed reports whether any argument of the user differs from before.
+func (u usersResourceUserModel) changed(prior usersResourceUserModel) bool {
+	if !u.SAMAccountName.Equal(prior.SAMAccountName) || !u.OrganizationalUnit.Equal(prior.OrganizationalUnit) ||
+		!u.Password.Equal(prior.Password) || !u.Enabled.Equal(prior.Enabled) {
+		return true
+	}
+	priorAttributes := prior.stringAttributes()
+	for name, value := range u.stringAttributes() {
+		if !value.Equal(*priorAttributes[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m usersResourceModel) users(ctx context.Context) (map[string]usersResourceUserModel, diag.Diagnostics) {
+	users := make(map[string]usersResourceUserModel)
+	if m.Users.IsNull() || m.Users.IsUnknown() {
+		return users, nil
+	}
+	diags := m.Users.ElementsAs(ctx, &users, false)
+	return users, diags
+}
+
+func (m *usersResourceModel) setUsers(ctx context.Context, users map[string]usersResourceUserModel) diag.Diagnostics {
+	value, diags := types.MapValueFrom(ctx, usersResourceUserType, users)
+	m.Users = value
+	return diags
+}
+
+func (m usersResourceModel) parallelism() int {
+	if m.Parallelism.IsNull() || m.Parallelism.IsUnknown() {
+		return defaultBulkParallelism
+	}
+	return int(m.Parallelism.ValueInt64())
+}
+
+// domainClient returns the client for the users' domain.
+func (m usersResourceModel) domainClient(ctx context.Context, l *lazyClient) (*LdapClient, error) {
+	client, err := l.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.ForDomain(ctx, m.Domain.ValueString())
+}
+
+func sortedUserKeys(users map[string]usersResourceUserModel) []string {
+	keys := make([]string, 0, len(users))
+	for key := range users {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringValueOrNull(value string) types.String {
+	if value == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(value)
+}
+
+func (r *usersResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_users"
+}
+
+func (r *usersResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "`adldap_users` manages many user accounts as one resource, creating, changing, and deleting them in parallel batches and reading them all with a single search, for fleets too large to manage as `adldap_user` resources.  It covers the common attributes only; manage users that need more with `adldap_user`.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "A random identifier of the resource.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"domain": schema.StringAttribute{
+				Description: "The DNS name of the domain to manage the users in: one of the provider's `domain` blocks, or with `discover_domains`, any domain in the forest or trusting the provider's.  Changing it deletes the users and creates them in the new domain.  Defaults to the provider's domain.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplaceIf(func(ctx context.Context, req planmodifier.StringRequest, resp *stringplanmodifier.RequiresReplaceIfFuncResponse) {
+						resp.RequiresReplace = !strings.EqualFold(strings.TrimSuffix(req.StateValue.ValueString(), "."), strings.TrimSuffix(req.PlanValue.ValueString(), "."))
+					}, "Changing the domain deletes the users and creates them again.", "Changing the domain deletes the users and creates them again."),
+				},
+			},
+			"parallelism": schema.Int64Attribute{
+				Description: "How many adds, modifies, or deletes to have in flight on the connection at once.  Defaults to `10`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(defaultBulkParallelism),
+			},
+			"users": schema.MapNestedAttribute{
+				Description: "The users, keyed by any name that stays the same for the life of each user, such as an employee number.  Changing a key deletes the user and creates it again.  Users deleted outside Terraform are created again on the next apply.",
+				Required:    true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"sam_account_name": schema.StringAttribute{
+							Description: "The sAMAccountName of the user.",
+							Required:    true,
+						},
+						"organizational_unit": schema.StringAttribute{
+							Description: "The OU that the user should be in.",
+							Required:    true,
+						},
+						"password": schema.StringAttribute{
+							Description: "The password for the user, set when the user is created and whenever it changes.  Changes made outside Terraform aren't detected.",
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"enabled": schema.BoolAttribute{
+							Description: "Whether the account is enabled.  AD only enables accounts with a password.  Defaults to `true`.",
+							Optional:    true,
+							Computed:    true,
+							Default:     booldefault.StaticBool(true),
+						},
+						"display_name": schema.StringAttribute{
+							Description: "Full name of the user object, which also names it when it is created.  Defaults to `sam_account_name`.",
+							Optional:    true,
+							Computed:    true,
+							PlanModifiers: []planmodifier.String{
+								stringplanmodifier.UseStateForUnknown(),
+							},
+						},
+						"given_name": schema.StringAttribute{
+							Description: "First Name of user.",
+							Optional:    true,
+						},
+						"surname": schema.StringAttribute{
+							Description: "Last name of user.",
+							Optional:    true,
+						},
+						"email_address": schema.StringAttribute{
+							Description: "The mail attribute value.",
+							Optional:    true,
+						},
+						"user_principal_name": schema.StringAttribute{
+							Description: "The user principal name of the user.",
+							Optional:    true,
+						},
+						"description": schema.StringAttribute{
+							Description: "Description property of the user.",
+							Optional:    true,
+						},
+						"distinguished_name": schema.StringAttribute{
+							Description: "The distinguished name of the user.",
+							Computed:    true,
+						},
+						"object_guid": schema.StringAttribute{
+							Description: "The objectGUID of the user.",
+							Computed:    true,
+							PlanModifiers: []planmodifier.String{
+								stringplanmodifier.UseStateForUnknown(),
+							},
+						},
+						"sid": schema.StringAttribute{
+							Description: "The security identifier (objectSid) of the user.",
+							Computed:    true,
+							PlanModifiers: []planmodifier.String{
+								stringplanmodifier.UseStateForUnknown(),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *usersResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	client, ok := req.ProviderData.(*lazyClient)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected provider data", fmt.Sprintf("Expected *lazyClient, got %T.", req.ProviderData))
+		return
+	}
+	r.client = client
+}
+
+// ValidateConfig refuses what would only fail part way through an apply:
+// two users with the same sAMAccountName, or an OU that isn't a DN.
+func (r *usersResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config usersResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !config.Parallelism.IsNull() && !config.Parallelism.IsUnknown() && config.Parallelism.ValueInt64() < 1 {
+		resp.Diagnostics.AddAttributeError(path.Root("parallelism"), "Invalid parallelism", "parallelism must be at least 1.")
+	}
+
+	users, diags := config.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	keysByName := make(map[string]string)
+	for _, key := range sortedUserKeys(users) {
+		user := users[key]
+		if !user.OrganizationalUnit.IsNull() && !user.OrganizationalUnit.IsUnknown() {
+			if _, err := NewLdapDN(user.OrganizationalUnit.ValueString()); err != nil {
+				resp.Diagnostics.AddAttributeError(path.Root("users").AtMapKey(key).AtName("organizational_unit"), "Invalid distinguished name", err.Error())
+			}
+		}
+		if user.SAMAccountName.IsNull() || user.SAMAccountName.IsUnknown() {
+			continue
+		}
+		name := strings.ToLower(user.SAMAccountName.ValueString())
+		if other, ok := keysByName[name]; ok {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("users").AtMapKey(key).AtName("sam_account_name"),
+				"Duplicate sam_account_name",
+				fmt.Sprintf("Users %q and %q both have the sam_account_name %q.", other, key, user.SAMAccountName.ValueString()),
+			)
+			continue
+		}
+		keysByName[name] = key
+	}
+}
+
+// ModifyPlan fills in the display names of new users and the DNs the users
+// will have, so that moves show in the plan.
+func (r *usersResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var plan, state, config usersResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if !req.State.Raw.IsNull() {
+		resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	}
+	if resp.Diagnostics.HasError() || plan.Users.IsUnknown() || config.Users.IsUnknown() {
+		return
+	}
+	for _, user := range plan.Users.Elements() {
+		if user.IsUnknown() {
+			return
+		}
+	}
+
+	planUsers, diags := plan.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	stateUsers, diags := state.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	configUsers, diags := config.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	for key, user := range planUsers {
+		if r.client != nil && r.client.config.DirectoryType == directoryTypeADLDS && !user.UserPrincipalName.IsNull() {
+			resp.Diagnostics.AddAttributeError(path.Root("users").AtMapKey(key).AtName("user_principal_name"), "Unsupported user_principal_name", "AD LDS keeps sam_account_name in userPrincipalName, so user_principal_name can't be set.")
+			continue
+		}
+		prior, exists := stateUsers[key]
+		if !exists && configUsers[key].DisplayName.IsNull() {
+			user.DisplayName = user.SAMAccountName
+		}
+		user.DistinguishedName = plannedUserDN(user, prior, exists)
+		planUsers[key] = user
+	}
+
+	resp.Diagnostics.Append(plan.setUsers(ctx, planUsers)...)
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+// plannedUserDN returns the DN the user will have after the apply: its
+// current RDN in the planned OU, or for a new user the DN it is created with.
+func plannedUserDN(user usersResourceUserModel, prior usersResourceUserModel, exists bool) types.String {
+	if user.OrganizationalUnit.IsUnknown() {
+		return types.StringUnknown()
+	}
+	ou := user.OrganizationalUnit.ValueString()
+
+	if !exists {
+		if user.SAMAccountName.IsUnknown() || user.DisplayName.IsUnknown() {
+			return types.StringUnknown()
+		}
+		return types.StringValue(user.newDN())
+	}
+
+	if prior.DistinguishedName.IsUnknown() || prior.DistinguishedName.IsNull() {
+		return types.StringUnknown()
+	}
+	dn, err := movedDN(prior.DistinguishedName.ValueString(), ou)
+	if err != nil {
+		return types.StringUnknown()
+	}
+	return types.StringValue(dn)
+}
+
+// newDN returns the DN the user is created with.
+func (u usersResourceUserModel) newDN() string {
+	return accountDN(u.SAMAccountName.ValueString(), u.OrganizationalUnit.ValueString(), u.attributes())
+}
+
+// movedDN returns the DN an object at the DN has once moved to the OU, which
+// is the DN itself if it is already there.
+func movedDN(distinguishedName string, ou string) (string, error) {
+	dn, err := NewLdapDN(distinguishedName)
+	if err != nil {
+		return "", err
+	}
+	if dnsEqual(dn.ParentDN(), ou) {
+		return distinguishedName, nil
+	}
+	ouDN, err := NewLdapDN(ou)
+	if err != nil {
+		return "", err
+	}
+	return JoinRDNs(append(dn.RDNs[:1], ouDN.RDNs...)), nil
+}
+
+func (r *usersResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan usersResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	users, diags := plan.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client, err := plan.domainClient(ctx, r.client)
+	if err != nil {
+		resp.Diagnostics.AddError("Error connecting to the directory", err.Error())
+		return
+	}
+
+	keys := sortedUserKeys(users)
+	for _, key := range keys {
+		user := users[key]
+		if user.DisplayName.IsUnknown() {
+			user.DisplayName = user.SAMAccountName
+		}
+		user.DistinguishedName = types.StringValue(user.newDN())
+		users[key] = user
+	}
+
+	errs := runBatch(ctx, keys, plan.parallelism(), func(key string) error {
+		return addBulkUser(ctx, client, users[key])
+	})
+	for _, key := range keys {
+		if err, ok := errs[key]; ok {
+			resp.Diagnostics.AddError(fmt.Sprintf("Error creating user %s", key), err.Error())
+		}
+	}
+	if !resp.Diagnostics.HasError() {
+		resp.Diagnostics.Append(readNewBulkUsers(ctx, client, users, keys)...)
+	}
+	if resp.Diagnostics.HasError() {
+		// Leave the directory as it was, since a failed create leaves no state
+		var created []string
+		for _, key := range keys {
+			if _, ok := errs[key]; !ok {
+				created = append(created, key)
+			}
+		}
+		_, diags := deleteBulkUsers(ctx, client, users, created, plan.parallelism(), "Error rolling back user %s")
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	plan.ID = types.StringValue(id.UniqueId())
+	resp.Diagnostics.Append(plan.setUsers(ctx, users)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *usersResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state usersResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	users, diags := state.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client, err := state.domainClient(ctx, r.client)
+	if err != nil {
+		resp.Diagnostics.AddError("Error connecting to the directory", err.Error())
+		return
+	}
+
+	guids := make([]string, 0, len(users))
+	for _, user := range users {
+		if user.ObjectGUID.ValueString() != "" {
+			guids = append(guids, user.ObjectGUID.ValueString())
+		}
+	}
+	accounts, err := client.GetUsersByGUID(ctx, guids, usersResourceAttributeNames)
+	if err != nil {
+		resp.Diagnostics.AddError("Error reading users", err.Error())
+		return
+	}
+
+	for key, user := range users {
+		account, ok := accounts[strings.ToLower(user.ObjectGUID.ValueString())]
+		if !ok {
+			// Created again on the next apply
+			delete(users, key)
+			continue
+		}
+		if err := readBulkUser(ctx, &user, account); err != nil {
+			resp.Diagnostics.AddError(fmt.Sprintf("Error reading user %s", key), err.Error())
+			return
+		}
+		if adminCount, _ := account.GetAttributeValue(ctx, "adminCount"); adminCount == "1" {
+			warning := adminSDHolderWarning("User", user.SAMAccountName.ValueString())
+			resp.Diagnostics.AddWarning(warning.Summary, warning.Detail)
+		}
+		users[key] = user
+	}
+
+	resp.Diagnostics.Append(state.setUsers(ctx, users)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// Update deletes the users removed from the map first, so their
+// sAMAccountNames are free for users added under other keys, then adds and
+// changes the rest.  The state records every operation that succeeded, so
+// the next apply only retries those that failed.
+func (r *usersResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state usersResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	planUsers, diags := plan.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	stateUsers, diags := state.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client, err := state.domainClient(ctx, r.client)
+	if err != nil {
+		resp.Diagnostics.AddError("Error connecting to the directory", err.Error())
+		return
+	}
+
+	var removed, added, changed, toggled []string
+	for _, key := range sortedUserKeys(stateUsers) {
+		if _, ok := planUsers[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	for _, key := range sortedUserKeys(planUsers) {
+		user := planUsers[key]
+		prior, exists := stateUsers[key]
+		switch {
+		case !exists:
+			if user.DisplayName.IsUnknown() {
+				user.DisplayName = user.SAMAccountName
+			}
+			user.DistinguishedName = types.StringValue(user.newDN())
+			planUsers[key] = user
+			added = append(added, key)
+		case user.changed(prior):
+			changed = append(changed, key)
+			if !user.Enabled.Equal(prior.Enabled) {
+				toggled = append(toggled, key)
+			}
+		}
+	}
+
+	// Each user's state is only replaced once its operation succeeds
+	users := make(map[string]usersResourceUserModel, len(stateUsers))
+	for key, user := range stateUsers {
+		users[key] = user
+	}
+	deleted, diags := deleteBulkUsers(ctx, client, stateUsers, removed, plan.parallelism(), "Error deleting user %s")
+	resp.Diagnostics.Append(diags...)
+	for _, key := range deleted {
+		delete(users, key)
+	}
+
+	// Read the userAccountControl of users being enabled or disabled, so that
+	// only ACCOUNTDISABLE changes
+	var guids []string
+	for _, key := range toggled {
+		guids = append(guids, stateUsers[key].ObjectGUID.ValueString())
+	}
+	current, err := client.GetUsersByGUID(ctx, guids, accountControlAttributes)
+	if err != nil {
+		resp.Diagnostics.AddError("Error reading users", err.Error())
+		changed = nil
+	}
+
+	addErrs := runBatch(ctx, added, plan.parallelism(), func(key string) error {
+		return addBulkUser(ctx, client, planUsers[key])
+	})
+	changeErrs := runBatch(ctx, changed, plan.parallelism(), func(key string) error {
+		prior := stateUsers[key]
+		return modifyBulkUser(ctx, client, prior, planUsers[key], current[strings.ToLower(prior.ObjectGUID.ValueString())])
+	})
+
+	var created []string
+	for _, key := range added {
+		if err, ok := addErrs[key]; ok {
+			resp.Diagnostics.AddError(fmt.Sprintf("Error creating user %s", key), err.Error())
+			continue
+		}
+		created = append(created, key)
+		users[key] = planUsers[key]
+	}
+	for _, key := range changed {
+		if err, ok := changeErrs[key]; ok {
+			resp.Diagnostics.AddError(fmt.Sprintf("Error updating user %s", key), err.Error())
+			continue
+		}
+		users[key] = planUsers[key]
+	}
+	readDiags := readNewBulkUsers(ctx, client, users, created)
+	if readDiags.HasError() {
+		// Without an objectGUID they can't be read, so leave them to be
+		// created again, which reports that they exist
+		for _, key := range created {
+			if users[key].ObjectGUID.IsUnknown() {
+				delete(users, key)
+			}
+		}
+	}
+	resp.Diagnostics.Append(readDiags...)
+
+	state.Parallelism = plan.Parallelism
+	resp.Diagnostics.Append(state.setUsers(ctx, users)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *usersResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state usersResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	users, diags := state.users(ctx)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	client, err := state.domainClient(ctx, r.client)
+	if err != nil {
+		resp.Diagnostics.AddError("Error connecting to the directory", err.Error())
+		return
+	}
+
+	deleted, diags := deleteBulkUsers(ctx, client, users, sortedUserKeys(users), state.parallelism(), "Error deleting user %s")
+	resp.Diagnostics.Append(diags...)
+	if !resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Keep the users that are left, so destroying again retries them
+	for _, key := range deleted {
+		delete(users, key)
+	}
+	resp.Diagnostics.Append(state.setUsers(ctx, users)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func addBulkUser(ctx context.Context, client *LdapClient, user usersResourceUserModel) error {
+	_, err := client.AddUserAccount(ctx, user.SAMAccountName.ValueString(), user.Password.ValueString(), user.OrganizationalUnit.ValueString(), user.Enabled.ValueBool(), user.attributes())
+	return err
+}
+
+// modifyBulkUser changes the user's attributes with a single modify, then
+// moves it if its OU changed.  current holds the user's userAccountControl
+// when it is being enabled or disabled.
+func modifyBulkUser(ctx context.Context, client *LdapClient, prior usersResourceUserModel, user usersResourceUserModel, current *LdapAccount) error {
+	request := ldap.NewModifyRequest(prior.DistinguishedName.ValueString(), nil)
+	if !user.SAMAccountName.Equal(prior.SAMAccountName) {
+		request.Replace(client.accountNameAttribute(), []string{user.SAMAccountName.ValueString()})
+	}
+
+	priorAttributes := prior.stringAttributes()
+	attributes := user.stringAttributes()
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if attributes[name].Equal(*priorAttributes[name]) {
+			continue
+		}
+		if value := attributes[name].ValueString(); value != "" {
+			request.Replace(name, []string{value})
+		} else {
+			request.Replace(name, []string{})
+		}
+	}
+
+	// The password is set before the account is enabled
+	if !user.Password.Equal(prior.Password) && user.Password.ValueString() != "" {
+		passwordEncoded, err := encodePassword(user.Password.ValueString())
+		if err != nil {
+			return err
+		}
+		request.Replace("unicodePwd", []string{passwordEncoded})
+	}
+	if !user.Enabled.Equal(prior.Enabled) {
+		if current == nil {
+			return &NotFoundError{ObjectClass: objectClassUser, Name: prior.ObjectGUID.ValueString()}
+		}
+		userAccountControl, err := client.entryAccountControl(current.Entry)
+		if err != nil {
+			return err
+		}
+		if user.Enabled.ValueBool() {
+			userAccountControl &^= uac.Accountdisable
+		} else {
+			userAccountControl |= uac.Accountdisable
+		}
+		accountControl, err := client.accountControlValues(userAccountControl)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(accountControl) {
+			request.Replace(name, accountControl[name])
+		}
+	}
+
+	if len(request.Changes) > 0 {
+		if err := modifyContext(ctx, client.Conn, request); err != nil {
+			return err
+		}
+	}
+
+	if !dnsEqual(user.DistinguishedName.ValueString(), prior.DistinguishedName.ValueString()) {
+		entry := &LdapEntry{LdapClient: client, Entry: ldap.NewEntry(prior.DistinguishedName.ValueString(), nil)}
+		return entry.ChangeDN(ctx, user.DistinguishedName.ValueString())
+	}
+
+	return nil
+}
+
+// readNewBulkUsers reads the identities of the users just created with a
+// single search.
+func readNewBulkUsers(ctx context.Context, client *LdapClient, users map[string]usersResourceUserModel, keys []string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	sAMAccountNames := make([]string, 0, len(keys))
+	for _, key := range keys {
+		sAMAccountNames = append(sAMAccountNames, users[key].SAMAccountName.ValueString())
+	}
+	accounts, err := client.GetUsersBySAMAccountName(ctx, sAMAccountNames, []string{"objectGUID", "objectSid"})
+	if err != nil {
+		diags.AddError("Error reading users", err.Error())
+		return diags
+	}
+
+	for _, key := range keys {
+		user := users[key]
+		account, ok := accounts[strings.ToLower(user.SAMAccountName.ValueString())]
+		if !ok {
+			diags.AddError(fmt.Sprintf("Error reading user %s", key), fmt.Sprintf("No user with sAMAccountName %q was found after it was created.", user.SAMAccountName.ValueString()))
+			continue
+		}
+		objectGUID, err := account.GetObjectGUID(ctx)
+		if err != nil {
+			diags.AddError(fmt.Sprintf("Error reading user %s", key), err.Error())
+			continue
+		}
+		sid, err := account.GetObjectSID(ctx)
+		if err != nil {
+			diags.AddError(fmt.Sprintf("Error reading user %s", key), err.Error())
+			continue
+		}
+		user.ObjectGUID = types.StringValue(objectGUID)
+		user.SID = types.StringValue(sid)
+		users[key] = user
+	}
+
+	return diags
+}
+
+// readBulkUser updates the user from the directory, keeping the password
+// and the spelling of an OU the directory considers equal.
+func readBulkUser(ctx context.Context, user *usersResourceUserModel, account *LdapAccount) error {
+	ou, err := account.ParentDN()
+	if err != nil {
+		return err
+	}
+	enabled, err := account.IsEnabled(ctx)
+	if err != nil {
+		return err
+	}
+	sid, err := account.GetObjectSID(ctx)
+	if err != nil {
+		return err
+	}
+	sAMAccountName, _ := account.GetAttributeValue(ctx, account.accountNameAttribute())
+
+	user.SAMAccountName = types.StringValue(sAMAccountName)
+	if !dnsEqual(user.OrganizationalUnit.ValueString(), ou) {
+		user.OrganizationalUnit = types.StringValue(ou)
+	}
+	user.Enabled = types.BoolValue(enabled)
+	for name, value := range user.stringAttributes() {
+		attributeValue, _ := account.GetAttributeValue(ctx, name)
+		*value = stringValueOrNull(attributeValue)
+	}
+	if account.IsADLDS() {
+		// The userPrincipalName is the sam_account_name
+		user.UserPrincipalName = types.StringNull()
+	}
+	user.DistinguishedName = types.StringValue(account.DN)
+	user.SID = types.StringValue(sid)
+
+	return nil
+}
+
+// deleteBulkUsers deletes the users with the keys in parallel batches,
+// treating users already gone as deleted, and returns the keys deleted.
+func deleteBulkUsers(ctx context.Context, client *LdapClient, users map[string]usersResourceUserModel, keys []string, parallelism int, summary string) ([]string, diag.Diagnostics) {
+	var deleted []string
+	var diags diag.Diagnostics
+
+	errs := runBatch(ctx, keys, parallelism, func(key string) error {
+		request := ldap.NewDelRequest(users[key].DistinguishedName.ValueString(), nil)
+		err := delContext(ctx, client.Conn, request)
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	for _, key := range keys {
+		if err, ok := errs[key]; ok {
+			diags.AddError(fmt.Sprintf(summary, key), err.Error())
+			continue
+		}
+		deleted = append(deleted, key)
+	}
+
+	return deleted, diags
+}
@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	uac "github.com/audibleblink/msldapuac"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// fakeUsersAttribute returns the string attribute of the user with the key in
+// an adldap_users state, or "" if it is null or the user is missing.
+func fakeUsersAttribute(t *testing.T, state tftypes.Value, key string, name string) string {
+	t.Helper()
+
+	path := tftypes.NewAttributePath().WithAttributeName("users").WithElementKeyString(key).WithAttributeName(name)
+	value, _, err := tftypes.WalkAttributePath(state, path)
+	if err != nil {
+		return ""
+	}
+	var s string
+	if err := value.(tftypes.Value).As(&s); err != nil {
+		var b bool
+		if err := value.(tftypes.Value).As(&b); err == nil {
+			return strconv.FormatBool(b)
+		}
+	}
+	return s
+}
+
+func TestAdldapResourceUsers_fake(t *testing.T) {
+	client, directory := newFakeClient(t)
+	staffDN := "OU=Staff," + fakeDomainDN
+	formerDN := "OU=Former," + fakeDomainDN
+	directory.put(staffDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+	directory.put(formerDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+
+	users := map[string]interface{}{
+		"e100": map[string]interface{}{"sam_account_name": "jdoe", "organizational_unit": staffDN, "password": "Initial#Pass1", "given_name": "Jane"},
+		"e101": map[string]interface{}{"sam_account_name": "asmith", "organizational_unit": staffDN, "display_name": "Alex Smith", "enabled": false},
+		"e102": map[string]interface{}{"sam_account_name": "bjones", "organizational_unit": staffDN, "enabled": false},
+	}
+	config := map[string]interface{}{"parallelism": 2, "users": users}
+
+	// The users are added and then read back with one search
+	searches := directory.Searches()
+	state := fakeFrameworkApply(t, client, "adldap_users", tftypes.Value{}, config)
+	if got := directory.Searches() - searches; got != 1 {
+		t.Errorf("Error creating users with a single read: got %d searches", got)
+	}
+	jdoeDN := "CN=jdoe," + staffDN
+	entry := directory.Entry(jdoeDN)
+	if entry == nil || fakeAttribute(entry, "givenName")[0] != "Jane" || directory.Password(jdoeDN) != "Initial#Pass1" {
+		t.Fatalf("Error creating jdoe: got %v", entry)
+	}
+	if fakeAttribute(entry, "userAccountControl")[0] != strconv.Itoa(uac.NormalAccount) {
+		t.Errorf("Error enabling jdoe: got userAccountControl %v", fakeAttribute(entry, "userAccountControl"))
+	}
+	if directory.Entry("CN=Alex Smith,"+staffDN) == nil {
+		t.Error("Error naming asmith after its display_name")
+	}
+	if fakeUsersAttribute(t, state, "e100", "display_name") != "jdoe" || fakeUsersAttribute(t, state, "e100", "distinguished_name") != jdoeDN {
+		t.Errorf("Error defaulting display_name: got %v", state)
+	}
+	if guid := fakeUsersAttribute(t, state, "e100", "object_guid"); guid != formatGUID([]byte(entry["objectGUID"][0])) {
+		t.Errorf("Error recording object_guid: got %q", guid)
+	}
+
+	// Refreshing takes one search and changes nothing
+	searches = directory.Searches()
+	refreshed := fakeFrameworkRefresh(t, client, "adldap_users", state)
+	if got := directory.Searches() - searches; got != 1 {
+		t.Errorf("Error reading users with a single search: got %d searches", got)
+	}
+	if !refreshed.Equal(state) {
+		t.Errorf("Error refreshing users: got %v, want %v", refreshed, state)
+	}
+
+	// Change one user, enable another, move a third, and add a fourth
+	users["e100"].(map[string]interface{})["given_name"] = nil
+	users["e100"].(map[string]interface{})["description"] = "Engineering"
+	users["e101"].(map[string]interface{})["enabled"] = true
+	users["e101"].(map[string]interface{})["password"] = "Second#Pass2"
+	users["e102"].(map[string]interface{})["organizational_unit"] = formerDN
+	users["e103"] = map[string]interface{}{"sam_account_name": "kwong", "organizational_unit": staffDN, "enabled": false}
+	state = fakeFrameworkApply(t, client, "adldap_users", state, config)
+	entry = directory.Entry(jdoeDN)
+	if fakeAttribute(entry, "givenName") != nil || fakeAttribute(entry, "description")[0] != "Engineering" {
+		t.Errorf("Error updating jdoe: got %v", entry)
+	}
+	entry = directory.Entry("CN=Alex Smith," + staffDN)
+	if fakeAttribute(entry, "userAccountControl")[0] != strconv.Itoa(uac.NormalAccount) || directory.Password("CN=Alex Smith,"+staffDN) != "Second#Pass2" {
+		t.Errorf("Error enabling asmith: got %v", entry)
+	}
+	if directory.Entry("CN=bjones,"+formerDN) == nil || fakeUsersAttribute(t, state, "e102", "distinguished_name") != "CN=bjones,"+formerDN {
+		t.Errorf("Error moving bjones: got %v", state)
+	}
+	if fakeUsersAttribute(t, state, "e103", "object_guid") == "" {
+		t.Errorf("Error adding kwong: got %v", state)
+	}
+
+	// Users deleted outside Terraform drop out of the state
+	if err := directory.Del(ldap.NewDelRequest("CN=kwong,"+staffDN, nil)); err != nil {
+		t.Fatal(err)
+	}
+	state = fakeFrameworkRefresh(t, client, "adldap_users", state)
+	if fakeUsersAttribute(t, state, "e103", "sam_account_name") != "" {
+		t.Errorf("Error dropping a deleted user: got %v", state)
+	}
+
+	// Removing a user deletes it, and its sAMAccountName can be reused under
+	// another key in the same apply
+	delete(users, "e101")
+	users["e104"] = map[string]interface{}{"sam_account_name": "asmith", "organizational_unit": formerDN, "enabled": false}
+	state = fakeFrameworkApply(t, client, "adldap_users", state, config)
+	if directory.Entry("CN=Alex Smith,"+staffDN) != nil || directory.Entry("CN=asmith,"+formerDN) == nil {
+		t.Errorf("Error replacing asmith: got %v", state)
+	}
+
+	fakeFrameworkApply(t, client, "adldap_users", state, nil)
+	for _, dn := range []string{jdoeDN, "CN=bjones," + formerDN, "CN=asmith," + formerDN} {
+		if directory.Entry(dn) != nil {
+			t.Errorf("Error deleting users: %s left behind", dn)
+		}
+	}
+}
+
+func TestAdldapResourceUsers_createRollback(t *testing.T) {
+	client, directory := newFakeClient(t)
+	directory.put("CN=Taken,CN=Users,"+fakeDomainDN, map[string][]string{"objectClass": {"user"}, "sAMAccountName": {"taken"}})
+
+	usersDN := "CN=Users," + fakeDomainDN
+	config := map[string]interface{}{"users": map[string]interface{}{
+		"a": map[string]interface{}{"sam_account_name": "fresh", "organizational_unit": usersDN, "enabled": false},
+		"b": map[string]interface{}{"sam_account_name": "taken", "organizational_unit": usersDN, "display_name": "Other", "enabled": false},
+	}}
+	_, diags := fakeFrameworkTryApply(t, client, "adldap_users", tftypes.Value{}, config)
+	if !fakeFrameworkHasError(diags) || !strings.Contains(diags[0].Summary, "user b") {
+		t.Fatalf("Error reporting a user that can't be created: got %v", diags)
+	}
+	if directory.Entry("CN=fresh,"+usersDN) != nil {
+		t.Error("Error rolling back: fresh left behind")
+	}
+
+	// Duplicates are refused before anything is changed
+	config["users"].(map[string]interface{})["b"].(map[string]interface{})["sam_account_name"] = "FRESH"
+	_, diags = fakeFrameworkTryApply(t, client, "adldap_users", tftypes.Value{}, config)
+	if !fakeFrameworkHasError(diags) || diags[0].Summary != "Duplicate sam_account_name" {
+		t.Errorf("Error refusing duplicate sam_account_name: got %v", diags)
+	}
+}
+
+func TestAdldapResourceUsers_adlds(t *testing.T) {
+	client, directory := newFakeADLDSClient(t)
+	usersDN := "CN=Users," + fakeDomainDN
+
+	user := map[string]interface{}{"sam_account_name": "ldsuser", "organizational_unit": usersDN, "enabled": false}
+	config := map[string]interface{}{"users": map[string]interface{}{"a": user}}
+	state := fakeFrameworkApply(t, client, "adldap_users", tftypes.Value{}, config)
+	entry := directory.Entry("CN=ldsuser," + usersDN)
+	if entry == nil || fakeAttribute(entry, "userPrincipalName")[0] != "ldsuser" || fakeAttribute(entry, "msDS-UserAccountDisabled")[0] != "TRUE" {
+		t.Fatalf("Error creating user: got %v", entry)
+	}
+	if fakeUsersAttribute(t, state, "a", "sam_account_name") != "ldsuser" || fakeUsersAttribute(t, state, "a", "user_principal_name") != "" {
+		t.Errorf("Error reading user: got %v", state)
+	}
+
+	user["enabled"] = true
+	state = fakeFrameworkApply(t, client, "adldap_users", state, config)
+	if fakeAttribute(directory.Entry("CN=ldsuser,"+usersDN), "msDS-UserAccountDisabled")[0] != "FALSE" || fakeUsersAttribute(t, state, "a", "enabled") != "true" {
+		t.Errorf("Error enabling user: got %v", state)
+	}
+
+	user["user_principal_name"] = "ldsuser@example.com"
+	_, diags := fakeFrameworkTryApply(t, client, "adldap_users", state, config)
+	if !fakeFrameworkHasError(diags) || diags[0].Summary != "Unsupported user_principal_name" {
+		t.Errorf("Error refusing user_principal_name in AD LDS: got %v", diags)
+	}
+}
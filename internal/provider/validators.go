@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// sAMAccountName may not contain " / \ [ ] : ; | = , + * ? < > @ or end with a period.
+var sAMAccountNameRegexp = regexp.MustCompile(`^[^"/\\\[\]:;|=,+*?<>@]*[^"/\\\[\]:;|=,+*?<>@.]$`)
+
+var userPrincipalNameRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+
+var dnsNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*\.?$`)
+
+var emailAddressRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// validateSAMAccountName enforces the 20 character limit and character set for user logon names.
+var validateSAMAccountName schema.SchemaValidateDiagFunc = validation.ToDiagFunc(validation.All(
+	stringRuneLenBetween(1, 20),
+	validation.StringMatch(sAMAccountNameRegexp, "must not contain \" / \\ [ ] : ; | = , + * ? < > @ or end with a period"),
+))
+
+// validateUserSAMAccountName accepts a user logon name, or the user principal
+// name AD LDS keeps in its place.  The validator can't see the directory type,
+// so resourceUserCustomizeDiff refuses user principal names outside AD LDS.
+func validateUserSAMAccountName(i interface{}, path cty.Path) diag.Diagnostics {
+	if value, ok := i.(string); ok && userPrincipalNameRegexp.MatchString(value) {
+		return nil
+	}
+	return validateSAMAccountName(i, path)
+}
+
+var validateUserPrincipalName schema.SchemaValidateDiagFunc = validation.ToDiagFunc(
+	validation.StringMatch(userPrincipalNameRegexp, "must be in user@suffix format"),
+)
+
+var validateEmailAddress schema.SchemaValidateDiagFunc = validation.ToDiagFunc(
+	validation.StringMatch(emailAddressRegexp, "must be a valid email address"),
+)
+
+var validateInitials schema.SchemaValidateDiagFunc = validation.ToDiagFunc(
+	stringRuneLenBetween(0, 6),
+)
+
+var validateOID schema.SchemaValidateDiagFunc = validation.ToDiagFunc(
+	validation.StringMatch(regexp.MustCompile(`^[0-2](\.(0|[1-9][0-9]*))+$`), "must be a dotted-decimal OID, such as 1.2.840.113556.1.4.1413"),
+)
+
+var validateDNSName schema.SchemaValidateDiagFunc = validation.ToDiagFunc(
+	validation.StringMatch(dnsNameRegexp, "must be a DNS name, such as emea.example.com"),
+)
+
+var validateBase64 schema.SchemaValidateDiagFunc = validation.ToDiagFunc(
+	validation.StringIsBase64,
+)
+
+var validateExtensionAttributeKeys schema.SchemaValidateDiagFunc = validation.MapKeyMatch(
+	regexp.MustCompile(`^([1-9]|1[0-5])$`), "keys must be extension attribute numbers from 1 to 15",
+)
+
+// stringRuneLenBetween is validation.StringLenBetween counting characters
+// rather than bytes, as AD's length limits do.
+func stringRuneLenBetween(min, max int) schema.SchemaValidateFunc {
+	return func(i interface{}, k string) ([]string, []error) {
+		value, ok := i.(string)
+		if !ok {
+			return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+		}
+		if length := utf8.RuneCountInString(value); length < min || length > max {
+			return nil, []error{fmt.Errorf("expected length of %s to be in the range (%d - %d), got %s", k, min, max, value)}
+		}
+		return nil, nil
+	}
+}
+
+// validateDN checks that a value parses as a distinguished name.
+func validateDN(i interface{}, path cty.Path) diag.Diagnostics {
+	value, ok := i.(string)
+	if !ok {
+		return diag.Errorf("expected type to be string")
+	}
+	if _, err := ldap.ParseDN(value); err != nil || value == "" {
+		return diag.Diagnostics{
+			{
+				Severity:      diag.Error,
+				Summary:       "Invalid distinguished name",
+				Detail:        fmt.Sprintf("\"%s\" is not a valid distinguished name", value),
+				AttributePath: path,
+			},
+		}
+	}
+	return nil
+}
+
+// validateGUID accepts a GUID with or without braces.
+var validateGUID schema.SchemaValidateDiagFunc = validation.ToDiagFunc(
+	validation.StringMatch(regexp.MustCompile(`^\{?[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}?$`), "must be a GUID"),
+)
+
+// validateOUDN checks that a value parses as a distinguished name beginning
+// with OU=.
+func validateOUDN(i interface{}, path cty.Path) diag.Diagnostics {
+	if diags := validateDN(i, path); diags.HasError() {
+		return diags
+	}
+	dn, _ := ldap.ParseDN(i.(string))
+	if !strings.EqualFold(dn.RDNs[0].Attributes[0].Type, "OU") {
+		return diag.Diagnostics{
+			{
+				Severity:      diag.Error,
+				Summary:       "Invalid organizational unit distinguished name",
+				Detail:        fmt.Sprintf("\"%s\" does not begin with OU=", i.(string)),
+				AttributePath: path,
+			},
+		}
+	}
+	return nil
+}
+
+var validateAttributeNameKeys schema.SchemaValidateDiagFunc = validation.MapKeyMatch(
+	regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`), "keys must be LDAP attribute names",
+)
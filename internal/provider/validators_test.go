@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestAdldapValidators(t *testing.T) {
+	cases := []struct {
+		validator schema.SchemaValidateDiagFunc
+		value     string
+		valid     bool
+	}{
+		{validator: validateUserSAMAccountName, value: "jdoe1", valid: true},
+		{validator: validateUserSAMAccountName, value: "svc-app.prod_01", valid: true},
+		{validator: validateUserSAMAccountName, value: "", valid: false},
+		{validator: validateUserSAMAccountName, value: "abcdefghijklmnopqrstu", valid: false},
+		{validator: validateUserSAMAccountName, value: "jérôme.ñúñez-müller", valid: true},
+		{validator: validateUserSAMAccountName, value: "jérôme.ñúñez-müllerxy", valid: false},
+		{validator: validateUserSAMAccountName, value: "j*doe", valid: false},
+		{validator: validateUserSAMAccountName, value: "jdoe@example", valid: true},
+		{validator: validateUserSAMAccountName, value: "john.doe.contractor@ad.example.com", valid: true},
+		{validator: validateUserSAMAccountName, value: "jdoe@ad@example.com", valid: false},
+		{validator: validateSAMAccountName, value: "jdoe@example", valid: false},
+		{validator: validateUserSAMAccountName, value: "jdoe.", valid: false},
+		{validator: validateUserPrincipalName, value: "jdoe@ad.example.com", valid: true},
+		{validator: validateUserPrincipalName, value: "jdoe", valid: false},
+		{validator: validateUserPrincipalName, value: "jdoe@ad@example.com", valid: false},
+		{validator: validateEmailAddress, value: "john.doe@example.com", valid: true},
+		{validator: validateEmailAddress, value: "john.doe@example", valid: false},
+		{validator: validateEmailAddress, value: "john doe@example.com", valid: false},
+		{validator: validateInitials, value: "JRRT", valid: true},
+		{validator: validateInitials, value: "ABCDEFG", valid: false},
+		{validator: validateInitials, value: "ÉÁÍÓÚÜ", valid: true},
+		{validator: validateDN, value: "CN=Jane Doe,OU=Users,DC=example,DC=com", valid: true},
+		{validator: validateDN, value: "Jane Doe", valid: false},
+		{validator: validateDN, value: "", valid: false},
+		{validator: validateOUDN, value: "ou=Servers,DC=example,DC=com", valid: true},
+		{validator: validateOUDN, value: "CN=Computers,DC=example,DC=com", valid: false},
+		{validator: validateOUDN, value: "Servers", valid: false},
+		{validator: validateOID, value: "1.2.840.113556.1.4.1413", valid: true},
+		{validator: validateOID, value: "1.2.840.113556.1.4.01", valid: false},
+		{validator: validateOID, value: "LDAP_SERVER_PERMISSIVE_MODIFY_OID", valid: false},
+		{validator: validateBase64, value: "MAA=", valid: true},
+		{validator: validateBase64, value: "not base64!", valid: false},
+		{validator: validateGUID, value: "31B2F340-016D-11D2-945F-00C04FB984F9", valid: true},
+		{validator: validateGUID, value: "{31b2f340-016d-11d2-945f-00c04fb984f9}", valid: true},
+		{validator: validateGUID, value: "31B2F340016D11D2945F00C04FB984F9", valid: false},
+	}
+
+	for _, c := range cases {
+		diags := c.validator(c.value, cty.Path{})
+		if diags.HasError() == c.valid {
+			t.Fatalf("Error matching validity for \"%s\": got %t, expected %t", c.value, !diags.HasError(), c.valid)
+		}
+	}
+}
+
+func TestAdldapValidateExtensionAttributeKeys(t *testing.T) {
+	cases := []struct {
+		value map[string]interface{}
+		valid bool
+	}{
+		{value: map[string]interface{}{"1": "a", "15": "b"}, valid: true},
+		{value: map[string]interface{}{"0": "a"}, valid: false},
+		{value: map[string]interface{}{"16": "a"}, valid: false},
+		{value: map[string]interface{}{"extensionAttribute1": "a"}, valid: false},
+	}
+
+	for _, c := range cases {
+		diags := validateExtensionAttributeKeys(c.value, cty.Path{})
+		if diags.HasError() == c.valid {
+			t.Fatalf("Error matching validity for %v: got %t, expected %t", c.value, !diags.HasError(), c.valid)
+		}
+	}
+}
+
+func TestAdldapValidateAttributeNameKeys(t *testing.T) {
+	cases := []struct {
+		value map[string]interface{}
+		valid bool
+	}{
+		{value: map[string]interface{}{"extensionAttribute1": "a", "msDS-cloudExtensionAttribute1": "b"}, valid: true},
+		{value: map[string]interface{}{"1": "a"}, valid: false},
+		{value: map[string]interface{}{"extension attribute": "a"}, valid: false},
+	}
+
+	for _, c := range cases {
+		diags := validateAttributeNameKeys(c.value, cty.Path{})
+		if diags.HasError() == c.valid {
+			t.Fatalf("Error matching validity for %v: got %t, expected %t", c.value, !diags.HasError(), c.valid)
+		}
+	}
+}
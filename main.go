@@ -7,7 +7,7 @@ import (
 
 	"github.com/greennosedmule/terraform-provider-adldap/internal/provider"
 
-	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6/tf6server"
 )
 
 // Run "go generate" to format example terraform files and generate the docs for the registry/website
@@ -26,17 +26,18 @@ func main() {
 	flag.BoolVar(&debugMode, "debug", false, "set to true to run the provider with support for debuggers like delve")
 	flag.Parse()
 
-	opts := &plugin.ServeOpts{
-		ProviderFunc: provider.New,
+	providerServer, err := provider.NewProviderServer(context.Background())
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 
+	var serveOpts []tf6server.ServeOpt
 	if debugMode {
-		err := plugin.Debug(context.Background(), "github.com/greennosedmule/terraform-provider-adldap", opts)
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-		return
+		serveOpts = append(serveOpts, tf6server.WithManagedDebug())
 	}
 
-	plugin.Serve(opts)
+	err = tf6server.Serve("github.com/greennosedmule/terraform-provider-adldap", providerServer, serveOpts...)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 }